@@ -1,11 +1,26 @@
 package auth
 
+import (
+	"github.com/fikryfahrezy/adea/los-inmen/notify"
+	"github.com/fikryfahrezy/adea/los-inmen/oidc"
+	"github.com/fikryfahrezy/adea/los-inmen/throttle"
+)
+
 type AuthApp struct {
 	repository *Repository
+	policy     PasswordPolicy
+	notifier   notify.Notifier
+	throttle   *throttle.Throttle
+	// idp is nil when the OpenID Connect login is not configured
+	idp *oidc.Provider
 }
 
-func NewApp(repository *Repository) *AuthApp {
+func NewApp(repository *Repository, policy PasswordPolicy, notifier notify.Notifier, throttle *throttle.Throttle, idp *oidc.Provider) *AuthApp {
 	return &AuthApp{
 		repository: repository,
+		policy:     policy,
+		notifier:   notifier,
+		throttle:   throttle,
+		idp:        idp,
 	}
 }
@@ -0,0 +1,91 @@
+package auth
+
+import (
+	"bufio"
+	"errors"
+	"io"
+	"os"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+)
+
+var (
+	ErrPasswordTooShort = errors.New("password too short")
+	ErrPasswordTooLong  = errors.New("password too long")
+	ErrPasswordBreached = errors.New("password is too common or has been breached")
+)
+
+// bcryptMaxLength is the most bytes bcrypt read, the rest would be silently ignored
+const bcryptMaxLength = 72
+
+type PasswordPolicy struct {
+	MinLength int
+	MaxLength int
+	denylist  map[string]struct{}
+}
+
+func DefaultPasswordPolicy() PasswordPolicy {
+	return PasswordPolicy{
+		MinLength: 8,
+		MaxLength: bcryptMaxLength,
+		denylist:  make(map[string]struct{}),
+	}
+}
+
+// PasswordPolicyFromEnv read PASSWORD_MIN_LENGTH and the denylist file from
+// PASSWORD_DENYLIST_FILE, one password per line, the denylist is skipped when the env is empty
+func PasswordPolicyFromEnv() (PasswordPolicy, error) {
+	policy := DefaultPasswordPolicy()
+	if n, err := strconv.Atoi(os.Getenv("PASSWORD_MIN_LENGTH")); err == nil && n > 0 {
+		policy.MinLength = n
+	}
+
+	path := os.Getenv("PASSWORD_DENYLIST_FILE")
+	if path == "" {
+		return policy, nil
+	}
+
+	f, err := os.Open(path)
+	if err != nil {
+		return PasswordPolicy{}, err
+	}
+	defer f.Close()
+
+	if err := policy.LoadDenylist(f); err != nil {
+		return PasswordPolicy{}, err
+	}
+
+	return policy, nil
+}
+
+// LoadDenylist add every non empty line of the reader to the denylist,
+// the comparison is case insensitive
+func (p PasswordPolicy) LoadDenylist(r io.Reader) error {
+	scanner := bufio.NewScanner(r)
+	for scanner.Scan() {
+		pw := strings.TrimSpace(scanner.Text())
+		if pw == "" || strings.HasPrefix(pw, "#") {
+			continue
+		}
+		p.denylist[strings.ToLower(pw)] = struct{}{}
+	}
+
+	return scanner.Err()
+}
+
+func (p PasswordPolicy) Validate(password string) error {
+	if utf8.RuneCountInString(password) == 0 {
+		return ErrPasswordRequired
+	}
+	if utf8.RuneCountInString(password) < p.MinLength {
+		return ErrPasswordTooShort
+	}
+	if len(password) > p.MaxLength {
+		return ErrPasswordTooLong
+	}
+	if _, ok := p.denylist[strings.ToLower(password)]; ok {
+		return ErrPasswordBreached
+	}
+	return nil
+}
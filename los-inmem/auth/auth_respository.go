@@ -2,52 +2,801 @@ package auth
 
 import (
 	"context"
-	"encoding/hex"
 	"errors"
+	"sort"
+	"strings"
 	"time"
 
 	"github.com/fikryfahrezy/adea/los-inmen/data"
+	"github.com/fikryfahrezy/adea/los-inmen/id"
 	"github.com/fikryfahrezy/adea/los-inmen/model"
 )
 
 var (
 	ErrDuplicateContraint = errors.New("some constraint are duplicate")
 	ErrUserNotFound       = errors.New("user not found")
+	ErrUserDeactivated    = errors.New("user already deactivated")
+	ErrInvitationNotFound = errors.New("invitation not found")
+	ErrInvitationUsed     = errors.New("invitation already used")
+	ErrResetNotFound      = errors.New("password reset token not found")
+	ErrResetUsed          = errors.New("password reset token already used")
+	ErrTotpNotFound       = errors.New("totp not found")
+	ErrTotpEnabled        = errors.New("totp already enabled")
+	ErrTotpReplayed       = errors.New("totp code already used")
+	ErrRecoveryNotFound   = errors.New("recovery code not found")
+	ErrChallengeNotFound  = errors.New("login challenge not found")
+	ErrChallengeUsed      = errors.New("login challenge already used")
+	ErrApiKeyNotFound     = errors.New("api key not found")
+	ErrIdentityNotFound   = errors.New("user identity not found")
+	ErrOidcStateNotFound  = errors.New("oidc state not found")
+	ErrOidcStateUsed      = errors.New("oidc state already used")
 )
 
 type Repository struct {
-	db *data.JsonFile
+	db  *data.JsonFile
+	ids id.Generator
 }
 
-func NewRepository(db *data.JsonFile) *Repository {
+func NewRepository(db *data.JsonFile, ids id.Generator) *Repository {
 	return &Repository{
-		db: db,
+		db:  db,
+		ids: ids,
 	}
 }
 
 func (r *Repository) InsertUser(ctx context.Context, user model.User) (model.User, error) {
-	t := time.Now()
-	id := hex.EncodeToString([]byte(user.Username))
+	userId, err := r.ids.New()
+	if err != nil {
+		return model.User{}, err
+	}
 
-	user.Id = id
-	user.CreatedDate = t
+	user.Id = userId
+	user.CreatedDate = time.Now()
 
 	r.db.Lock()
 	defer r.db.Unlock()
-	r.db.DbUser[id] = user
+	if r.usernameExist(user.Username) {
+		return model.User{}, ErrDuplicateContraint
+	}
+	r.db.DbUser[user.Id] = user
+	r.db.IdxUsername[user.Username] = user.Id
 
 	return user, nil
 }
 
+// usernameExist must be called with the lock held
+func (r *Repository) usernameExist(username string) bool {
+	_, ok := r.db.DbUser[r.db.IdxUsername[username]]
+	return ok
+}
+
 func (r *Repository) GetUserByUsername(ctx context.Context, username string) (model.User, error) {
-	id := hex.EncodeToString([]byte(username))
+	r.db.RLock()
+	defer r.db.RUnlock()
+	userId, ok := r.db.IdxUsername[username]
+	if !ok {
+		return model.User{}, ErrUserNotFound
+	}
+
+	user, ok := r.db.DbUser[userId]
+	if !ok || user.Username != username {
+		return model.User{}, ErrUserNotFound
+	}
+
+	return user, nil
+}
+
+func (r *Repository) GetUser(ctx context.Context, userId string) (model.User, error) {
+	r.db.RLock()
+	defer r.db.RUnlock()
+	user, ok := r.db.DbUser[userId]
+	if !ok {
+		return model.User{}, ErrUserNotFound
+	}
+
+	return user, nil
+}
+
+func (r *Repository) InsertInvitation(ctx context.Context, inv model.Invitation) (model.Invitation, error) {
+	inv.CreatedDate = time.Now()
+
+	r.db.Lock()
+	defer r.db.Unlock()
+	if _, ok := r.db.DbInvitation[inv.Id]; ok {
+		return model.Invitation{}, ErrDuplicateContraint
+	}
+	r.db.DbInvitation[inv.Id] = inv
+
+	return inv, nil
+}
+
+func (r *Repository) GetInvitationByTokenHash(ctx context.Context, tokenHash string) (model.Invitation, error) {
+	r.db.RLock()
+	defer r.db.RUnlock()
+	for _, v := range r.db.DbInvitation {
+		if v.TokenHash == tokenHash {
+			return v, nil
+		}
+	}
+
+	return model.Invitation{}, ErrInvitationNotFound
+}
+
+// AcceptInvitation create the invited user and mark the invitation as used at once,
+// so an invitation can only ever create a single user
+func (r *Repository) AcceptInvitation(ctx context.Context, invitationId string, user model.User) (model.User, error) {
+	userId, err := r.ids.New()
+	if err != nil {
+		return model.User{}, err
+	}
+
+	user.Id = userId
+	user.CreatedDate = time.Now()
+
+	r.db.Lock()
+	defer r.db.Unlock()
+	inv, ok := r.db.DbInvitation[invitationId]
+	if !ok {
+		return model.User{}, ErrInvitationNotFound
+	}
+	if inv.IsUsed {
+		return model.User{}, ErrInvitationUsed
+	}
+	if r.usernameExist(user.Username) {
+		return model.User{}, ErrDuplicateContraint
+	}
+
+	inv.IsUsed = true
+	inv.UserId = user.Id
+	r.db.DbInvitation[invitationId] = inv
+	r.db.DbUser[user.Id] = user
+	r.db.IdxUsername[user.Username] = user.Id
+
+	return user, nil
+}
+
+func (r *Repository) UpdateUsername(ctx context.Context, userId, username string) error {
+	r.db.Lock()
+	defer r.db.Unlock()
+	user, ok := r.db.DbUser[userId]
+	if !ok {
+		return ErrUserNotFound
+	}
+	if r.usernameExist(username) {
+		return ErrDuplicateContraint
+	}
+
+	delete(r.db.IdxUsername, user.Username)
+	user.Username = username
+	r.db.DbUser[userId] = user
+	r.db.IdxUsername[username] = userId
+
+	return nil
+}
+
+func (r *Repository) UpdateRole(ctx context.Context, userId, role string) error {
+	r.db.Lock()
+	defer r.db.Unlock()
+	user, ok := r.db.DbUser[userId]
+	if !ok {
+		return ErrUserNotFound
+	}
+
+	user.Role = role
+	r.db.DbUser[userId] = user
+
+	return nil
+}
+
+func (r *Repository) UpdatePassword(ctx context.Context, userId, password string) error {
+	r.db.Lock()
+	defer r.db.Unlock()
+	user, ok := r.db.DbUser[userId]
+	if !ok {
+		return ErrUserNotFound
+	}
+
+	user.Password = password
+	r.db.DbUser[userId] = user
+
+	return nil
+}
+
+// UserProfile is the part of the user the user can edit itself
+type UserProfile struct {
+	DisplayName string
+	Email       string
+	Phone       string
+}
+
+func (r *Repository) UpdateProfile(ctx context.Context, userId string, profile UserProfile) (model.User, error) {
+	r.db.Lock()
+	defer r.db.Unlock()
+	user, ok := r.db.DbUser[userId]
+	if !ok {
+		return model.User{}, ErrUserNotFound
+	}
 
+	user.DisplayName = profile.DisplayName
+	user.Email = profile.Email
+	user.Phone = profile.Phone
+	r.db.DbUser[userId] = user
+
+	return user, nil
+}
+
+// DeactivateUser mark the user as deactivated, the user is kept
+// so the loan and the activity still point to it
+func (r *Repository) DeactivateUser(ctx context.Context, userId string) (model.User, error) {
 	r.db.Lock()
 	defer r.db.Unlock()
-	user, ok := r.db.DbUser[id]
+	user, ok := r.db.DbUser[userId]
 	if !ok {
 		return model.User{}, ErrUserNotFound
 	}
+	if !user.IsActive() {
+		return model.User{}, ErrUserDeactivated
+	}
+
+	user.DeactivatedDate = time.Now()
+	r.db.DbUser[userId] = user
 
 	return user, nil
 }
+
+// UserFilter narrow down the user, the zero value of a field mean
+// the field is not used to filter
+type UserFilter struct {
+	// Query is matched case insensitively against the username, display name, email and phone
+	Query string
+	Role  string
+	// IsActive filter by whether the user is deactivated, nil mean both
+	IsActive *bool
+	Limit    int
+	Offset   int
+}
+
+func (f UserFilter) match(user model.User) bool {
+	if f.Role != "" && user.Role != f.Role {
+		return false
+	}
+	if f.IsActive != nil && user.IsActive() != *f.IsActive {
+		return false
+	}
+	if f.Query == "" {
+		return true
+	}
+
+	q := strings.ToLower(f.Query)
+	for _, v := range []string{user.Username, user.DisplayName, user.Email, user.Phone} {
+		if strings.Contains(strings.ToLower(v), q) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// GetUsers return the matching user, the newest come first
+func (r *Repository) GetUsers(ctx context.Context, filter UserFilter) ([]model.User, error) {
+	r.db.RLock()
+	defer r.db.RUnlock()
+
+	users := make([]model.User, 0)
+	for _, v := range r.db.DbUser {
+		if filter.match(v) {
+			users = append(users, v)
+		}
+	}
+
+	sort.Slice(users, func(i, j int) bool {
+		if users[i].CreatedDate.Equal(users[j].CreatedDate) {
+			return users[i].Id > users[j].Id
+		}
+		return users[i].CreatedDate.After(users[j].CreatedDate)
+	})
+
+	if filter.Offset >= len(users) {
+		return users[:0], nil
+	}
+	users = users[filter.Offset:]
+	if filter.Limit > 0 && len(users) > filter.Limit {
+		users = users[:filter.Limit]
+	}
+
+	return users, nil
+}
+
+func (r *Repository) InsertPasswordReset(ctx context.Context, reset model.PasswordReset) (model.PasswordReset, error) {
+	reset.CreatedDate = time.Now()
+
+	r.db.Lock()
+	defer r.db.Unlock()
+	if _, ok := r.db.DbReset[reset.Id]; ok {
+		return model.PasswordReset{}, ErrDuplicateContraint
+	}
+	r.db.DbReset[reset.Id] = reset
+
+	return reset, nil
+}
+
+func (r *Repository) GetPasswordResetByTokenHash(ctx context.Context, tokenHash string) (model.PasswordReset, error) {
+	r.db.RLock()
+	defer r.db.RUnlock()
+	for _, v := range r.db.DbReset {
+		if v.TokenHash == tokenHash {
+			return v, nil
+		}
+	}
+
+	return model.PasswordReset{}, ErrResetNotFound
+}
+
+// ResetPassword update the password and mark every reset token of the user as used,
+// so the other token requested before can not be used anymore
+func (r *Repository) ResetPassword(ctx context.Context, resetId, password string) error {
+	r.db.Lock()
+	defer r.db.Unlock()
+	reset, ok := r.db.DbReset[resetId]
+	if !ok {
+		return ErrResetNotFound
+	}
+	if reset.IsUsed {
+		return ErrResetUsed
+	}
+
+	user, ok := r.db.DbUser[reset.UserId]
+	if !ok {
+		return ErrUserNotFound
+	}
+
+	for k, v := range r.db.DbReset {
+		if v.UserId == reset.UserId {
+			v.IsUsed = true
+			r.db.DbReset[k] = v
+		}
+	}
+
+	user.Password = password
+	r.db.DbUser[user.Id] = user
+
+	return nil
+}
+
+// RecordLogin keep the login attempt and, when it succeed, set the attempt time
+// as the last login of the user
+func (r *Repository) RecordLogin(ctx context.Context, act model.LoginActivity) (model.LoginActivity, error) {
+	act.CreatedDate = time.Now()
+
+	r.db.Lock()
+	defer r.db.Unlock()
+	if _, ok := r.db.DbActivity[act.Id]; ok {
+		return model.LoginActivity{}, ErrDuplicateContraint
+	}
+
+	if act.IsSuccess {
+		user, ok := r.db.DbUser[act.UserId]
+		if !ok {
+			return model.LoginActivity{}, ErrUserNotFound
+		}
+
+		user.LastLoginAt = act.CreatedDate
+		r.db.DbUser[user.Id] = user
+	}
+
+	r.db.DbActivity[act.Id] = act
+
+	return act, nil
+}
+
+// LoginActivityFilter narrow down the login activity, the zero value of a field mean
+// the field is not used to filter
+type LoginActivityFilter struct {
+	UserId   string
+	Username string
+	// IsSuccess filter by the result of the attempt, nil mean both
+	IsSuccess *bool
+	From      time.Time
+	To        time.Time
+	Limit     int
+}
+
+func (f LoginActivityFilter) match(act model.LoginActivity) bool {
+	if f.UserId != "" && act.UserId != f.UserId {
+		return false
+	}
+	if f.Username != "" && act.Username != f.Username {
+		return false
+	}
+	if f.IsSuccess != nil && act.IsSuccess != *f.IsSuccess {
+		return false
+	}
+	if !f.From.IsZero() && act.CreatedDate.Before(f.From) {
+		return false
+	}
+	if !f.To.IsZero() && !act.CreatedDate.Before(f.To) {
+		return false
+	}
+
+	return true
+}
+
+// GetLoginActivities return the matching login activity, the newest come first
+func (r *Repository) GetLoginActivities(ctx context.Context, filter LoginActivityFilter) ([]model.LoginActivity, error) {
+	r.db.RLock()
+	defer r.db.RUnlock()
+
+	acts := make([]model.LoginActivity, 0)
+	for _, v := range r.db.DbActivity {
+		if filter.match(v) {
+			acts = append(acts, v)
+		}
+	}
+
+	sort.Slice(acts, func(i, j int) bool {
+		return acts[i].CreatedDate.After(acts[j].CreatedDate)
+	})
+
+	if filter.Limit > 0 && len(acts) > filter.Limit {
+		acts = acts[:filter.Limit]
+	}
+
+	return acts, nil
+}
+
+func (r *Repository) GetUserTotp(ctx context.Context, userId string) (model.UserTotp, error) {
+	r.db.RLock()
+	defer r.db.RUnlock()
+	t, ok := r.db.DbTotp[userId]
+	if !ok {
+		return model.UserTotp{}, ErrTotpNotFound
+	}
+
+	return t, nil
+}
+
+// SetUserTotp keep a new secret for the user waiting to be verified,
+// the secret that is already enabled can not be replaced
+func (r *Repository) SetUserTotp(ctx context.Context, t model.UserTotp) (model.UserTotp, error) {
+	t.IsEnabled = false
+	t.CreatedDate = time.Now()
+
+	r.db.Lock()
+	defer r.db.Unlock()
+	if v, ok := r.db.DbTotp[t.UserId]; ok && v.IsEnabled {
+		return model.UserTotp{}, ErrTotpEnabled
+	}
+	r.db.DbTotp[t.UserId] = t
+
+	return t, nil
+}
+
+// EnableTotp enable the secret waiting to be verified and replace
+// the recovery codes of the user at once
+func (r *Repository) EnableTotp(ctx context.Context, userId string, counter int64, codes []model.RecoveryCode) error {
+	r.db.Lock()
+	defer r.db.Unlock()
+	t, ok := r.db.DbTotp[userId]
+	if !ok {
+		return ErrTotpNotFound
+	}
+	if t.IsEnabled {
+		return ErrTotpEnabled
+	}
+
+	t.IsEnabled = true
+	t.LastCounter = counter
+	r.db.DbTotp[userId] = t
+	r.replaceRecoveryCodes(userId, codes)
+
+	return nil
+}
+
+// UseTotp move the last accepted time step forward,
+// so the code of the step or the earlier one can not be used again
+func (r *Repository) UseTotp(ctx context.Context, userId string, counter int64) error {
+	r.db.Lock()
+	defer r.db.Unlock()
+	t, ok := r.db.DbTotp[userId]
+	if !ok || !t.IsEnabled {
+		return ErrTotpNotFound
+	}
+	if counter <= t.LastCounter {
+		return ErrTotpReplayed
+	}
+
+	t.LastCounter = counter
+	r.db.DbTotp[userId] = t
+
+	return nil
+}
+
+// DeleteUserTotp remove the secret and the recovery codes of the user
+func (r *Repository) DeleteUserTotp(ctx context.Context, userId string) error {
+	r.db.Lock()
+	defer r.db.Unlock()
+	if _, ok := r.db.DbTotp[userId]; !ok {
+		return ErrTotpNotFound
+	}
+
+	delete(r.db.DbTotp, userId)
+	r.replaceRecoveryCodes(userId, nil)
+
+	return nil
+}
+
+func (r *Repository) ReplaceRecoveryCodes(ctx context.Context, userId string, codes []model.RecoveryCode) error {
+	r.db.Lock()
+	defer r.db.Unlock()
+	r.replaceRecoveryCodes(userId, codes)
+
+	return nil
+}
+
+// replaceRecoveryCodes must be called with the lock held
+func (r *Repository) replaceRecoveryCodes(userId string, codes []model.RecoveryCode) {
+	for k, v := range r.db.DbRecovery {
+		if v.UserId == userId {
+			delete(r.db.DbRecovery, k)
+		}
+	}
+
+	t := time.Now()
+	for _, v := range codes {
+		v.UserId = userId
+		v.CreatedDate = t
+		r.db.DbRecovery[v.Id] = v
+	}
+}
+
+// UseRecoveryCode mark the unused recovery code of the user as used
+func (r *Repository) UseRecoveryCode(ctx context.Context, userId, codeHash string) error {
+	r.db.Lock()
+	defer r.db.Unlock()
+	for k, v := range r.db.DbRecovery {
+		if v.UserId == userId && v.CodeHash == codeHash && !v.IsUsed {
+			v.IsUsed = true
+			r.db.DbRecovery[k] = v
+			return nil
+		}
+	}
+
+	return ErrRecoveryNotFound
+}
+
+func (r *Repository) InsertLoginChallenge(ctx context.Context, ch model.LoginChallenge) (model.LoginChallenge, error) {
+	ch.CreatedDate = time.Now()
+
+	r.db.Lock()
+	defer r.db.Unlock()
+	if _, ok := r.db.DbChallenge[ch.Id]; ok {
+		return model.LoginChallenge{}, ErrDuplicateContraint
+	}
+	r.db.DbChallenge[ch.Id] = ch
+
+	return ch, nil
+}
+
+func (r *Repository) GetLoginChallengeByTokenHash(ctx context.Context, tokenHash string) (model.LoginChallenge, error) {
+	r.db.RLock()
+	defer r.db.RUnlock()
+	for _, v := range r.db.DbChallenge {
+		if v.TokenHash == tokenHash {
+			return v, nil
+		}
+	}
+
+	return model.LoginChallenge{}, ErrChallengeNotFound
+}
+
+// FailLoginChallenge count a wrong code against the challenge,
+// the challenge is used up once it reach the max attempts
+func (r *Repository) FailLoginChallenge(ctx context.Context, challengeId string, maxAttempts int) error {
+	r.db.Lock()
+	defer r.db.Unlock()
+	ch, ok := r.db.DbChallenge[challengeId]
+	if !ok {
+		return ErrChallengeNotFound
+	}
+
+	ch.Attempts++
+	if ch.Attempts >= maxAttempts {
+		ch.IsUsed = true
+	}
+	r.db.DbChallenge[challengeId] = ch
+
+	return nil
+}
+
+func (r *Repository) UseLoginChallenge(ctx context.Context, challengeId string) error {
+	r.db.Lock()
+	defer r.db.Unlock()
+	ch, ok := r.db.DbChallenge[challengeId]
+	if !ok {
+		return ErrChallengeNotFound
+	}
+	if ch.IsUsed {
+		return ErrChallengeUsed
+	}
+
+	ch.IsUsed = true
+	r.db.DbChallenge[challengeId] = ch
+
+	return nil
+}
+
+func (r *Repository) InsertApiKey(ctx context.Context, key model.ApiKey) (model.ApiKey, error) {
+	key.CreatedDate = time.Now()
+
+	r.db.Lock()
+	defer r.db.Unlock()
+	if _, ok := r.db.DbApiKey[key.Id]; ok {
+		return model.ApiKey{}, ErrDuplicateContraint
+	}
+	r.db.DbApiKey[key.Id] = key
+
+	return key, nil
+}
+
+func (r *Repository) GetApiKey(ctx context.Context, id string) (model.ApiKey, error) {
+	r.db.RLock()
+	defer r.db.RUnlock()
+	key, ok := r.db.DbApiKey[id]
+	if !ok {
+		return model.ApiKey{}, ErrApiKeyNotFound
+	}
+
+	return key, nil
+}
+
+func (r *Repository) GetApiKeyByKeyHash(ctx context.Context, keyHash string) (model.ApiKey, error) {
+	r.db.RLock()
+	defer r.db.RUnlock()
+	for _, v := range r.db.DbApiKey {
+		if v.KeyHash == keyHash {
+			return v, nil
+		}
+	}
+
+	return model.ApiKey{}, ErrApiKeyNotFound
+}
+
+// GetApiKeys return every API key, the newest come first
+func (r *Repository) GetApiKeys(ctx context.Context) ([]model.ApiKey, error) {
+	r.db.RLock()
+	defer r.db.RUnlock()
+
+	keys := make([]model.ApiKey, 0, len(r.db.DbApiKey))
+	for _, v := range r.db.DbApiKey {
+		keys = append(keys, v)
+	}
+
+	sort.Slice(keys, func(i, j int) bool {
+		return keys[i].CreatedDate.After(keys[j].CreatedDate)
+	})
+
+	return keys, nil
+}
+
+// RotateApiKey replace the key of the API key that is not revoked,
+// the old key stop working right away
+func (r *Repository) RotateApiKey(ctx context.Context, id, prefix, keyHash string) (model.ApiKey, error) {
+	r.db.Lock()
+	defer r.db.Unlock()
+	key, ok := r.db.DbApiKey[id]
+	if !ok || key.IsRevoked {
+		return model.ApiKey{}, ErrApiKeyNotFound
+	}
+
+	key.Prefix = prefix
+	key.KeyHash = keyHash
+	r.db.DbApiKey[id] = key
+
+	return key, nil
+}
+
+func (r *Repository) RevokeApiKey(ctx context.Context, id string) error {
+	r.db.Lock()
+	defer r.db.Unlock()
+	key, ok := r.db.DbApiKey[id]
+	if !ok || key.IsRevoked {
+		return ErrApiKeyNotFound
+	}
+
+	key.IsRevoked = true
+	r.db.DbApiKey[id] = key
+
+	return nil
+}
+
+func (r *Repository) UseApiKey(ctx context.Context, id string, t time.Time) error {
+	r.db.Lock()
+	defer r.db.Unlock()
+	key, ok := r.db.DbApiKey[id]
+	if !ok {
+		return ErrApiKeyNotFound
+	}
+
+	key.LastUsedDate = t
+	r.db.DbApiKey[id] = key
+
+	return nil
+}
+
+func (r *Repository) GetUserIdentity(ctx context.Context, issuer, subject string) (model.UserIdentity, error) {
+	r.db.RLock()
+	defer r.db.RUnlock()
+	for _, v := range r.db.DbIdentity {
+		if v.Issuer == issuer && v.Subject == subject {
+			return v, nil
+		}
+	}
+
+	return model.UserIdentity{}, ErrIdentityNotFound
+}
+
+// InsertIdentityUser create the user signed up through the OpenID provider and its identity at once,
+// so a subject is never left without its user
+func (r *Repository) InsertIdentityUser(ctx context.Context, user model.User, identity model.UserIdentity) (model.User, error) {
+	userId, err := r.ids.New()
+	if err != nil {
+		return model.User{}, err
+	}
+
+	user.Id = userId
+	user.CreatedDate = time.Now()
+	identity.UserId = user.Id
+	identity.CreatedDate = user.CreatedDate
+
+	r.db.Lock()
+	defer r.db.Unlock()
+	if r.usernameExist(user.Username) {
+		return model.User{}, ErrDuplicateContraint
+	}
+	for _, v := range r.db.DbIdentity {
+		if v.Id == identity.Id || (v.Issuer == identity.Issuer && v.Subject == identity.Subject) {
+			return model.User{}, ErrDuplicateContraint
+		}
+	}
+
+	r.db.DbUser[user.Id] = user
+	r.db.IdxUsername[user.Username] = user.Id
+	r.db.DbIdentity[identity.Id] = identity
+
+	return user, nil
+}
+
+func (r *Repository) InsertOidcState(ctx context.Context, st model.OidcState) (model.OidcState, error) {
+	st.CreatedDate = time.Now()
+
+	r.db.Lock()
+	defer r.db.Unlock()
+	if _, ok := r.db.DbOidcState[st.Id]; ok {
+		return model.OidcState{}, ErrDuplicateContraint
+	}
+	r.db.DbOidcState[st.Id] = st
+
+	return st, nil
+}
+
+// UseOidcState return the state of the hash and mark it used at once,
+// so the callback can only be completed once
+func (r *Repository) UseOidcState(ctx context.Context, stateHash string) (model.OidcState, error) {
+	r.db.Lock()
+	defer r.db.Unlock()
+	for k, v := range r.db.DbOidcState {
+		if v.StateHash != stateHash {
+			continue
+		}
+		if v.IsUsed {
+			return model.OidcState{}, ErrOidcStateUsed
+		}
+
+		v.IsUsed = true
+		r.db.DbOidcState[k] = v
+
+		return v, nil
+	}
+
+	return model.OidcState{}, ErrOidcStateNotFound
+}
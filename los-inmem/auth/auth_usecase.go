@@ -3,27 +3,89 @@ package auth
 import (
 	"context"
 	"errors"
+	"math"
 	"net/http"
+	"strings"
+	"sync"
+	"time"
+	"unicode/utf8"
 
 	"github.com/fikryfahrezy/adea/los-inmen/model"
+	"github.com/fikryfahrezy/adea/los-inmen/notify"
+	"github.com/fikryfahrezy/adea/los-inmen/oidc"
+	"github.com/fikryfahrezy/adea/los-inmen/rbac"
 	"github.com/fikryfahrezy/adea/los-inmen/resp"
+	"github.com/fikryfahrezy/adea/los-inmen/session"
+	"github.com/fikryfahrezy/adea/los-inmen/totp"
 	"golang.org/x/crypto/bcrypt"
 )
 
 var (
-	ErrAuthPwNotMatch = errors.New("authentication password not match")
-	ErrUsernameExist  = errors.New("username already exist")
+	ErrAuthPwNotMatch      = errors.New("authentication password not match")
+	ErrInvalidCredentials  = errors.New("invalid username or password")
+	ErrTooManyLoginAttempt = errors.New("too many failed login attempt, try again later")
+	ErrTooManyResetRequest = errors.New("too many password reset request, try again later")
+	ErrUsernameExist       = errors.New("username already exist")
+	ErrUserForbidden       = errors.New("user role not allowed")
+	ErrInvitationExpired   = errors.New("invitation expired")
+	ErrResetExpired        = errors.New("password reset token expired")
+	ErrPasswordSame        = errors.New("new password must be different from the old one")
+	ErrChallengeNotValid   = errors.New("login challenge not valid or expired, log in again")
+	ErrTotpNotValid        = errors.New("two-factor code not valid")
+	ErrTotpNotEnabled      = errors.New("two-factor authentication not enabled")
+	ErrApiKeyNotValid      = errors.New("api key not valid")
+	ErrUsernameSame        = errors.New("new username must be different from the old one")
+	ErrAccountDeactivated  = errors.New("account deactivated")
+	ErrDeactivateSelf      = errors.New("officer can not deactivate its own account here")
+	ErrOidcNotConfigured   = errors.New("openid connect login not configured")
+	ErrOidcStateNotValid   = errors.New("openid connect login state not valid or expired, log in again")
+	ErrOidcLoginFailed     = errors.New("openid connect login failed")
+	ErrOidcRoleNotValid    = errors.New("identity provider did not grant an officer role")
+)
+
+const (
+	// defaultInvitationTTL is used when the admin does not set how long the invitation live
+	defaultInvitationTTL = 72 * time.Hour
+	passwordResetTTL     = 30 * time.Minute
+	// maxUserAgentLength is how many character of the user agent kept in the login activity
+	maxUserAgentLength = 500
+
+	totpIssuer = "ADeA LOS"
+	// totpSkew is how many time step before and after the current one a code is accepted
+	totpSkew             = 1
+	loginChallengeTTL    = 5 * time.Minute
+	maxChallengeAttempts = 5
+	recoveryCodeCount    = 10
+
+	// ApiKeyPrefix start every API key so it can be told apart from the session token
+	ApiKeyPrefix = "lak_"
+	// apiKeyUseInterval is how often the last used date of an API key is written,
+	// so a busy key does not write on every request
+	apiKeyUseInterval = time.Minute
+
+	// oidcStateTTL is how long the user has to log in at the OpenID provider
+	oidcStateTTL = 10 * time.Minute
+)
+
+// The reason a login attempt failed, kept in the login activity
+const (
+	loginReasonInvalidCredentials = "invalid_credentials"
+	loginReasonTooManyAttempt     = "too_many_attempt"
+	loginReasonInvalidTotp        = "invalid_totp"
+	loginReasonDeactivated        = "deactivated"
 )
 
 type (
 	RegisterIn struct {
-		IsOfficer bool   `json:"is_officer"`
-		Username  string `json:"username"`
-		Password  string `json:"password"`
+		Username string `json:"username"`
+		Password string `json:"password"`
 	}
 	RegisterRes struct {
-		IsOfficer bool   `json:"is_officer"`
-		Id        string `json:"id"`
+		ExpiresIn    int64  `json:"expires_in"`
+		Id           string `json:"id"`
+		Role         string `json:"role"`
+		Token        string `json:"token"`
+		RefreshToken string `json:"refresh_token"`
 	}
 	RegisterOut struct {
 		resp.Response
@@ -39,6 +101,11 @@ func (a *AuthApp) Register(ctx context.Context, in RegisterIn) (out RegisterOut)
 		return
 	}
 
+	if err := a.policy.Validate(in.Password); err != nil {
+		out.Response = resp.NewResponse(http.StatusUnprocessableEntity, "", err)
+		return
+	}
+
 	_, err := a.repository.GetUserByUsername(ctx, in.Username)
 	if err == nil {
 		out.Response = resp.NewResponse(http.StatusBadRequest, "", ErrUsernameExist)
@@ -55,10 +122,12 @@ func (a *AuthApp) Register(ctx context.Context, in RegisterIn) (out RegisterOut)
 		return
 	}
 
+	// Public registration always create an applicant, the officer
+	// account is created only through the invitation of an admin
 	newUser := model.User{
-		Username:  in.Username,
-		IsOfficer: in.IsOfficer,
-		Password:  string(hashed),
+		Username: in.Username,
+		Password: string(hashed),
+		Role:     rbac.Applicant.String(),
 	}
 
 	if newUser, err = a.repository.InsertUser(ctx, newUser); err != nil {
@@ -67,8 +136,8 @@ func (a *AuthApp) Register(ctx context.Context, in RegisterIn) (out RegisterOut)
 	}
 
 	out.Res = RegisterRes{
-		IsOfficer: newUser.IsOfficer,
-		Id:        newUser.Id,
+		Id:   newUser.Id,
+		Role: newUser.Role,
 	}
 
 	return
@@ -78,10 +147,38 @@ type (
 	LoginIn struct {
 		Username string `json:"username"`
 		Password string `json:"password"`
+		// Cookie ask the handler to set the session as cookie for the browser
+		// instead of returning the token in the body
+		Cookie bool `json:"cookie"`
+		// Ip and UserAgent are set by the handler from the request, they are not read from the body
+		Ip        string `json:"-"`
+		UserAgent string `json:"-"`
 	}
 	LoginRes struct {
-		IsOfficer bool   `json:"is_officer"`
-		Id        string `json:"id"`
+		// RetryAfter is how many seconds the client must wait when the login is throttled
+		RetryAfter   int64  `json:"-"`
+		ExpiresIn    int64  `json:"expires_in"`
+		Id           string `json:"id"`
+		Role         string `json:"role"`
+		Token        string `json:"token"`
+		RefreshToken string `json:"refresh_token"`
+		// CsrfToken is only set when the session is set as cookie, it is sent back
+		// in the X-CSRF-Token header of every request that change something
+		CsrfToken string `json:"csrf_token"`
+		// LastLoginAt is the previous successful login, empty on the first one
+		LastLoginAt string `json:"last_login_at"`
+		// TotpRequired mean the password is right but the session is only issued
+		// after the TOTP code is verified with the ChallengeToken
+		TotpRequired   bool   `json:"totp_required"`
+		ChallengeToken string `json:"challenge_token"`
+		// TotpSecret and TotpUri are only set when the user has not enrolled yet,
+		// the first code verified enable the TOTP and return the RecoveryCodes
+		TotpSecret    string   `json:"totp_secret"`
+		TotpUri       string   `json:"totp_uri"`
+		RecoveryCodes []string `json:"recovery_codes"`
+		// RoleChanged is set when the OIDC login changed the role of the user,
+		// the session issued with the old role has to be ended
+		RoleChanged bool `json:"-"`
 	}
 	LoginOut struct {
 		resp.Response
@@ -97,7 +194,249 @@ func (a *AuthApp) Login(ctx context.Context, in LoginIn) (out LoginOut) {
 		return
 	}
 
+	// The attempt is counted both by the username, so a single account can not be guessed
+	// from many address, and by the address, so many account can not be guessed from one
+	keys := []string{"user:" + strings.ToLower(in.Username)}
+	if in.Ip != "" {
+		keys = append(keys, "ip:"+in.Ip)
+	}
+
 	user, err := a.repository.GetUserByUsername(ctx, in.Username)
+	if err != nil && !errors.Is(err, ErrUserNotFound) {
+		out.Response = resp.NewResponse(http.StatusInternalServerError, "", err)
+		return
+	}
+
+	if wait := a.loginWait(keys); wait > 0 {
+		if err := a.recordLogin(ctx, in, user.Id, false, loginReasonTooManyAttempt); err != nil {
+			out.Response = resp.NewResponse(http.StatusInternalServerError, "", err)
+			return
+		}
+
+		out.Response = resp.NewResponse(http.StatusTooManyRequests, "", ErrTooManyLoginAttempt)
+		out.Res.RetryAfter = int64(math.Ceil(wait.Seconds()))
+		return
+	}
+
+	// Compare against a dummy hash when the user does not exist so both case
+	// take the same time and can not be told apart from the outside
+	hashed := user.Password
+	if errors.Is(err, ErrUserNotFound) {
+		hashed = dummyHash()
+	}
+
+	err = bcrypt.CompareHashAndPassword([]byte(hashed), []byte(in.Password))
+	if err != nil && !errors.Is(err, bcrypt.ErrMismatchedHashAndPassword) {
+		out.Response = resp.NewResponse(http.StatusInternalServerError, "", err)
+		return
+	}
+
+	if err != nil || user.Id == "" {
+		for _, k := range keys {
+			a.throttle.Fail(k)
+		}
+		if err := a.recordLogin(ctx, in, user.Id, false, loginReasonInvalidCredentials); err != nil {
+			out.Response = resp.NewResponse(http.StatusInternalServerError, "", err)
+			return
+		}
+
+		out.Response = resp.NewResponse(http.StatusUnauthorized, "", ErrInvalidCredentials)
+		return
+	}
+
+	// Only told after the password is verified so the state of an account
+	// is not revealed to whoever try its username
+	if !user.IsActive() {
+		if err := a.recordLogin(ctx, in, user.Id, false, loginReasonDeactivated); err != nil {
+			out.Response = resp.NewResponse(http.StatusInternalServerError, "", err)
+			return
+		}
+
+		out.Response = resp.NewResponse(http.StatusForbidden, "", ErrAccountDeactivated)
+		return
+	}
+
+	// The failure is not reset yet for the user that require TOTP,
+	// otherwise a known password would allow unlimited guess of the code
+	if totpRequired(user.Role) {
+		res, err := a.loginChallenge(ctx, user)
+		if err != nil {
+			out.Response = resp.NewResponse(http.StatusInternalServerError, "", err)
+			return
+		}
+
+		out.Res = res
+		return
+	}
+
+	out.Response = a.loginSucceed(ctx, in, keys[0], user)
+	if out.Error != nil {
+		return
+	}
+
+	out.Res = loginRes(user)
+
+	return
+}
+
+// loginSucceed reset the failure of the username and record the login,
+// only the username is reset, resetting the address would let an attacker
+// clear its own counter by logging in to its own account in between
+func (a *AuthApp) loginSucceed(ctx context.Context, in LoginIn, userKey string, user model.User) resp.Response {
+	a.throttle.Reset(userKey)
+
+	if err := a.recordLogin(ctx, in, user.Id, true, ""); err != nil {
+		return resp.NewResponse(http.StatusInternalServerError, "", err)
+	}
+
+	return resp.NewResponse(http.StatusOK, "", nil)
+}
+
+func loginRes(user model.User) LoginRes {
+	res := LoginRes{
+		Id:   user.Id,
+		Role: user.Role,
+	}
+	if !user.LastLoginAt.IsZero() {
+		res.LastLoginAt = user.LastLoginAt.Format(time.RFC3339)
+	}
+
+	return res
+}
+
+// totpRequired tell whether the role must verify a TOTP code to log in,
+// every officer role does since they can act on the loan of other user
+func totpRequired(role string) bool {
+	return role != "" && role != rbac.Applicant.String()
+}
+
+// loginChallenge hand out the challenge to be verified with the TOTP code,
+// a new secret is generated for the user that has not enrolled yet
+func (a *AuthApp) loginChallenge(ctx context.Context, user model.User) (LoginRes, error) {
+	res := LoginRes{
+		Id:           user.Id,
+		Role:         user.Role,
+		TotpRequired: true,
+	}
+
+	t, err := a.repository.GetUserTotp(ctx, user.Id)
+	if err != nil && !errors.Is(err, ErrTotpNotFound) {
+		return LoginRes{}, err
+	}
+
+	if !t.IsEnabled {
+		secret, err := totp.GenerateSecret()
+		if err != nil {
+			return LoginRes{}, err
+		}
+
+		if _, err = a.repository.SetUserTotp(ctx, model.UserTotp{UserId: user.Id, Secret: secret}); err != nil {
+			return LoginRes{}, err
+		}
+
+		res.TotpSecret = secret
+		res.TotpUri = totp.URI(totpIssuer, user.Username, secret)
+	}
+
+	token, err := session.NewToken()
+	if err != nil {
+		return LoginRes{}, err
+	}
+
+	ch := model.LoginChallenge{
+		Id:          session.KeyId(token),
+		TokenHash:   session.KeyHash(token),
+		UserId:      user.Id,
+		ExpiredDate: time.Now().Add(loginChallengeTTL),
+	}
+
+	if _, err = a.repository.InsertLoginChallenge(ctx, ch); err != nil {
+		return LoginRes{}, err
+	}
+
+	res.ChallengeToken = token
+
+	return res, nil
+}
+
+func (a *AuthApp) recordLogin(ctx context.Context, in LoginIn, userId string, isSuccess bool, reason string) error {
+	token, err := session.NewToken()
+	if err != nil {
+		return err
+	}
+
+	userAgent := in.UserAgent
+	if utf8.RuneCountInString(userAgent) > maxUserAgentLength {
+		userAgent = string([]rune(userAgent)[:maxUserAgentLength])
+	}
+
+	_, err = a.repository.RecordLogin(ctx, model.LoginActivity{
+		IsSuccess: isSuccess,
+		Id:        session.KeyId(token),
+		UserId:    userId,
+		Username:  in.Username,
+		Reason:    reason,
+		Ip:        in.Ip,
+		UserAgent: userAgent,
+	})
+
+	return err
+}
+
+func (a *AuthApp) loginWait(keys []string) time.Duration {
+	var wait time.Duration
+	for _, k := range keys {
+		if w := a.throttle.Wait(k); w > wait {
+			wait = w
+		}
+	}
+
+	return wait
+}
+
+var (
+	dummyHashOnce  sync.Once
+	dummyHashValue string
+)
+
+func dummyHash() string {
+	dummyHashOnce.Do(func() {
+		hashed, _ := bcrypt.GenerateFromPassword([]byte("dummy-password"), bcrypt.DefaultCost)
+		dummyHashValue = string(hashed)
+	})
+
+	return dummyHashValue
+}
+
+type (
+	CreateInvitationIn struct {
+		// ExpiresIn is how many seconds the invitation can be accepted, 0 mean the default
+		ExpiresIn int64  `json:"expires_in"`
+		Role      string `json:"role"`
+	}
+	CreateInvitationRes struct {
+		Id          string `json:"id"`
+		Token       string `json:"token"`
+		Role        string `json:"role"`
+		ExpiredDate string `json:"expired_date"`
+	}
+	CreateInvitationOut struct {
+		resp.Response
+		Res CreateInvitationRes
+	}
+)
+
+// CreateInvitation issue a single use token to create an officer account, only
+// the hash of the token is stored so it is only shown once in the response
+func (a *AuthApp) CreateInvitation(ctx context.Context, userId string, in CreateInvitationIn) (out CreateInvitationOut) {
+	out.Response = resp.NewResponse(http.StatusCreated, "", nil)
+
+	if err := validateCreateInvitation(in); err != nil {
+		out.Response = resp.NewResponse(http.StatusUnprocessableEntity, "", err)
+		return
+	}
+
+	user, err := a.repository.GetUser(ctx, userId)
 	if errors.Is(err, ErrUserNotFound) {
 		out.Response = resp.NewResponse(http.StatusNotFound, "", err)
 		return
@@ -107,7 +446,204 @@ func (a *AuthApp) Login(ctx context.Context, in LoginIn) (out LoginOut) {
 		return
 	}
 
-	err = bcrypt.CompareHashAndPassword([]byte(user.Password), []byte(in.Password))
+	if !rbac.Can(user.Role, rbac.UserInvite) {
+		out.Response = resp.NewResponse(http.StatusForbidden, "", ErrUserForbidden)
+		return
+	}
+
+	token, err := session.NewToken()
+	if err != nil {
+		out.Response = resp.NewResponse(http.StatusInternalServerError, "", err)
+		return
+	}
+
+	ttl := defaultInvitationTTL
+	if in.ExpiresIn > 0 {
+		ttl = time.Duration(in.ExpiresIn) * time.Second
+	}
+
+	inv := model.Invitation{
+		Id:          session.KeyId(token),
+		TokenHash:   session.KeyHash(token),
+		Role:        in.Role,
+		InvitedBy:   user.Id,
+		ExpiredDate: time.Now().Add(ttl),
+	}
+
+	if inv, err = a.repository.InsertInvitation(ctx, inv); err != nil {
+		out.Response = resp.NewResponse(http.StatusInternalServerError, "", err)
+		return
+	}
+
+	out.Res = CreateInvitationRes{
+		Id:          inv.Id,
+		Token:       token,
+		Role:        inv.Role,
+		ExpiredDate: inv.ExpiredDate.Format(time.RFC3339),
+	}
+
+	return
+}
+
+type AcceptInvitationIn struct {
+	Token    string `json:"token"`
+	Username string `json:"username"`
+	Password string `json:"password"`
+}
+
+// AcceptInvitation create the user with the role of the invitation, the result
+// is the same as Register so the client can be logged in right away
+func (a *AuthApp) AcceptInvitation(ctx context.Context, in AcceptInvitationIn) (out RegisterOut) {
+	out.Response = resp.NewResponse(http.StatusCreated, "", nil)
+
+	if err := validateAcceptInvitation(in); err != nil {
+		out.Response = resp.NewResponse(http.StatusUnprocessableEntity, "", err)
+		return
+	}
+
+	if err := a.policy.Validate(in.Password); err != nil {
+		out.Response = resp.NewResponse(http.StatusUnprocessableEntity, "", err)
+		return
+	}
+
+	inv, err := a.repository.GetInvitationByTokenHash(ctx, session.KeyHash(in.Token))
+	if errors.Is(err, ErrInvitationNotFound) {
+		out.Response = resp.NewResponse(http.StatusNotFound, "", err)
+		return
+	}
+	if err != nil {
+		out.Response = resp.NewResponse(http.StatusInternalServerError, "", err)
+		return
+	}
+
+	if inv.IsUsed {
+		out.Response = resp.NewResponse(http.StatusBadRequest, "", ErrInvitationUsed)
+		return
+	}
+
+	if !inv.ExpiredDate.After(time.Now()) {
+		out.Response = resp.NewResponse(http.StatusBadRequest, "", ErrInvitationExpired)
+		return
+	}
+
+	_, err = a.repository.GetUserByUsername(ctx, in.Username)
+	if err == nil {
+		out.Response = resp.NewResponse(http.StatusBadRequest, "", ErrUsernameExist)
+		return
+	}
+	if !errors.Is(err, ErrUserNotFound) {
+		out.Response = resp.NewResponse(http.StatusInternalServerError, "", err)
+		return
+	}
+
+	hashed, err := bcrypt.GenerateFromPassword([]byte(in.Password), bcrypt.DefaultCost)
+	if err != nil {
+		out.Response = resp.NewResponse(http.StatusInternalServerError, "", err)
+		return
+	}
+
+	newUser := model.User{
+		Username: in.Username,
+		Password: string(hashed),
+		Role:     inv.Role,
+	}
+
+	newUser, err = a.repository.AcceptInvitation(ctx, inv.Id, newUser)
+	if errors.Is(err, ErrInvitationUsed) {
+		out.Response = resp.NewResponse(http.StatusBadRequest, "", err)
+		return
+	}
+	if errors.Is(err, ErrDuplicateContraint) {
+		out.Response = resp.NewResponse(http.StatusBadRequest, "", ErrUsernameExist)
+		return
+	}
+	if err != nil {
+		out.Response = resp.NewResponse(http.StatusInternalServerError, "", err)
+		return
+	}
+
+	// The invited user is always an officer that has to enroll
+	// the TOTP on the first login, so no session is issued here
+	out.Response = resp.NewResponse(http.StatusCreated, "log in to set up the two-factor authentication", nil)
+	out.Res = RegisterRes{
+		Id:   newUser.Id,
+		Role: newUser.Role,
+	}
+
+	return
+}
+
+// EnsureAdmin create the admin user when it does not exist yet, since the public
+// registration only create applicant this is the way the first admin is made
+func (a *AuthApp) EnsureAdmin(ctx context.Context, username, password string) error {
+	if username == "" || password == "" {
+		return nil
+	}
+
+	_, err := a.repository.GetUserByUsername(ctx, username)
+	if err == nil {
+		return nil
+	}
+	if !errors.Is(err, ErrUserNotFound) {
+		return err
+	}
+
+	hashed, err := bcrypt.GenerateFromPassword([]byte(password), bcrypt.DefaultCost)
+	if err != nil {
+		return err
+	}
+
+	_, err = a.repository.InsertUser(ctx, model.User{
+		Username: username,
+		Password: string(hashed),
+		Role:     rbac.Admin.String(),
+	})
+	return err
+}
+
+type (
+	ChangePasswordIn struct {
+		OldPassword string `json:"old_password"`
+		NewPassword string `json:"new_password"`
+	}
+	ChangePasswordRes struct {
+		ExpiresIn    int64  `json:"expires_in"`
+		Id           string `json:"id"`
+		Role         string `json:"role"`
+		Token        string `json:"token"`
+		RefreshToken string `json:"refresh_token"`
+		CsrfToken    string `json:"csrf_token"`
+	}
+	ChangePasswordOut struct {
+		resp.Response
+		Res ChangePasswordRes
+	}
+)
+
+func (a *AuthApp) ChangePassword(ctx context.Context, userId string, in ChangePasswordIn) (out ChangePasswordOut) {
+	out.Response = resp.NewResponse(http.StatusOK, "", nil)
+
+	if err := validateChangePassword(in); err != nil {
+		out.Response = resp.NewResponse(http.StatusUnprocessableEntity, "", err)
+		return
+	}
+
+	if err := a.policy.Validate(in.NewPassword); err != nil {
+		out.Response = resp.NewResponse(http.StatusUnprocessableEntity, "", err)
+		return
+	}
+
+	user, err := a.repository.GetUser(ctx, userId)
+	if errors.Is(err, ErrUserNotFound) {
+		out.Response = resp.NewResponse(http.StatusNotFound, "", err)
+		return
+	}
+	if err != nil {
+		out.Response = resp.NewResponse(http.StatusInternalServerError, "", err)
+		return
+	}
+
+	err = bcrypt.CompareHashAndPassword([]byte(user.Password), []byte(in.OldPassword))
 	if errors.Is(err, bcrypt.ErrMismatchedHashAndPassword) {
 		out.Response = resp.NewResponse(http.StatusBadRequest, "", ErrAuthPwNotMatch)
 		return
@@ -117,10 +653,1509 @@ func (a *AuthApp) Login(ctx context.Context, in LoginIn) (out LoginOut) {
 		return
 	}
 
-	out.Res = LoginRes{
-		IsOfficer: user.IsOfficer,
-		Id:        user.Id,
+	hashed, err := bcrypt.GenerateFromPassword([]byte(in.NewPassword), bcrypt.DefaultCost)
+	if err != nil {
+		out.Response = resp.NewResponse(http.StatusInternalServerError, "", err)
+		return
+	}
+
+	if err = a.repository.UpdatePassword(ctx, user.Id, string(hashed)); err != nil {
+		out.Response = resp.NewResponse(http.StatusInternalServerError, "", err)
+		return
+	}
+
+	out.Res = ChangePasswordRes{
+		Id:   user.Id,
+		Role: user.Role,
 	}
 
 	return
 }
+
+type (
+	ChangeUsernameIn struct {
+		Username string `json:"username"`
+		Password string `json:"password"`
+	}
+	ChangeUsernameRes struct {
+		Id       string `json:"id"`
+		Username string `json:"username"`
+	}
+	ChangeUsernameOut struct {
+		resp.Response
+		Res ChangeUsernameRes
+	}
+)
+
+// ChangeUsername give the user a new username, the id stay the same
+// so the session and every record of the user keep pointing to it
+func (a *AuthApp) ChangeUsername(ctx context.Context, userId string, in ChangeUsernameIn) (out ChangeUsernameOut) {
+	out.Response = resp.NewResponse(http.StatusOK, "", nil)
+
+	if err := validateChangeUsername(in); err != nil {
+		out.Response = resp.NewResponse(http.StatusUnprocessableEntity, "", err)
+		return
+	}
+
+	user, err := a.repository.GetUser(ctx, userId)
+	if errors.Is(err, ErrUserNotFound) {
+		out.Response = resp.NewResponse(http.StatusNotFound, "", err)
+		return
+	}
+	if err != nil {
+		out.Response = resp.NewResponse(http.StatusInternalServerError, "", err)
+		return
+	}
+
+	err = bcrypt.CompareHashAndPassword([]byte(user.Password), []byte(in.Password))
+	if errors.Is(err, bcrypt.ErrMismatchedHashAndPassword) {
+		out.Response = resp.NewResponse(http.StatusBadRequest, "", ErrAuthPwNotMatch)
+		return
+	}
+	if err != nil {
+		out.Response = resp.NewResponse(http.StatusInternalServerError, "", err)
+		return
+	}
+
+	if in.Username == user.Username {
+		out.Response = resp.NewResponse(http.StatusBadRequest, "", ErrUsernameSame)
+		return
+	}
+
+	err = a.repository.UpdateUsername(ctx, user.Id, in.Username)
+	if errors.Is(err, ErrDuplicateContraint) {
+		out.Response = resp.NewResponse(http.StatusBadRequest, "", ErrUsernameExist)
+		return
+	}
+	if err != nil {
+		out.Response = resp.NewResponse(http.StatusInternalServerError, "", err)
+		return
+	}
+
+	// The lockout follow the account, otherwise a rename would clear it
+	// and hand it to whoever register the old username next
+	a.throttle.Move("user:"+strings.ToLower(user.Username), "user:"+strings.ToLower(in.Username))
+	a.throttle.Move("reset:user:"+strings.ToLower(user.Username), "reset:user:"+strings.ToLower(in.Username))
+
+	out.Res = ChangeUsernameRes{
+		Id:       user.Id,
+		Username: in.Username,
+	}
+
+	return
+}
+
+type (
+	UserRes struct {
+		IsActive    bool   `json:"is_active"`
+		Id          string `json:"id"`
+		Username    string `json:"username"`
+		DisplayName string `json:"display_name"`
+		Email       string `json:"email"`
+		Phone       string `json:"phone"`
+		Role        string `json:"role"`
+		CreatedDate string `json:"created_date"`
+		// LastLoginAt and DeactivatedDate are empty when it never happen
+		LastLoginAt     string `json:"last_login_at"`
+		DeactivatedDate string `json:"deactivated_date"`
+	}
+	UserOut struct {
+		resp.Response
+		Res UserRes
+	}
+)
+
+func userRes(user model.User) UserRes {
+	res := UserRes{
+		IsActive:    user.IsActive(),
+		Id:          user.Id,
+		Username:    user.Username,
+		DisplayName: user.DisplayName,
+		Email:       user.Email,
+		Phone:       user.Phone,
+		Role:        user.Role,
+		CreatedDate: user.CreatedDate.Format(time.RFC3339),
+	}
+	if !user.LastLoginAt.IsZero() {
+		res.LastLoginAt = user.LastLoginAt.Format(time.RFC3339)
+	}
+	if !user.DeactivatedDate.IsZero() {
+		res.DeactivatedDate = user.DeactivatedDate.Format(time.RFC3339)
+	}
+
+	return res
+}
+
+// GetMe return the profile of the logged in user
+func (a *AuthApp) GetMe(ctx context.Context, userId string) (out UserOut) {
+	out.Response = resp.NewResponse(http.StatusOK, "", nil)
+
+	user, err := a.repository.GetUser(ctx, userId)
+	if errors.Is(err, ErrUserNotFound) {
+		out.Response = resp.NewResponse(http.StatusNotFound, "", err)
+		return
+	}
+	if err != nil {
+		out.Response = resp.NewResponse(http.StatusInternalServerError, "", err)
+		return
+	}
+
+	out.Res = userRes(user)
+
+	return
+}
+
+// UpdateProfileIn replace the whole profile, an empty field clear the stored one
+type UpdateProfileIn struct {
+	DisplayName string `json:"display_name"`
+	Email       string `json:"email"`
+	Phone       string `json:"phone"`
+}
+
+// phoneReplacer remove the separator people usually type in a phone number
+var phoneReplacer = strings.NewReplacer(" ", "", "-", "", "(", "", ")", "")
+
+func (a *AuthApp) UpdateProfile(ctx context.Context, userId string, in UpdateProfileIn) (out UserOut) {
+	out.Response = resp.NewResponse(http.StatusOK, "", nil)
+
+	in.DisplayName = strings.TrimSpace(in.DisplayName)
+	in.Email = strings.TrimSpace(in.Email)
+	in.Phone = phoneReplacer.Replace(in.Phone)
+	if err := validateUpdateProfile(in); err != nil {
+		out.Response = resp.NewResponse(http.StatusUnprocessableEntity, "", err)
+		return
+	}
+
+	user, err := a.repository.UpdateProfile(ctx, userId, UserProfile{
+		DisplayName: in.DisplayName,
+		Email:       in.Email,
+		Phone:       in.Phone,
+	})
+	if errors.Is(err, ErrUserNotFound) {
+		out.Response = resp.NewResponse(http.StatusNotFound, "", err)
+		return
+	}
+	if err != nil {
+		out.Response = resp.NewResponse(http.StatusInternalServerError, "", err)
+		return
+	}
+
+	out.Res = userRes(user)
+
+	return
+}
+
+type (
+	DeactivateAccountIn struct {
+		Password string `json:"password"`
+	}
+	DeactivateUserIn struct {
+		Username string `json:"username"`
+	}
+	DeactivateRes struct {
+		Id string `json:"id"`
+	}
+	DeactivateOut struct {
+		resp.Response
+		Res DeactivateRes
+	}
+)
+
+// DeactivateAccount let the user close its own account, the password is asked again
+// so a session left open on a shared device can not do it
+func (a *AuthApp) DeactivateAccount(ctx context.Context, userId string, in DeactivateAccountIn) (out DeactivateOut) {
+	out.Response = resp.NewResponse(http.StatusOK, "", nil)
+
+	if utf8.RuneCountInString(in.Password) == 0 {
+		out.Response = resp.NewResponse(http.StatusUnprocessableEntity, "", ErrPasswordRequired)
+		return
+	}
+
+	user, err := a.repository.GetUser(ctx, userId)
+	if errors.Is(err, ErrUserNotFound) {
+		out.Response = resp.NewResponse(http.StatusNotFound, "", err)
+		return
+	}
+	if err != nil {
+		out.Response = resp.NewResponse(http.StatusInternalServerError, "", err)
+		return
+	}
+
+	err = bcrypt.CompareHashAndPassword([]byte(user.Password), []byte(in.Password))
+	if errors.Is(err, bcrypt.ErrMismatchedHashAndPassword) {
+		out.Response = resp.NewResponse(http.StatusBadRequest, "", ErrAuthPwNotMatch)
+		return
+	}
+	if err != nil {
+		out.Response = resp.NewResponse(http.StatusInternalServerError, "", err)
+		return
+	}
+
+	out.Response = a.deactivate(ctx, user.Id)
+	if out.Error != nil {
+		return
+	}
+
+	out.Res = DeactivateRes{
+		Id: user.Id,
+	}
+
+	return
+}
+
+// DeactivateUser let an officer deactivate an applicant, only the admin can deactivate
+// another officer and no one can deactivate itself here
+func (a *AuthApp) DeactivateUser(ctx context.Context, userId string, in DeactivateUserIn) (out DeactivateOut) {
+	out.Response = resp.NewResponse(http.StatusOK, "", nil)
+
+	if utf8.RuneCountInString(in.Username) == 0 {
+		out.Response = resp.NewResponse(http.StatusUnprocessableEntity, "", ErrUsernameRequired)
+		return
+	}
+
+	officer, err := a.repository.GetUser(ctx, userId)
+	if errors.Is(err, ErrUserNotFound) {
+		out.Response = resp.NewResponse(http.StatusNotFound, "", err)
+		return
+	}
+	if err != nil {
+		out.Response = resp.NewResponse(http.StatusInternalServerError, "", err)
+		return
+	}
+
+	if !rbac.Can(officer.Role, rbac.UserDeactivate) {
+		out.Response = resp.NewResponse(http.StatusForbidden, "", ErrUserForbidden)
+		return
+	}
+
+	user, err := a.repository.GetUserByUsername(ctx, in.Username)
+	if errors.Is(err, ErrUserNotFound) {
+		out.Response = resp.NewResponse(http.StatusNotFound, "", err)
+		return
+	}
+	if err != nil {
+		out.Response = resp.NewResponse(http.StatusInternalServerError, "", err)
+		return
+	}
+
+	if user.Id == officer.Id {
+		out.Response = resp.NewResponse(http.StatusBadRequest, "", ErrDeactivateSelf)
+		return
+	}
+
+	if totpRequired(user.Role) && officer.Role != rbac.Admin.String() {
+		out.Response = resp.NewResponse(http.StatusForbidden, "", ErrUserForbidden)
+		return
+	}
+
+	out.Response = a.deactivate(ctx, user.Id)
+	if out.Error != nil {
+		return
+	}
+
+	out.Res = DeactivateRes{
+		Id: user.Id,
+	}
+
+	return
+}
+
+func (a *AuthApp) deactivate(ctx context.Context, userId string) resp.Response {
+	_, err := a.repository.DeactivateUser(ctx, userId)
+	if errors.Is(err, ErrUserNotFound) {
+		return resp.NewResponse(http.StatusNotFound, "", err)
+	}
+	if errors.Is(err, ErrUserDeactivated) {
+		return resp.NewResponse(http.StatusBadRequest, "", err)
+	}
+	if err != nil {
+		return resp.NewResponse(http.StatusInternalServerError, "", err)
+	}
+
+	return resp.NewResponse(http.StatusOK, "", nil)
+}
+
+type (
+	UsersQueryIn struct {
+		Query string
+		Role  string
+		// Status is either active or inactive, empty mean both
+		Status string
+		Limit  string
+		Offset string
+	}
+	UsersOut struct {
+		resp.Response
+		Res []UserRes
+	}
+)
+
+// GetUsers list and search the user for the officer, the newest come first
+func (a *AuthApp) GetUsers(ctx context.Context, userId string, in UsersQueryIn) (out UsersOut) {
+	out.Response = resp.NewResponse(http.StatusOK, "", nil)
+	out.Res = make([]UserRes, 0)
+
+	if res := a.authorize(ctx, userId, rbac.UserRead); res.Error != nil {
+		out.Response = res
+		return
+	}
+
+	filter, err := userFilter(in)
+	if err != nil {
+		out.Response = resp.NewResponse(http.StatusUnprocessableEntity, "", err)
+		return
+	}
+
+	users, err := a.repository.GetUsers(ctx, filter)
+	if err != nil {
+		out.Response = resp.NewResponse(http.StatusInternalServerError, "", err)
+		return
+	}
+
+	for _, v := range users {
+		out.Res = append(out.Res, userRes(v))
+	}
+
+	return
+}
+
+type (
+	ForgotPasswordIn struct {
+		Username string `json:"username"`
+		// Ip is set by the handler from the request, it is not read from the body
+		Ip string `json:"-"`
+	}
+	ForgotPasswordOut struct {
+		resp.Response
+		// RetryAfter is how many seconds the client must wait when the request is throttled
+		RetryAfter int64
+	}
+)
+
+// ForgotPassword send a single use reset token through the notifier, the response
+// is the same whether the user exist or not so it can not be used to find a username
+func (a *AuthApp) ForgotPassword(ctx context.Context, in ForgotPasswordIn) (out ForgotPasswordOut) {
+	out.Response = resp.NewResponse(http.StatusOK, "if the user exist the reset token has been sent", nil)
+
+	if utf8.RuneCountInString(in.Username) == 0 {
+		out.Response = resp.NewResponse(http.StatusUnprocessableEntity, "", ErrUsernameRequired)
+		return
+	}
+
+	// Every request send a mail, so it is counted whether the user exist or not
+	// so the throttle does not tell either, on its own keys so the request can not
+	// lock the user out of the login and the login does not clear the request count
+	keys := []string{"reset:user:" + strings.ToLower(in.Username)}
+	if in.Ip != "" {
+		keys = append(keys, "reset:ip:"+in.Ip)
+	}
+	if wait := a.loginWait(keys); wait > 0 {
+		out.Response = resp.NewResponse(http.StatusTooManyRequests, "", ErrTooManyResetRequest)
+		out.RetryAfter = int64(math.Ceil(wait.Seconds()))
+		return
+	}
+	for _, k := range keys {
+		a.throttle.Fail(k)
+	}
+
+	user, err := a.repository.GetUserByUsername(ctx, in.Username)
+	if errors.Is(err, ErrUserNotFound) {
+		return
+	}
+	if err != nil {
+		out.Response = resp.NewResponse(http.StatusInternalServerError, "", err)
+		return
+	}
+
+	// A deactivated user get the same answer as the one that does not exist
+	if !user.IsActive() {
+		return
+	}
+
+	token, err := session.NewToken()
+	if err != nil {
+		out.Response = resp.NewResponse(http.StatusInternalServerError, "", err)
+		return
+	}
+
+	reset := model.PasswordReset{
+		Id:          session.KeyId(token),
+		TokenHash:   session.KeyHash(token),
+		UserId:      user.Id,
+		ExpiredDate: time.Now().Add(passwordResetTTL),
+	}
+
+	if _, err = a.repository.InsertPasswordReset(ctx, reset); err != nil {
+		out.Response = resp.NewResponse(http.StatusInternalServerError, "", err)
+		return
+	}
+
+	err = a.notifier.Notify(ctx, notify.Message{
+		To:      user.Username,
+		Subject: "Password reset",
+		Body:    "Use this token to reset your password, it expire in " + passwordResetTTL.String() + ": " + token,
+	})
+	if err != nil {
+		out.Response = resp.NewResponse(http.StatusInternalServerError, "", err)
+		return
+	}
+
+	return
+}
+
+type (
+	ResetPasswordIn struct {
+		Token    string `json:"token"`
+		Password string `json:"password"`
+	}
+	ResetPasswordRes struct {
+		Id string `json:"id"`
+	}
+	ResetPasswordOut struct {
+		resp.Response
+		Res ResetPasswordRes
+	}
+)
+
+func (a *AuthApp) ResetPassword(ctx context.Context, in ResetPasswordIn) (out ResetPasswordOut) {
+	out.Response = resp.NewResponse(http.StatusOK, "", nil)
+
+	if err := validateResetPassword(in); err != nil {
+		out.Response = resp.NewResponse(http.StatusUnprocessableEntity, "", err)
+		return
+	}
+
+	if err := a.policy.Validate(in.Password); err != nil {
+		out.Response = resp.NewResponse(http.StatusUnprocessableEntity, "", err)
+		return
+	}
+
+	reset, err := a.repository.GetPasswordResetByTokenHash(ctx, session.KeyHash(in.Token))
+	if errors.Is(err, ErrResetNotFound) {
+		out.Response = resp.NewResponse(http.StatusNotFound, "", err)
+		return
+	}
+	if err != nil {
+		out.Response = resp.NewResponse(http.StatusInternalServerError, "", err)
+		return
+	}
+
+	if reset.IsUsed {
+		out.Response = resp.NewResponse(http.StatusBadRequest, "", ErrResetUsed)
+		return
+	}
+
+	if !reset.ExpiredDate.After(time.Now()) {
+		out.Response = resp.NewResponse(http.StatusBadRequest, "", ErrResetExpired)
+		return
+	}
+
+	hashed, err := bcrypt.GenerateFromPassword([]byte(in.Password), bcrypt.DefaultCost)
+	if err != nil {
+		out.Response = resp.NewResponse(http.StatusInternalServerError, "", err)
+		return
+	}
+
+	err = a.repository.ResetPassword(ctx, reset.Id, string(hashed))
+	if errors.Is(err, ErrResetUsed) {
+		out.Response = resp.NewResponse(http.StatusBadRequest, "", err)
+		return
+	}
+	if err != nil {
+		out.Response = resp.NewResponse(http.StatusInternalServerError, "", err)
+		return
+	}
+
+	out.Res = ResetPasswordRes{
+		Id: reset.UserId,
+	}
+
+	return
+}
+
+type (
+	UnlockUserIn struct {
+		Username string `json:"username"`
+	}
+	UnlockUserRes struct {
+		Id string `json:"id"`
+	}
+	UnlockUserOut struct {
+		resp.Response
+		Res UnlockUserRes
+	}
+)
+
+// UnlockUser clear the failed login of the username so it can log in right away,
+// the failure counted by the address is kept
+func (a *AuthApp) UnlockUser(ctx context.Context, userId string, in UnlockUserIn) (out UnlockUserOut) {
+	out.Response = resp.NewResponse(http.StatusOK, "", nil)
+
+	if utf8.RuneCountInString(in.Username) == 0 {
+		out.Response = resp.NewResponse(http.StatusUnprocessableEntity, "", ErrUsernameRequired)
+		return
+	}
+
+	officer, err := a.repository.GetUser(ctx, userId)
+	if errors.Is(err, ErrUserNotFound) {
+		out.Response = resp.NewResponse(http.StatusNotFound, "", err)
+		return
+	}
+	if err != nil {
+		out.Response = resp.NewResponse(http.StatusInternalServerError, "", err)
+		return
+	}
+
+	if !rbac.Can(officer.Role, rbac.UserUnlock) {
+		out.Response = resp.NewResponse(http.StatusForbidden, "", ErrUserForbidden)
+		return
+	}
+
+	user, err := a.repository.GetUserByUsername(ctx, in.Username)
+	if errors.Is(err, ErrUserNotFound) {
+		out.Response = resp.NewResponse(http.StatusNotFound, "", err)
+		return
+	}
+	if err != nil {
+		out.Response = resp.NewResponse(http.StatusInternalServerError, "", err)
+		return
+	}
+
+	a.throttle.Reset("user:" + strings.ToLower(user.Username))
+
+	out.Res = UnlockUserRes{
+		Id: user.Id,
+	}
+
+	return
+}
+
+type (
+	ActivityQueryIn struct {
+		UserId   string
+		Username string
+		// Status is either success or failure, empty mean both
+		Status string
+		From   string
+		To     string
+		Limit  string
+	}
+	ActivityRes struct {
+		IsSuccess   bool   `json:"is_success"`
+		Id          string `json:"id"`
+		UserId      string `json:"user_id"`
+		Username    string `json:"username"`
+		Reason      string `json:"reason"`
+		Ip          string `json:"ip"`
+		UserAgent   string `json:"user_agent"`
+		CreatedDate string `json:"created_date"`
+	}
+	ActivityOut struct {
+		resp.Response
+		Res []ActivityRes
+	}
+)
+
+// GetOwnActivity return the recent login attempt to the account of the user,
+// only the limit of the query is used
+func (a *AuthApp) GetOwnActivity(ctx context.Context, userId string, in ActivityQueryIn) (out ActivityOut) {
+	out.Response = resp.NewResponse(http.StatusOK, "", nil)
+	out.Res = make([]ActivityRes, 0)
+
+	filter, err := activityFilter(ActivityQueryIn{Limit: in.Limit})
+	if err != nil {
+		out.Response = resp.NewResponse(http.StatusUnprocessableEntity, "", err)
+		return
+	}
+	filter.UserId = userId
+
+	acts, err := a.repository.GetLoginActivities(ctx, filter)
+	if err != nil {
+		out.Response = resp.NewResponse(http.StatusInternalServerError, "", err)
+		return
+	}
+
+	out.Res = activityRes(acts)
+
+	return
+}
+
+// GetActivity return the login attempt of every user that match the query
+func (a *AuthApp) GetActivity(ctx context.Context, userId string, in ActivityQueryIn) (out ActivityOut) {
+	out.Response = resp.NewResponse(http.StatusOK, "", nil)
+	out.Res = make([]ActivityRes, 0)
+
+	user, err := a.repository.GetUser(ctx, userId)
+	if errors.Is(err, ErrUserNotFound) {
+		out.Response = resp.NewResponse(http.StatusNotFound, "", err)
+		return
+	}
+	if err != nil {
+		out.Response = resp.NewResponse(http.StatusInternalServerError, "", err)
+		return
+	}
+
+	if !rbac.Can(user.Role, rbac.ActivityRead) {
+		out.Response = resp.NewResponse(http.StatusForbidden, "", ErrUserForbidden)
+		return
+	}
+
+	filter, err := activityFilter(in)
+	if err != nil {
+		out.Response = resp.NewResponse(http.StatusUnprocessableEntity, "", err)
+		return
+	}
+
+	acts, err := a.repository.GetLoginActivities(ctx, filter)
+	if err != nil {
+		out.Response = resp.NewResponse(http.StatusInternalServerError, "", err)
+		return
+	}
+
+	out.Res = activityRes(acts)
+
+	return
+}
+
+func activityRes(acts []model.LoginActivity) []ActivityRes {
+	res := make([]ActivityRes, 0, len(acts))
+	for _, v := range acts {
+		res = append(res, ActivityRes{
+			IsSuccess:   v.IsSuccess,
+			Id:          v.Id,
+			UserId:      v.UserId,
+			Username:    v.Username,
+			Reason:      v.Reason,
+			Ip:          v.Ip,
+			UserAgent:   v.UserAgent,
+			CreatedDate: v.CreatedDate.Format(time.RFC3339),
+		})
+	}
+
+	return res
+}
+
+type LoginTotpIn struct {
+	ChallengeToken string `json:"challenge_token"`
+	// Either the Code of the authenticator app or one of the RecoveryCode is verified
+	Code         string `json:"code"`
+	RecoveryCode string `json:"recovery_code"`
+	// Cookie is the same as LoginIn.Cookie
+	Cookie bool `json:"cookie"`
+	// Ip and UserAgent are set by the handler from the request, they are not read from the body
+	Ip        string `json:"-"`
+	UserAgent string `json:"-"`
+}
+
+// LoginTotp is the second step of the login of the user that require TOTP,
+// the code verified for the user that has not enrolled yet enable the TOTP
+func (a *AuthApp) LoginTotp(ctx context.Context, in LoginTotpIn) (out LoginOut) {
+	out.Response = resp.NewResponse(http.StatusOK, "", nil)
+
+	if err := validateLoginTotp(in); err != nil {
+		out.Response = resp.NewResponse(http.StatusUnprocessableEntity, "", err)
+		return
+	}
+
+	ch, err := a.repository.GetLoginChallengeByTokenHash(ctx, session.KeyHash(in.ChallengeToken))
+	if errors.Is(err, ErrChallengeNotFound) {
+		out.Response = resp.NewResponse(http.StatusUnauthorized, "", ErrChallengeNotValid)
+		return
+	}
+	if err != nil {
+		out.Response = resp.NewResponse(http.StatusInternalServerError, "", err)
+		return
+	}
+
+	if ch.IsUsed || time.Now().After(ch.ExpiredDate) {
+		out.Response = resp.NewResponse(http.StatusUnauthorized, "", ErrChallengeNotValid)
+		return
+	}
+
+	user, err := a.repository.GetUser(ctx, ch.UserId)
+	if err != nil {
+		out.Response = resp.NewResponse(http.StatusInternalServerError, "", err)
+		return
+	}
+
+	// The account may be deactivated between the password and the code
+	if !user.IsActive() {
+		out.Response = resp.NewResponse(http.StatusForbidden, "", ErrAccountDeactivated)
+		return
+	}
+
+	loginIn := LoginIn{Username: user.Username, Ip: in.Ip, UserAgent: in.UserAgent}
+	keys := []string{"user:" + strings.ToLower(user.Username)}
+	if in.Ip != "" {
+		keys = append(keys, "ip:"+in.Ip)
+	}
+
+	if wait := a.loginWait(keys); wait > 0 {
+		if err := a.recordLogin(ctx, loginIn, user.Id, false, loginReasonTooManyAttempt); err != nil {
+			out.Response = resp.NewResponse(http.StatusInternalServerError, "", err)
+			return
+		}
+
+		out.Response = resp.NewResponse(http.StatusTooManyRequests, "", ErrTooManyLoginAttempt)
+		out.Res.RetryAfter = int64(math.Ceil(wait.Seconds()))
+		return
+	}
+
+	t, err := a.repository.GetUserTotp(ctx, user.Id)
+	if errors.Is(err, ErrTotpNotFound) {
+		out.Response = resp.NewResponse(http.StatusUnauthorized, "", ErrChallengeNotValid)
+		return
+	}
+	if err != nil {
+		out.Response = resp.NewResponse(http.StatusInternalServerError, "", err)
+		return
+	}
+
+	recoveryCodes, ok, err := a.verifyTotp(ctx, t, in)
+	if err != nil {
+		out.Response = resp.NewResponse(http.StatusInternalServerError, "", err)
+		return
+	}
+
+	if !ok {
+		if err := a.repository.FailLoginChallenge(ctx, ch.Id, maxChallengeAttempts); err != nil {
+			out.Response = resp.NewResponse(http.StatusInternalServerError, "", err)
+			return
+		}
+		for _, k := range keys {
+			a.throttle.Fail(k)
+		}
+		if err := a.recordLogin(ctx, loginIn, user.Id, false, loginReasonInvalidTotp); err != nil {
+			out.Response = resp.NewResponse(http.StatusInternalServerError, "", err)
+			return
+		}
+
+		out.Response = resp.NewResponse(http.StatusUnauthorized, "", ErrTotpNotValid)
+		return
+	}
+
+	err = a.repository.UseLoginChallenge(ctx, ch.Id)
+	if errors.Is(err, ErrChallengeUsed) {
+		out.Response = resp.NewResponse(http.StatusUnauthorized, "", ErrChallengeNotValid)
+		return
+	}
+	if err != nil {
+		out.Response = resp.NewResponse(http.StatusInternalServerError, "", err)
+		return
+	}
+
+	out.Response = a.loginSucceed(ctx, loginIn, keys[0], user)
+	if out.Error != nil {
+		return
+	}
+
+	out.Res = loginRes(user)
+	out.Res.RecoveryCodes = recoveryCodes
+
+	return
+}
+
+// verifyTotp check the code or the recovery code of the input, a verified code enable
+// the TOTP that is not enabled yet and return the new recovery codes of the user
+func (a *AuthApp) verifyTotp(ctx context.Context, t model.UserTotp, in LoginTotpIn) ([]string, bool, error) {
+	if in.Code == "" {
+		if !t.IsEnabled {
+			return nil, false, nil
+		}
+
+		err := a.repository.UseRecoveryCode(ctx, t.UserId, recoveryCodeHash(in.RecoveryCode))
+		if errors.Is(err, ErrRecoveryNotFound) {
+			return nil, false, nil
+		}
+
+		return nil, err == nil, err
+	}
+
+	counter, ok := totp.Validate(t.Secret, in.Code, time.Now(), totpSkew)
+	if !ok {
+		return nil, false, nil
+	}
+
+	if t.IsEnabled {
+		err := a.repository.UseTotp(ctx, t.UserId, counter)
+		if errors.Is(err, ErrTotpReplayed) {
+			return nil, false, nil
+		}
+
+		return nil, err == nil, err
+	}
+
+	codes, recoveries, err := newRecoveryCodes()
+	if err != nil {
+		return nil, false, err
+	}
+
+	err = a.repository.EnableTotp(ctx, t.UserId, counter, recoveries)
+	if errors.Is(err, ErrTotpEnabled) {
+		return nil, false, nil
+	}
+	if err != nil {
+		return nil, false, err
+	}
+
+	return codes, true, nil
+}
+
+// newRecoveryCodes return the recovery codes to be shown once to the user
+// and the hashed one to be stored
+func newRecoveryCodes() ([]string, []model.RecoveryCode, error) {
+	codes := make([]string, 0, recoveryCodeCount)
+	recoveries := make([]model.RecoveryCode, 0, recoveryCodeCount)
+	for i := 0; i < recoveryCodeCount; i++ {
+		token, err := session.NewToken()
+		if err != nil {
+			return nil, nil, err
+		}
+
+		code := token[:5] + "-" + token[5:10]
+		codes = append(codes, code)
+		recoveries = append(recoveries, model.RecoveryCode{
+			Id:       session.KeyId(token),
+			CodeHash: recoveryCodeHash(code),
+		})
+	}
+
+	return codes, recoveries, nil
+}
+
+// recoveryCodeHash normalize the code typed by the user before hashing it,
+// so the dash and the letter case do not matter
+func recoveryCodeHash(code string) string {
+	code = strings.ToLower(strings.ReplaceAll(strings.TrimSpace(code), "-", ""))
+	return session.KeyHash(code)
+}
+
+type (
+	RecoveryCodesIn struct {
+		Code string `json:"code"`
+	}
+	RecoveryCodesRes struct {
+		RecoveryCodes []string `json:"recovery_codes"`
+	}
+	RecoveryCodesOut struct {
+		resp.Response
+		Res RecoveryCodesRes
+	}
+)
+
+// RegenerateRecoveryCodes replace every recovery code of the user,
+// the current TOTP code is required so a stolen session alone can not do it
+func (a *AuthApp) RegenerateRecoveryCodes(ctx context.Context, userId string, in RecoveryCodesIn) (out RecoveryCodesOut) {
+	out.Response = resp.NewResponse(http.StatusOK, "", nil)
+
+	if utf8.RuneCountInString(in.Code) == 0 {
+		out.Response = resp.NewResponse(http.StatusUnprocessableEntity, "", ErrTotpCodeRequired)
+		return
+	}
+
+	t, err := a.repository.GetUserTotp(ctx, userId)
+	if err != nil && !errors.Is(err, ErrTotpNotFound) {
+		out.Response = resp.NewResponse(http.StatusInternalServerError, "", err)
+		return
+	}
+
+	if !t.IsEnabled {
+		out.Response = resp.NewResponse(http.StatusBadRequest, "", ErrTotpNotEnabled)
+		return
+	}
+
+	counter, ok := totp.Validate(t.Secret, in.Code, time.Now(), totpSkew)
+	if ok {
+		err = a.repository.UseTotp(ctx, userId, counter)
+		if errors.Is(err, ErrTotpReplayed) {
+			ok = false
+		} else if err != nil {
+			out.Response = resp.NewResponse(http.StatusInternalServerError, "", err)
+			return
+		}
+	}
+
+	if !ok {
+		out.Response = resp.NewResponse(http.StatusBadRequest, "", ErrTotpNotValid)
+		return
+	}
+
+	codes, recoveries, err := newRecoveryCodes()
+	if err != nil {
+		out.Response = resp.NewResponse(http.StatusInternalServerError, "", err)
+		return
+	}
+
+	if err = a.repository.ReplaceRecoveryCodes(ctx, userId, recoveries); err != nil {
+		out.Response = resp.NewResponse(http.StatusInternalServerError, "", err)
+		return
+	}
+
+	out.Res = RecoveryCodesRes{
+		RecoveryCodes: codes,
+	}
+
+	return
+}
+
+type (
+	ResetTotpIn struct {
+		Username string `json:"username"`
+	}
+	ResetTotpRes struct {
+		Id string `json:"id"`
+	}
+	ResetTotpOut struct {
+		resp.Response
+		Res ResetTotpRes
+	}
+)
+
+// ResetTotp remove the TOTP of the user that lost the authenticator app and the recovery codes,
+// the user enroll again on the next login
+func (a *AuthApp) ResetTotp(ctx context.Context, userId string, in ResetTotpIn) (out ResetTotpOut) {
+	out.Response = resp.NewResponse(http.StatusOK, "", nil)
+
+	if utf8.RuneCountInString(in.Username) == 0 {
+		out.Response = resp.NewResponse(http.StatusUnprocessableEntity, "", ErrUsernameRequired)
+		return
+	}
+
+	admin, err := a.repository.GetUser(ctx, userId)
+	if errors.Is(err, ErrUserNotFound) {
+		out.Response = resp.NewResponse(http.StatusNotFound, "", err)
+		return
+	}
+	if err != nil {
+		out.Response = resp.NewResponse(http.StatusInternalServerError, "", err)
+		return
+	}
+
+	if !rbac.Can(admin.Role, rbac.UserTotpReset) {
+		out.Response = resp.NewResponse(http.StatusForbidden, "", ErrUserForbidden)
+		return
+	}
+
+	user, err := a.repository.GetUserByUsername(ctx, in.Username)
+	if errors.Is(err, ErrUserNotFound) {
+		out.Response = resp.NewResponse(http.StatusNotFound, "", err)
+		return
+	}
+	if err != nil {
+		out.Response = resp.NewResponse(http.StatusInternalServerError, "", err)
+		return
+	}
+
+	err = a.repository.DeleteUserTotp(ctx, user.Id)
+	if errors.Is(err, ErrTotpNotFound) {
+		out.Response = resp.NewResponse(http.StatusNotFound, "", err)
+		return
+	}
+	if err != nil {
+		out.Response = resp.NewResponse(http.StatusInternalServerError, "", err)
+		return
+	}
+
+	out.Res = ResetTotpRes{
+		Id: user.Id,
+	}
+
+	return
+}
+
+// SessionRole is the session.UserLookup of the signed token, it refuse to refresh
+// the user that is gone or deactivated and give the current role of the others
+func (a *AuthApp) SessionRole(ctx context.Context, userId string) (string, error) {
+	user, err := a.repository.GetUser(ctx, userId)
+	if errors.Is(err, ErrUserNotFound) {
+		return "", session.ErrRefreshNotFound
+	}
+	if err != nil {
+		return "", err
+	}
+
+	if !user.IsActive() {
+		return "", session.ErrRefreshNotFound
+	}
+
+	return user.Role, nil
+}
+
+// authorize check the user has the permission, the returned response
+// carry the error when the user is not found or not allowed
+func (a *AuthApp) authorize(ctx context.Context, userId string, p rbac.Permission) resp.Response {
+	user, err := a.repository.GetUser(ctx, userId)
+	if errors.Is(err, ErrUserNotFound) {
+		return resp.NewResponse(http.StatusNotFound, "", err)
+	}
+	if err != nil {
+		return resp.NewResponse(http.StatusInternalServerError, "", err)
+	}
+
+	if !rbac.Can(user.Role, p) {
+		return resp.NewResponse(http.StatusForbidden, "", ErrUserForbidden)
+	}
+
+	return resp.NewResponse(http.StatusOK, "", nil)
+}
+
+type (
+	CreateApiKeyIn struct {
+		Name   string   `json:"name"`
+		Scopes []string `json:"scopes"`
+		// ExpiresIn is how many seconds the key can be used, 0 mean it never expire
+		ExpiresIn int64 `json:"expires_in"`
+	}
+	ApiKeyRes struct {
+		IsRevoked bool   `json:"is_revoked"`
+		Id        string `json:"id"`
+		Name      string `json:"name"`
+		Prefix    string `json:"prefix"`
+		// Key is only returned when the key is created or rotated
+		Key          string   `json:"key"`
+		Scopes       []string `json:"scopes"`
+		CreatedDate  string   `json:"created_date"`
+		ExpiredDate  string   `json:"expired_date"`
+		LastUsedDate string   `json:"last_used_date"`
+	}
+	ApiKeyOut struct {
+		resp.Response
+		Res ApiKeyRes
+	}
+)
+
+func apiKeyRes(key model.ApiKey) ApiKeyRes {
+	res := ApiKeyRes{
+		IsRevoked:   key.IsRevoked,
+		Id:          key.Id,
+		Name:        key.Name,
+		Prefix:      key.Prefix,
+		Scopes:      key.Scopes,
+		CreatedDate: key.CreatedDate.Format(time.RFC3339),
+	}
+	if !key.ExpiredDate.IsZero() {
+		res.ExpiredDate = key.ExpiredDate.Format(time.RFC3339)
+	}
+	if !key.LastUsedDate.IsZero() {
+		res.LastUsedDate = key.LastUsedDate.Format(time.RFC3339)
+	}
+
+	return res
+}
+
+// newApiKey return the key to be shown once and the prefix and hash to be stored
+func newApiKey() (string, string, string, error) {
+	token, err := session.NewToken()
+	if err != nil {
+		return "", "", "", err
+	}
+
+	key := ApiKeyPrefix + token
+	return key, key[:len(ApiKeyPrefix)+8], session.KeyHash(key), nil
+}
+
+func (a *AuthApp) CreateApiKey(ctx context.Context, userId string, in CreateApiKeyIn) (out ApiKeyOut) {
+	out.Response = resp.NewResponse(http.StatusCreated, "", nil)
+
+	if err := validateCreateApiKey(in); err != nil {
+		out.Response = resp.NewResponse(http.StatusUnprocessableEntity, "", err)
+		return
+	}
+
+	if res := a.authorize(ctx, userId, rbac.ApiKeyManage); res.Error != nil {
+		out.Response = res
+		return
+	}
+
+	key, prefix, keyHash, err := newApiKey()
+	if err != nil {
+		out.Response = resp.NewResponse(http.StatusInternalServerError, "", err)
+		return
+	}
+
+	apiKey := model.ApiKey{
+		Id:      session.KeyId(key),
+		Name:    in.Name,
+		Prefix:  prefix,
+		KeyHash: keyHash,
+		UserId:  userId,
+		Scopes:  in.Scopes,
+	}
+	if in.ExpiresIn > 0 {
+		apiKey.ExpiredDate = time.Now().Add(time.Duration(in.ExpiresIn) * time.Second)
+	}
+
+	if apiKey, err = a.repository.InsertApiKey(ctx, apiKey); err != nil {
+		out.Response = resp.NewResponse(http.StatusInternalServerError, "", err)
+		return
+	}
+
+	out.Res = apiKeyRes(apiKey)
+	out.Res.Key = key
+
+	return
+}
+
+type ApiKeysOut struct {
+	resp.Response
+	Res []ApiKeyRes
+}
+
+func (a *AuthApp) GetApiKeys(ctx context.Context, userId string) (out ApiKeysOut) {
+	out.Response = resp.NewResponse(http.StatusOK, "", nil)
+	out.Res = make([]ApiKeyRes, 0)
+
+	if res := a.authorize(ctx, userId, rbac.ApiKeyManage); res.Error != nil {
+		out.Response = res
+		return
+	}
+
+	keys, err := a.repository.GetApiKeys(ctx)
+	if err != nil {
+		out.Response = resp.NewResponse(http.StatusInternalServerError, "", err)
+		return
+	}
+
+	for _, v := range keys {
+		out.Res = append(out.Res, apiKeyRes(v))
+	}
+
+	return
+}
+
+// RotateApiKey give the API key a new key while keeping its id, name and scopes
+func (a *AuthApp) RotateApiKey(ctx context.Context, userId, id string) (out ApiKeyOut) {
+	out.Response = resp.NewResponse(http.StatusOK, "", nil)
+
+	if res := a.authorize(ctx, userId, rbac.ApiKeyManage); res.Error != nil {
+		out.Response = res
+		return
+	}
+
+	key, prefix, keyHash, err := newApiKey()
+	if err != nil {
+		out.Response = resp.NewResponse(http.StatusInternalServerError, "", err)
+		return
+	}
+
+	apiKey, err := a.repository.RotateApiKey(ctx, id, prefix, keyHash)
+	if errors.Is(err, ErrApiKeyNotFound) {
+		out.Response = resp.NewResponse(http.StatusNotFound, "", err)
+		return
+	}
+	if err != nil {
+		out.Response = resp.NewResponse(http.StatusInternalServerError, "", err)
+		return
+	}
+
+	out.Res = apiKeyRes(apiKey)
+	out.Res.Key = key
+
+	return
+}
+
+func (a *AuthApp) RevokeApiKey(ctx context.Context, userId, id string) (out ApiKeyOut) {
+	out.Response = resp.NewResponse(http.StatusOK, "", nil)
+
+	if res := a.authorize(ctx, userId, rbac.ApiKeyManage); res.Error != nil {
+		out.Response = res
+		return
+	}
+
+	err := a.repository.RevokeApiKey(ctx, id)
+	if errors.Is(err, ErrApiKeyNotFound) {
+		out.Response = resp.NewResponse(http.StatusNotFound, "", err)
+		return
+	}
+	if err != nil {
+		out.Response = resp.NewResponse(http.StatusInternalServerError, "", err)
+		return
+	}
+
+	out.Res = ApiKeyRes{
+		IsRevoked: true,
+		Id:        id,
+	}
+
+	return
+}
+
+// AuthenticateApiKey return the session of the owner of the API key limited to the key scopes,
+// the role is read on every request so a change of the owner role apply right away
+func (a *AuthApp) AuthenticateApiKey(ctx context.Context, key string) (session.SessionObj, error) {
+	apiKey, err := a.repository.GetApiKeyByKeyHash(ctx, session.KeyHash(key))
+	if errors.Is(err, ErrApiKeyNotFound) {
+		return session.SessionObj{}, ErrApiKeyNotValid
+	}
+	if err != nil {
+		return session.SessionObj{}, err
+	}
+
+	now := time.Now()
+	if apiKey.IsRevoked || (!apiKey.ExpiredDate.IsZero() && now.After(apiKey.ExpiredDate)) {
+		return session.SessionObj{}, ErrApiKeyNotValid
+	}
+
+	user, err := a.repository.GetUser(ctx, apiKey.UserId)
+	if errors.Is(err, ErrUserNotFound) {
+		return session.SessionObj{}, ErrApiKeyNotValid
+	}
+	if err != nil {
+		return session.SessionObj{}, err
+	}
+	if !user.IsActive() {
+		return session.SessionObj{}, ErrApiKeyNotValid
+	}
+
+	if now.Sub(apiKey.LastUsedDate) >= apiKeyUseInterval {
+		if err := a.repository.UseApiKey(ctx, apiKey.Id, now); err != nil {
+			return session.SessionObj{}, err
+		}
+	}
+
+	sess := session.SessionObj{
+		Id:       apiKey.Id,
+		UserId:   user.Id,
+		Role:     user.Role,
+		ApiKeyId: apiKey.Id,
+		Scopes:   apiKey.Scopes,
+		Created:  apiKey.CreatedDate.Unix(),
+	}
+	if !apiKey.ExpiredDate.IsZero() {
+		sess.Expired = apiKey.ExpiredDate.Unix()
+	}
+
+	return sess, nil
+}
+
+type (
+	OidcStartRes struct {
+		AuthUrl string `json:"auth_url"`
+	}
+	OidcStartOut struct {
+		resp.Response
+		Res OidcStartRes
+	}
+)
+
+// StartOidcLogin return the URL of the OpenID provider the user log in at, the state, nonce
+// and PKCE verifier are kept until the provider send the user back to the callback
+func (a *AuthApp) StartOidcLogin(ctx context.Context) (out OidcStartOut) {
+	out.Response = resp.NewResponse(http.StatusOK, "", nil)
+
+	if a.idp == nil {
+		out.Response = resp.NewResponse(http.StatusNotImplemented, "", ErrOidcNotConfigured)
+		return
+	}
+
+	state, err := session.NewToken()
+	if err != nil {
+		out.Response = resp.NewResponse(http.StatusInternalServerError, "", err)
+		return
+	}
+	nonce, err := session.NewToken()
+	if err != nil {
+		out.Response = resp.NewResponse(http.StatusInternalServerError, "", err)
+		return
+	}
+	verifier, err := oidc.NewVerifier()
+	if err != nil {
+		out.Response = resp.NewResponse(http.StatusInternalServerError, "", err)
+		return
+	}
+
+	_, err = a.repository.InsertOidcState(ctx, model.OidcState{
+		Id:           session.KeyId(state),
+		StateHash:    session.KeyHash(state),
+		Nonce:        nonce,
+		CodeVerifier: verifier,
+		ExpiredDate:  time.Now().Add(oidcStateTTL),
+	})
+	if err != nil {
+		out.Response = resp.NewResponse(http.StatusInternalServerError, "", err)
+		return
+	}
+
+	out.Res = OidcStartRes{
+		AuthUrl: a.idp.AuthCodeURL(state, nonce, verifier),
+	}
+
+	return
+}
+
+type OidcCallbackIn struct {
+	Code  string
+	State string
+	// Error is set by the provider when the user did not log in
+	Error     string
+	Ip        string
+	UserAgent string
+}
+
+// OidcCallback finish the login the OpenID provider sent the user back from, the subject is linked
+// to a new user on its first login and the role is taken from the claims on every login.
+// The TOTP of the application is not asked since the provider has its own second factor
+func (a *AuthApp) OidcCallback(ctx context.Context, in OidcCallbackIn) (out LoginOut) {
+	out.Response = resp.NewResponse(http.StatusOK, "", nil)
+
+	if a.idp == nil {
+		out.Response = resp.NewResponse(http.StatusNotImplemented, "", ErrOidcNotConfigured)
+		return
+	}
+
+	if in.Error != "" {
+		out.Response = resp.NewResponse(http.StatusUnauthorized, "", ErrOidcLoginFailed)
+		return
+	}
+
+	if utf8.RuneCountInString(in.Code) == 0 || utf8.RuneCountInString(in.State) == 0 {
+		out.Response = resp.NewResponse(http.StatusUnprocessableEntity, "", ErrOidcCodeRequired)
+		return
+	}
+
+	st, err := a.repository.UseOidcState(ctx, session.KeyHash(in.State))
+	if errors.Is(err, ErrOidcStateNotFound) || errors.Is(err, ErrOidcStateUsed) {
+		out.Response = resp.NewResponse(http.StatusUnauthorized, "", ErrOidcStateNotValid)
+		return
+	}
+	if err != nil {
+		out.Response = resp.NewResponse(http.StatusInternalServerError, "", err)
+		return
+	}
+
+	if time.Now().After(st.ExpiredDate) {
+		out.Response = resp.NewResponse(http.StatusUnauthorized, "", ErrOidcStateNotValid)
+		return
+	}
+
+	claims, err := a.idp.Exchange(ctx, in.Code, st.CodeVerifier, st.Nonce)
+	if errors.Is(err, oidc.ErrExchangeFailed) || errors.Is(err, oidc.ErrTokenNotValid) {
+		out.Response = resp.NewResponse(http.StatusUnauthorized, "", ErrOidcLoginFailed)
+		return
+	}
+	if err != nil {
+		out.Response = resp.NewResponse(http.StatusInternalServerError, "", err)
+		return
+	}
+
+	role, ok := oidcRole(claims.Roles, a.idp.AllowedRoles())
+	if !ok {
+		out.Response = resp.NewResponse(http.StatusForbidden, "", ErrOidcRoleNotValid)
+		return
+	}
+
+	user, roleChanged, err := a.identityUser(ctx, claims, role)
+	if errors.Is(err, ErrDuplicateContraint) {
+		out.Response = resp.NewResponse(http.StatusBadRequest, "", ErrUsernameExist)
+		return
+	}
+	if err != nil {
+		out.Response = resp.NewResponse(http.StatusInternalServerError, "", err)
+		return
+	}
+
+	loginIn := LoginIn{Username: user.Username, Ip: in.Ip, UserAgent: in.UserAgent}
+	if !user.IsActive() {
+		if err := a.recordLogin(ctx, loginIn, user.Id, false, loginReasonDeactivated); err != nil {
+			out.Response = resp.NewResponse(http.StatusInternalServerError, "", err)
+			return
+		}
+
+		out.Response = resp.NewResponse(http.StatusForbidden, "", ErrAccountDeactivated)
+		return
+	}
+
+	if err := a.recordLogin(ctx, loginIn, user.Id, true, ""); err != nil {
+		out.Response = resp.NewResponse(http.StatusInternalServerError, "", err)
+		return
+	}
+
+	out.Res = loginRes(user)
+	out.Res.RoleChanged = roleChanged
+
+	return
+}
+
+// identityUser return the user linked to the subject, creating it on the first login,
+// and keep its role the same as the one granted by the provider, telling whether it changed
+func (a *AuthApp) identityUser(ctx context.Context, claims oidc.Claims, role string) (model.User, bool, error) {
+	identity, err := a.repository.GetUserIdentity(ctx, claims.Issuer, claims.Subject)
+	if err != nil && !errors.Is(err, ErrIdentityNotFound) {
+		return model.User{}, false, err
+	}
+
+	if err == nil {
+		user, err := a.repository.GetUser(ctx, identity.UserId)
+		if err != nil {
+			return model.User{}, false, err
+		}
+
+		if user.Role == role {
+			return user, false, nil
+		}
+
+		if err := a.repository.UpdateRole(ctx, user.Id, role); err != nil {
+			return model.User{}, false, err
+		}
+		user.Role = role
+
+		return user, true, nil
+	}
+
+	// The user never log in with the password, the random one only keep
+	// the password login of the user behave like any other
+	password, err := session.NewToken()
+	if err != nil {
+		return model.User{}, false, err
+	}
+	hashed, err := bcrypt.GenerateFromPassword([]byte(password), bcrypt.DefaultCost)
+	if err != nil {
+		return model.User{}, false, err
+	}
+
+	identityId, err := session.NewToken()
+	if err != nil {
+		return model.User{}, false, err
+	}
+
+	username := claims.PreferredUsername
+	if username == "" {
+		username = claims.Email
+	}
+	if username == "" {
+		username = claims.Subject
+	}
+
+	user, err := a.repository.InsertIdentityUser(ctx, model.User{
+		Username:    username,
+		Password:    string(hashed),
+		Role:        role,
+		DisplayName: claims.Name,
+		Email:       claims.Email,
+	}, model.UserIdentity{
+		Id:      session.KeyId(identityId),
+		Issuer:  claims.Issuer,
+		Subject: claims.Subject,
+	})
+
+	return user, false, err
+}
+
+// oidcRole return the first officer role among the role claim the provider is allowed to grant,
+// the applicant sign up by itself and never through the provider
+func oidcRole(roles, allowed []string) (string, bool) {
+	for _, v := range roles {
+		role, err := rbac.FromString(v)
+		if err != nil || role == rbac.Applicant {
+			continue
+		}
+
+		for _, a := range allowed {
+			if a == role.String() {
+				return role.String(), true
+			}
+		}
+	}
+
+	return "", false
+}
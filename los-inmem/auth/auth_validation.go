@@ -2,14 +2,63 @@ package auth
 
 import (
 	"errors"
+	"net/mail"
+	"regexp"
+	"strconv"
+	"time"
 	"unicode/utf8"
+
+	"github.com/fikryfahrezy/adea/los-inmen/rbac"
 )
 
 var (
 	ErrUsernameRequired = errors.New("password required")
 	ErrPasswordRequired = errors.New("password required")
+
+	ErrRefreshTokenRequired = errors.New("refresh token required")
+	ErrCsrfTokenNotValid    = errors.New("csrf token not valid")
+
+	ErrInvitationRoleNotValid  = errors.New("invitation role must be an officer role")
+	ErrInvitationExpiresIn     = errors.New("invitation expires in must not be negative")
+	ErrInvitationTokenRequired = errors.New("invitation token required")
+
+	ErrOldPasswordRequired = errors.New("old password required")
+	ErrResetTokenRequired  = errors.New("password reset token required")
+
+	ErrChallengeTokenRequired = errors.New("login challenge token required")
+	ErrTotpCodeRequired       = errors.New("two-factor code or recovery code required")
+	ErrOidcCodeRequired       = errors.New("openid connect code and state required")
+
+	ErrApiKeyNameRequired  = errors.New("api key name required")
+	ErrApiKeyScopeRequired = errors.New("api key need at least one scope")
+	ErrApiKeyScopeNotValid = errors.New("api key scope must be a permission other than apikey:manage")
+	ErrApiKeyExpiresIn     = errors.New("api key expires in must not be negative")
+
+	ErrActivityStatusNotValid = errors.New("activity status must be success or failure")
+	ErrActivityDateNotValid   = errors.New("activity from and to must be RFC3339 date")
+	ErrActivityLimitNotValid  = errors.New("activity limit must be between 1 and 100")
+
+	ErrDisplayNameTooLong = errors.New("display name must be at most 100 character")
+	ErrEmailNotValid      = errors.New("email not valid")
+	ErrPhoneNotValid      = errors.New("phone must be 7 to 15 digit with an optional leading +")
+
+	ErrUserRoleNotValid   = errors.New("user role not valid")
+	ErrUserStatusNotValid = errors.New("user status must be active or inactive")
+	ErrUserLimitNotValid  = errors.New("user limit must be between 1 and 100")
+	ErrUserOffsetNotValid = errors.New("user offset must not be negative")
+)
+
+const (
+	defaultActivityLimit = 20
+	maxActivityLimit     = 100
+
+	maxDisplayNameLength = 100
+	defaultUserLimit     = 20
+	maxUserLimit         = 100
 )
 
+var phonePattern = regexp.MustCompile(`^\+?[0-9]{7,15}$`)
+
 func validateRegister(in RegisterIn) error {
 	if utf8.RuneCountInString(in.Username) == 0 {
 		return ErrUsernameRequired
@@ -29,3 +78,186 @@ func validateLogin(in LoginIn) error {
 	}
 	return nil
 }
+
+func validateCreateInvitation(in CreateInvitationIn) error {
+	role, err := rbac.FromString(in.Role)
+	if err != nil || role == rbac.Applicant {
+		return ErrInvitationRoleNotValid
+	}
+	if in.ExpiresIn < 0 {
+		return ErrInvitationExpiresIn
+	}
+	return nil
+}
+
+func validateAcceptInvitation(in AcceptInvitationIn) error {
+	if utf8.RuneCountInString(in.Token) == 0 {
+		return ErrInvitationTokenRequired
+	}
+	if utf8.RuneCountInString(in.Username) == 0 {
+		return ErrUsernameRequired
+	}
+	if utf8.RuneCountInString(in.Password) == 0 {
+		return ErrPasswordRequired
+	}
+	return nil
+}
+
+func validateChangeUsername(in ChangeUsernameIn) error {
+	if utf8.RuneCountInString(in.Username) == 0 {
+		return ErrUsernameRequired
+	}
+	if utf8.RuneCountInString(in.Password) == 0 {
+		return ErrPasswordRequired
+	}
+	return nil
+}
+
+func validateChangePassword(in ChangePasswordIn) error {
+	if utf8.RuneCountInString(in.OldPassword) == 0 {
+		return ErrOldPasswordRequired
+	}
+	if utf8.RuneCountInString(in.NewPassword) == 0 {
+		return ErrPasswordRequired
+	}
+	if in.OldPassword == in.NewPassword {
+		return ErrPasswordSame
+	}
+	return nil
+}
+
+func validateResetPassword(in ResetPasswordIn) error {
+	if utf8.RuneCountInString(in.Token) == 0 {
+		return ErrResetTokenRequired
+	}
+	if utf8.RuneCountInString(in.Password) == 0 {
+		return ErrPasswordRequired
+	}
+	return nil
+}
+
+func validateLoginTotp(in LoginTotpIn) error {
+	if utf8.RuneCountInString(in.ChallengeToken) == 0 {
+		return ErrChallengeTokenRequired
+	}
+	if utf8.RuneCountInString(in.Code) == 0 && utf8.RuneCountInString(in.RecoveryCode) == 0 {
+		return ErrTotpCodeRequired
+	}
+	return nil
+}
+
+func validateCreateApiKey(in CreateApiKeyIn) error {
+	if utf8.RuneCountInString(in.Name) == 0 {
+		return ErrApiKeyNameRequired
+	}
+	if len(in.Scopes) == 0 {
+		return ErrApiKeyScopeRequired
+	}
+	for _, v := range in.Scopes {
+		// A key that can manage key could create a key that outlive its own revocation
+		p, err := rbac.PermissionFromString(v)
+		if err != nil || p == rbac.ApiKeyManage {
+			return ErrApiKeyScopeNotValid
+		}
+	}
+	if in.ExpiresIn < 0 {
+		return ErrApiKeyExpiresIn
+	}
+	return nil
+}
+
+// activityFilter turn the query of the activity endpoint into the repository filter
+func activityFilter(in ActivityQueryIn) (LoginActivityFilter, error) {
+	filter := LoginActivityFilter{
+		UserId:   in.UserId,
+		Username: in.Username,
+		Limit:    defaultActivityLimit,
+	}
+
+	switch in.Status {
+	case "":
+	case "success", "failure":
+		isSuccess := in.Status == "success"
+		filter.IsSuccess = &isSuccess
+	default:
+		return LoginActivityFilter{}, ErrActivityStatusNotValid
+	}
+
+	var err error
+	if in.From != "" {
+		if filter.From, err = time.Parse(time.RFC3339, in.From); err != nil {
+			return LoginActivityFilter{}, ErrActivityDateNotValid
+		}
+	}
+	if in.To != "" {
+		if filter.To, err = time.Parse(time.RFC3339, in.To); err != nil {
+			return LoginActivityFilter{}, ErrActivityDateNotValid
+		}
+	}
+
+	if in.Limit != "" {
+		filter.Limit, err = strconv.Atoi(in.Limit)
+		if err != nil || filter.Limit < 1 || filter.Limit > maxActivityLimit {
+			return LoginActivityFilter{}, ErrActivityLimitNotValid
+		}
+	}
+
+	return filter, nil
+}
+
+func validateUpdateProfile(in UpdateProfileIn) error {
+	if utf8.RuneCountInString(in.DisplayName) > maxDisplayNameLength {
+		return ErrDisplayNameTooLong
+	}
+	if in.Email != "" {
+		// Only the bare address is accepted, not the "Name <address>" form
+		addr, err := mail.ParseAddress(in.Email)
+		if err != nil || addr.Address != in.Email {
+			return ErrEmailNotValid
+		}
+	}
+	if in.Phone != "" && !phonePattern.MatchString(in.Phone) {
+		return ErrPhoneNotValid
+	}
+	return nil
+}
+
+// userFilter turn the query of the user list endpoint into the repository filter
+func userFilter(in UsersQueryIn) (UserFilter, error) {
+	filter := UserFilter{
+		Query: in.Query,
+		Role:  in.Role,
+		Limit: defaultUserLimit,
+	}
+
+	if in.Role != "" {
+		if _, err := rbac.FromString(in.Role); err != nil {
+			return UserFilter{}, ErrUserRoleNotValid
+		}
+	}
+
+	switch in.Status {
+	case "":
+	case "active", "inactive":
+		isActive := in.Status == "active"
+		filter.IsActive = &isActive
+	default:
+		return UserFilter{}, ErrUserStatusNotValid
+	}
+
+	var err error
+	if in.Limit != "" {
+		filter.Limit, err = strconv.Atoi(in.Limit)
+		if err != nil || filter.Limit < 1 || filter.Limit > maxUserLimit {
+			return UserFilter{}, ErrUserLimitNotValid
+		}
+	}
+	if in.Offset != "" {
+		filter.Offset, err = strconv.Atoi(in.Offset)
+		if err != nil || filter.Offset < 0 {
+			return UserFilter{}, ErrUserOffsetNotValid
+		}
+	}
+
+	return filter, nil
+}
@@ -0,0 +1,166 @@
+package committee
+
+import (
+	"errors"
+	"os"
+	"strconv"
+	"time"
+)
+
+var ErrUnknownChoice = errors.New("unknown vote choice")
+
+// Choice is the vote of a committee member
+type Choice struct {
+	slug string
+}
+
+func (c Choice) String() string {
+	return c.slug
+}
+
+var (
+	Approve = Choice{"approve"}
+	Reject  = Choice{"reject"}
+	// Abstain count for the quorum but not for the majority
+	Abstain = Choice{"abstain"}
+)
+
+func ChoiceFromString(s string) (Choice, error) {
+	switch s {
+	case Approve.slug:
+		return Approve, nil
+	case Reject.slug:
+		return Reject, nil
+	case Abstain.slug:
+		return Abstain, nil
+	}
+
+	return Choice{}, ErrUnknownChoice
+}
+
+// Status is where the vote is, every status other than Open is the outcome of the closed vote
+type Status struct {
+	slug string
+}
+
+func (s Status) String() string {
+	return s.slug
+}
+
+var (
+	Open     = Status{"open"}
+	Approved = Status{"approved"}
+	Rejected = Status{"rejected"}
+	// NoQuorum is the vote that closed without enough member voting, the loan is left as is
+	NoQuorum = Status{"no_quorum"}
+	// Void is the vote that closed after its loan was removed or left the review, it decide nothing
+	Void = Status{"void"}
+)
+
+type Config struct {
+	// ThresholdInIdr is the amount above which the loan can only be decided by the committee
+	ThresholdInIdr int64
+	// Quorum is the percent of the invited members that must vote
+	Quorum int
+	// Majority is the percent of the approve and reject votes the approve must be above
+	Majority int
+	// VoteTTL is how long the vote stay open before it is closed with the votes it has
+	VoteTTL time.Duration
+}
+
+func DefaultConfig() Config {
+	return Config{
+		ThresholdInIdr: 500_000_000,
+		Quorum:         50,
+		Majority:       50,
+		VoteTTL:        72 * time.Hour,
+	}
+}
+
+// ConfigFromEnv read COMMITTEE_THRESHOLD, COMMITTEE_QUORUM, COMMITTEE_MAJORITY and COMMITTEE_VOTE_TTL
+// in time.ParseDuration format, the default config value is used for the empty one
+func ConfigFromEnv() (Config, error) {
+	cfg := DefaultConfig()
+	if s := os.Getenv("COMMITTEE_THRESHOLD"); s != "" {
+		n, err := strconv.ParseInt(s, 10, 64)
+		if err != nil || n < 0 {
+			return Config{}, errors.New("invalid COMMITTEE_THRESHOLD: " + s)
+		}
+		cfg.ThresholdInIdr = n
+	}
+	if s := os.Getenv("COMMITTEE_QUORUM"); s != "" {
+		n, err := strconv.Atoi(s)
+		if err != nil || n < 0 || n > 100 {
+			return Config{}, errors.New("invalid COMMITTEE_QUORUM: " + s)
+		}
+		cfg.Quorum = n
+	}
+	if s := os.Getenv("COMMITTEE_MAJORITY"); s != "" {
+		n, err := strconv.Atoi(s)
+		if err != nil || n < 0 || n >= 100 {
+			return Config{}, errors.New("invalid COMMITTEE_MAJORITY: " + s)
+		}
+		cfg.Majority = n
+	}
+	if s := os.Getenv("COMMITTEE_VOTE_TTL"); s != "" {
+		d, err := time.ParseDuration(s)
+		if err != nil || d <= 0 {
+			return Config{}, errors.New("invalid COMMITTEE_VOTE_TTL: " + s)
+		}
+		cfg.VoteTTL = d
+	}
+
+	return cfg, nil
+}
+
+// IsRequired tell whether the loan of the amount can only be decided by the committee
+func (c Config) IsRequired(amountInIdr int64) bool {
+	return amountInIdr > c.ThresholdInIdr
+}
+
+// Tally is the count of the vote, Invited include the member that has not voted yet
+type Tally struct {
+	Invited int
+	Approve int
+	Reject  int
+	Abstain int
+}
+
+// Count the choices of the invited members, the empty choice is the member that has not voted yet
+func Count(invited int, choices []string) Tally {
+	t := Tally{Invited: invited}
+	for _, v := range choices {
+		switch v {
+		case Approve.slug:
+			t.Approve++
+		case Reject.slug:
+			t.Reject++
+		case Abstain.slug:
+			t.Abstain++
+		}
+	}
+
+	return t
+}
+
+func (t Tally) Voted() int {
+	return t.Approve + t.Reject + t.Abstain
+}
+
+// Outcome decide the vote, it is NoQuorum when too few member voted or every voter abstained,
+// otherwise the loan is approved when the share of approve is above the majority
+func (t Tally) Outcome(quorum, majority int) Status {
+	if t.Invited == 0 || t.Voted()*100 < quorum*t.Invited {
+		return NoQuorum
+	}
+
+	decided := t.Approve + t.Reject
+	if decided == 0 {
+		return NoQuorum
+	}
+	if t.Approve*100 > majority*decided {
+		return Approved
+	}
+
+	return Rejected
+}
@@ -7,20 +7,74 @@ import (
 	"sync"
 
 	"github.com/fikryfahrezy/adea/los-inmen/model"
+	"github.com/fikryfahrezy/adea/los-inmen/rbac"
 )
 
 type JsonFile struct {
-	path   string
-	DbUser map[string]model.User
-	DbLoan map[string]model.LoanApplication
+	path         string
+	DbUser       map[string]model.User
+	DbLoan       map[string]model.LoanApplication
+	DbLoanStatus map[string]model.LoanStatusHistory
+	DbApproval   map[string]model.ApprovalSignature
+	DbVote       map[string]model.CommitteeVote
+	DbBallot     map[string]model.CommitteeBallot
+	DbInvitation map[string]model.Invitation
+	DbReset      map[string]model.PasswordReset
+	DbActivity   map[string]model.LoginActivity
+	DbTotp       map[string]model.UserTotp
+	DbRecovery   map[string]model.RecoveryCode
+	DbChallenge  map[string]model.LoginChallenge
+	DbApiKey     map[string]model.ApiKey
+	DbIdentity   map[string]model.UserIdentity
+	DbOidcState  map[string]model.OidcState
+	// DbOfficerRegion is keyed by the id of the officer
+	DbOfficerRegion map[string]model.OfficerRegion
+	// IdxUsername map the username to the id of the user, it is kept by the repository
+	// and rebuilt when the user table is loaded
+	IdxUsername map[string]string
 	sync.RWMutex
 }
 
+// legacyUser read the user saved before the role based access control,
+// when only the IsOfficer flag told the officer from the applicant
+type legacyUser struct {
+	model.User
+	IsOfficer bool
+}
+
+func (u legacyUser) toUser() model.User {
+	if u.Role != "" {
+		return u.User
+	}
+
+	u.User.Role = rbac.Applicant.String()
+	if u.IsOfficer {
+		u.User.Role = rbac.FieldOfficer.String()
+	}
+
+	return u.User
+}
+
 func NewJson(path string) *JsonFile {
 	return &JsonFile{
-		DbUser: make(map[string]model.User),
-		DbLoan: make(map[string]model.LoanApplication),
-		path:   path,
+		DbUser:          make(map[string]model.User),
+		DbLoan:          make(map[string]model.LoanApplication),
+		DbLoanStatus:    make(map[string]model.LoanStatusHistory),
+		DbApproval:      make(map[string]model.ApprovalSignature),
+		DbVote:          make(map[string]model.CommitteeVote),
+		DbBallot:        make(map[string]model.CommitteeBallot),
+		DbInvitation:    make(map[string]model.Invitation),
+		DbReset:         make(map[string]model.PasswordReset),
+		DbActivity:      make(map[string]model.LoginActivity),
+		DbTotp:          make(map[string]model.UserTotp),
+		DbRecovery:      make(map[string]model.RecoveryCode),
+		DbChallenge:     make(map[string]model.LoginChallenge),
+		DbApiKey:        make(map[string]model.ApiKey),
+		DbIdentity:      make(map[string]model.UserIdentity),
+		DbOidcState:     make(map[string]model.OidcState),
+		DbOfficerRegion: make(map[string]model.OfficerRegion),
+		IdxUsername:     make(map[string]string),
+		path:            path,
 	}
 }
 
@@ -30,13 +84,68 @@ func (f *JsonFile) ScanToMap(r io.Reader, tableName string) error {
 
 	switch tableName {
 	case "user":
-		if err := json.NewDecoder(r).Decode(&f.DbUser); err != nil {
+		var users map[string]legacyUser
+		if err := json.NewDecoder(r).Decode(&users); err != nil {
 			return err
 		}
+
+		f.DbUser = make(map[string]model.User, len(users))
+		for k, v := range users {
+			f.DbUser[k] = v.toUser()
+		}
+
+		f.IdxUsername = make(map[string]string, len(f.DbUser))
+		for _, v := range f.DbUser {
+			f.IdxUsername[v.Username] = v.Id
+		}
 	case "loan":
 		if err := json.NewDecoder(r).Decode(&f.DbLoan); err != nil {
 			return err
 		}
+	case "loan_status_history":
+		if err := json.NewDecoder(r).Decode(&f.DbLoanStatus); err != nil {
+			return err
+		}
+	case "approval_signature":
+		if err := json.NewDecoder(r).Decode(&f.DbApproval); err != nil {
+			return err
+		}
+	case "committee_vote":
+		if err := json.NewDecoder(r).Decode(&f.DbVote); err != nil {
+			return err
+		}
+	case "committee_ballot":
+		if err := json.NewDecoder(r).Decode(&f.DbBallot); err != nil {
+			return err
+		}
+	case "invitation":
+		if err := json.NewDecoder(r).Decode(&f.DbInvitation); err != nil {
+			return err
+		}
+	case "login_activity":
+		if err := json.NewDecoder(r).Decode(&f.DbActivity); err != nil {
+			return err
+		}
+	case "totp":
+		if err := json.NewDecoder(r).Decode(&f.DbTotp); err != nil {
+			return err
+		}
+	case "recovery_code":
+		if err := json.NewDecoder(r).Decode(&f.DbRecovery); err != nil {
+			return err
+		}
+	case "api_key":
+		if err := json.NewDecoder(r).Decode(&f.DbApiKey); err != nil {
+			return err
+		}
+	case "user_identity":
+		if err := json.NewDecoder(r).Decode(&f.DbIdentity); err != nil {
+			return err
+		}
+	case "officer_region":
+		if err := json.NewDecoder(r).Decode(&f.DbOfficerRegion); err != nil {
+			return err
+		}
 	default:
 		return errors.New("table not exist")
 	}
@@ -49,7 +158,18 @@ func (f *JsonFile) Generate(w io.Writer) error {
 	defer f.Unlock()
 
 	res := map[string]interface{}{
-		"user": f.DbUser,
+		"user":                f.DbUser,
+		"loan_status_history": f.DbLoanStatus,
+		"approval_signature":  f.DbApproval,
+		"committee_vote":      f.DbVote,
+		"committee_ballot":    f.DbBallot,
+		"invitation":          f.DbInvitation,
+		"login_activity":      f.DbActivity,
+		"totp":                f.DbTotp,
+		"recovery_code":       f.DbRecovery,
+		"api_key":             f.DbApiKey,
+		"user_identity":       f.DbIdentity,
+		"officer_region":      f.DbOfficerRegion,
 	}
 
 	if err := json.NewEncoder(w).Encode(res); err != nil {
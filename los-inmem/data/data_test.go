@@ -0,0 +1,35 @@
+package data_test
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/fikryfahrezy/adea/los-inmen/data"
+	"github.com/fikryfahrezy/adea/los-inmen/rbac"
+)
+
+func TestScanLegacyUser(t *testing.T) {
+	db := data.NewJson("")
+	users := `{
+		"1": {"Id": "1", "Username": "officer", "IsOfficer": true},
+		"2": {"Id": "2", "Username": "applicant", "IsOfficer": false},
+		"3": {"Id": "3", "Username": "approver", "Role": "approver"}
+	}`
+	if err := db.ScanToMap(strings.NewReader(users), "user"); err != nil {
+		t.Fatal(err)
+	}
+
+	testCases := map[string]string{
+		"1": rbac.FieldOfficer.String(),
+		"2": rbac.Applicant.String(),
+		"3": rbac.Approver.String(),
+	}
+	for id, expect := range testCases {
+		if res := db.DbUser[id].Role; res != expect {
+			t.Fatalf("resulting: %s, expect: %s | user: %s", res, expect, id)
+		}
+	}
+	if db.IdxUsername["officer"] != "1" {
+		t.Fatalf("resulting: %s, expect: %s", db.IdxUsername["officer"], "1")
+	}
+}
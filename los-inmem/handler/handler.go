@@ -1,33 +1,39 @@
 package handler
 
 import (
+	"errors"
 	"fmt"
 	"net/http"
+	"strings"
 
 	"github.com/fikryfahrezy/adea/los-inmen/auth"
 	"github.com/fikryfahrezy/adea/los-inmen/loan"
+	"github.com/fikryfahrezy/adea/los-inmen/rbac"
 	"github.com/fikryfahrezy/adea/los-inmen/session"
 	"github.com/fikryfahrezy/adea/los-inmen/setting"
 )
 
 type Handler struct {
-	*session.Session
+	session.Authenticator
 	*setting.SettingApp
 	*auth.AuthApp
 	*loan.LoanApp
+	Cookie session.CookieConfig
 }
 
 func NewHandler(
-	session *session.Session,
+	authenticator session.Authenticator,
 	settingApp *setting.SettingApp,
 	authApp *auth.AuthApp,
 	loanApp *loan.LoanApp,
+	cookie session.CookieConfig,
 ) *Handler {
 	return &Handler{
-		Session:    session,
-		SettingApp: settingApp,
-		AuthApp:    authApp,
-		LoanApp:    loanApp,
+		Authenticator: authenticator,
+		SettingApp:    settingApp,
+		AuthApp:       authApp,
+		LoanApp:       loanApp,
+		Cookie:        cookie,
 	}
 }
 
@@ -36,62 +42,174 @@ func (h *Handler) ServeRestAPI() {
 
 	mux.Handle("/tmp/", http.StripPrefix("/tmp/", http.FileServer(http.Dir("./tmp"))))
 
-	mux.HandleFunc("/setting/generatejsondb", routeMWCompose(h.GanerateJsonDB, getRoute, h.authRoute(true)))
-	mux.HandleFunc("/setting/loadjsondb", routeMWCompose(h.LoadJsonDB, postRoute, h.authRoute(true)))
-	mux.HandleFunc("/setting/ziptmp", routeMWCompose(h.ZipTmp, getRoute, h.authRoute(true)))
-	mux.HandleFunc("/setting/unziptmp", routeMWCompose(h.LoadZipTmp, postRoute, h.authRoute(true)))
+	mux.HandleFunc("/setting/generatejsondb", routeMWCompose(h.GanerateJsonDB, getRoute, h.authRoute(rbac.SettingDb)))
+	mux.HandleFunc("/setting/loadjsondb", routeMWCompose(h.LoadJsonDB, postRoute, h.authRoute(rbac.SettingDb)))
+	mux.HandleFunc("/setting/ziptmp", routeMWCompose(h.ZipTmp, getRoute, h.authRoute(rbac.SettingTmp)))
+	mux.HandleFunc("/setting/unziptmp", routeMWCompose(h.LoadZipTmp, postRoute, h.authRoute(rbac.SettingTmp)))
 
-	mux.HandleFunc("/auth/login", routeMWCompose(h.LoginPost(h.Session), postRoute))
-	mux.HandleFunc("/auth/register", routeMWCompose(h.RegisterPost(h.Session), postRoute))
+	mux.HandleFunc("/auth/login", routeMWCompose(h.LoginPost(h.Authenticator, h.Cookie), postRoute))
+	mux.HandleFunc("/auth/login/totp", routeMWCompose(h.LoginTotpPost(h.Authenticator, h.Cookie), postRoute))
+	mux.HandleFunc("/auth/oidc/login", routeMWCompose(h.OidcLoginGet, getRoute))
+	mux.HandleFunc("/auth/oidc/callback", routeMWCompose(h.OidcCallbackGet(h.Authenticator), getRoute))
+	mux.HandleFunc("/auth/register", routeMWCompose(h.RegisterPost(h.Authenticator), postRoute))
+	mux.HandleFunc("/auth/refresh", routeMWCompose(h.RefreshPost(h.Authenticator, h.Cookie), postRoute))
+	mux.HandleFunc("/auth/logout", routeMWCompose(h.LogoutPost(h.Authenticator, h.Cookie), postRoute, h.authRoute()))
+	mux.HandleFunc("/auth/logoutall", routeMWCompose(h.LogoutAllPost(h.Authenticator, h.Cookie), postRoute, h.authRoute()))
 
-	mux.HandleFunc("/loan/getall", routeMWCompose(h.UserLoansGet, getRoute, h.authRoute(false)))
-	mux.HandleFunc("/loan/get", routeMWCompose(h.UserLoanDetailGet, getRoute, h.authRoute(false)))
-	mux.HandleFunc("/loan/create", routeMWCompose(h.CreateLoanPost, postRoute, h.authRoute(false)))
-	mux.HandleFunc("/loan/update", routeMWCompose(h.UpdateLoanPut, putRoute, h.authRoute(false)))
-	mux.HandleFunc("/loan/delete", routeMWCompose(h.UserLoanDelete, deleteRoute, h.authRoute(false)))
+	mux.HandleFunc("/auth/me", routeMWCompose(h.MeGet, getRoute, h.authRoute()))
+	mux.HandleFunc("/auth/me/update", routeMWCompose(h.MeUpdatePut, putRoute, h.authRoute()))
+	mux.HandleFunc("/auth/me/deactivate", routeMWCompose(h.MeDeactivatePost(h.Authenticator), postRoute, h.authRoute()))
 
-	mux.HandleFunc("/loan/getall/admin", routeMWCompose(h.LoansGet, getRoute, h.authRoute(true)))
-	mux.HandleFunc("/loan/get/admin", routeMWCompose(h.LoanDetailGet, getRoute, h.authRoute(true)))
-	mux.HandleFunc("/loan/proceedloan", routeMWCompose(h.ProceedLoanPatch, patchRoute, h.authRoute(true)))
-	mux.HandleFunc("/loan/approveloan", routeMWCompose(h.ApproveLoanPatch, patchRoute, h.authRoute(true)))
+	mux.HandleFunc("/auth/username/change", routeMWCompose(h.ChangeUsernamePost, postRoute, h.authRoute()))
+	mux.HandleFunc("/auth/password/change", routeMWCompose(h.ChangePasswordPost(h.Authenticator, h.Cookie), postRoute, h.authRoute()))
+	mux.HandleFunc("/auth/password/forgot", routeMWCompose(h.ForgotPasswordPost, postRoute))
+	mux.HandleFunc("/auth/password/reset", routeMWCompose(h.ResetPasswordPost(h.Authenticator), postRoute))
+
+	mux.HandleFunc("/auth/invitation/accept", routeMWCompose(h.AcceptInvitationPost, postRoute))
+	mux.HandleFunc("/auth/invitation/admin", routeMWCompose(h.InvitationPost, postRoute, h.authRoute(rbac.UserInvite)))
+
+	mux.HandleFunc("/auth/user/getall/admin", routeMWCompose(h.UsersGet, getRoute, h.authRoute(rbac.UserRead)))
+	mux.HandleFunc("/auth/user/deactivate/admin", routeMWCompose(h.UserDeactivatePost(h.Authenticator), postRoute, h.authRoute(rbac.UserDeactivate)))
+	mux.HandleFunc("/auth/unlock/admin", routeMWCompose(h.UnlockUserPost, postRoute, h.authRoute(rbac.UserUnlock)))
+
+	mux.HandleFunc("/auth/totp/recovery", routeMWCompose(h.RecoveryCodesPost, postRoute, h.authRoute()))
+	mux.HandleFunc("/auth/totp/reset/admin", routeMWCompose(h.ResetTotpPost(h.Authenticator), postRoute, h.authRoute(rbac.UserTotpReset)))
+
+	mux.HandleFunc("/auth/activity", routeMWCompose(h.OwnActivityGet, getRoute, h.authRoute()))
+	mux.HandleFunc("/auth/activity/admin", routeMWCompose(h.ActivityGet, getRoute, h.authRoute(rbac.ActivityRead)))
+
+	mux.HandleFunc("/auth/apikey/create/admin", routeMWCompose(h.ApiKeyPost, postRoute, h.authRoute(rbac.ApiKeyManage)))
+	mux.HandleFunc("/auth/apikey/getall/admin", routeMWCompose(h.ApiKeysGet, getRoute, h.authRoute(rbac.ApiKeyManage)))
+	mux.HandleFunc("/auth/apikey/rotate/admin", routeMWCompose(h.ApiKeyRotatePost, postRoute, h.authRoute(rbac.ApiKeyManage)))
+	mux.HandleFunc("/auth/apikey/revoke/admin", routeMWCompose(h.ApiKeyRevokeDelete, deleteRoute, h.authRoute(rbac.ApiKeyManage)))
+
+	mux.HandleFunc("/auth/session/getall/admin", routeMWCompose(h.SessionsGet(h.Authenticator), getRoute, h.authRoute(rbac.SessionRead)))
+	mux.HandleFunc("/auth/session/revoke/admin", routeMWCompose(h.SessionRevokeDelete(h.Authenticator), deleteRoute, h.authRoute(rbac.SessionRevoke)))
+
+	mux.HandleFunc("/loan/getall", routeMWCompose(h.UserLoansGet, getRoute, h.authRoute(rbac.LoanReadOwn)))
+	mux.HandleFunc("/loan/get", routeMWCompose(h.UserLoanDetailGet, getRoute, h.authRoute(rbac.LoanReadOwn)))
+	mux.HandleFunc("/loan/create", routeMWCompose(h.CreateLoanPost, postRoute, h.authRoute(rbac.LoanCreate)))
+	mux.HandleFunc("/loan/update", routeMWCompose(h.UpdateLoanPut, putRoute, h.authRoute(rbac.LoanUpdateOwn)))
+	mux.HandleFunc("/loan/delete", routeMWCompose(h.UserLoanDelete, deleteRoute, h.authRoute(rbac.LoanDeleteOwn)))
+	mux.HandleFunc("/loan/actions", routeMWCompose(h.LoanActionsGet, getRoute, h.authRoute()))
+	mux.HandleFunc("/loan/transition", routeMWCompose(h.TransitionPatch, patchRoute, h.authRoute()))
+	mux.HandleFunc("/loan/history", routeMWCompose(h.LoanHistoryGet, getRoute, h.authRoute()))
+	mux.HandleFunc("/loan/withdraw", routeMWCompose(h.WithdrawPatch, patchRoute, h.authRoute(rbac.LoanUpdateOwn)))
+
+	mux.HandleFunc("/loan/getall/admin", routeMWCompose(h.LoansGet, getRoute, h.authRoute(rbac.LoanReadAll)))
+	mux.HandleFunc("/loan/getall/admin/deleted", routeMWCompose(h.DeletedLoansGet, getRoute, h.authRoute(rbac.LoanReadAll)))
+	mux.HandleFunc("/loan/get/admin", routeMWCompose(h.LoanDetailGet, getRoute, h.authRoute(rbac.LoanReadAll)))
+	mux.HandleFunc("/loan/proceedloan", routeMWCompose(h.ProceedLoanPatch, patchRoute, h.authRoute(rbac.LoanProceed)))
+	mux.HandleFunc("/loan/approveloan", routeMWCompose(h.ApproveLoanPatch, patchRoute, h.authRoute(rbac.LoanApprove)))
+	mux.HandleFunc("/loan/archive", routeMWCompose(h.ArchiveLoanPatch, patchRoute, h.authRoute(rbac.LoanArchive)))
+	mux.HandleFunc("/loan/restore", routeMWCompose(h.RestoreLoanPatch, patchRoute, h.authRoute(rbac.LoanArchive)))
+	mux.HandleFunc("/loan/queue", routeMWCompose(h.MyQueueGet, getRoute, h.authRoute(rbac.LoanQueue)))
+	mux.HandleFunc("/loan/queue/pool", routeMWCompose(h.QueuePoolGet, getRoute, h.authRoute(rbac.LoanQueue)))
+	mux.HandleFunc("/loan/claim", routeMWCompose(h.ClaimLoanPatch, patchRoute, h.authRoute(rbac.LoanQueue)))
+	mux.HandleFunc("/loan/release", routeMWCompose(h.ReleaseLoanPatch, patchRoute, h.authRoute(rbac.LoanQueue)))
+	mux.HandleFunc("/loan/reassign/admin", routeMWCompose(h.ReassignLoanPatch, patchRoute, h.authRoute(rbac.QueueManage)))
+	mux.HandleFunc("/loan/queue/region/admin", routeMWCompose(h.OfficerRegionPut, putRoute, h.authRoute(rbac.QueueManage)))
+	mux.HandleFunc("/loan/committee", routeMWCompose(h.LoanVotesGet, getRoute, h.authRoute(rbac.LoanReadAll)))
+	mux.HandleFunc("/loan/committee/open", routeMWCompose(h.OpenVotePost, postRoute, h.authRoute(rbac.CommitteeOpen)))
+	mux.HandleFunc("/loan/committee/vote", routeMWCompose(h.CastVotePatch, patchRoute, h.authRoute(rbac.CommitteeVote)))
+	mux.HandleFunc("/loan/committee/close", routeMWCompose(h.CloseVotePatch, patchRoute, h.authRoute(rbac.CommitteeOpen)))
 
 	fmt.Println("You are ready to rock and roll!")
 	http.ListenAndServe(":4000", mux)
 }
 
-func (h *Handler) authRoute(isPrivate bool) func(next http.HandlerFunc) http.HandlerFunc {
+// authRoute require a valid session whose role has every of the permissions,
+// no permission mean any authenticated user can access the route.
+// The token is read from the Authorization header or else from the session cookie,
+// the request made with the cookie must also carry the CSRF token to change anything
+func (h *Handler) authRoute(perms ...rbac.Permission) func(next http.HandlerFunc) http.HandlerFunc {
 	return func(next http.HandlerFunc) http.HandlerFunc {
 		return func(w http.ResponseWriter, r *http.Request) {
-			auth := r.Header.Get("authorization")
-			if auth == "" {
+			token, fromCookie := bearerToken(r), false
+			if token == "" {
+				token, fromCookie = session.CookieToken(r, session.AccessCookie), true
+			}
+			if token == "" {
 				http.Error(w, "forbidden", http.StatusForbidden)
 				return
 			}
 
-			var ok bool
-			var sess session.SessionObj
-			if isPrivate {
-				if sess, ok = h.Session.IsKeyPrivate(auth); !ok {
-					http.Error(w, "forbidden private route", http.StatusForbidden)
-					return
-				}
+			if strings.HasPrefix(token, auth.ApiKeyPrefix) && !fromCookie {
+				h.apiKeyRoute(perms, next)(w, r)
+				return
+			}
+
+			if fromCookie && !session.IsSafeMethod(r.Method) && !session.ValidCsrf(r, token) {
+				http.Error(w, "forbidden csrf token not valid", http.StatusForbidden)
+				return
+			}
+
+			sess, err := h.Authenticator.Authenticate(r.Context(), token)
+			if errors.Is(err, session.ErrSessionExpired) {
+				http.Error(w, "forbidden session expired", http.StatusForbidden)
+				return
+			}
+			if err != nil {
+				http.Error(w, "forbidden", http.StatusForbidden)
+				return
 			}
 
-			if sess.Key == "" {
-				if sess, ok = h.Session.Get(auth); !ok {
-					http.Error(w, "forbidden", http.StatusForbidden)
+			for _, p := range perms {
+				if !rbac.Can(sess.Role, p) {
+					http.Error(w, "forbidden missing permission "+p.String(), http.StatusForbidden)
 					return
 				}
 			}
 
-			if h.Session.IsExpired(sess) {
-				http.Error(w, "forbidden session expired", http.StatusForbidden)
+			next(w, r.WithContext(session.NewContext(r.Context(), sess)))
+		}
+	}
+}
+
+// apiKeyRoute authenticate the request made with an API key, the key is only accepted
+// by the route that require a permission and every permission must be in its scopes,
+// so it can never reach the route meant for the user itself like logout or change password
+func (h *Handler) apiKeyRoute(perms []rbac.Permission, next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if len(perms) == 0 {
+			http.Error(w, "forbidden api key not allowed", http.StatusForbidden)
+			return
+		}
+
+		sess, err := h.AuthApp.AuthenticateApiKey(r.Context(), bearerToken(r))
+		if err != nil {
+			http.Error(w, "forbidden", http.StatusForbidden)
+			return
+		}
+
+		for _, p := range perms {
+			if !rbac.Can(sess.Role, p) || !hasScope(sess.Scopes, p) {
+				http.Error(w, "forbidden missing permission "+p.String(), http.StatusForbidden)
 				return
 			}
+		}
+
+		next(w, r.WithContext(session.NewContext(r.Context(), sess)))
+	}
+}
 
-			next(w, r)
+func hasScope(scopes []string, p rbac.Permission) bool {
+	for _, v := range scopes {
+		if v == p.String() {
+			return true
 		}
 	}
+
+	return false
+}
+
+func bearerToken(r *http.Request) string {
+	auth := r.Header.Get("authorization")
+	if len(auth) > 7 && strings.EqualFold(auth[:7], "bearer ") {
+		return strings.TrimSpace(auth[7:])
+	}
+
+	return auth
 }
 
 func getRoute(next http.HandlerFunc) http.HandlerFunc {
@@ -0,0 +1,146 @@
+package id
+
+import (
+	"crypto/rand"
+	"encoding/binary"
+	"encoding/hex"
+	"errors"
+	"os"
+	"sync"
+	"time"
+)
+
+var ErrUnknownGenerator = errors.New("unknown id generator, use ulid or uuidv7")
+
+// Generator create the id of a new record, the id is opaque to the user
+// and sorted by the time it was created
+type Generator interface {
+	New() (string, error)
+}
+
+// FromEnv return the generator chosen by ID_GENERATOR, ulid when it is empty
+func FromEnv() (Generator, error) {
+	return NewGenerator(os.Getenv("ID_GENERATOR"))
+}
+
+func NewGenerator(kind string) (Generator, error) {
+	switch kind {
+	case "", "ulid":
+		return NewUlid(), nil
+	case "uuidv7":
+		return NewUuidV7(), nil
+	}
+
+	return nil, ErrUnknownGenerator
+}
+
+// crockford is the base32 alphabet of ULID, it has no I, L, O and U
+// so the id can not be misread
+const crockford = "0123456789ABCDEFGHJKMNPQRSTVWXYZ"
+
+// Ulid generate a 26 character ULID, 48 bit of millisecond timestamp followed by 80 bit
+// of randomness, the randomness is incremented within the same millisecond so the id
+// created by the same generator stay sorted
+type Ulid struct {
+	sync.Mutex
+	now     func() time.Time
+	lastMs  uint64
+	lastRnd [10]byte
+}
+
+func NewUlid() *Ulid {
+	return &Ulid{
+		now: time.Now,
+	}
+}
+
+func (g *Ulid) New() (string, error) {
+	g.Lock()
+	defer g.Unlock()
+
+	ms := uint64(g.now().UnixMilli())
+	if ms <= g.lastMs {
+		// Keep the last millisecond when the clock goes backward
+		// and increment the randomness like in the same millisecond
+		ms = g.lastMs
+		if !increment(g.lastRnd[:]) {
+			return "", errors.New("ulid randomness overflow within the same millisecond")
+		}
+	} else {
+		if _, err := rand.Read(g.lastRnd[:]); err != nil {
+			return "", err
+		}
+		g.lastMs = ms
+	}
+
+	var b [16]byte
+	b[0] = byte(ms >> 40)
+	b[1] = byte(ms >> 32)
+	b[2] = byte(ms >> 24)
+	b[3] = byte(ms >> 16)
+	b[4] = byte(ms >> 8)
+	b[5] = byte(ms)
+	copy(b[6:], g.lastRnd[:])
+
+	return encodeCrockford(b), nil
+}
+
+// increment add one to the big endian number and report false when it overflow
+func increment(b []byte) bool {
+	for i := len(b) - 1; i >= 0; i-- {
+		b[i]++
+		if b[i] != 0 {
+			return true
+		}
+	}
+
+	return false
+}
+
+// encodeCrockford encode the 128 bit as 26 character, 5 bit each,
+// the first character only carry the top 3 bit
+func encodeCrockford(b [16]byte) string {
+	hi := binary.BigEndian.Uint64(b[:8])
+	lo := binary.BigEndian.Uint64(b[8:])
+
+	out := make([]byte, 26)
+	for i := 25; i >= 0; i-- {
+		out[i] = crockford[lo&0x1f]
+		lo = lo>>5 | hi<<59
+		hi >>= 5
+	}
+
+	return string(out)
+}
+
+// UuidV7 generate a RFC 9562 UUID version 7, 48 bit of millisecond timestamp
+// followed by the version, the variant and 74 bit of randomness
+type UuidV7 struct {
+	now func() time.Time
+}
+
+func NewUuidV7() *UuidV7 {
+	return &UuidV7{
+		now: time.Now,
+	}
+}
+
+func (g *UuidV7) New() (string, error) {
+	var b [16]byte
+	if _, err := rand.Read(b[6:]); err != nil {
+		return "", err
+	}
+
+	ms := uint64(g.now().UnixMilli())
+	b[0] = byte(ms >> 40)
+	b[1] = byte(ms >> 32)
+	b[2] = byte(ms >> 24)
+	b[3] = byte(ms >> 16)
+	b[4] = byte(ms >> 8)
+	b[5] = byte(ms)
+	b[6] = b[6]&0x0f | 0x70
+	b[8] = b[8]&0x3f | 0x80
+
+	h := hex.EncodeToString(b[:])
+	return h[0:8] + "-" + h[8:12] + "-" + h[12:16] + "-" + h[16:20] + "-" + h[20:], nil
+}
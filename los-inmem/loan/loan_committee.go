@@ -0,0 +1,462 @@
+package loan
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/fikryfahrezy/adea/los-inmen/committee"
+	"github.com/fikryfahrezy/adea/los-inmen/model"
+	"github.com/fikryfahrezy/adea/los-inmen/rbac"
+	"github.com/fikryfahrezy/adea/los-inmen/resp"
+)
+
+var (
+	ErrCommitteeRequired = errors.New("loan above the committee threshold is decided by the credit committee")
+	ErrMemberNotValid    = errors.New("officer not found, can not vote or took the loan in review")
+	ErrVoteNotClosed     = errors.New("expired committee vote not closed")
+)
+
+// CommitteeActorRole is the actor role of the history of the loan decided by the committee vote
+const CommitteeActorRole = "credit_committee"
+
+type (
+	OpenVoteIn struct {
+		OfficerIds []string `json:"officer_ids"`
+		Note       string   `json:"note"`
+	}
+	CastVoteIn struct {
+		Choice  string `json:"choice"`
+		Comment string `json:"comment"`
+	}
+	BallotRes struct {
+		OfficerId string `json:"officer_id"`
+		Choice    string `json:"choice"`
+		Comment   string `json:"comment"`
+		VotedDate string `json:"voted_date"`
+	}
+	VoteRes struct {
+		Quorum       int         `json:"quorum"`
+		Majority     int         `json:"majority"`
+		Invited      int         `json:"invited"`
+		Approve      int         `json:"approve"`
+		Reject       int         `json:"reject"`
+		Abstain      int         `json:"abstain"`
+		Id           string      `json:"id"`
+		LoanId       string      `json:"loan_id"`
+		OpenedBy     string      `json:"opened_by"`
+		Status       string      `json:"status"`
+		Note         string      `json:"note"`
+		DeadlineDate string      `json:"deadline_date"`
+		CreatedDate  string      `json:"created_date"`
+		ClosedDate   string      `json:"closed_date"`
+		Ballots      []BallotRes `json:"ballots"`
+	}
+	VoteOut struct {
+		resp.Response
+		Res VoteRes
+	}
+	VotesOut struct {
+		resp.Response
+		Res []VoteRes
+	}
+)
+
+func dateRes(t time.Time) string {
+	if t.IsZero() {
+		return ""
+	}
+
+	return t.Format(time.RFC3339)
+}
+
+func voteRes(vote model.CommitteeVote, ballots []model.CommitteeBallot) VoteRes {
+	tally := tallyOf(ballots)
+	res := VoteRes{
+		Quorum:       vote.Quorum,
+		Majority:     vote.Majority,
+		Invited:      tally.Invited,
+		Approve:      tally.Approve,
+		Reject:       tally.Reject,
+		Abstain:      tally.Abstain,
+		Id:           vote.Id,
+		LoanId:       vote.LoanId,
+		OpenedBy:     vote.OpenedBy,
+		Status:       vote.Status,
+		Note:         vote.Note,
+		DeadlineDate: dateRes(vote.DeadlineDate),
+		CreatedDate:  dateRes(vote.CreatedDate),
+		ClosedDate:   dateRes(vote.ClosedDate),
+		Ballots:      make([]BallotRes, 0, len(ballots)),
+	}
+
+	for _, b := range ballots {
+		res.Ballots = append(res.Ballots, BallotRes{
+			OfficerId: b.OfficerId,
+			Choice:    b.Choice,
+			Comment:   b.Comment,
+			VotedDate: dateRes(b.VotedDate),
+		})
+	}
+
+	return res
+}
+
+func tallyOf(ballots []model.CommitteeBallot) committee.Tally {
+	choices := make([]string, 0, len(ballots))
+	for _, b := range ballots {
+		choices = append(choices, b.Choice)
+	}
+
+	return committee.Count(len(ballots), choices)
+}
+
+// OpenVote invite the officers to decide on the loan in review, the loan can not be moved
+// by anyone until the vote is closed
+func (a *LoanApp) OpenVote(ctx context.Context, loanId, userId string, in OpenVoteIn) (out VoteOut) {
+	out.Response = resp.NewResponse(http.StatusOK, "", nil)
+
+	if err := validateOpenVote(in); err != nil {
+		out.Response = resp.NewResponse(http.StatusUnprocessableEntity, "", err)
+		return
+	}
+
+	user, res := a.authorize(ctx, userId, rbac.CommitteeOpen)
+	if res.Error != nil {
+		out.Response = res
+		return
+	}
+
+	userLoan, err := a.repository.GetLoan(ctx, loanId)
+	if errors.Is(err, ErrUserLoanNotFound) {
+		out.Response = resp.NewResponse(http.StatusNotFound, "", err)
+		return
+	}
+	if err != nil {
+		out.Response = resp.NewResponse(http.StatusInternalServerError, "", err)
+		return
+	}
+
+	if status, _ := FromString(userLoan.Status); status != InReview {
+		out.Response = resp.NewResponse(http.StatusBadRequest, "", ErrModifyProcessLoan)
+		return
+	}
+
+	histories, err := a.repository.GetLoanHistories(ctx, loanId)
+	if err != nil {
+		out.Response = resp.NewResponse(http.StatusInternalServerError, "", err)
+		return
+	}
+
+	reviewers := reviewersOf(histories)
+	officerIds := uniqueStrings(in.OfficerIds)
+	for _, v := range officerIds {
+		officer, err := a.repository.GetUser(ctx, v)
+		if errors.Is(err, ErrUserNotFound) ||
+			(err == nil && (!officer.IsActive() || !rbac.Can(officer.Role, rbac.CommitteeVote) || reviewers[v] || v == userLoan.UserId)) {
+			out.Response = resp.NewResponse(http.StatusUnprocessableEntity, "", ErrMemberNotValid)
+			return
+		}
+		if err != nil {
+			out.Response = resp.NewResponse(http.StatusInternalServerError, "", err)
+			return
+		}
+	}
+
+	vote, ballots, err := a.repository.InsertCommitteeVote(ctx, model.CommitteeVote{
+		LoanId:       loanId,
+		OpenedBy:     user.Id,
+		Status:       committee.Open.String(),
+		Note:         strings.TrimSpace(in.Note),
+		Quorum:       a.committee.Quorum,
+		Majority:     a.committee.Majority,
+		DeadlineDate: time.Now().Add(a.committee.VoteTTL),
+	}, officerIds)
+	if errors.Is(err, ErrUserLoanNotFound) {
+		out.Response = resp.NewResponse(http.StatusNotFound, "", err)
+		return
+	}
+	if errors.Is(err, ErrVoteOpen) {
+		out.Response = resp.NewResponse(http.StatusConflict, "", err)
+		return
+	}
+	if err != nil {
+		out.Response = resp.NewResponse(http.StatusInternalServerError, "", err)
+		return
+	}
+
+	out.Res = voteRes(vote, ballots)
+
+	return
+}
+
+// GetLoanVotes list every committee vote of the loan with its ballots, the oldest first
+func (a *LoanApp) GetLoanVotes(ctx context.Context, loanId, userId string) (out VotesOut) {
+	out.Response = resp.NewResponse(http.StatusOK, "", nil)
+
+	if _, out.Response = a.authorize(ctx, userId, rbac.LoanReadAll); out.Error != nil {
+		return
+	}
+
+	if _, err := a.repository.GetLoan(ctx, loanId); errors.Is(err, ErrUserLoanNotFound) {
+		out.Response = resp.NewResponse(http.StatusNotFound, "", err)
+		return
+	} else if err != nil {
+		out.Response = resp.NewResponse(http.StatusInternalServerError, "", err)
+		return
+	}
+
+	votes, err := a.repository.GetCommitteeVotes(ctx, loanId)
+	if err != nil {
+		out.Response = resp.NewResponse(http.StatusInternalServerError, "", err)
+		return
+	}
+
+	res := make([]VoteRes, 0, len(votes))
+	for _, v := range votes {
+		ballots, err := a.repository.GetCommitteeBallots(ctx, v.Id)
+		if err != nil {
+			out.Response = resp.NewResponse(http.StatusInternalServerError, "", err)
+			return
+		}
+
+		res = append(res, voteRes(v, ballots))
+	}
+
+	out.Res = res
+
+	return
+}
+
+// CastVote keep the choice of the invited officer, the vote close as soon as every officer voted
+func (a *LoanApp) CastVote(ctx context.Context, voteId, userId string, in CastVoteIn) (out VoteOut) {
+	out.Response = resp.NewResponse(http.StatusOK, "", nil)
+
+	if err := validateCastVote(in); err != nil {
+		out.Response = resp.NewResponse(http.StatusUnprocessableEntity, "", err)
+		return
+	}
+
+	user, res := a.authorize(ctx, userId, rbac.CommitteeVote)
+	if res.Error != nil {
+		out.Response = res
+		return
+	}
+
+	vote, res := a.getVote(ctx, voteId)
+	if res.Error != nil {
+		out.Response = res
+		return
+	}
+
+	// the vote past its deadline is closed with the votes it has, the sweeper may not have got to it yet
+	if vote.Status == committee.Open.String() && !vote.DeadlineDate.After(time.Now()) {
+		if _, _, out.Response = a.closeVote(ctx, vote); out.Error == nil {
+			out.Response = resp.NewResponse(http.StatusConflict, "", ErrVoteClosed)
+		}
+		return
+	}
+
+	_, err := a.repository.CastBallot(ctx, model.CommitteeBallot{
+		VoteId:    voteId,
+		OfficerId: user.Id,
+		Choice:    in.Choice,
+		Comment:   strings.TrimSpace(in.Comment),
+	})
+	if errors.Is(err, ErrVoteNotFound) {
+		out.Response = resp.NewResponse(http.StatusNotFound, "", err)
+		return
+	}
+	if errors.Is(err, ErrNotVoteMember) {
+		out.Response = resp.NewResponse(http.StatusForbidden, "", err)
+		return
+	}
+	if errors.Is(err, ErrVoteClosed) || errors.Is(err, ErrAlreadyVoted) {
+		out.Response = resp.NewResponse(http.StatusConflict, "", err)
+		return
+	}
+	if err != nil {
+		out.Response = resp.NewResponse(http.StatusInternalServerError, "", err)
+		return
+	}
+
+	ballots, err := a.repository.GetCommitteeBallots(ctx, voteId)
+	if err != nil {
+		out.Response = resp.NewResponse(http.StatusInternalServerError, "", err)
+		return
+	}
+
+	if tally := tallyOf(ballots); tally.Voted() == tally.Invited {
+		if vote, ballots, out.Response = a.closeVote(ctx, vote); out.Error != nil {
+			return
+		}
+	}
+
+	out.Res = voteRes(vote, ballots)
+
+	return
+}
+
+// CloseVote close the vote before its deadline with the votes it has
+func (a *LoanApp) CloseVote(ctx context.Context, voteId, userId string) (out VoteOut) {
+	out.Response = resp.NewResponse(http.StatusOK, "", nil)
+
+	if _, out.Response = a.authorize(ctx, userId, rbac.CommitteeOpen); out.Error != nil {
+		return
+	}
+
+	vote, res := a.getVote(ctx, voteId)
+	if res.Error != nil {
+		out.Response = res
+		return
+	}
+
+	vote, ballots, res := a.closeVote(ctx, vote)
+	if res.Error != nil {
+		out.Response = res
+		return
+	}
+
+	out.Res = voteRes(vote, ballots)
+
+	return
+}
+
+// CloseExpiredVotes close every open vote past its deadline, it return how many were closed
+// and the error of every vote that could not be
+func (a *LoanApp) CloseExpiredVotes(ctx context.Context) (int, error) {
+	votes, err := a.repository.GetExpiredCommitteeVotes(ctx, time.Now())
+	if err != nil {
+		return 0, err
+	}
+
+	// one vote that can not be closed does not keep the others open
+	n := 0
+	var failed []string
+	for _, v := range votes {
+		_, _, res := a.closeVote(ctx, v)
+		if errors.Is(res.Error, ErrVoteClosed) {
+			continue
+		}
+		if res.Error != nil {
+			failed = append(failed, fmt.Sprintf("vote %s: %v", v.Id, res.Error))
+			continue
+		}
+		n++
+	}
+
+	if len(failed) > 0 {
+		return n, fmt.Errorf("%w, %s", ErrVoteNotClosed, strings.Join(failed, "; "))
+	}
+
+	return n, nil
+}
+
+// RunVoteSweeper call CloseExpiredVotes every interval until the context is done,
+// it is blocking so it should be run in its own goroutine
+func RunVoteSweeper(ctx context.Context, a *LoanApp, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			a.CloseExpiredVotes(ctx)
+		}
+	}
+}
+
+func (a *LoanApp) getVote(ctx context.Context, voteId string) (model.CommitteeVote, resp.Response) {
+	vote, err := a.repository.GetCommitteeVote(ctx, voteId)
+	if errors.Is(err, ErrVoteNotFound) {
+		return model.CommitteeVote{}, resp.NewResponse(http.StatusNotFound, "", err)
+	}
+	if err != nil {
+		return model.CommitteeVote{}, resp.NewResponse(http.StatusInternalServerError, "", err)
+	}
+
+	return vote, resp.NewResponse(http.StatusOK, "", nil)
+}
+
+// closeVote count the ballots, close the vote with its outcome and move the loan by it,
+// the loan is left in review when the vote has no quorum. The vote of the loan that was removed
+// or left the review is closed as void instead, otherwise it would be tried on every sweep
+func (a *LoanApp) closeVote(ctx context.Context, vote model.CommitteeVote) (model.CommitteeVote, []model.CommitteeBallot, resp.Response) {
+	ballots, err := a.repository.GetCommitteeBallots(ctx, vote.Id)
+	if err != nil {
+		return model.CommitteeVote{}, nil, resp.NewResponse(http.StatusInternalServerError, "", err)
+	}
+
+	tally := tallyOf(ballots)
+	outcome := tally.Outcome(vote.Quorum, vote.Majority)
+	vote.Status = outcome.String()
+	vote.ClosedDate = time.Now()
+
+	// the committee move the loan itself, so the decision does not depend on the officer
+	// that opened the vote still being allowed to decide, the opener is kept as the actor of the history
+	var prevStatus string
+	var userLoan model.LoanApplication
+	var history model.LoanStatusHistory
+	if outcome != committee.NoQuorum {
+		userLoan, err = a.repository.GetLoan(ctx, vote.LoanId)
+		if err != nil && !errors.Is(err, ErrUserLoanNotFound) {
+			return model.CommitteeVote{}, nil, resp.NewResponse(http.StatusInternalServerError, "", err)
+		}
+		if err != nil || userLoan.Status != InReview.String() {
+			outcome = committee.Void
+			vote.Status = outcome.String()
+			userLoan = model.LoanApplication{}
+		}
+	}
+	if outcome == committee.Approved || outcome == committee.Rejected {
+		to := Rejected
+		if outcome == committee.Approved {
+			to = Approved
+		}
+
+		prevStatus = userLoan.Status
+		userLoan.Status = to.String()
+		userLoan.DecisionReasons = []string{ReasonOther.String()}
+		userLoan.DecisionNote = "Decided by the credit committee"
+		userLoan.DecisionInternalNote = fmt.Sprintf("Credit committee vote %s: %d approve, %d reject, %d abstain of %d invited",
+			vote.Status, tally.Approve, tally.Reject, tally.Abstain, tally.Invited)
+		history = model.LoanStatusHistory{
+			FromStatus: InReview.String(),
+			ToStatus:   to.String(),
+			ActorId:    vote.OpenedBy,
+			ActorRole:  CommitteeActorRole,
+			Comment:    userLoan.DecisionNote,
+		}
+	}
+
+	err = a.repository.CloseCommitteeVote(ctx, vote, prevStatus, userLoan, history)
+	if errors.Is(err, ErrVoteNotFound) || errors.Is(err, ErrUserLoanNotFound) {
+		return model.CommitteeVote{}, nil, resp.NewResponse(http.StatusNotFound, "", err)
+	}
+	if errors.Is(err, ErrVoteClosed) || errors.Is(err, ErrLoanStatusChanged) {
+		return model.CommitteeVote{}, nil, resp.NewResponse(http.StatusConflict, "", err)
+	}
+	if err != nil {
+		return model.CommitteeVote{}, nil, resp.NewResponse(http.StatusInternalServerError, "", err)
+	}
+
+	return vote, ballots, resp.NewResponse(http.StatusOK, "", nil)
+}
+
+// checkNoOpenVote stop the loan from being moved while the committee vote on it
+func (a *LoanApp) checkNoOpenVote(ctx context.Context, loanId string) resp.Response {
+	_, err := a.repository.GetOpenCommitteeVote(ctx, loanId)
+	if err == nil {
+		return resp.NewResponse(http.StatusConflict, "", ErrVoteOpen)
+	}
+	if !errors.Is(err, ErrVoteNotFound) {
+		return resp.NewResponse(http.StatusInternalServerError, "", err)
+	}
+
+	return resp.NewResponse(http.StatusOK, "", nil)
+}
@@ -0,0 +1,123 @@
+package loan
+
+import "github.com/fikryfahrezy/adea/los-inmen/model"
+
+// loanFields is every field the officer can ask the applicant to correct,
+// named as the form field of /loan/update
+var loanFields = []string{
+	"full_name",
+	"birth_date",
+	"full_address",
+	"phone",
+	"other_business",
+	"id_card",
+	"is_private_field",
+	"exp_in_year",
+	"active_field_number",
+	"sow_seeds_per_cycle",
+	"needed_fertilizer_per_cycle_in_kg",
+	"estimated_yield_in_kg",
+	"estimated_price_of_harvest_per_kg",
+	"harvest_cycle_in_months",
+	"loan_application_in_idr",
+	"business_income_per_month_in_idr",
+	"business_outcome_per_month_in_idr",
+	"region",
+}
+
+func isLoanField(name string) bool {
+	for _, v := range loanFields {
+		if v == name {
+			return true
+		}
+	}
+
+	return false
+}
+
+// copyLoanField copy the value of the named field from one loan to the other
+func copyLoanField(name string, to *model.LoanApplication, from model.LoanApplication) {
+	switch name {
+	case "full_name":
+		to.FullName = from.FullName
+	case "birth_date":
+		to.BirthDate = from.BirthDate
+	case "full_address":
+		to.FullAddress = from.FullAddress
+	case "phone":
+		to.Phone = from.Phone
+	case "other_business":
+		to.OtherBusiness = from.OtherBusiness
+	case "id_card":
+		to.IdCardUrl = from.IdCardUrl
+	case "is_private_field":
+		to.IsPrivateField = from.IsPrivateField
+	case "exp_in_year":
+		to.ExpInYear = from.ExpInYear
+	case "active_field_number":
+		to.ActiveFieldNumber = from.ActiveFieldNumber
+	case "sow_seeds_per_cycle":
+		to.SowSeedsPerCycle = from.SowSeedsPerCycle
+	case "needed_fertilizer_per_cycle_in_kg":
+		to.NeededFertilizerPerCycleInKg = from.NeededFertilizerPerCycleInKg
+	case "estimated_yield_in_kg":
+		to.EstimatedYieldInKg = from.EstimatedYieldInKg
+	case "estimated_price_of_harvest_per_kg":
+		to.EstimatedPriceOfHarvestPerKg = from.EstimatedPriceOfHarvestPerKg
+	case "harvest_cycle_in_months":
+		to.HarvestCycleInMonths = from.HarvestCycleInMonths
+	case "loan_application_in_idr":
+		to.LoanApplicationInIdr = from.LoanApplicationInIdr
+	case "business_income_per_month_in_idr":
+		to.BusinessIncomePerMonthInIdr = from.BusinessIncomePerMonthInIdr
+	case "business_outcome_per_month_in_idr":
+		to.BusinessOutcomePerMonthInIdr = from.BusinessOutcomePerMonthInIdr
+	case "region":
+		to.Region = from.Region
+	}
+}
+
+func isUnlocked(userLoan model.LoanApplication, name string) bool {
+	for _, v := range userLoan.UnlockedFields {
+		if v == name {
+			return true
+		}
+	}
+
+	return false
+}
+
+// keepLockedFields put back the current value of every field the officer did not unlock,
+// so the update of the loan that needs info only change what was asked
+func keepLockedFields(updated, current model.LoanApplication) model.LoanApplication {
+	for _, name := range loanFields {
+		if !isUnlocked(current, name) {
+			copyLoanField(name, &updated, current)
+		}
+	}
+
+	return updated
+}
+
+// uniqueStrings drop the value given twice and keep the order of the first one
+func uniqueStrings(values []string) []string {
+	res := make([]string, 0, len(values))
+	seen := make(map[string]bool, len(values))
+	for _, v := range values {
+		if !seen[v] {
+			seen[v] = true
+			res = append(res, v)
+		}
+	}
+
+	return res
+}
+
+// nonNilStrings keep the list empty instead of null, in the response and in the array column
+func nonNilStrings(s []string) []string {
+	if s == nil {
+		return []string{}
+	}
+
+	return s
+}
@@ -2,59 +2,37 @@ package loan
 
 import (
 	"context"
-	"encoding/hex"
 	"errors"
-	"fmt"
-	"math/rand"
+	"sort"
 	"time"
 
+	"github.com/fikryfahrezy/adea/los-inmen/committee"
 	"github.com/fikryfahrezy/adea/los-inmen/data"
+	"github.com/fikryfahrezy/adea/los-inmen/id"
 	"github.com/fikryfahrezy/adea/los-inmen/model"
+	"github.com/fikryfahrezy/adea/los-inmen/queue"
 )
 
-type Status struct {
-	slug string
-}
-
-func (r Status) String() string {
-	return r.slug
-}
-
-var (
-	Unknown = Status{""}
-	Wait    = Status{"wait"}
-	Process = Status{"process"}
-	Reject  = Status{"reject"}
-	Approve = Status{"approve"}
-)
-
-func FromString(s string) (Status, error) {
-	switch s {
-	case Wait.slug:
-		return Wait, nil
-	case Process.slug:
-		return Process, nil
-	case Reject.slug:
-		return Reject, nil
-	case Approve.slug:
-		return Approve, nil
-	}
-
-	return Unknown, errors.New("unknown status: " + s)
-}
-
 var (
-	ErrUserNotFound     = errors.New("user not found")
-	ErrUserLoanNotFound = errors.New("user loan not found")
+	ErrUserNotFound      = errors.New("user not found")
+	ErrUserLoanNotFound  = errors.New("user loan not found")
+	ErrLoanStatusChanged = errors.New("loan status changed by someone else, reload the loan")
+	ErrVoteNotFound      = errors.New("committee vote not found")
+	ErrVoteOpen          = errors.New("a committee vote is still open on the loan")
+	ErrVoteClosed        = errors.New("committee vote already closed")
+	ErrNotVoteMember     = errors.New("user not invited to the committee vote")
+	ErrAlreadyVoted      = errors.New("user already voted")
 )
 
 type Repository struct {
-	db *data.JsonFile
+	db  *data.JsonFile
+	ids id.Generator
 }
 
-func NewRepository(db *data.JsonFile) *Repository {
+func NewRepository(db *data.JsonFile, ids id.Generator) *Repository {
 	return &Repository{
-		db: db,
+		db:  db,
+		ids: ids,
 	}
 }
 
@@ -76,7 +54,7 @@ func (r *Repository) GetUserLoans(ctx context.Context, userId string) (map[strin
 
 	userLoans := make(map[string]model.LoanApplication)
 	for k, v := range r.db.DbLoan {
-		if v.UserId == userId {
+		if v.UserId == userId && v.DeletedDate.IsZero() {
 			userLoans[k] = v
 		}
 	}
@@ -89,7 +67,7 @@ func (r *Repository) GetUserLoan(ctx context.Context, loanId, userId string) (mo
 	defer r.db.Unlock()
 
 	for _, v := range r.db.DbLoan {
-		if v.UserId == userId && v.Id == loanId {
+		if v.UserId == userId && v.Id == loanId && v.DeletedDate.IsZero() {
 			return v, nil
 		}
 	}
@@ -101,7 +79,29 @@ func (r *Repository) GetLoans(ctx context.Context) (map[string]model.LoanApplica
 	r.db.Lock()
 	defer r.db.Unlock()
 
-	return r.db.DbLoan, nil
+	loans := make(map[string]model.LoanApplication)
+	for k, v := range r.db.DbLoan {
+		if v.DeletedDate.IsZero() {
+			loans[k] = v
+		}
+	}
+
+	return loans, nil
+}
+
+// GetDeletedLoans return the loan deleted by the applicant or archived by the officer
+func (r *Repository) GetDeletedLoans(ctx context.Context) (map[string]model.LoanApplication, error) {
+	r.db.Lock()
+	defer r.db.Unlock()
+
+	loans := make(map[string]model.LoanApplication)
+	for k, v := range r.db.DbLoan {
+		if !v.DeletedDate.IsZero() {
+			loans[k] = v
+		}
+	}
+
+	return loans, nil
 }
 
 func (r *Repository) GetLoan(ctx context.Context, loanId string) (model.LoanApplication, error) {
@@ -109,7 +109,7 @@ func (r *Repository) GetLoan(ctx context.Context, loanId string) (model.LoanAppl
 	defer r.db.Unlock()
 
 	for _, v := range r.db.DbLoan {
-		if v.Id == loanId {
+		if v.Id == loanId && v.DeletedDate.IsZero() {
 			return v, nil
 		}
 	}
@@ -118,39 +118,507 @@ func (r *Repository) GetLoan(ctx context.Context, loanId string) (model.LoanAppl
 }
 
 func (r *Repository) InsertLoan(ctx context.Context, loan model.LoanApplication) (model.LoanApplication, error) {
-	t := time.Now()
-	tn := t.UnixNano()
-	ra := rand.New(rand.NewSource(tn))
-	id := hex.EncodeToString([]byte(fmt.Sprintf("%d-%d", tn, ra)))
+	loanId, err := r.ids.New()
+	if err != nil {
+		return model.LoanApplication{}, err
+	}
 
-	loan.Id = id
+	t := time.Now()
+	loan.Id = loanId
 	loan.CreatedDate = t
 	loan.UpdatedDate = t
-	loan.Status = Wait.String()
+	if loan.Status == "" {
+		loan.Status = Submitted.String()
+	}
 
 	r.db.Lock()
 	defer r.db.Unlock()
-	r.db.DbLoan[id] = loan
+	r.db.DbLoan[loanId] = loan
 
 	return loan, nil
 }
 
+// RemoveLoan only mark the loan as deleted, the loan and its history are kept for the record
 func (r *Repository) RemoveLoan(ctx context.Context, loanId string) error {
 	r.db.Lock()
 	defer r.db.Unlock()
 
-	if _, ok := r.db.DbLoan[loanId]; ok {
-		delete(r.db.DbLoan, loanId)
+	loan, ok := r.db.DbLoan[loanId]
+	if !ok || !loan.DeletedDate.IsZero() {
+		return ErrUserLoanNotFound
 	}
 
+	loan.DeletedDate = time.Now()
+	r.db.DbLoan[loanId] = loan
+
 	return nil
 }
 
-func (r *Repository) UpdateLoan(ctx context.Context, loanId string, loan model.LoanApplication) error {
+// RestoreLoan bring back the deleted loan to the listing, the open loan is not restored
+// when its applicant already has another open loan
+func (r *Repository) RestoreLoan(ctx context.Context, loanId string) error {
 	r.db.Lock()
 	defer r.db.Unlock()
 
+	loan, ok := r.db.DbLoan[loanId]
+	if !ok || loan.DeletedDate.IsZero() {
+		return ErrUserLoanNotFound
+	}
+	if status, _ := FromString(loan.Status); status.IsOpen() {
+		for _, v := range r.db.DbLoan {
+			if status, _ := FromString(v.Status); v.UserId == loan.UserId && v.DeletedDate.IsZero() && status.IsOpen() {
+				return ErrProcessLoanExist
+			}
+		}
+	}
+
+	loan.DeletedDate = time.Time{}
+	loan.UpdatedDate = time.Now()
 	r.db.DbLoan[loanId] = loan
 
 	return nil
 }
+
+// UpdateLoan save the fields edited by the applicant, the status, the officer and the claim are kept,
+// the loan is only saved when its status is still the prevStatus it was read with
+func (r *Repository) UpdateLoan(ctx context.Context, prevStatus string, loan model.LoanApplication) error {
+	r.db.Lock()
+	defer r.db.Unlock()
+
+	current, ok := r.db.DbLoan[loan.Id]
+	if !ok || !current.DeletedDate.IsZero() {
+		return ErrUserLoanNotFound
+	}
+	if current.Status != prevStatus {
+		return ErrLoanStatusChanged
+	}
+
+	loan.Status = current.Status
+	loan.OfficerId = current.OfficerId
+	loan.ClaimedDate = current.ClaimedDate
+	loan.UpdatedDate = time.Now()
+	r.db.DbLoan[loan.Id] = loan
+
+	return nil
+}
+
+// TransitionLoan save the loan with its new status and append the history of the change,
+// the loan is only saved when its status is still the prevStatus it was read with
+func (r *Repository) TransitionLoan(ctx context.Context, prevStatus string, loan model.LoanApplication, h model.LoanStatusHistory) (model.LoanStatusHistory, error) {
+	historyId, err := r.ids.New()
+	if err != nil {
+		return model.LoanStatusHistory{}, err
+	}
+
+	h.Id = historyId
+	h.LoanId = loan.Id
+	h.CreatedDate = time.Now()
+
+	r.db.Lock()
+	defer r.db.Unlock()
+
+	if err := r.transitionLoan(prevStatus, loan, h); err != nil {
+		return model.LoanStatusHistory{}, err
+	}
+
+	return h, nil
+}
+
+// transitionLoan is TransitionLoan for the caller that already hold the lock, the history is already made
+func (r *Repository) transitionLoan(prevStatus string, loan model.LoanApplication, h model.LoanStatusHistory) error {
+	current, ok := r.db.DbLoan[loan.Id]
+	if !ok || !current.DeletedDate.IsZero() {
+		return ErrUserLoanNotFound
+	}
+	if current.Status != prevStatus {
+		return ErrLoanStatusChanged
+	}
+
+	loan.UpdatedDate = h.CreatedDate
+	r.db.DbLoan[loan.Id] = loan
+	r.db.DbLoanStatus[h.Id] = h
+
+	return nil
+}
+
+// WithdrawLoan cancel the open loan deleted by the applicant and mark it as deleted at once,
+// with the history of the cancel, the loan is only saved when its status is still prevStatus
+func (r *Repository) WithdrawLoan(ctx context.Context, prevStatus string, loan model.LoanApplication, h model.LoanStatusHistory) (model.LoanStatusHistory, error) {
+	historyId, err := r.ids.New()
+	if err != nil {
+		return model.LoanStatusHistory{}, err
+	}
+
+	t := time.Now()
+	loan.UpdatedDate = t
+	loan.DeletedDate = t
+	h.Id = historyId
+	h.LoanId = loan.Id
+	h.CreatedDate = t
+
+	r.db.Lock()
+	defer r.db.Unlock()
+
+	current, ok := r.db.DbLoan[loan.Id]
+	if !ok || !current.DeletedDate.IsZero() {
+		return model.LoanStatusHistory{}, ErrUserLoanNotFound
+	}
+	if current.Status != prevStatus {
+		return model.LoanStatusHistory{}, ErrLoanStatusChanged
+	}
+
+	r.db.DbLoan[loan.Id] = loan
+	r.db.DbLoanStatus[h.Id] = h
+
+	return h, nil
+}
+
+// GetLoanHistories return every status change of the loan, the oldest first
+func (r *Repository) GetLoanHistories(ctx context.Context, loanId string) ([]model.LoanStatusHistory, error) {
+	r.db.RLock()
+	defer r.db.RUnlock()
+
+	return r.loanHistories(loanId), nil
+}
+
+// loanHistories is GetLoanHistories for the caller that already hold the lock
+func (r *Repository) loanHistories(loanId string) []model.LoanStatusHistory {
+	histories := make([]model.LoanStatusHistory, 0)
+	for _, v := range r.db.DbLoanStatus {
+		if v.LoanId == loanId {
+			histories = append(histories, v)
+		}
+	}
+
+	// The id is time sortable, it keep the order of the change made in the same instant
+	sort.Slice(histories, func(i, j int) bool {
+		return histories[i].Id < histories[j].Id
+	})
+
+	return histories
+}
+
+// GetQueueOfficers return the active user of the roles with their region and how many open loan they have,
+// the loan is only counted while isClaimed tell the officer still hold it
+func (r *Repository) GetQueueOfficers(ctx context.Context, roles []string, isClaimed func(officerId string, claimedDate, now time.Time) bool) ([]queue.Officer, error) {
+	r.db.Lock()
+	defer r.db.Unlock()
+
+	isQueueRole := make(map[string]bool, len(roles))
+	for _, v := range roles {
+		isQueueRole[v] = true
+	}
+
+	now := time.Now()
+	loads := make(map[string]int)
+	for _, v := range r.db.DbLoan {
+		if status, _ := FromString(v.Status); v.DeletedDate.IsZero() && status.IsOpen() && isClaimed(v.OfficerId, v.ClaimedDate, now) {
+			loads[v.OfficerId]++
+		}
+	}
+
+	officers := make([]queue.Officer, 0)
+	for _, v := range r.db.DbUser {
+		if !isQueueRole[v.Role] || !v.IsActive() {
+			continue
+		}
+
+		officers = append(officers, queue.Officer{
+			Id:     v.Id,
+			Region: r.db.DbOfficerRegion[v.Id].Region,
+			Load:   loads[v.Id],
+		})
+	}
+
+	return officers, nil
+}
+
+// AssignLoan give the loan to its OfficerId only when the stored loan still belong to the prevOfficerId,
+// so two officers claiming the same loan at once does not both get it
+func (r *Repository) AssignLoan(ctx context.Context, prevOfficerId string, loan model.LoanApplication) error {
+	r.db.Lock()
+	defer r.db.Unlock()
+
+	current, ok := r.db.DbLoan[loan.Id]
+	if !ok || !current.DeletedDate.IsZero() {
+		return ErrUserLoanNotFound
+	}
+	if current.OfficerId != prevOfficerId {
+		return ErrLoanClaimed
+	}
+
+	current.OfficerId = loan.OfficerId
+	current.ClaimedDate = loan.ClaimedDate
+	current.UpdatedDate = time.Now()
+	r.db.DbLoan[loan.Id] = current
+
+	return nil
+}
+
+func (r *Repository) SetOfficerRegion(ctx context.Context, region model.OfficerRegion) (model.OfficerRegion, error) {
+	region.UpdatedDate = time.Now()
+
+	r.db.Lock()
+	defer r.db.Unlock()
+
+	r.db.DbOfficerRegion[region.UserId] = region
+
+	return region, nil
+}
+
+// SignLoan keep the approval of the approver and return every signature given since the loan last went
+// in review, the new one included, the loan must still be in the prevStatus it was read with
+func (r *Repository) SignLoan(ctx context.Context, prevStatus string, s model.ApprovalSignature) ([]model.ApprovalSignature, error) {
+	signatureId, err := r.ids.New()
+	if err != nil {
+		return nil, err
+	}
+
+	t := time.Now()
+	s.Id = signatureId
+	s.CreatedDate = t
+
+	r.db.Lock()
+	defer r.db.Unlock()
+
+	current, ok := r.db.DbLoan[s.LoanId]
+	if !ok || !current.DeletedDate.IsZero() {
+		return nil, ErrUserLoanNotFound
+	}
+	if current.Status != prevStatus {
+		return nil, ErrLoanStatusChanged
+	}
+
+	// The signatures are read under the same lock as the new one is kept, so of the approvers
+	// signing at once the last one always see every signature and can approve the loan
+	histories := r.loanHistories(s.LoanId)
+	signatures := currentSignatures(r.approvalSignatures(s.LoanId), histories)
+	if hasSigned(signatures, s.ApproverId) {
+		return nil, ErrAlreadySigned
+	}
+	s.ReviewId = lastReviewId(histories)
+
+	current.UpdatedDate = t
+	r.db.DbLoan[s.LoanId] = current
+	r.db.DbApproval[s.Id] = s
+
+	return append(signatures, s), nil
+}
+
+// GetApprovalSignatures return every approval given to the loan, the oldest first
+func (r *Repository) GetApprovalSignatures(ctx context.Context, loanId string) ([]model.ApprovalSignature, error) {
+	r.db.RLock()
+	defer r.db.RUnlock()
+
+	return r.approvalSignatures(loanId), nil
+}
+
+// approvalSignatures is GetApprovalSignatures for the caller that already hold the lock
+func (r *Repository) approvalSignatures(loanId string) []model.ApprovalSignature {
+	signatures := make([]model.ApprovalSignature, 0)
+	for _, v := range r.db.DbApproval {
+		if v.LoanId == loanId {
+			signatures = append(signatures, v)
+		}
+	}
+
+	// The id is time sortable, it keep the order of the approval given in the same instant
+	sort.Slice(signatures, func(i, j int) bool {
+		return signatures[i].Id < signatures[j].Id
+	})
+
+	return signatures
+}
+
+// InsertCommitteeVote open the vote on the loan with a ballot for every invited officer,
+// there is only one open vote on a loan at a time
+func (r *Repository) InsertCommitteeVote(ctx context.Context, vote model.CommitteeVote, officerIds []string) (model.CommitteeVote, []model.CommitteeBallot, error) {
+	voteId, err := r.ids.New()
+	if err != nil {
+		return model.CommitteeVote{}, nil, err
+	}
+
+	t := time.Now()
+	vote.Id = voteId
+	vote.CreatedDate = t
+
+	ballots := make([]model.CommitteeBallot, 0, len(officerIds))
+	for _, v := range officerIds {
+		ballotId, err := r.ids.New()
+		if err != nil {
+			return model.CommitteeVote{}, nil, err
+		}
+
+		ballots = append(ballots, model.CommitteeBallot{
+			Id:          ballotId,
+			VoteId:      vote.Id,
+			OfficerId:   v,
+			CreatedDate: t,
+		})
+	}
+
+	r.db.Lock()
+	defer r.db.Unlock()
+
+	if current, ok := r.db.DbLoan[vote.LoanId]; !ok || !current.DeletedDate.IsZero() {
+		return model.CommitteeVote{}, nil, ErrUserLoanNotFound
+	}
+	for _, v := range r.db.DbVote {
+		if v.LoanId == vote.LoanId && v.Status == committee.Open.String() {
+			return model.CommitteeVote{}, nil, ErrVoteOpen
+		}
+	}
+
+	r.db.DbVote[vote.Id] = vote
+	for _, v := range ballots {
+		r.db.DbBallot[v.Id] = v
+	}
+
+	return vote, ballots, nil
+}
+
+func (r *Repository) GetCommitteeVote(ctx context.Context, voteId string) (model.CommitteeVote, error) {
+	r.db.RLock()
+	defer r.db.RUnlock()
+
+	vote, ok := r.db.DbVote[voteId]
+	if !ok {
+		return model.CommitteeVote{}, ErrVoteNotFound
+	}
+
+	return vote, nil
+}
+
+// GetCommitteeVotes return every vote of the loan, the oldest first
+func (r *Repository) GetCommitteeVotes(ctx context.Context, loanId string) ([]model.CommitteeVote, error) {
+	return r.findCommitteeVotes(func(v model.CommitteeVote) bool {
+		return v.LoanId == loanId
+	}), nil
+}
+
+// GetOpenCommitteeVote return the vote still open on the loan, ErrVoteNotFound when there is none
+func (r *Repository) GetOpenCommitteeVote(ctx context.Context, loanId string) (model.CommitteeVote, error) {
+	votes := r.findCommitteeVotes(func(v model.CommitteeVote) bool {
+		return v.LoanId == loanId && v.Status == committee.Open.String()
+	})
+	if len(votes) == 0 {
+		return model.CommitteeVote{}, ErrVoteNotFound
+	}
+
+	return votes[0], nil
+}
+
+// GetExpiredCommitteeVotes return the open vote past its deadline
+func (r *Repository) GetExpiredCommitteeVotes(ctx context.Context, now time.Time) ([]model.CommitteeVote, error) {
+	return r.findCommitteeVotes(func(v model.CommitteeVote) bool {
+		return v.Status == committee.Open.String() && v.DeadlineDate.Before(now)
+	}), nil
+}
+
+func (r *Repository) findCommitteeVotes(match func(model.CommitteeVote) bool) []model.CommitteeVote {
+	r.db.RLock()
+	defer r.db.RUnlock()
+
+	votes := make([]model.CommitteeVote, 0)
+	for _, v := range r.db.DbVote {
+		if match(v) {
+			votes = append(votes, v)
+		}
+	}
+
+	// The id is time sortable
+	sort.Slice(votes, func(i, j int) bool {
+		return votes[i].Id < votes[j].Id
+	})
+
+	return votes
+}
+
+// GetCommitteeBallots return the ballot of every invited officer of the vote, in the order they were invited
+func (r *Repository) GetCommitteeBallots(ctx context.Context, voteId string) ([]model.CommitteeBallot, error) {
+	r.db.RLock()
+	defer r.db.RUnlock()
+
+	ballots := make([]model.CommitteeBallot, 0)
+	for _, v := range r.db.DbBallot {
+		if v.VoteId == voteId {
+			ballots = append(ballots, v)
+		}
+	}
+
+	sort.Slice(ballots, func(i, j int) bool {
+		return ballots[i].Id < ballots[j].Id
+	})
+
+	return ballots, nil
+}
+
+// CastBallot keep the choice of the officer, only once and only while the vote is open
+func (r *Repository) CastBallot(ctx context.Context, ballot model.CommitteeBallot) (model.CommitteeBallot, error) {
+	r.db.Lock()
+	defer r.db.Unlock()
+
+	vote, ok := r.db.DbVote[ballot.VoteId]
+	if !ok {
+		return model.CommitteeBallot{}, ErrVoteNotFound
+	}
+	if vote.Status != committee.Open.String() {
+		return model.CommitteeBallot{}, ErrVoteClosed
+	}
+
+	for _, v := range r.db.DbBallot {
+		if v.VoteId != ballot.VoteId || v.OfficerId != ballot.OfficerId {
+			continue
+		}
+		if v.Choice != "" {
+			return model.CommitteeBallot{}, ErrAlreadyVoted
+		}
+
+		v.Choice = ballot.Choice
+		v.Comment = ballot.Comment
+		v.VotedDate = time.Now()
+		r.db.DbBallot[v.Id] = v
+
+		return v, nil
+	}
+
+	return model.CommitteeBallot{}, ErrNotVoteMember
+}
+
+// CloseCommitteeVote save the outcome of the vote, only the open vote can be closed. The loan the vote decided,
+// when h has a status to move to, is saved with its new status and the history under the same lock
+func (r *Repository) CloseCommitteeVote(ctx context.Context, vote model.CommitteeVote, prevStatus string, loan model.LoanApplication, h model.LoanStatusHistory) error {
+	if h.ToStatus != "" {
+		historyId, err := r.ids.New()
+		if err != nil {
+			return err
+		}
+
+		h.Id = historyId
+		h.LoanId = loan.Id
+		h.CreatedDate = vote.ClosedDate
+	}
+
+	r.db.Lock()
+	defer r.db.Unlock()
+
+	current, ok := r.db.DbVote[vote.Id]
+	if !ok {
+		return ErrVoteNotFound
+	}
+	if current.Status != committee.Open.String() {
+		return ErrVoteClosed
+	}
+
+	if h.ToStatus != "" {
+		if err := r.transitionLoan(prevStatus, loan, h); err != nil {
+			return err
+		}
+	}
+
+	current.Status = vote.Status
+	current.ClosedDate = vote.ClosedDate
+	r.db.DbVote[vote.Id] = current
+
+	return nil
+}
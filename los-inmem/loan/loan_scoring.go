@@ -0,0 +1,65 @@
+package loan
+
+import (
+	"time"
+
+	"github.com/fikryfahrezy/adea/los-inmen/model"
+	"github.com/fikryfahrezy/adea/los-inmen/scoring"
+)
+
+// scoreLoan compute the credit score of the loan from its current fields
+func scoreLoan(userLoan model.LoanApplication) model.LoanApplication {
+	userLoan.CreditScore = scoring.Evaluate(userLoan)
+	userLoan.CreditScore.ScoredDate = time.Now()
+
+	return userLoan
+}
+
+type (
+	ScoreFactorRes struct {
+		Name        string `json:"name"`
+		Weight      int64  `json:"weight"`
+		Points      int64  `json:"points"`
+		Explanation string `json:"explanation"`
+	}
+	CreditScoreRes struct {
+		ProjectedRevenuePerYearInIdr int64            `json:"projected_revenue_per_year_in_idr"`
+		NetMargin                    float64          `json:"net_margin"`
+		LoanToRevenue                float64          `json:"loan_to_revenue"`
+		DebtServiceRatio             float64          `json:"debt_service_ratio"`
+		Score                        int64            `json:"score"`
+		Grade                        string           `json:"grade"`
+		Factors                      []ScoreFactorRes `json:"factors"`
+		ScoredDate                   string           `json:"scored_date"`
+	}
+)
+
+// creditScoreRes show the stored score, the loan created before the scoring existed
+// is scored on the fly without a scored date
+func creditScoreRes(userLoan model.LoanApplication) CreditScoreRes {
+	score := userLoan.CreditScore
+	if score.Grade == "" {
+		score = scoring.Evaluate(userLoan)
+	}
+
+	factors := make([]ScoreFactorRes, 0, len(score.Factors))
+	for _, f := range score.Factors {
+		factors = append(factors, ScoreFactorRes{
+			Name:        f.Name,
+			Weight:      f.Weight,
+			Points:      f.Points,
+			Explanation: f.Explanation,
+		})
+	}
+
+	return CreditScoreRes{
+		ProjectedRevenuePerYearInIdr: score.ProjectedRevenuePerYearInIdr,
+		NetMargin:                    score.NetMargin,
+		LoanToRevenue:                score.LoanToRevenue,
+		DebtServiceRatio:             score.DebtServiceRatio,
+		Score:                        score.Score,
+		Grade:                        score.Grade,
+		Factors:                      factors,
+		ScoredDate:                   dateRes(score.ScoredDate),
+	}
+}
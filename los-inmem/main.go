@@ -1,28 +1,96 @@
 package main
 
 import (
+	"context"
+	"log"
+	"os"
+	"time"
+
 	"github.com/fikryfahrezy/adea/los-inmen/auth"
+	"github.com/fikryfahrezy/adea/los-inmen/committee"
 	"github.com/fikryfahrezy/adea/los-inmen/data"
 	"github.com/fikryfahrezy/adea/los-inmen/file"
 	"github.com/fikryfahrezy/adea/los-inmen/handler"
+	"github.com/fikryfahrezy/adea/los-inmen/id"
 	"github.com/fikryfahrezy/adea/los-inmen/loan"
+	"github.com/fikryfahrezy/adea/los-inmen/notify"
+	"github.com/fikryfahrezy/adea/los-inmen/oidc"
+	"github.com/fikryfahrezy/adea/los-inmen/queue"
 	"github.com/fikryfahrezy/adea/los-inmen/session"
 	"github.com/fikryfahrezy/adea/los-inmen/setting"
+	"github.com/fikryfahrezy/adea/los-inmen/throttle"
 )
 
 func main() {
 	dbJson := data.NewJson("")
 	file := file.New()
-	session := session.New()
+	sessionStore := session.New()
+	go session.RunSweeper(context.Background(), sessionStore, time.Minute)
+
+	ids, err := id.FromEnv()
+	if err != nil {
+		log.Fatal(err)
+	}
 
-	authRepo := auth.NewRepository(dbJson)
-	loanRepo := loan.NewRepository(dbJson)
+	authRepo := auth.NewRepository(dbJson, ids)
+	loanRepo := loan.NewRepository(dbJson, ids)
 
 	setting := setting.NewSetting(file, dbJson)
-	authApp := auth.NewApp(authRepo)
-	loanApp := loan.NewApp(file.Save, loanRepo)
+	passwordPolicy, err := auth.PasswordPolicyFromEnv()
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	loginThrottle := throttle.New(throttle.ConfigFromEnv())
+	go throttle.RunSweeper(context.Background(), loginThrottle, time.Minute)
+
+	// OIDC_ISSUER enable the login through the OpenID provider of the partner,
+	// the provider must be reachable at start to read its discovery document
+	var idp *oidc.Provider
+	if oidcCfg := oidc.ConfigFromEnv(); oidcCfg.Issuer != "" {
+		idp, err = oidc.NewProvider(context.Background(), oidcCfg, nil)
+		if err != nil {
+			log.Fatal(err)
+		}
+	}
+
+	queueCfg, err := queue.ConfigFromEnv()
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	approval, err := loan.ApprovalPolicyFromEnv()
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	committeeCfg, err := committee.ConfigFromEnv()
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	authApp := auth.NewApp(authRepo, passwordPolicy, notify.FromEnv(), loginThrottle, idp)
+	loanApp := loan.NewApp(file.Save, loanRepo, queue.New(queueCfg), approval, committeeCfg)
+	go loan.RunVoteSweeper(context.Background(), loanApp, time.Minute)
+
+	if err := authApp.EnsureAdmin(context.Background(), os.Getenv("ADMIN_USERNAME"), os.Getenv("ADMIN_PASSWORD")); err != nil {
+		log.Fatal(err)
+	}
+
+	// AUTH_MODE=token issue stateless signed token instead of keeping session,
+	// useful when the replicas can not share the session store
+	sessionCfg := session.ConfigFromEnv()
+	var authenticator session.Authenticator = session.NewManager(sessionStore, sessionCfg)
+	if os.Getenv("AUTH_MODE") == "token" {
+		signer, err := session.SignerFromEnv(sessionCfg)
+		if err != nil {
+			log.Fatal(err)
+		}
+		signer.SetUserLookup(authApp.SessionRole)
+		authenticator = signer
+	}
 
-	handler := handler.NewHandler(session, setting, authApp, loanApp)
+	handler := handler.NewHandler(authenticator, setting, authApp, loanApp, session.CookieConfigFromEnv(sessionCfg))
 
 	handler.ServeRestAPI()
 }
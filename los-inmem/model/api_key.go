@@ -0,0 +1,19 @@
+package model
+
+import "time"
+
+// ApiKey let a partner system call the API without a human login,
+// it act on behalf of the user that created it and is limited to its scopes
+type ApiKey struct {
+	IsRevoked bool
+	Id        string
+	Name      string
+	// Prefix is the start of the key, kept so the key can be told apart without storing it
+	Prefix       string
+	KeyHash      string
+	UserId       string
+	Scopes       []string
+	CreatedDate  time.Time
+	ExpiredDate  time.Time
+	LastUsedDate time.Time
+}
@@ -0,0 +1,16 @@
+package model
+
+import "time"
+
+// LoginActivity is a single login attempt, the UserId is empty
+// when the attempted username does not belong to any user
+type LoginActivity struct {
+	IsSuccess   bool
+	Id          string
+	UserId      string
+	Username    string
+	Reason      string
+	Ip          string
+	UserAgent   string
+	CreatedDate time.Time
+}
@@ -0,0 +1,10 @@
+package model
+
+import "time"
+
+// OfficerRegion is the region the officer work in, it is used to assign the loan by region
+type OfficerRegion struct {
+	UserId      string
+	Region      string
+	UpdatedDate time.Time
+}
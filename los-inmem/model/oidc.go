@@ -0,0 +1,25 @@
+package model
+
+import "time"
+
+// UserIdentity link the subject of an OpenID provider to the user,
+// the subject is the only claim the provider promise to never change
+type UserIdentity struct {
+	Id          string
+	Issuer      string
+	Subject     string
+	UserId      string
+	CreatedDate time.Time
+}
+
+// OidcState is kept between sending the user to the provider and its callback,
+// the state is what come back in the URL so only its hash is stored
+type OidcState struct {
+	IsUsed       bool
+	Id           string
+	StateHash    string
+	Nonce        string
+	CodeVerifier string
+	CreatedDate  time.Time
+	ExpiredDate  time.Time
+}
@@ -0,0 +1,12 @@
+package model
+
+import "time"
+
+type PasswordReset struct {
+	IsUsed      bool
+	Id          string
+	TokenHash   string
+	UserId      string
+	CreatedDate time.Time
+	ExpiredDate time.Time
+}
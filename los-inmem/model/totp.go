@@ -0,0 +1,35 @@
+package model
+
+import "time"
+
+// UserTotp is the TOTP secret of a user, it is kept disabled until
+// the user prove the authenticator app has it by verifying the first code
+type UserTotp struct {
+	IsEnabled bool
+	UserId    string
+	Secret    string
+	// LastCounter is the time step of the last accepted code,
+	// a code of the same or an earlier step is refused
+	LastCounter int64
+	CreatedDate time.Time
+}
+
+type RecoveryCode struct {
+	IsUsed      bool
+	Id          string
+	UserId      string
+	CodeHash    string
+	CreatedDate time.Time
+}
+
+// LoginChallenge is handed out after the password of a user that require TOTP is verified,
+// the session is only issued after the TOTP code is verified against it
+type LoginChallenge struct {
+	IsUsed      bool
+	Id          string
+	TokenHash   string
+	UserId      string
+	Attempts    int
+	CreatedDate time.Time
+	ExpiredDate time.Time
+}
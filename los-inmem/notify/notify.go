@@ -0,0 +1,79 @@
+package notify
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"log"
+	"os"
+	"sync"
+	"time"
+)
+
+type Message struct {
+	To      string `json:"to"`
+	Subject string `json:"subject"`
+	Body    string `json:"body"`
+}
+
+// Notifier deliver a message to a user, the real implementation would send
+// an email or a text message while Log and File are the stand-in for development
+type Notifier interface {
+	Notify(ctx context.Context, msg Message) error
+}
+
+type Log struct {
+	logger *log.Logger
+}
+
+func NewLog(w io.Writer) *Log {
+	return &Log{
+		logger: log.New(w, "notify: ", log.LstdFlags),
+	}
+}
+
+func (n *Log) Notify(ctx context.Context, msg Message) error {
+	n.logger.Printf("to=%q subject=%q body=%q", msg.To, msg.Subject, msg.Body)
+	return nil
+}
+
+// File append every message as a JSON line to the file, so it can be read
+// by the developer or a test to get the token that would be sent
+type File struct {
+	sync.Mutex
+	path string
+}
+
+func NewFile(path string) *File {
+	return &File{
+		path: path,
+	}
+}
+
+func (n *File) Notify(ctx context.Context, msg Message) error {
+	n.Lock()
+	defer n.Unlock()
+
+	f, err := os.OpenFile(n.path, os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0o600)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	return json.NewEncoder(f).Encode(struct {
+		Message
+		SentDate string `json:"sent_date"`
+	}{
+		Message:  msg,
+		SentDate: time.Now().Format(time.RFC3339),
+	})
+}
+
+// FromEnv use File when NOTIFY_FILE is set, otherwise the message is logged to stdout
+func FromEnv() Notifier {
+	if path := os.Getenv("NOTIFY_FILE"); path != "" {
+		return NewFile(path)
+	}
+
+	return NewLog(os.Stdout)
+}
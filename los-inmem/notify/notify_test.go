@@ -0,0 +1,40 @@
+package notify_test
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/fikryfahrezy/adea/los-inmen/notify"
+)
+
+func TestFileNotify(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "notify.log")
+	n := notify.NewFile(path)
+
+	n.Notify(context.Background(), notify.Message{To: "user1", Subject: "first", Body: "body"})
+	n.Notify(context.Background(), notify.Message{To: "user2", Subject: "second", Body: "body"})
+
+	f, err := os.Open(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+
+	var msgs []notify.Message
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		var msg notify.Message
+		if err := json.Unmarshal(scanner.Bytes(), &msg); err != nil {
+			t.Fatal(err)
+		}
+		msgs = append(msgs, msg)
+	}
+
+	if len(msgs) != 2 || msgs[1].To != "user2" {
+		t.Fatalf("resulting: %+v, expect two message with the last to user2", msgs)
+	}
+}
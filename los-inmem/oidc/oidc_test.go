@@ -0,0 +1,215 @@
+package oidc_test
+
+import (
+	"context"
+	"encoding/base64"
+	"errors"
+	"net/http"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/fikryfahrezy/adea/los-inmen/oidc"
+	"github.com/fikryfahrezy/adea/los-inmen/oidc/oidctest"
+)
+
+func newProvider(t *testing.T) (*oidctest.Server, *oidc.Provider) {
+	idp := oidctest.NewServer("los", "secret")
+	t.Cleanup(idp.Close)
+
+	p, err := oidc.NewProvider(context.Background(), oidc.Config{
+		Issuer:       idp.Issuer(),
+		ClientId:     "los",
+		ClientSecret: "secret",
+		RedirectUrl:  "http://localhost:4000/auth/oidc/callback",
+		Scopes:       []string{"openid"},
+		RoleClaim:    "realm_access.roles",
+	}, idp.Client())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return idp, p
+}
+
+// authorize follow the authorization URL and return the code the provider redirect back with
+func authorize(t *testing.T, idp *oidctest.Server, authUrl string) (string, string) {
+	client := idp.Client()
+	client.CheckRedirect = func(req *http.Request, via []*http.Request) error {
+		return http.ErrUseLastResponse
+	}
+
+	res, err := client.Get(authUrl)
+	if err != nil {
+		t.Fatal(err)
+	}
+	res.Body.Close()
+
+	if res.StatusCode != http.StatusFound {
+		t.Fatalf("resulting: %d, expect: %d", res.StatusCode, http.StatusFound)
+	}
+
+	loc, err := url.Parse(res.Header.Get("Location"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return loc.Query().Get("code"), loc.Query().Get("state")
+}
+
+func TestChallenge(t *testing.T) {
+	// The example of RFC 7636 appendix B
+	res := oidc.Challenge("dBjftJeZ4CVP-mB92K27uhbUJU1p1r_wW1gFWFOEjXk")
+	if res != "E9Melhoa2OwvFrEMTJguCHaoeK1t8URWbuGJSstw-cM" {
+		t.Fatalf("resulting: %s, expect: E9Melhoa2OwvFrEMTJguCHaoeK1t8URWbuGJSstw-cM", res)
+	}
+
+	verifier, err := oidc.NewVerifier()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(verifier) != 43 {
+		t.Fatalf("resulting: %d, expect: 43", len(verifier))
+	}
+}
+
+func TestNewProviderIssuerMismatch(t *testing.T) {
+	idp := oidctest.NewServer("los", "secret")
+	defer idp.Close()
+
+	_, err := oidc.NewProvider(context.Background(), oidc.Config{Issuer: idp.Issuer() + "/"}, idp.Client())
+	if !errors.Is(err, oidc.ErrDiscovery) {
+		t.Fatalf("resulting: %v, expect: %v", err, oidc.ErrDiscovery)
+	}
+}
+
+func TestExchange(t *testing.T) {
+	ctx := context.Background()
+	idp, p := newProvider(t)
+	idp.SetUser("subject-1", map[string]interface{}{
+		"preferred_username": "jdoe",
+		"realm_access":       map[string]interface{}{"roles": []string{"offline_access", "approver"}},
+	})
+
+	verifier, _ := oidc.NewVerifier()
+	authUrl := p.AuthCodeURL("state-1", "nonce-1", verifier)
+	if strings.Contains(authUrl, verifier) {
+		t.Fatalf("resulting: %s, expect: url without the verifier", authUrl)
+	}
+
+	code, state := authorize(t, idp, authUrl)
+	if state != "state-1" {
+		t.Fatalf("resulting: %s, expect: state-1", state)
+	}
+
+	if _, err := p.Exchange(ctx, code, verifier, "nonce-2"); !errors.Is(err, oidc.ErrTokenNotValid) {
+		t.Fatalf("resulting: %v, expect: %v", err, oidc.ErrTokenNotValid)
+	}
+
+	code, _ = authorize(t, idp, authUrl)
+	if _, err := p.Exchange(ctx, code, "wrong-verifier-wrong-verifier-wrong-verifier", "nonce-1"); !errors.Is(err, oidc.ErrExchangeFailed) {
+		t.Fatalf("resulting: %v, expect: %v", err, oidc.ErrExchangeFailed)
+	}
+
+	code, _ = authorize(t, idp, authUrl)
+	claims, err := p.Exchange(ctx, code, verifier, "nonce-1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if claims.Subject != "subject-1" || claims.PreferredUsername != "jdoe" {
+		t.Fatalf("resulting: %+v, expect: subject-1 jdoe", claims)
+	}
+	if len(claims.Roles) != 2 || claims.Roles[1] != "approver" {
+		t.Fatalf("resulting: %v, expect: [offline_access approver]", claims.Roles)
+	}
+
+	if _, err := p.Exchange(ctx, code, verifier, "nonce-1"); !errors.Is(err, oidc.ErrExchangeFailed) {
+		t.Fatalf("resulting: %v, expect: %v", err, oidc.ErrExchangeFailed)
+	}
+}
+
+func TestVerify(t *testing.T) {
+	ctx := context.Background()
+	idp, p := newProvider(t)
+
+	sign := func(change func(c map[string]interface{})) string {
+		c := idp.IdTokenClaims("subject-1", "nonce-1")
+		change(c)
+		token, err := idp.Sign(c)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return token
+	}
+
+	valid := sign(func(c map[string]interface{}) {})
+	parts := strings.Split(valid, ".")
+
+	testCases := []struct {
+		expect error
+		name   string
+		token  string
+	}{
+		{
+			expect: nil,
+			name:   "Verify successfully",
+			token:  valid,
+		},
+		{
+			expect: nil,
+			name:   "Verify successfully, audience list",
+			token:  sign(func(c map[string]interface{}) { c["aud"] = []string{"other", "los"} }),
+		},
+		{
+			expect: oidc.ErrTokenNotValid,
+			name:   "Verify fail, other audience",
+			token:  sign(func(c map[string]interface{}) { c["aud"] = "other" }),
+		},
+		{
+			expect: oidc.ErrTokenNotValid,
+			name:   "Verify fail, other issuer",
+			token:  sign(func(c map[string]interface{}) { c["iss"] = "https://evil.example.com" }),
+		},
+		{
+			expect: oidc.ErrTokenNotValid,
+			name:   "Verify fail, expired",
+			token:  sign(func(c map[string]interface{}) { c["exp"] = time.Now().Add(-time.Hour).Unix() }),
+		},
+		{
+			expect: oidc.ErrTokenNotValid,
+			name:   "Verify fail, no subject",
+			token:  sign(func(c map[string]interface{}) { delete(c, "sub") }),
+		},
+		{
+			expect: oidc.ErrTokenNotValid,
+			name:   "Verify fail, tampered payload",
+			token:  parts[0] + "." + base64.RawURLEncoding.EncodeToString([]byte(`{"sub":"admin"}`)) + "." + parts[2],
+		},
+		{
+			expect: oidc.ErrTokenNotValid,
+			name:   "Verify fail, unsigned token",
+			token:  base64.RawURLEncoding.EncodeToString([]byte(`{"alg":"none"}`)) + "." + parts[1] + ".",
+		},
+	}
+
+	for _, c := range testCases {
+		t.Run(c.name, func(t *testing.T) {
+			_, err := p.Verify(ctx, c.token)
+			if !errors.Is(err, c.expect) {
+				t.Fatalf("resulting: %v, expect: %v", err, c.expect)
+			}
+		})
+	}
+
+	// The token signed with the new key is verified after the JWKS is fetched again
+	if err := idp.RotateKey(); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := p.Verify(ctx, sign(func(c map[string]interface{}) {})); err != nil {
+		t.Fatalf("resulting: %v, expect: nil", err)
+	}
+	if _, err := p.Verify(ctx, valid); !errors.Is(err, oidc.ErrTokenNotValid) {
+		t.Fatalf("resulting: %v, expect: %v", err, oidc.ErrTokenNotValid)
+	}
+}
@@ -0,0 +1,291 @@
+// Package oidctest is an in-process OpenID provider to test the OIDC login without a real one
+package oidctest
+
+import (
+	"crypto"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"sync"
+	"time"
+
+	"github.com/fikryfahrezy/adea/los-inmen/oidc"
+)
+
+// grant is an authorization code waiting to be exchanged
+type grant struct {
+	redirectUri string
+	challenge   string
+	nonce       string
+	subject     string
+	claims      map[string]interface{}
+	expiredDate time.Time
+}
+
+// Server approve every authorization request right away as the user set through SetUser,
+// the code can only be exchanged once with the matching PKCE verifier and client credential
+type Server struct {
+	*httptest.Server
+	ClientId     string
+	ClientSecret string
+
+	sync.Mutex
+	key     *rsa.PrivateKey
+	kid     string
+	subject string
+	claims  map[string]interface{}
+	codes   map[string]grant
+}
+
+func NewServer(clientId, clientSecret string) *Server {
+	s := &Server{
+		ClientId:     clientId,
+		ClientSecret: clientSecret,
+		codes:        make(map[string]grant),
+	}
+	if err := s.RotateKey(); err != nil {
+		panic(err)
+	}
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/.well-known/openid-configuration", s.discovery)
+	mux.HandleFunc("/authorize", s.authorize)
+	mux.HandleFunc("/token", s.token)
+	mux.HandleFunc("/jwks", s.jwks)
+	s.Server = httptest.NewServer(mux)
+
+	return s
+}
+
+// Issuer is the value to be set as oidc.Config.Issuer
+func (s *Server) Issuer() string {
+	return s.URL
+}
+
+// SetUser set who log in on the next authorization request and the extra claims of its ID token
+func (s *Server) SetUser(subject string, claims map[string]interface{}) {
+	s.Lock()
+	defer s.Unlock()
+	s.subject = subject
+	s.claims = claims
+}
+
+// RotateKey replace the signing key, the provider must fetch the JWKS again to verify the next token
+func (s *Server) RotateKey() error {
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		return err
+	}
+
+	kid, err := randomHex(8)
+	if err != nil {
+		return err
+	}
+
+	s.Lock()
+	defer s.Unlock()
+	s.key = key
+	s.kid = kid
+
+	return nil
+}
+
+// Sign return an RS256 token of the claims signed with the current key,
+// so a test can craft a token the provider would never issue
+func (s *Server) Sign(claims map[string]interface{}) (string, error) {
+	s.Lock()
+	key, kid := s.key, s.kid
+	s.Unlock()
+
+	header, err := json.Marshal(map[string]string{"alg": "RS256", "typ": "JWT", "kid": kid})
+	if err != nil {
+		return "", err
+	}
+	payload, err := json.Marshal(claims)
+	if err != nil {
+		return "", err
+	}
+
+	signing := base64.RawURLEncoding.EncodeToString(header) + "." + base64.RawURLEncoding.EncodeToString(payload)
+	digest := sha256.Sum256([]byte(signing))
+	sig, err := rsa.SignPKCS1v15(rand.Reader, key, crypto.SHA256, digest[:])
+	if err != nil {
+		return "", err
+	}
+
+	return signing + "." + base64.RawURLEncoding.EncodeToString(sig), nil
+}
+
+// IdTokenClaims return the standard claims of a token issued now to the subject
+func (s *Server) IdTokenClaims(subject, nonce string) map[string]interface{} {
+	now := time.Now()
+	return map[string]interface{}{
+		"iss":   s.Issuer(),
+		"sub":   subject,
+		"aud":   s.ClientId,
+		"iat":   now.Unix(),
+		"exp":   now.Add(5 * time.Minute).Unix(),
+		"nonce": nonce,
+	}
+}
+
+func (s *Server) discovery(w http.ResponseWriter, r *http.Request) {
+	writeJSON(w, http.StatusOK, map[string]interface{}{
+		"issuer":                                s.Issuer(),
+		"authorization_endpoint":                s.URL + "/authorize",
+		"token_endpoint":                        s.URL + "/token",
+		"jwks_uri":                              s.URL + "/jwks",
+		"response_types_supported":              []string{"code"},
+		"subject_types_supported":               []string{"public"},
+		"id_token_signing_alg_values_supported": []string{"RS256"},
+		"code_challenge_methods_supported":      []string{"S256"},
+	})
+}
+
+func (s *Server) authorize(w http.ResponseWriter, r *http.Request) {
+	q := r.URL.Query()
+	redirectUri, err := url.Parse(q.Get("redirect_uri"))
+	if err != nil || q.Get("redirect_uri") == "" {
+		http.Error(w, "invalid redirect_uri", http.StatusBadRequest)
+		return
+	}
+
+	if q.Get("client_id") != s.ClientId ||
+		q.Get("response_type") != "code" ||
+		q.Get("code_challenge_method") != "S256" ||
+		q.Get("code_challenge") == "" {
+		http.Error(w, "invalid authorization request", http.StatusBadRequest)
+		return
+	}
+
+	code, err := randomHex(16)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	s.Lock()
+	s.codes[code] = grant{
+		redirectUri: q.Get("redirect_uri"),
+		challenge:   q.Get("code_challenge"),
+		nonce:       q.Get("nonce"),
+		subject:     s.subject,
+		claims:      s.claims,
+		expiredDate: time.Now().Add(time.Minute),
+	}
+	s.Unlock()
+
+	back := redirectUri.Query()
+	back.Set("code", code)
+	back.Set("state", q.Get("state"))
+	redirectUri.RawQuery = back.Encode()
+
+	http.Redirect(w, r, redirectUri.String(), http.StatusFound)
+}
+
+func (s *Server) token(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.NotFound(w, r)
+		return
+	}
+	if err := r.ParseForm(); err != nil {
+		writeJSON(w, http.StatusBadRequest, map[string]string{"error": "invalid_request"})
+		return
+	}
+
+	clientId, clientSecret, ok := r.BasicAuth()
+	if ok {
+		clientId, _ = url.QueryUnescape(clientId)
+		clientSecret, _ = url.QueryUnescape(clientSecret)
+	} else {
+		clientId, clientSecret = r.PostForm.Get("client_id"), r.PostForm.Get("client_secret")
+	}
+	if clientId != s.ClientId || subtle.ConstantTimeCompare([]byte(clientSecret), []byte(s.ClientSecret)) != 1 {
+		writeJSON(w, http.StatusUnauthorized, map[string]string{"error": "invalid_client"})
+		return
+	}
+
+	if r.PostForm.Get("grant_type") != "authorization_code" {
+		writeJSON(w, http.StatusBadRequest, map[string]string{"error": "unsupported_grant_type"})
+		return
+	}
+
+	// The code is removed before it is checked so it can never be used twice
+	s.Lock()
+	g, ok := s.codes[r.PostForm.Get("code")]
+	delete(s.codes, r.PostForm.Get("code"))
+	s.Unlock()
+
+	if !ok || time.Now().After(g.expiredDate) ||
+		g.redirectUri != r.PostForm.Get("redirect_uri") ||
+		oidc.Challenge(r.PostForm.Get("code_verifier")) != g.challenge {
+		writeJSON(w, http.StatusBadRequest, map[string]string{"error": "invalid_grant"})
+		return
+	}
+
+	claims := s.IdTokenClaims(g.subject, g.nonce)
+	for k, v := range g.claims {
+		claims[k] = v
+	}
+
+	idToken, err := s.Sign(claims)
+	if err != nil {
+		writeJSON(w, http.StatusInternalServerError, map[string]string{"error": "server_error"})
+		return
+	}
+
+	accessToken, err := randomHex(16)
+	if err != nil {
+		writeJSON(w, http.StatusInternalServerError, map[string]string{"error": "server_error"})
+		return
+	}
+
+	writeJSON(w, http.StatusOK, map[string]interface{}{
+		"access_token": accessToken,
+		"token_type":   "Bearer",
+		"expires_in":   300,
+		"id_token":     idToken,
+	})
+}
+
+func (s *Server) jwks(w http.ResponseWriter, r *http.Request) {
+	s.Lock()
+	pub, kid := s.key.PublicKey, s.kid
+	s.Unlock()
+
+	writeJSON(w, http.StatusOK, map[string]interface{}{
+		"keys": []map[string]string{
+			{
+				"kty": "RSA",
+				"use": "sig",
+				"alg": "RS256",
+				"kid": kid,
+				"n":   base64.RawURLEncoding.EncodeToString(pub.N.Bytes()),
+				"e":   base64.RawURLEncoding.EncodeToString(big.NewInt(int64(pub.E)).Bytes()),
+			},
+		},
+	})
+}
+
+func writeJSON(w http.ResponseWriter, status int, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(v)
+}
+
+func randomHex(n int) (string, error) {
+	b := make([]byte, n)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+
+	return hex.EncodeToString(b), nil
+}
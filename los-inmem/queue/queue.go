@@ -0,0 +1,176 @@
+package queue
+
+import (
+	"errors"
+	"os"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+var ErrUnknownStrategy = errors.New("unknown queue strategy")
+
+// Strategy decide which officer get the new loan
+type Strategy struct {
+	slug string
+}
+
+func (s Strategy) String() string {
+	return s.slug
+}
+
+var (
+	// RoundRobin give the loan to each officer in turn
+	RoundRobin = Strategy{"round_robin"}
+	// LeastLoaded give the loan to the officer with the fewest open loan
+	LeastLoaded = Strategy{"least_loaded"}
+	// ByRegion give the loan to the least loaded officer of the region of the loan,
+	// or of every region when no officer work in that region
+	ByRegion = Strategy{"region"}
+)
+
+func StrategyFromString(s string) (Strategy, error) {
+	switch s {
+	case RoundRobin.slug:
+		return RoundRobin, nil
+	case LeastLoaded.slug:
+		return LeastLoaded, nil
+	case ByRegion.slug:
+		return ByRegion, nil
+	}
+
+	return Strategy{}, ErrUnknownStrategy
+}
+
+type Config struct {
+	Strategy Strategy
+	// ClaimTTL is how long the officer keep the loan without touching it,
+	// the loan go back to the pool afterward
+	ClaimTTL time.Duration
+}
+
+func DefaultConfig() Config {
+	return Config{
+		Strategy: LeastLoaded,
+		ClaimTTL: 48 * time.Hour,
+	}
+}
+
+// ConfigFromEnv read QUEUE_STRATEGY and QUEUE_CLAIM_TTL in time.ParseDuration format,
+// the default config value is used for the empty one
+func ConfigFromEnv() (Config, error) {
+	cfg := DefaultConfig()
+	if s := os.Getenv("QUEUE_STRATEGY"); s != "" {
+		strategy, err := StrategyFromString(s)
+		if err != nil {
+			return Config{}, err
+		}
+		cfg.Strategy = strategy
+	}
+	if s := os.Getenv("QUEUE_CLAIM_TTL"); s != "" {
+		d, err := time.ParseDuration(s)
+		if err != nil || d <= 0 {
+			return Config{}, errors.New("invalid QUEUE_CLAIM_TTL: " + s)
+		}
+		cfg.ClaimTTL = d
+	}
+
+	return cfg, nil
+}
+
+// Officer is the one that can be given a loan, Load is how many open loan they already have
+type Officer struct {
+	Id     string
+	Region string
+	Load   int
+}
+
+// Queue pick the officer of the new loan, it remember the last officer for the round robin
+type Queue struct {
+	sync.Mutex
+	cfg  Config
+	last string
+}
+
+func New(cfg Config) *Queue {
+	return &Queue{
+		cfg: cfg,
+	}
+}
+
+// Pick return the officer that get the loan of the region, false when there is no officer
+func (q *Queue) Pick(officers []Officer, region string) (Officer, bool) {
+	if len(officers) == 0 {
+		return Officer{}, false
+	}
+
+	// Sorted by id so the pick does not depend on the order the repository return them
+	candidates := make([]Officer, len(officers))
+	copy(candidates, officers)
+	sort.Slice(candidates, func(i, j int) bool {
+		return candidates[i].Id < candidates[j].Id
+	})
+
+	switch q.cfg.Strategy {
+	case RoundRobin:
+		return q.next(candidates), true
+	case ByRegion:
+		if inRegion := sameRegion(candidates, region); len(inRegion) != 0 {
+			candidates = inRegion
+		}
+	}
+
+	return leastLoaded(candidates), true
+}
+
+// IsClaimed tell whether the officer still hold the loan, the claim end once it is untouched for the ClaimTTL
+func (q *Queue) IsClaimed(officerId string, claimedDate, now time.Time) bool {
+	if officerId == "" {
+		return false
+	}
+
+	return now.Sub(claimedDate) < q.cfg.ClaimTTL
+}
+
+func (q *Queue) next(officers []Officer) Officer {
+	q.Lock()
+	defer q.Unlock()
+
+	picked := officers[0]
+	for _, o := range officers {
+		if o.Id > q.last {
+			picked = o
+			break
+		}
+	}
+	q.last = picked.Id
+
+	return picked
+}
+
+func sameRegion(officers []Officer, region string) []Officer {
+	res := make([]Officer, 0)
+	if region == "" {
+		return res
+	}
+
+	for _, o := range officers {
+		if strings.EqualFold(o.Region, region) {
+			res = append(res, o)
+		}
+	}
+
+	return res
+}
+
+func leastLoaded(officers []Officer) Officer {
+	picked := officers[0]
+	for _, o := range officers[1:] {
+		if o.Load < picked.Load {
+			picked = o
+		}
+	}
+
+	return picked
+}
@@ -0,0 +1,184 @@
+package scoring
+
+import (
+	"fmt"
+	"math"
+
+	"github.com/fikryfahrezy/adea/los-inmen/model"
+)
+
+// RepaymentMonths is the tenor the debt service is computed with,
+// the loan is assumed repaid in equal monthly installment without interest
+const RepaymentMonths = 12
+
+// The ratio at which the factor get its full points and the one at which it get none,
+// the points are linear in between
+const (
+	debtServiceBest    = 0.3
+	debtServiceWorst   = 1.0
+	loanToRevenueBest  = 0.25
+	loanToRevenueWorst = 1.5
+	netMarginBest      = 0.4
+	netMarginWorst     = 0.0
+	experienceBest     = 5
+)
+
+// Factor is one part of the score
+type Factor struct {
+	slug string
+}
+
+func (f Factor) String() string {
+	return f.slug
+}
+
+var (
+	DebtService    = Factor{"debt_service"}
+	LoanToRevenue  = Factor{"loan_to_revenue"}
+	NetMargin      = Factor{"net_margin"}
+	Experience     = Factor{"experience"}
+	FieldOwnership = Factor{"field_ownership"}
+)
+
+// weights sum to 100, the debt service weigh the most as it is what repay the loan
+var weights = map[Factor]int64{
+	DebtService:    30,
+	LoanToRevenue:  25,
+	NetMargin:      20,
+	Experience:     15,
+	FieldOwnership: 10,
+}
+
+// Grade is the score put in band, A is the best
+type Grade struct {
+	slug string
+}
+
+func (g Grade) String() string {
+	return g.slug
+}
+
+var (
+	A = Grade{"A"}
+	B = Grade{"B"}
+	C = Grade{"C"}
+	D = Grade{"D"}
+	E = Grade{"E"}
+)
+
+func GradeOf(score int64) Grade {
+	switch {
+	case score >= 80:
+		return A
+	case score >= 65:
+		return B
+	case score >= 50:
+		return C
+	case score >= 35:
+		return D
+	}
+
+	return E
+}
+
+// Evaluate score the farm business of the loan out of 100, the factor which ratio
+// can not be computed, like the harvest without projected revenue, get no point
+func Evaluate(l model.LoanApplication) model.CreditScore {
+	// The revenue is computed in float64 since the yield times the price can overflow int64,
+	// the harvest without a cycle has no projected revenue as it can not be put per year
+	var revenuePerYear float64
+	if l.HarvestCycleInMonths > 0 {
+		revenuePerYear = float64(l.EstimatedYieldInKg) * float64(l.EstimatedPriceOfHarvestPerKg) * 12 / float64(l.HarvestCycleInMonths)
+	}
+	netIncome := l.BusinessIncomePerMonthInIdr - l.BusinessOutcomePerMonthInIdr
+	installment := l.LoanApplicationInIdr / RepaymentMonths
+
+	res := model.CreditScore{
+		ProjectedRevenuePerYearInIdr: idr(revenuePerYear),
+	}
+
+	debtService := factor(DebtService, 0, "The business has no net income to pay the installment of Rp %d per month", installment)
+	if netIncome > 0 {
+		res.DebtServiceRatio = ratio(float64(installment), float64(netIncome))
+		debtService = factor(
+			DebtService,
+			points(weights[DebtService], res.DebtServiceRatio, debtServiceWorst, debtServiceBest),
+			"The installment of Rp %d per month take %.0f%% of the net income of Rp %d per month, full points up to %.0f%% and none from %.0f%%",
+			installment, res.DebtServiceRatio*100, netIncome, debtServiceBest*100, debtServiceWorst*100,
+		)
+	}
+
+	loanToRevenue := factor(LoanToRevenue, 0, "The harvest has no projected revenue")
+	if revenuePerYear > 0 {
+		res.LoanToRevenue = ratio(float64(l.LoanApplicationInIdr), revenuePerYear)
+		loanToRevenue = factor(
+			LoanToRevenue,
+			points(weights[LoanToRevenue], res.LoanToRevenue, loanToRevenueWorst, loanToRevenueBest),
+			"The loan is %.0f%% of the projected revenue of Rp %d per year, full points up to %.0f%% and none from %.0f%%",
+			res.LoanToRevenue*100, res.ProjectedRevenuePerYearInIdr, loanToRevenueBest*100, loanToRevenueWorst*100,
+		)
+	}
+
+	netMargin := factor(NetMargin, 0, "The business has no income")
+	if l.BusinessIncomePerMonthInIdr > 0 {
+		res.NetMargin = ratio(float64(netIncome), float64(l.BusinessIncomePerMonthInIdr))
+		netMargin = factor(
+			NetMargin,
+			points(weights[NetMargin], res.NetMargin, netMarginWorst, netMarginBest),
+			"The net margin is %.0f%% of the business income, full points from %.0f%% and none from %.0f%%",
+			res.NetMargin*100, netMarginBest*100, netMarginWorst*100,
+		)
+	}
+
+	experience := factor(
+		Experience,
+		points(weights[Experience], float64(l.ExpInYear), 0, experienceBest),
+		"%d years of farming experience, full points from %d years",
+		l.ExpInYear, experienceBest,
+	)
+
+	fieldOwnership := factor(FieldOwnership, 0, "The field is not privately owned")
+	if l.IsPrivateField {
+		fieldOwnership = factor(FieldOwnership, weights[FieldOwnership], "The field is privately owned")
+	}
+
+	res.Factors = []model.ScoreFactor{debtService, loanToRevenue, netMargin, experience, fieldOwnership}
+	for _, f := range res.Factors {
+		res.Score += f.Points
+	}
+	res.Grade = GradeOf(res.Score).String()
+
+	return res
+}
+
+func factor(f Factor, pts int64, format string, args ...interface{}) model.ScoreFactor {
+	return model.ScoreFactor{
+		Name:        f.String(),
+		Weight:      weights[f],
+		Points:      pts,
+		Explanation: fmt.Sprintf(format, args...),
+	}
+}
+
+// points give the full weight at best and nothing at worst, best may be below worst
+// for the ratio where lower is better
+func points(weight int64, v, worst, best float64) int64 {
+	f := (v - worst) / (best - worst)
+	f = math.Max(0, math.Min(1, f))
+
+	return int64(math.Round(f * float64(weight)))
+}
+
+// ratio is rounded to 4 decimals so the stored score read the same as it was computed
+func ratio(a, b float64) float64 {
+	return math.Round(a/b*10000) / 10000
+}
+
+// idr round the amount back to rupiah, the amount past int64 is capped at its max
+func idr(amount float64) int64 {
+	if amount >= math.MaxInt64 {
+		return math.MaxInt64
+	}
+
+	return int64(math.Round(amount))
+}
@@ -0,0 +1,111 @@
+package session_test
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/fikryfahrezy/adea/los-inmen/session"
+)
+
+func TestIssueAndAuthenticate(t *testing.T) {
+	ctx := context.Background()
+	sm := session.NewManager(session.New(), session.DefaultConfig())
+
+	token, err := sm.Issue(ctx, "user1", "admin")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	sess, err := sm.Authenticate(ctx, token.AccessToken)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if sess.UserId != "user1" || sess.Role != "admin" {
+		t.Fatalf("resulting: %+v, expect admin session of user1", sess)
+	}
+
+	if _, err := sm.Authenticate(ctx, token.RefreshToken); !errors.Is(err, session.ErrSessionNotFound) {
+		t.Fatalf("resulting: %v, expect: %v", err, session.ErrSessionNotFound)
+	}
+}
+
+func TestAuthenticateSlideExpiry(t *testing.T) {
+	ctx := context.Background()
+	store := session.New()
+	cfg := session.Config{AccessTTL: time.Hour, RefreshTTL: time.Hour}
+	sm := session.NewManager(store, cfg)
+
+	almostExpired := time.Now().Add(time.Minute).Unix()
+	store.Set(ctx, session.SessionObj{Key: "token1", UserId: "user1", Expired: almostExpired})
+
+	sess, err := sm.Authenticate(ctx, "token1")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if sess.Expired <= almostExpired {
+		t.Fatalf("resulting: %d, expect greater than: %d", sess.Expired, almostExpired)
+	}
+
+	stored, _ := store.Get(ctx, "token1")
+	if stored.Expired != sess.Expired {
+		t.Fatalf("resulting: %d, expect: %d", stored.Expired, sess.Expired)
+	}
+
+	store.Set(ctx, session.SessionObj{Key: "token2", UserId: "user1", Expired: time.Now().Add(-time.Minute).Unix()})
+	if _, err := sm.Authenticate(ctx, "token2"); !errors.Is(err, session.ErrSessionExpired) {
+		t.Fatalf("resulting: %v, expect: %v", err, session.ErrSessionExpired)
+	}
+}
+
+func TestRefresh(t *testing.T) {
+	ctx := context.Background()
+	sm := session.NewManager(session.New(), session.DefaultConfig())
+
+	token, _ := sm.Issue(ctx, "user1", "applicant")
+
+	newToken, err := sm.Refresh(ctx, token.RefreshToken)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if newToken.RefreshToken == token.RefreshToken || newToken.AccessToken == token.AccessToken {
+		t.Fatalf("resulting: %+v, expect rotated token", newToken)
+	}
+
+	if _, err := sm.Authenticate(ctx, newToken.AccessToken); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := sm.Refresh(ctx, "random-token"); !errors.Is(err, session.ErrRefreshNotFound) {
+		t.Fatalf("resulting: %v, expect: %v", err, session.ErrRefreshNotFound)
+	}
+}
+
+func TestRefreshReuseRevokeFamily(t *testing.T) {
+	ctx := context.Background()
+	sm := session.NewManager(session.New(), session.DefaultConfig())
+
+	token, _ := sm.Issue(ctx, "user1", "applicant")
+	otherLogin, _ := sm.Issue(ctx, "user1", "applicant")
+	newToken, _ := sm.Refresh(ctx, token.RefreshToken)
+
+	if _, err := sm.Refresh(ctx, token.RefreshToken); !errors.Is(err, session.ErrRefreshReused) {
+		t.Fatalf("resulting: %v, expect: %v", err, session.ErrRefreshReused)
+	}
+
+	if _, err := sm.Authenticate(ctx, newToken.AccessToken); !errors.Is(err, session.ErrSessionNotFound) {
+		t.Fatalf("resulting: %v, expect: %v", err, session.ErrSessionNotFound)
+	}
+
+	if _, err := sm.Refresh(ctx, newToken.RefreshToken); !errors.Is(err, session.ErrRefreshNotFound) {
+		t.Fatalf("resulting: %v, expect: %v", err, session.ErrRefreshNotFound)
+	}
+
+	if _, err := sm.Authenticate(ctx, otherLogin.AccessToken); err != nil {
+		t.Fatalf("resulting: %v, expect: %v", err, nil)
+	}
+}
@@ -0,0 +1,182 @@
+package session_test
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/fikryfahrezy/adea/los-inmen/session"
+)
+
+func TestNewSignerWithoutKey(t *testing.T) {
+	if _, err := session.NewSigner(session.DefaultConfig(), "k1", map[string][]byte{}); !errors.Is(err, session.ErrSignerNoKey) {
+		t.Fatalf("resulting: %v, expect: %v", err, session.ErrSignerNoKey)
+	}
+}
+
+func TestSignerIssueAndAuthenticate(t *testing.T) {
+	ctx := context.Background()
+	signer, _ := session.NewSigner(session.DefaultConfig(), "k1", map[string][]byte{"k1": []byte("secret")})
+
+	token, err := signer.Issue(ctx, "user1", "admin")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	sess, err := signer.Authenticate(ctx, token.AccessToken)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if sess.UserId != "user1" || sess.Role != "admin" {
+		t.Fatalf("resulting: %+v, expect admin session of user1", sess)
+	}
+
+	if _, err := signer.Authenticate(ctx, token.RefreshToken); !errors.Is(err, session.ErrSessionNotFound) {
+		t.Fatalf("resulting: %v, expect: %v", err, session.ErrSessionNotFound)
+	}
+}
+
+func TestSignerTamperedToken(t *testing.T) {
+	ctx := context.Background()
+	signer, _ := session.NewSigner(session.DefaultConfig(), "k1", map[string][]byte{"k1": []byte("secret")})
+	other, _ := session.NewSigner(session.DefaultConfig(), "k1", map[string][]byte{"k1": []byte("other-secret")})
+
+	token, _ := other.Issue(ctx, "user1", "admin")
+
+	testCases := []struct {
+		name  string
+		token string
+	}{
+		{
+			name:  "Signed with other secret",
+			token: token.AccessToken,
+		},
+		{
+			name:  "Signature removed",
+			token: token.AccessToken[:strings.LastIndex(token.AccessToken, ".")+1],
+		},
+		{
+			name:  "Not a token",
+			token: "random-token",
+		},
+	}
+
+	for _, c := range testCases {
+		t.Run(c.name, func(t *testing.T) {
+			if _, err := signer.Authenticate(ctx, c.token); !errors.Is(err, session.ErrSessionNotFound) {
+				t.Fatalf("resulting: %v, expect: %v", err, session.ErrSessionNotFound)
+			}
+		})
+	}
+}
+
+func TestSignerExpiredToken(t *testing.T) {
+	ctx := context.Background()
+	cfg := session.Config{AccessTTL: -time.Minute, RefreshTTL: -time.Minute}
+	signer, _ := session.NewSigner(cfg, "k1", map[string][]byte{"k1": []byte("secret")})
+
+	token, _ := signer.Issue(ctx, "user1", "applicant")
+
+	if _, err := signer.Authenticate(ctx, token.AccessToken); !errors.Is(err, session.ErrSessionExpired) {
+		t.Fatalf("resulting: %v, expect: %v", err, session.ErrSessionExpired)
+	}
+
+	if _, err := signer.Refresh(ctx, token.RefreshToken); !errors.Is(err, session.ErrSessionExpired) {
+		t.Fatalf("resulting: %v, expect: %v", err, session.ErrSessionExpired)
+	}
+}
+
+func TestSignerKeyRotation(t *testing.T) {
+	ctx := context.Background()
+	oldSigner, _ := session.NewSigner(session.DefaultConfig(), "k1", map[string][]byte{"k1": []byte("secret")})
+	token, _ := oldSigner.Issue(ctx, "user1", "applicant")
+
+	keys := map[string][]byte{"k1": []byte("secret"), "k2": []byte("new-secret")}
+	newSigner, _ := session.NewSigner(session.DefaultConfig(), "k2", keys)
+
+	if _, err := newSigner.Authenticate(ctx, token.AccessToken); err != nil {
+		t.Fatalf("resulting: %v, expect: %v", err, nil)
+	}
+
+	retired, _ := session.NewSigner(session.DefaultConfig(), "k2", map[string][]byte{"k2": []byte("new-secret")})
+	if _, err := retired.Authenticate(ctx, token.AccessToken); !errors.Is(err, session.ErrSessionNotFound) {
+		t.Fatalf("resulting: %v, expect: %v", err, session.ErrSessionNotFound)
+	}
+}
+
+func TestSignerRefresh(t *testing.T) {
+	ctx := context.Background()
+	signer, _ := session.NewSigner(session.DefaultConfig(), "k1", map[string][]byte{"k1": []byte("secret")})
+
+	token, _ := signer.Issue(ctx, "user1", "admin")
+
+	newToken, err := signer.Refresh(ctx, token.RefreshToken)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	sess, err := signer.Authenticate(ctx, newToken.AccessToken)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if sess.UserId != "user1" || sess.Role != "admin" {
+		t.Fatalf("resulting: %+v, expect admin session of user1", sess)
+	}
+
+	if _, err := signer.Refresh(ctx, token.AccessToken); !errors.Is(err, session.ErrRefreshNotFound) {
+		t.Fatalf("resulting: %v, expect: %v", err, session.ErrRefreshNotFound)
+	}
+
+	if _, err := signer.Revoke(ctx, sess); !errors.Is(err, session.ErrStatelessNotSupported) {
+		t.Fatalf("resulting: %v, expect: %v", err, session.ErrStatelessNotSupported)
+	}
+}
+
+func TestSignerRefreshLookup(t *testing.T) {
+	ctx := context.Background()
+	signer, _ := session.NewSigner(session.DefaultConfig(), "k1", map[string][]byte{"k1": []byte("secret")})
+
+	roles := map[string]string{"user1": "field_officer"}
+	signer.SetUserLookup(func(ctx context.Context, userId string) (string, error) {
+		role, ok := roles[userId]
+		if !ok {
+			return "", session.ErrRefreshNotFound
+		}
+		return role, nil
+	})
+
+	token, _ := signer.Issue(ctx, "user1", "admin")
+	newToken, err := signer.Refresh(ctx, token.RefreshToken)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	sess, _ := signer.Authenticate(ctx, newToken.AccessToken)
+	if sess.Role != "field_officer" {
+		t.Fatalf("resulting: %s, expect: %s", sess.Role, "field_officer")
+	}
+
+	delete(roles, "user1")
+	if _, err := signer.Refresh(ctx, newToken.RefreshToken); !errors.Is(err, session.ErrRefreshNotFound) {
+		t.Fatalf("resulting: %v, expect: %v", err, session.ErrRefreshNotFound)
+	}
+}
+
+func TestSignerLoginTTL(t *testing.T) {
+	ctx := context.Background()
+	cfg := session.Config{AccessTTL: time.Minute, RefreshTTL: time.Hour, LoginTTL: -time.Second}
+	signer, _ := session.NewSigner(cfg, "k1", map[string][]byte{"k1": []byte("secret")})
+
+	// The token never outlive the login, even when its own TTL is longer
+	token, _ := signer.Issue(ctx, "user1", "applicant")
+	if _, err := signer.Refresh(ctx, token.RefreshToken); !errors.Is(err, session.ErrSessionExpired) {
+		t.Fatalf("resulting: %v, expect: %v", err, session.ErrSessionExpired)
+	}
+	if _, err := signer.Authenticate(ctx, token.AccessToken); !errors.Is(err, session.ErrSessionExpired) {
+		t.Fatalf("resulting: %v, expect: %v", err, session.ErrSessionExpired)
+	}
+}
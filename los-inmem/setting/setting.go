@@ -1,13 +1,18 @@
 package setting
 
 import (
+	"errors"
 	"net/http"
 
 	"github.com/fikryfahrezy/adea/los-inmen/data"
 	"github.com/fikryfahrezy/adea/los-inmen/file"
+	"github.com/fikryfahrezy/adea/los-inmen/rbac"
 	"github.com/fikryfahrezy/adea/los-inmen/resp"
+	"github.com/fikryfahrezy/adea/los-inmen/session"
 )
 
+var ErrSettingForbidden = errors.New("user role not allowed")
+
 type SettingApp struct {
 	file file.File
 	db   *data.JsonFile
@@ -20,7 +25,24 @@ func NewSetting(file file.File, db *data.JsonFile) *SettingApp {
 	}
 }
 
+// allowed check the permission of the session in the request context,
+// the route middleware already did it but the setting replace the whole data
+// so it is checked once more here
+func allowed(w http.ResponseWriter, r *http.Request, p rbac.Permission) bool {
+	sess, _ := session.FromContext(r.Context())
+	if !rbac.Can(sess.Role, p) {
+		resp.NewResponse(http.StatusForbidden, "", ErrSettingForbidden).HttpJSON(w, nil)
+		return false
+	}
+
+	return true
+}
+
 func (a *SettingApp) LoadJsonDB(w http.ResponseWriter, r *http.Request) {
+	if !allowed(w, r, rbac.SettingDb) {
+		return
+	}
+
 	if err := r.ParseMultipartForm(1024); err != nil {
 		resp.NewResponse(http.StatusInternalServerError, "", err).HttpJSON(w, nil)
 		return
@@ -43,6 +65,10 @@ func (a *SettingApp) LoadJsonDB(w http.ResponseWriter, r *http.Request) {
 }
 
 func (a *SettingApp) GanerateJsonDB(w http.ResponseWriter, r *http.Request) {
+	if !allowed(w, r, rbac.SettingDb) {
+		return
+	}
+
 	contentDisposition := "attachment; filename=los-db.json"
 	w.Header().Set("Content-Disposition", contentDisposition)
 	w.WriteHeader(http.StatusOK)
@@ -53,6 +79,10 @@ func (a *SettingApp) GanerateJsonDB(w http.ResponseWriter, r *http.Request) {
 }
 
 func (a *SettingApp) ZipTmp(w http.ResponseWriter, r *http.Request) {
+	if !allowed(w, r, rbac.SettingTmp) {
+		return
+	}
+
 	contentDisposition := "attachment; filename=tmp.zip"
 	w.Header().Set("Content-Disposition", contentDisposition)
 	w.WriteHeader(http.StatusOK)
@@ -63,6 +93,10 @@ func (a *SettingApp) ZipTmp(w http.ResponseWriter, r *http.Request) {
 }
 
 func (a *SettingApp) LoadZipTmp(w http.ResponseWriter, r *http.Request) {
+	if !allowed(w, r, rbac.SettingTmp) {
+		return
+	}
+
 	if err := r.ParseMultipartForm(1024); err != nil {
 		resp.NewResponse(http.StatusInternalServerError, "", err).HttpJSON(w, nil)
 		return
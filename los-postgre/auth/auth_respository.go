@@ -2,42 +2,65 @@ package auth
 
 import (
 	"context"
-	"encoding/hex"
+	"database/sql"
 	"errors"
+	"strconv"
+	"strings"
 	"time"
 
 	"github.com/cockroachdb/cockroach-go/v2/crdb/crdbpgx"
+	"github.com/fikryfahrezy/adea/los-postgre/id"
 	"github.com/fikryfahrezy/adea/los-postgre/model"
 	"github.com/jackc/pgx/v4"
+	"github.com/jackc/pgx/v4/pgxpool"
 )
 
 var (
 	ErrDuplicateContraint = errors.New("some constraint are duplicate")
 	ErrUserNotFound       = errors.New("user not found")
+	ErrUserDeactivated    = errors.New("user already deactivated")
+	ErrInvitationNotFound = errors.New("invitation not found")
+	ErrInvitationUsed     = errors.New("invitation already used")
+	ErrResetNotFound      = errors.New("password reset token not found")
+	ErrResetUsed          = errors.New("password reset token already used")
+	ErrTotpNotFound       = errors.New("totp not found")
+	ErrTotpEnabled        = errors.New("totp already enabled")
+	ErrTotpReplayed       = errors.New("totp code already used")
+	ErrRecoveryNotFound   = errors.New("recovery code not found")
+	ErrChallengeNotFound  = errors.New("login challenge not found")
+	ErrChallengeUsed      = errors.New("login challenge already used")
+	ErrApiKeyNotFound     = errors.New("api key not found")
+	ErrIdentityNotFound   = errors.New("user identity not found")
+	ErrOidcStateNotFound  = errors.New("oidc state not found")
+	ErrOidcStateUsed      = errors.New("oidc state already used")
 )
 
 type Repository struct {
-	db *pgx.Conn
+	db  *pgxpool.Pool
+	ids id.Generator
 }
 
-func NewRepository(db *pgx.Conn) *Repository {
+func NewRepository(db *pgxpool.Pool, ids id.Generator) *Repository {
 	return &Repository{
-		db: db,
+		db:  db,
+		ids: ids,
 	}
 }
 
 func (r *Repository) InsertUser(ctx context.Context, user model.User) (model.User, error) {
-	t := time.Now()
-	id := hex.EncodeToString([]byte(user.Username))
+	userId, err := r.ids.New()
+	if err != nil {
+		return model.User{}, err
+	}
 
-	user.Id = id
-	user.CreatedDate = t
+	user.Id = userId
+	user.CreatedDate = time.Now()
 
-	err := crdbpgx.ExecuteTx(context.Background(), r.db, pgx.TxOptions{}, func(tx pgx.Tx) error {
+	err = crdbpgx.ExecuteTx(context.Background(), r.db, pgx.TxOptions{}, func(tx pgx.Tx) error {
 		if _, err := tx.Exec(ctx,
-			`INSERT INTO users (id, username, password, is_officer, created_date)
+			`INSERT INTO users (id, username, password, role, created_date)
 			VALUES ($1, $2, $3, $4, $5)`,
-			user.Id, user.Username, user.Password, user.IsOfficer, user.CreatedDate,
+			user.Id, user.Username, user.Password, user.Role, user.CreatedDate,
 		); err != nil {
 			return err
 		}
@@ -50,23 +73,1129 @@ func (r *Repository) InsertUser(ctx context.Context, user model.User) (model.Use
 	return user, nil
 }
 
+const userColumns = `id, username, password, role, display_name, email, phone, created_date, last_login_at, deactivated_date`
+
+func scanUser(row pgx.Row) (model.User, error) {
+	var user model.User
+	var lastLoginAt, deactivatedDate sql.NullTime
+	if err := row.Scan(
+		&user.Id,
+		&user.Username,
+		&user.Password,
+		&user.Role,
+		&user.DisplayName,
+		&user.Email,
+		&user.Phone,
+		&user.CreatedDate,
+		&lastLoginAt,
+		&deactivatedDate,
+	); err != nil {
+		return model.User{}, err
+	}
+
+	user.LastLoginAt = lastLoginAt.Time
+	user.DeactivatedDate = deactivatedDate.Time
+
+	return user, nil
+}
+
+func (r *Repository) getUser(ctx context.Context, where string, arg interface{}) (model.User, error) {
+	var user model.User
+	err := crdbpgx.ExecuteTx(context.Background(), r.db, pgx.TxOptions{}, func(tx pgx.Tx) error {
+		var err error
+		user, err = scanUser(tx.QueryRow(ctx,
+			`SELECT `+userColumns+` FROM users WHERE `+where+` = $1`,
+			arg,
+		))
+		return err
+	})
+	if errors.Is(err, pgx.ErrNoRows) {
+		return model.User{}, ErrUserNotFound
+	}
+	if err != nil {
+		return model.User{}, err
+	}
+
+	return user, nil
+}
+
 func (r *Repository) GetUserByUsername(ctx context.Context, username string) (model.User, error) {
-	id := hex.EncodeToString([]byte(username))
+	return r.getUser(ctx, "username", username)
+}
+
+func (r *Repository) GetUser(ctx context.Context, userId string) (model.User, error) {
+	return r.getUser(ctx, "id", userId)
+}
+
+func (r *Repository) InsertInvitation(ctx context.Context, inv model.Invitation) (model.Invitation, error) {
+	inv.CreatedDate = time.Now()
+
+	err := crdbpgx.ExecuteTx(context.Background(), r.db, pgx.TxOptions{}, func(tx pgx.Tx) error {
+		if _, err := tx.Exec(ctx,
+			`INSERT INTO invitations (id, token_hash, role, invited_by, created_date, expired_date)
+			VALUES ($1, $2, $3, $4, $5, $6)`,
+			inv.Id, inv.TokenHash, inv.Role, inv.InvitedBy, inv.CreatedDate.UTC(), inv.ExpiredDate.UTC(),
+		); err != nil {
+			return err
+		}
+		return nil
+	})
+	if err != nil {
+		return model.Invitation{}, err
+	}
+
+	return inv, nil
+}
+
+func (r *Repository) GetInvitationByTokenHash(ctx context.Context, tokenHash string) (model.Invitation, error) {
+	var inv model.Invitation
+	var userId sql.NullString
+	err := crdbpgx.ExecuteTx(context.Background(), r.db, pgx.TxOptions{}, func(tx pgx.Tx) error {
+		return tx.QueryRow(ctx,
+			`SELECT id, token_hash, role, invited_by, user_id, is_used, created_date, expired_date
+			FROM invitations WHERE token_hash = $1`,
+			tokenHash,
+		).Scan(&inv.Id, &inv.TokenHash, &inv.Role, &inv.InvitedBy, &userId, &inv.IsUsed, &inv.CreatedDate, &inv.ExpiredDate)
+	})
+	if errors.Is(err, pgx.ErrNoRows) {
+		return model.Invitation{}, ErrInvitationNotFound
+	}
+	if err != nil {
+		return model.Invitation{}, err
+	}
+
+	inv.UserId = userId.String
+
+	return inv, nil
+}
+
+// AcceptInvitation create the invited user and mark the invitation as used in one transaction,
+// so an invitation can only ever create a single user
+func (r *Repository) AcceptInvitation(ctx context.Context, invitationId string, user model.User) (model.User, error) {
+	userId, err := r.ids.New()
+	if err != nil {
+		return model.User{}, err
+	}
+
+	user.Id = userId
+	user.CreatedDate = time.Now()
+
+	err = crdbpgx.ExecuteTx(context.Background(), r.db, pgx.TxOptions{}, func(tx pgx.Tx) error {
+		var exist bool
+		if err := tx.QueryRow(ctx,
+			`SELECT EXISTS (SELECT 1 FROM users WHERE username = $1)`,
+			user.Username,
+		).Scan(&exist); err != nil {
+			return err
+		}
+		if exist {
+			return ErrDuplicateContraint
+		}
 
+		if _, err := tx.Exec(ctx,
+			`INSERT INTO users (id, username, password, role, created_date)
+			VALUES ($1, $2, $3, $4, $5)`,
+			user.Id, user.Username, user.Password, user.Role, user.CreatedDate,
+		); err != nil {
+			return err
+		}
+
+		tag, err := tx.Exec(ctx,
+			`UPDATE invitations SET is_used = true, user_id = $2
+			WHERE id = $1 AND is_used = false`,
+			invitationId, user.Id,
+		)
+		if err != nil {
+			return err
+		}
+		if tag.RowsAffected() == 0 {
+			return ErrInvitationUsed
+		}
+
+		return nil
+	})
+	if err != nil {
+		return model.User{}, err
+	}
+
+	return user, nil
+}
+
+func (r *Repository) UpdateUsername(ctx context.Context, userId, username string) error {
+	return crdbpgx.ExecuteTx(context.Background(), r.db, pgx.TxOptions{}, func(tx pgx.Tx) error {
+		var exist bool
+		if err := tx.QueryRow(ctx,
+			`SELECT EXISTS (SELECT 1 FROM users WHERE username = $1)`,
+			username,
+		).Scan(&exist); err != nil {
+			return err
+		}
+		if exist {
+			return ErrDuplicateContraint
+		}
+
+		tag, err := tx.Exec(ctx,
+			`UPDATE users SET username = $2 WHERE id = $1`,
+			userId, username,
+		)
+		if err != nil {
+			return err
+		}
+		if tag.RowsAffected() == 0 {
+			return ErrUserNotFound
+		}
+
+		return nil
+	})
+}
+
+func (r *Repository) UpdateRole(ctx context.Context, userId, role string) error {
+	return crdbpgx.ExecuteTx(context.Background(), r.db, pgx.TxOptions{}, func(tx pgx.Tx) error {
+		tag, err := tx.Exec(ctx,
+			`UPDATE users SET role = $2 WHERE id = $1`,
+			userId, role,
+		)
+		if err != nil {
+			return err
+		}
+		if tag.RowsAffected() == 0 {
+			return ErrUserNotFound
+		}
+
+		return nil
+	})
+}
+
+func (r *Repository) UpdatePassword(ctx context.Context, userId, password string) error {
+	var n int64
+	err := crdbpgx.ExecuteTx(context.Background(), r.db, pgx.TxOptions{}, func(tx pgx.Tx) error {
+		tag, err := tx.Exec(ctx,
+			`UPDATE users SET password = $2 WHERE id = $1`,
+			userId, password,
+		)
+		if err != nil {
+			return err
+		}
+
+		n = tag.RowsAffected()
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+
+	if n == 0 {
+		return ErrUserNotFound
+	}
+
+	return nil
+}
+
+// UserProfile is the part of the user the user can edit itself
+type UserProfile struct {
+	DisplayName string
+	Email       string
+	Phone       string
+}
+
+func (r *Repository) UpdateProfile(ctx context.Context, userId string, profile UserProfile) (model.User, error) {
 	var user model.User
+	err := crdbpgx.ExecuteTx(context.Background(), r.db, pgx.TxOptions{}, func(tx pgx.Tx) error {
+		var err error
+		user, err = scanUser(tx.QueryRow(ctx,
+			`UPDATE users SET display_name = $2, email = $3, phone = $4
+			WHERE id = $1
+			RETURNING `+userColumns,
+			userId, profile.DisplayName, profile.Email, profile.Phone,
+		))
+		return err
+	})
+	if errors.Is(err, pgx.ErrNoRows) {
+		return model.User{}, ErrUserNotFound
+	}
+	if err != nil {
+		return model.User{}, err
+	}
+
+	return user, nil
+}
+
+// DeactivateUser mark the user as deactivated, the user is kept
+// so the loan and the activity still point to it
+func (r *Repository) DeactivateUser(ctx context.Context, userId string) (model.User, error) {
+	var user model.User
+	err := crdbpgx.ExecuteTx(context.Background(), r.db, pgx.TxOptions{}, func(tx pgx.Tx) error {
+		var err error
+		user, err = scanUser(tx.QueryRow(ctx,
+			`UPDATE users SET deactivated_date = $2
+			WHERE id = $1 AND deactivated_date IS NULL
+			RETURNING `+userColumns,
+			userId, time.Now(),
+		))
+		if !errors.Is(err, pgx.ErrNoRows) {
+			return err
+		}
+
+		var exist bool
+		if err := tx.QueryRow(ctx,
+			`SELECT EXISTS (SELECT 1 FROM users WHERE id = $1)`,
+			userId,
+		).Scan(&exist); err != nil {
+			return err
+		}
+		if exist {
+			return ErrUserDeactivated
+		}
+
+		return ErrUserNotFound
+	})
+	if err != nil {
+		return model.User{}, err
+	}
+
+	return user, nil
+}
+
+// UserFilter narrow down the user, the zero value of a field mean
+// the field is not used to filter
+type UserFilter struct {
+	// Query is matched case insensitively against the username, display name, email and phone
+	Query string
+	Role  string
+	// IsActive filter by whether the user is deactivated, nil mean both
+	IsActive *bool
+	Limit    int
+	Offset   int
+}
+
+func (f UserFilter) where() (string, []interface{}) {
+	conds := make([]string, 0)
+	args := make([]interface{}, 0)
+
+	if f.Role != "" {
+		args = append(args, f.Role)
+		conds = append(conds, "role = $"+strconv.Itoa(len(args)))
+	}
+	if f.IsActive != nil {
+		if *f.IsActive {
+			conds = append(conds, "deactivated_date IS NULL")
+		} else {
+			conds = append(conds, "deactivated_date IS NOT NULL")
+		}
+	}
+	if f.Query != "" {
+		// The wildcard typed by the user is matched literally
+		q := strings.NewReplacer(`\`, `\\`, "%", `\%`, "_", `\_`).Replace(f.Query)
+		args = append(args, "%"+q+"%")
+		n := "$" + strconv.Itoa(len(args))
+		conds = append(conds, "(username ILIKE "+n+" OR display_name ILIKE "+n+" OR email ILIKE "+n+" OR phone ILIKE "+n+")")
+	}
+
+	if len(conds) == 0 {
+		return "", args
+	}
+
+	return "WHERE " + strings.Join(conds, " AND "), args
+}
+
+// GetUsers return the matching user, the newest come first
+func (r *Repository) GetUsers(ctx context.Context, filter UserFilter) ([]model.User, error) {
+	where, args := filter.where()
+	query := `SELECT ` + userColumns + ` FROM users ` + where + `
+		ORDER BY created_date DESC, id DESC`
+	if filter.Limit > 0 {
+		args = append(args, filter.Limit)
+		query += " LIMIT $" + strconv.Itoa(len(args))
+	}
+	if filter.Offset > 0 {
+		args = append(args, filter.Offset)
+		query += " OFFSET $" + strconv.Itoa(len(args))
+	}
+
+	users := make([]model.User, 0)
+	err := crdbpgx.ExecuteTx(context.Background(), r.db, pgx.TxOptions{}, func(tx pgx.Tx) error {
+		users = users[:0]
+
+		rows, err := tx.Query(ctx, query, args...)
+		if err != nil {
+			return err
+		}
+		defer rows.Close()
+
+		for rows.Next() {
+			user, err := scanUser(rows)
+			if err != nil {
+				return err
+			}
+
+			users = append(users, user)
+		}
+
+		return rows.Err()
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return users, nil
+}
+
+func (r *Repository) InsertPasswordReset(ctx context.Context, reset model.PasswordReset) (model.PasswordReset, error) {
+	reset.CreatedDate = time.Now()
+
+	err := crdbpgx.ExecuteTx(context.Background(), r.db, pgx.TxOptions{}, func(tx pgx.Tx) error {
+		if _, err := tx.Exec(ctx,
+			`INSERT INTO password_resets (id, token_hash, user_id, created_date, expired_date)
+			VALUES ($1, $2, $3, $4, $5)`,
+			reset.Id, reset.TokenHash, reset.UserId, reset.CreatedDate.UTC(), reset.ExpiredDate.UTC(),
+		); err != nil {
+			return err
+		}
+		return nil
+	})
+	if err != nil {
+		return model.PasswordReset{}, err
+	}
+
+	return reset, nil
+}
+
+func (r *Repository) GetPasswordResetByTokenHash(ctx context.Context, tokenHash string) (model.PasswordReset, error) {
+	var reset model.PasswordReset
+	err := crdbpgx.ExecuteTx(context.Background(), r.db, pgx.TxOptions{}, func(tx pgx.Tx) error {
+		return tx.QueryRow(ctx,
+			`SELECT id, token_hash, user_id, is_used, created_date, expired_date
+			FROM password_resets WHERE token_hash = $1`,
+			tokenHash,
+		).Scan(&reset.Id, &reset.TokenHash, &reset.UserId, &reset.IsUsed, &reset.CreatedDate, &reset.ExpiredDate)
+	})
+	if errors.Is(err, pgx.ErrNoRows) {
+		return model.PasswordReset{}, ErrResetNotFound
+	}
+	if err != nil {
+		return model.PasswordReset{}, err
+	}
+
+	return reset, nil
+}
+
+// ResetPassword update the password and mark every reset token of the user as used in one
+// transaction, so the other token requested before can not be used anymore
+func (r *Repository) ResetPassword(ctx context.Context, resetId, password string) error {
+	return crdbpgx.ExecuteTx(context.Background(), r.db, pgx.TxOptions{}, func(tx pgx.Tx) error {
+		var userId string
+		err := tx.QueryRow(ctx,
+			`UPDATE password_resets SET is_used = true
+			WHERE id = $1 AND is_used = false
+			RETURNING user_id`,
+			resetId,
+		).Scan(&userId)
+		if errors.Is(err, pgx.ErrNoRows) {
+			return ErrResetUsed
+		}
+		if err != nil {
+			return err
+		}
+
+		if _, err := tx.Exec(ctx,
+			`UPDATE password_resets SET is_used = true WHERE user_id = $1`,
+			userId,
+		); err != nil {
+			return err
+		}
+
+		_, err = tx.Exec(ctx,
+			`UPDATE users SET password = $2 WHERE id = $1`,
+			userId, password,
+		)
+		return err
+	})
+}
+
+// RecordLogin keep the login attempt and, when it succeed, set the attempt time
+// as the last login of the user in one transaction
+func (r *Repository) RecordLogin(ctx context.Context, act model.LoginActivity) (model.LoginActivity, error) {
+	act.CreatedDate = time.Now()
+
+	var userId sql.NullString
+	if act.UserId != "" {
+		userId.Scan(act.UserId)
+	}
+
+	err := crdbpgx.ExecuteTx(context.Background(), r.db, pgx.TxOptions{}, func(tx pgx.Tx) error {
+		if act.IsSuccess {
+			tag, err := tx.Exec(ctx,
+				`UPDATE users SET last_login_at = $2 WHERE id = $1`,
+				act.UserId, act.CreatedDate.UTC(),
+			)
+			if err != nil {
+				return err
+			}
+			if tag.RowsAffected() == 0 {
+				return ErrUserNotFound
+			}
+		}
+
+		_, err := tx.Exec(ctx,
+			`INSERT INTO login_activities (id, user_id, username, is_success, reason, ip, user_agent, created_date)
+			VALUES ($1, $2, $3, $4, $5, $6, $7, $8)`,
+			act.Id, userId, act.Username, act.IsSuccess, act.Reason, act.Ip, act.UserAgent, act.CreatedDate.UTC(),
+		)
+		return err
+	})
+	if err != nil {
+		return model.LoginActivity{}, err
+	}
+
+	return act, nil
+}
+
+// LoginActivityFilter narrow down the login activity, the zero value of a field mean
+// the field is not used to filter
+type LoginActivityFilter struct {
+	UserId   string
+	Username string
+	// IsSuccess filter by the result of the attempt, nil mean both
+	IsSuccess *bool
+	From      time.Time
+	To        time.Time
+	Limit     int
+}
+
+func (f LoginActivityFilter) where() (string, []interface{}) {
+	conds := make([]string, 0)
+	args := make([]interface{}, 0)
+	add := func(cond string, arg interface{}) {
+		args = append(args, arg)
+		conds = append(conds, cond+" $"+strconv.Itoa(len(args)))
+	}
+
+	if f.UserId != "" {
+		add("user_id =", f.UserId)
+	}
+	if f.Username != "" {
+		add("username =", f.Username)
+	}
+	if f.IsSuccess != nil {
+		add("is_success =", *f.IsSuccess)
+	}
+	if !f.From.IsZero() {
+		add("created_date >=", f.From.UTC())
+	}
+	if !f.To.IsZero() {
+		add("created_date <", f.To.UTC())
+	}
+
+	if len(conds) == 0 {
+		return "", args
+	}
+
+	return "WHERE " + strings.Join(conds, " AND "), args
+}
+
+// GetLoginActivities return the matching login activity, the newest come first
+func (r *Repository) GetLoginActivities(ctx context.Context, filter LoginActivityFilter) ([]model.LoginActivity, error) {
+	where, args := filter.where()
+	query := `SELECT id, user_id, username, is_success, reason, ip, user_agent, created_date
+		FROM login_activities ` + where + `
+		ORDER BY created_date DESC`
+	if filter.Limit > 0 {
+		args = append(args, filter.Limit)
+		query += " LIMIT $" + strconv.Itoa(len(args))
+	}
+
+	acts := make([]model.LoginActivity, 0)
+	err := crdbpgx.ExecuteTx(context.Background(), r.db, pgx.TxOptions{}, func(tx pgx.Tx) error {
+		acts = acts[:0]
+
+		rows, err := tx.Query(ctx, query, args...)
+		if err != nil {
+			return err
+		}
+		defer rows.Close()
+
+		for rows.Next() {
+			var act model.LoginActivity
+			var userId sql.NullString
+			if err := rows.Scan(&act.Id, &userId, &act.Username, &act.IsSuccess, &act.Reason, &act.Ip, &act.UserAgent, &act.CreatedDate); err != nil {
+				return err
+			}
+
+			act.UserId = userId.String
+			acts = append(acts, act)
+		}
+
+		return rows.Err()
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return acts, nil
+}
+
+func (r *Repository) GetUserTotp(ctx context.Context, userId string) (model.UserTotp, error) {
+	var t model.UserTotp
+	err := crdbpgx.ExecuteTx(context.Background(), r.db, pgx.TxOptions{}, func(tx pgx.Tx) error {
+		return tx.QueryRow(ctx,
+			`SELECT user_id, secret, is_enabled, last_counter, created_date
+			FROM user_totps WHERE user_id = $1`,
+			userId,
+		).Scan(&t.UserId, &t.Secret, &t.IsEnabled, &t.LastCounter, &t.CreatedDate)
+	})
+	if errors.Is(err, pgx.ErrNoRows) {
+		return model.UserTotp{}, ErrTotpNotFound
+	}
+	if err != nil {
+		return model.UserTotp{}, err
+	}
+
+	return t, nil
+}
+
+// SetUserTotp keep a new secret for the user waiting to be verified,
+// the secret that is already enabled can not be replaced
+func (r *Repository) SetUserTotp(ctx context.Context, t model.UserTotp) (model.UserTotp, error) {
+	t.IsEnabled = false
+	t.CreatedDate = time.Now()
+
+	err := crdbpgx.ExecuteTx(context.Background(), r.db, pgx.TxOptions{}, func(tx pgx.Tx) error {
+		tag, err := tx.Exec(ctx,
+			`INSERT INTO user_totps (user_id, secret, is_enabled, last_counter, created_date)
+			VALUES ($1, $2, false, 0, $3)
+			ON CONFLICT (user_id) DO UPDATE SET secret = excluded.secret, last_counter = 0, created_date = excluded.created_date
+			WHERE user_totps.is_enabled = false`,
+			t.UserId, t.Secret, t.CreatedDate.UTC(),
+		)
+		if err != nil {
+			return err
+		}
+		if tag.RowsAffected() == 0 {
+			return ErrTotpEnabled
+		}
+		return nil
+	})
+	if err != nil {
+		return model.UserTotp{}, err
+	}
+
+	return t, nil
+}
+
+// EnableTotp enable the secret waiting to be verified and replace
+// the recovery codes of the user in one transaction
+func (r *Repository) EnableTotp(ctx context.Context, userId string, counter int64, codes []model.RecoveryCode) error {
+	return crdbpgx.ExecuteTx(context.Background(), r.db, pgx.TxOptions{}, func(tx pgx.Tx) error {
+		var isEnabled bool
+		err := tx.QueryRow(ctx,
+			`SELECT is_enabled FROM user_totps WHERE user_id = $1 FOR UPDATE`,
+			userId,
+		).Scan(&isEnabled)
+		if errors.Is(err, pgx.ErrNoRows) {
+			return ErrTotpNotFound
+		}
+		if err != nil {
+			return err
+		}
+		if isEnabled {
+			return ErrTotpEnabled
+		}
+
+		if _, err := tx.Exec(ctx,
+			`UPDATE user_totps SET is_enabled = true, last_counter = $2 WHERE user_id = $1`,
+			userId, counter,
+		); err != nil {
+			return err
+		}
+
+		return replaceRecoveryCodes(ctx, tx, userId, codes)
+	})
+}
+
+// UseTotp move the last accepted time step forward,
+// so the code of the step or the earlier one can not be used again
+func (r *Repository) UseTotp(ctx context.Context, userId string, counter int64) error {
+	return crdbpgx.ExecuteTx(context.Background(), r.db, pgx.TxOptions{}, func(tx pgx.Tx) error {
+		var lastCounter int64
+		err := tx.QueryRow(ctx,
+			`SELECT last_counter FROM user_totps WHERE user_id = $1 AND is_enabled = true FOR UPDATE`,
+			userId,
+		).Scan(&lastCounter)
+		if errors.Is(err, pgx.ErrNoRows) {
+			return ErrTotpNotFound
+		}
+		if err != nil {
+			return err
+		}
+		if counter <= lastCounter {
+			return ErrTotpReplayed
+		}
+
+		_, err = tx.Exec(ctx,
+			`UPDATE user_totps SET last_counter = $2 WHERE user_id = $1`,
+			userId, counter,
+		)
+		return err
+	})
+}
+
+// DeleteUserTotp remove the secret and the recovery codes of the user
+func (r *Repository) DeleteUserTotp(ctx context.Context, userId string) error {
+	return crdbpgx.ExecuteTx(context.Background(), r.db, pgx.TxOptions{}, func(tx pgx.Tx) error {
+		tag, err := tx.Exec(ctx,
+			`DELETE FROM user_totps WHERE user_id = $1`,
+			userId,
+		)
+		if err != nil {
+			return err
+		}
+		if tag.RowsAffected() == 0 {
+			return ErrTotpNotFound
+		}
+
+		return replaceRecoveryCodes(ctx, tx, userId, nil)
+	})
+}
+
+func (r *Repository) ReplaceRecoveryCodes(ctx context.Context, userId string, codes []model.RecoveryCode) error {
+	return crdbpgx.ExecuteTx(context.Background(), r.db, pgx.TxOptions{}, func(tx pgx.Tx) error {
+		return replaceRecoveryCodes(ctx, tx, userId, codes)
+	})
+}
+
+func replaceRecoveryCodes(ctx context.Context, tx pgx.Tx, userId string, codes []model.RecoveryCode) error {
+	if _, err := tx.Exec(ctx,
+		`DELETE FROM recovery_codes WHERE user_id = $1`,
+		userId,
+	); err != nil {
+		return err
+	}
+
+	t := time.Now().UTC()
+	for _, v := range codes {
+		if _, err := tx.Exec(ctx,
+			`INSERT INTO recovery_codes (id, user_id, code_hash, created_date)
+			VALUES ($1, $2, $3, $4)`,
+			v.Id, userId, v.CodeHash, t,
+		); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// UseRecoveryCode mark the unused recovery code of the user as used
+func (r *Repository) UseRecoveryCode(ctx context.Context, userId, codeHash string) error {
+	var n int64
+	err := crdbpgx.ExecuteTx(context.Background(), r.db, pgx.TxOptions{}, func(tx pgx.Tx) error {
+		tag, err := tx.Exec(ctx,
+			`UPDATE recovery_codes SET is_used = true
+			WHERE user_id = $1 AND code_hash = $2 AND is_used = false`,
+			userId, codeHash,
+		)
+		if err != nil {
+			return err
+		}
+
+		n = tag.RowsAffected()
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+
+	if n == 0 {
+		return ErrRecoveryNotFound
+	}
+
+	return nil
+}
+
+func (r *Repository) InsertLoginChallenge(ctx context.Context, ch model.LoginChallenge) (model.LoginChallenge, error) {
+	ch.CreatedDate = time.Now()
+
+	err := crdbpgx.ExecuteTx(context.Background(), r.db, pgx.TxOptions{}, func(tx pgx.Tx) error {
+		if _, err := tx.Exec(ctx,
+			`INSERT INTO login_challenges (id, token_hash, user_id, created_date, expired_date)
+			VALUES ($1, $2, $3, $4, $5)`,
+			ch.Id, ch.TokenHash, ch.UserId, ch.CreatedDate.UTC(), ch.ExpiredDate.UTC(),
+		); err != nil {
+			return err
+		}
+		return nil
+	})
+	if err != nil {
+		return model.LoginChallenge{}, err
+	}
+
+	return ch, nil
+}
+
+func (r *Repository) GetLoginChallengeByTokenHash(ctx context.Context, tokenHash string) (model.LoginChallenge, error) {
+	var ch model.LoginChallenge
 	err := crdbpgx.ExecuteTx(context.Background(), r.db, pgx.TxOptions{}, func(tx pgx.Tx) error {
 		return tx.QueryRow(ctx,
-			`SELECT id, username, password, is_officer, created_date
-			FROM users WHERE id = $1`,
+			`SELECT id, token_hash, user_id, attempts, is_used, created_date, expired_date
+			FROM login_challenges WHERE token_hash = $1`,
+			tokenHash,
+		).Scan(&ch.Id, &ch.TokenHash, &ch.UserId, &ch.Attempts, &ch.IsUsed, &ch.CreatedDate, &ch.ExpiredDate)
+	})
+	if errors.Is(err, pgx.ErrNoRows) {
+		return model.LoginChallenge{}, ErrChallengeNotFound
+	}
+	if err != nil {
+		return model.LoginChallenge{}, err
+	}
+
+	return ch, nil
+}
+
+// FailLoginChallenge count a wrong code against the challenge,
+// the challenge is used up once it reach the max attempts
+func (r *Repository) FailLoginChallenge(ctx context.Context, challengeId string, maxAttempts int) error {
+	var n int64
+	err := crdbpgx.ExecuteTx(context.Background(), r.db, pgx.TxOptions{}, func(tx pgx.Tx) error {
+		tag, err := tx.Exec(ctx,
+			`UPDATE login_challenges
+			SET attempts = attempts + 1, is_used = is_used OR attempts + 1 >= $2
+			WHERE id = $1`,
+			challengeId, maxAttempts,
+		)
+		if err != nil {
+			return err
+		}
+
+		n = tag.RowsAffected()
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+
+	if n == 0 {
+		return ErrChallengeNotFound
+	}
+
+	return nil
+}
+
+func (r *Repository) UseLoginChallenge(ctx context.Context, challengeId string) error {
+	var n int64
+	err := crdbpgx.ExecuteTx(context.Background(), r.db, pgx.TxOptions{}, func(tx pgx.Tx) error {
+		tag, err := tx.Exec(ctx,
+			`UPDATE login_challenges SET is_used = true WHERE id = $1 AND is_used = false`,
+			challengeId,
+		)
+		if err != nil {
+			return err
+		}
+
+		n = tag.RowsAffected()
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+
+	if n == 0 {
+		return ErrChallengeUsed
+	}
+
+	return nil
+}
+
+func (r *Repository) InsertApiKey(ctx context.Context, key model.ApiKey) (model.ApiKey, error) {
+	key.CreatedDate = time.Now()
+
+	var expiredDate sql.NullTime
+	if !key.ExpiredDate.IsZero() {
+		expiredDate.Scan(key.ExpiredDate.UTC())
+	}
+
+	err := crdbpgx.ExecuteTx(context.Background(), r.db, pgx.TxOptions{}, func(tx pgx.Tx) error {
+		if _, err := tx.Exec(ctx,
+			`INSERT INTO api_keys (id, name, prefix, key_hash, user_id, scopes, created_date, expired_date)
+			VALUES ($1, $2, $3, $4, $5, $6, $7, $8)`,
+			key.Id, key.Name, key.Prefix, key.KeyHash, key.UserId, key.Scopes, key.CreatedDate.UTC(), expiredDate,
+		); err != nil {
+			return err
+		}
+		return nil
+	})
+	if err != nil {
+		return model.ApiKey{}, err
+	}
+
+	return key, nil
+}
+
+const apiKeyColumns = `id, name, prefix, key_hash, user_id, scopes, is_revoked, created_date, expired_date, last_used_date`
+
+func scanApiKey(row pgx.Row) (model.ApiKey, error) {
+	var key model.ApiKey
+	var expiredDate, lastUsedDate sql.NullTime
+	if err := row.Scan(
+		&key.Id,
+		&key.Name,
+		&key.Prefix,
+		&key.KeyHash,
+		&key.UserId,
+		&key.Scopes,
+		&key.IsRevoked,
+		&key.CreatedDate,
+		&expiredDate,
+		&lastUsedDate,
+	); err != nil {
+		return model.ApiKey{}, err
+	}
+
+	key.ExpiredDate = expiredDate.Time
+	key.LastUsedDate = lastUsedDate.Time
+
+	return key, nil
+}
+
+func (r *Repository) getApiKey(ctx context.Context, where string, arg interface{}) (model.ApiKey, error) {
+	var key model.ApiKey
+	err := crdbpgx.ExecuteTx(context.Background(), r.db, pgx.TxOptions{}, func(tx pgx.Tx) error {
+		var err error
+		key, err = scanApiKey(tx.QueryRow(ctx,
+			`SELECT `+apiKeyColumns+` FROM api_keys WHERE `+where+` = $1`,
+			arg,
+		))
+		return err
+	})
+	if errors.Is(err, pgx.ErrNoRows) {
+		return model.ApiKey{}, ErrApiKeyNotFound
+	}
+	if err != nil {
+		return model.ApiKey{}, err
+	}
+
+	return key, nil
+}
+
+func (r *Repository) GetApiKey(ctx context.Context, id string) (model.ApiKey, error) {
+	return r.getApiKey(ctx, "id", id)
+}
+
+func (r *Repository) GetApiKeyByKeyHash(ctx context.Context, keyHash string) (model.ApiKey, error) {
+	return r.getApiKey(ctx, "key_hash", keyHash)
+}
+
+// GetApiKeys return every API key, the newest come first
+func (r *Repository) GetApiKeys(ctx context.Context) ([]model.ApiKey, error) {
+	keys := make([]model.ApiKey, 0)
+	err := crdbpgx.ExecuteTx(context.Background(), r.db, pgx.TxOptions{}, func(tx pgx.Tx) error {
+		keys = keys[:0]
+
+		rows, err := tx.Query(ctx,
+			`SELECT `+apiKeyColumns+` FROM api_keys ORDER BY created_date DESC`,
+		)
+		if err != nil {
+			return err
+		}
+		defer rows.Close()
+
+		for rows.Next() {
+			key, err := scanApiKey(rows)
+			if err != nil {
+				return err
+			}
+
+			keys = append(keys, key)
+		}
+
+		return rows.Err()
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return keys, nil
+}
+
+// RotateApiKey replace the key of the API key that is not revoked,
+// the old key stop working right away
+func (r *Repository) RotateApiKey(ctx context.Context, id, prefix, keyHash string) (model.ApiKey, error) {
+	var key model.ApiKey
+	err := crdbpgx.ExecuteTx(context.Background(), r.db, pgx.TxOptions{}, func(tx pgx.Tx) error {
+		var err error
+		key, err = scanApiKey(tx.QueryRow(ctx,
+			`UPDATE api_keys SET prefix = $2, key_hash = $3
+			WHERE id = $1 AND is_revoked = false
+			RETURNING `+apiKeyColumns,
+			id, prefix, keyHash,
+		))
+		return err
+	})
+	if errors.Is(err, pgx.ErrNoRows) {
+		return model.ApiKey{}, ErrApiKeyNotFound
+	}
+	if err != nil {
+		return model.ApiKey{}, err
+	}
+
+	return key, nil
+}
+
+func (r *Repository) RevokeApiKey(ctx context.Context, id string) error {
+	var n int64
+	err := crdbpgx.ExecuteTx(context.Background(), r.db, pgx.TxOptions{}, func(tx pgx.Tx) error {
+		tag, err := tx.Exec(ctx,
+			`UPDATE api_keys SET is_revoked = true WHERE id = $1 AND is_revoked = false`,
 			id,
-		).Scan(&user.Id, &user.Username, &user.Password, &user.IsOfficer, &user.CreatedDate)
+		)
+		if err != nil {
+			return err
+		}
+
+		n = tag.RowsAffected()
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+
+	if n == 0 {
+		return ErrApiKeyNotFound
+	}
+
+	return nil
+}
+
+func (r *Repository) UseApiKey(ctx context.Context, id string, t time.Time) error {
+	return crdbpgx.ExecuteTx(context.Background(), r.db, pgx.TxOptions{}, func(tx pgx.Tx) error {
+		_, err := tx.Exec(ctx,
+			`UPDATE api_keys SET last_used_date = $2 WHERE id = $1`,
+			id, t.UTC(),
+		)
+		return err
+	})
+}
+
+func (r *Repository) GetUserIdentity(ctx context.Context, issuer, subject string) (model.UserIdentity, error) {
+	var identity model.UserIdentity
+	err := crdbpgx.ExecuteTx(context.Background(), r.db, pgx.TxOptions{}, func(tx pgx.Tx) error {
+		return tx.QueryRow(ctx,
+			`SELECT id, issuer, subject, user_id, created_date
+			FROM user_identities WHERE issuer = $1 AND subject = $2`,
+			issuer, subject,
+		).Scan(&identity.Id, &identity.Issuer, &identity.Subject, &identity.UserId, &identity.CreatedDate)
 	})
 	if errors.Is(err, pgx.ErrNoRows) {
-		return model.User{}, ErrUserNotFound
+		return model.UserIdentity{}, ErrIdentityNotFound
+	}
+	if err != nil {
+		return model.UserIdentity{}, err
 	}
+
+	return identity, nil
+}
+
+// InsertIdentityUser create the user signed up through the OpenID provider and its identity at once,
+// so a subject is never left without its user
+func (r *Repository) InsertIdentityUser(ctx context.Context, user model.User, identity model.UserIdentity) (model.User, error) {
+	userId, err := r.ids.New()
+	if err != nil {
+		return model.User{}, err
+	}
+
+	user.Id = userId
+	user.CreatedDate = time.Now()
+	identity.UserId = user.Id
+	identity.CreatedDate = user.CreatedDate
+
+	err = crdbpgx.ExecuteTx(context.Background(), r.db, pgx.TxOptions{}, func(tx pgx.Tx) error {
+		var exist bool
+		if err := tx.QueryRow(ctx,
+			`SELECT EXISTS (SELECT 1 FROM users WHERE username = $1)
+			OR EXISTS (SELECT 1 FROM user_identities WHERE issuer = $2 AND subject = $3)`,
+			user.Username, identity.Issuer, identity.Subject,
+		).Scan(&exist); err != nil {
+			return err
+		}
+		if exist {
+			return ErrDuplicateContraint
+		}
+
+		if _, err := tx.Exec(ctx,
+			`INSERT INTO users (id, username, password, role, display_name, email, created_date)
+			VALUES ($1, $2, $3, $4, $5, $6, $7)`,
+			user.Id, user.Username, user.Password, user.Role, user.DisplayName, user.Email, user.CreatedDate,
+		); err != nil {
+			return err
+		}
+
+		if _, err := tx.Exec(ctx,
+			`INSERT INTO user_identities (id, issuer, subject, user_id, created_date)
+			VALUES ($1, $2, $3, $4, $5)`,
+			identity.Id, identity.Issuer, identity.Subject, identity.UserId, identity.CreatedDate,
+		); err != nil {
+			return err
+		}
+
+		return nil
+	})
 	if err != nil {
 		return model.User{}, err
 	}
 
 	return user, nil
 }
+
+func (r *Repository) InsertOidcState(ctx context.Context, st model.OidcState) (model.OidcState, error) {
+	st.CreatedDate = time.Now()
+
+	err := crdbpgx.ExecuteTx(context.Background(), r.db, pgx.TxOptions{}, func(tx pgx.Tx) error {
+		if _, err := tx.Exec(ctx,
+			`INSERT INTO oidc_states (id, state_hash, nonce, code_verifier, created_date, expired_date)
+			VALUES ($1, $2, $3, $4, $5, $6)`,
+			st.Id, st.StateHash, st.Nonce, st.CodeVerifier, st.CreatedDate.UTC(), st.ExpiredDate.UTC(),
+		); err != nil {
+			return err
+		}
+		return nil
+	})
+	if err != nil {
+		return model.OidcState{}, err
+	}
+
+	return st, nil
+}
+
+// UseOidcState return the state of the hash and mark it used at once,
+// so the callback can only be completed once
+func (r *Repository) UseOidcState(ctx context.Context, stateHash string) (model.OidcState, error) {
+	var st model.OidcState
+	err := crdbpgx.ExecuteTx(context.Background(), r.db, pgx.TxOptions{}, func(tx pgx.Tx) error {
+		err := tx.QueryRow(ctx,
+			`UPDATE oidc_states SET is_used = true
+			WHERE state_hash = $1 AND is_used = false
+			RETURNING id, state_hash, nonce, code_verifier, is_used, created_date, expired_date`,
+			stateHash,
+		).Scan(&st.Id, &st.StateHash, &st.Nonce, &st.CodeVerifier, &st.IsUsed, &st.CreatedDate, &st.ExpiredDate)
+		if !errors.Is(err, pgx.ErrNoRows) {
+			return err
+		}
+
+		var exist bool
+		if err := tx.QueryRow(ctx,
+			`SELECT EXISTS (SELECT 1 FROM oidc_states WHERE state_hash = $1)`,
+			stateHash,
+		).Scan(&exist); err != nil {
+			return err
+		}
+		if exist {
+			return ErrOidcStateUsed
+		}
+
+		return ErrOidcStateNotFound
+	})
+	if err != nil {
+		return model.OidcState{}, err
+	}
+
+	return st, nil
+}
@@ -2,14 +2,18 @@ package auth
 
 import (
 	"encoding/json"
+	"errors"
+	"io"
+	"net"
 	"net/http"
+	"strconv"
 	"time"
 
 	"github.com/fikryfahrezy/adea/los-postgre/resp"
 	"github.com/fikryfahrezy/adea/los-postgre/session"
 )
 
-func (a *AuthApp) RegisterPost(session *session.Session) http.HandlerFunc {
+func (a *AuthApp) RegisterPost(sa session.Authenticator) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
 		var in RegisterIn
 		err := json.NewDecoder(r.Body).Decode(&in)
@@ -20,14 +24,35 @@ func (a *AuthApp) RegisterPost(session *session.Session) http.HandlerFunc {
 
 		out := a.Register(r.Context(), in)
 		if out.Error == nil {
-			session.Set(out.Res.Id, out.Res.Id, out.Res.IsOfficer, time.Now().Add(time.Hour).Unix())
+			token, err := sa.Issue(r.Context(), out.Res.Id, out.Res.Role)
+			if err != nil {
+				resp.NewResponse(http.StatusInternalServerError, "", err).HttpJSON(w, nil)
+				return
+			}
+
+			out.Res.Token = token.AccessToken
+			out.Res.RefreshToken = token.RefreshToken
+			out.Res.ExpiresIn = token.ExpiresIn
 		}
 
 		out.HttpJSON(w, resp.NewHttpBody(out.Res))
 	}
 }
 
-func (a *AuthApp) LoginPost(session *session.Session) http.HandlerFunc {
+// setLoginToken put the issued token into the body of the login response,
+// or into the cookies when the client ask for it so the script of the page never see it
+func setLoginToken(w http.ResponseWriter, cc session.CookieConfig, res *LoginRes, token session.Token, useCookie bool) {
+	res.ExpiresIn = token.ExpiresIn
+	if useCookie {
+		res.CsrfToken = session.SetCookie(w, cc, token)
+		return
+	}
+
+	res.Token = token.AccessToken
+	res.RefreshToken = token.RefreshToken
+}
+
+func (a *AuthApp) LoginPost(sa session.Authenticator, cc session.CookieConfig) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
 		var in LoginIn
 		err := json.NewDecoder(r.Body).Decode(&in)
@@ -36,11 +61,610 @@ func (a *AuthApp) LoginPost(session *session.Session) http.HandlerFunc {
 			return
 		}
 
+		in.Ip = clientIp(r)
+		in.UserAgent = r.UserAgent()
 		out := a.Login(r.Context(), in)
+		if out.StatusCode == http.StatusTooManyRequests {
+			w.Header().Set("Retry-After", strconv.FormatInt(out.Res.RetryAfter, 10))
+		}
+		// The session of the user that require TOTP is issued by LoginTotpPost
+		if out.Error == nil && !out.Res.TotpRequired {
+			token, err := sa.Issue(r.Context(), out.Res.Id, out.Res.Role)
+			if err != nil {
+				resp.NewResponse(http.StatusInternalServerError, "", err).HttpJSON(w, nil)
+				return
+			}
+
+			setLoginToken(w, cc, &out.Res, token, in.Cookie)
+		}
+
+		out.HttpJSON(w, resp.NewHttpBody(out.Res))
+	}
+}
+
+func (a *AuthApp) OidcLoginGet(w http.ResponseWriter, r *http.Request) {
+	out := a.StartOidcLogin(r.Context())
+	out.HttpJSON(w, resp.NewHttpBody(out.Res))
+}
+
+// OidcCallbackGet is the redirect URL registered at the OpenID provider,
+// the session is returned the same way as the password login
+func (a *AuthApp) OidcCallbackGet(sa session.Authenticator) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		q := r.URL.Query()
+		out := a.OidcCallback(r.Context(), OidcCallbackIn{
+			Code:      q.Get("code"),
+			State:     q.Get("state"),
+			Error:     q.Get("error"),
+			Ip:        clientIp(r),
+			UserAgent: r.UserAgent(),
+		})
 		if out.Error == nil {
-			session.Set(out.Res.Id, out.Res.Id, out.Res.IsOfficer, time.Now().Add(time.Hour).Unix())
+			// The signed token can not be revoked, its refresh read the new role instead
+			if out.Res.RoleChanged && sa.CanRevoke() {
+				if _, err := sa.RevokeByUserId(r.Context(), out.Res.Id); err != nil {
+					resp.NewResponse(http.StatusInternalServerError, "", err).HttpJSON(w, nil)
+					return
+				}
+			}
+
+			token, err := sa.Issue(r.Context(), out.Res.Id, out.Res.Role)
+			if err != nil {
+				resp.NewResponse(http.StatusInternalServerError, "", err).HttpJSON(w, nil)
+				return
+			}
+
+			out.Res.Token = token.AccessToken
+			out.Res.RefreshToken = token.RefreshToken
+			out.Res.ExpiresIn = token.ExpiresIn
 		}
 
 		out.HttpJSON(w, resp.NewHttpBody(out.Res))
 	}
 }
+
+type (
+	RefreshIn struct {
+		RefreshToken string `json:"refresh_token"`
+	}
+	RefreshRes struct {
+		ExpiresIn    int64  `json:"expires_in"`
+		Token        string `json:"token"`
+		RefreshToken string `json:"refresh_token"`
+		CsrfToken    string `json:"csrf_token"`
+	}
+)
+
+// RefreshPost exchange the refresh token of the body, or else the one of the cookie,
+// the session that live in the cookie is refreshed into the cookie again
+func (a *AuthApp) RefreshPost(sa session.Authenticator, cc session.CookieConfig) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		var in RefreshIn
+		err := json.NewDecoder(r.Body).Decode(&in)
+		if err != nil && !errors.Is(err, io.EOF) {
+			resp.NewResponse(http.StatusInternalServerError, "", err).HttpJSON(w, nil)
+			return
+		}
+
+		fromCookie := false
+		if in.RefreshToken == "" {
+			in.RefreshToken, fromCookie = session.CookieToken(r, session.RefreshCookie), true
+		}
+		// The access token may be expired already, it is only used to check the CSRF token
+		if fromCookie && in.RefreshToken != "" && !session.ValidCsrf(r, session.CookieToken(r, session.AccessCookie)) {
+			resp.NewResponse(http.StatusForbidden, "", ErrCsrfTokenNotValid).HttpJSON(w, nil)
+			return
+		}
+
+		if in.RefreshToken == "" {
+			resp.NewResponse(http.StatusUnprocessableEntity, "", ErrRefreshTokenRequired).HttpJSON(w, nil)
+			return
+		}
+
+		token, err := sa.Refresh(r.Context(), in.RefreshToken)
+		if errors.Is(err, session.ErrRefreshNotFound) ||
+			errors.Is(err, session.ErrRefreshReused) ||
+			errors.Is(err, session.ErrSessionExpired) {
+			resp.NewResponse(http.StatusUnauthorized, "", err).HttpJSON(w, nil)
+			return
+		}
+		if err != nil {
+			resp.NewResponse(http.StatusInternalServerError, "", err).HttpJSON(w, nil)
+			return
+		}
+
+		if fromCookie {
+			resp.NewResponse(http.StatusOK, "", nil).HttpJSON(w, resp.NewHttpBody(RefreshRes{
+				ExpiresIn: token.ExpiresIn,
+				CsrfToken: session.SetCookie(w, cc, token),
+			}))
+			return
+		}
+
+		resp.NewResponse(http.StatusOK, "", nil).HttpJSON(w, resp.NewHttpBody(RefreshRes{
+			ExpiresIn:    token.ExpiresIn,
+			Token:        token.AccessToken,
+			RefreshToken: token.RefreshToken,
+		}))
+	}
+}
+
+type (
+	LogoutRes struct {
+		Revoked int `json:"revoked"`
+	}
+	SessionRes struct {
+		Id          string `json:"id"`
+		UserId      string `json:"user_id"`
+		Role        string `json:"role"`
+		CreatedDate string `json:"created_date"`
+		ExpiredDate string `json:"expired_date"`
+	}
+)
+
+func (a *AuthApp) LogoutPost(sa session.Authenticator, cc session.CookieConfig) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		// The cookie is removed even when the token can not be revoked, so the browser is logged out
+		session.ClearCookie(w, cc)
+		current, _ := session.FromContext(r.Context())
+		n, err := sa.Revoke(r.Context(), current)
+		if errors.Is(err, session.ErrStatelessNotSupported) {
+			resp.NewResponse(http.StatusNotImplemented, "", err).HttpJSON(w, nil)
+			return
+		}
+		if err != nil {
+			resp.NewResponse(http.StatusInternalServerError, "", err).HttpJSON(w, nil)
+			return
+		}
+
+		resp.NewResponse(http.StatusOK, "", nil).HttpJSON(w, resp.NewHttpBody(LogoutRes{Revoked: n}))
+	}
+}
+
+func (a *AuthApp) LogoutAllPost(sa session.Authenticator, cc session.CookieConfig) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		session.ClearCookie(w, cc)
+		n, err := sa.RevokeByUserId(r.Context(), session.UserId(r.Context()))
+		if errors.Is(err, session.ErrStatelessNotSupported) {
+			resp.NewResponse(http.StatusNotImplemented, "", err).HttpJSON(w, nil)
+			return
+		}
+		if err != nil {
+			resp.NewResponse(http.StatusInternalServerError, "", err).HttpJSON(w, nil)
+			return
+		}
+
+		resp.NewResponse(http.StatusOK, "", nil).HttpJSON(w, resp.NewHttpBody(LogoutRes{Revoked: n}))
+	}
+}
+
+func (a *AuthApp) SessionsGet(sa session.Authenticator) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		userId := r.URL.Query().Get("user_id")
+		if userId == "" {
+			http.NotFound(w, r)
+			return
+		}
+
+		sessions, err := sa.GetByUserId(r.Context(), userId)
+		if errors.Is(err, session.ErrStatelessNotSupported) {
+			resp.NewResponse(http.StatusNotImplemented, "", err).HttpJSON(w, nil)
+			return
+		}
+		if err != nil {
+			resp.NewResponse(http.StatusInternalServerError, "", err).HttpJSON(w, nil)
+			return
+		}
+
+		res := make([]SessionRes, 0, len(sessions))
+		for _, s := range sessions {
+			res = append(res, SessionRes{
+				Id:          s.Id,
+				UserId:      s.UserId,
+				Role:        s.Role,
+				CreatedDate: time.Unix(s.Created, 0).Format(time.RFC3339),
+				ExpiredDate: time.Unix(s.Expired, 0).Format(time.RFC3339),
+			})
+		}
+
+		resp.NewResponse(http.StatusOK, "", nil).HttpJSON(w, resp.NewHttpBody(res))
+	}
+}
+
+func (a *AuthApp) SessionRevokeDelete(sa session.Authenticator) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		q := r.URL.Query()
+		if userId := q.Get("user_id"); userId != "" {
+			n, err := sa.RevokeByUserId(r.Context(), userId)
+			if errors.Is(err, session.ErrStatelessNotSupported) {
+				resp.NewResponse(http.StatusNotImplemented, "", err).HttpJSON(w, nil)
+				return
+			}
+			if err != nil {
+				resp.NewResponse(http.StatusInternalServerError, "", err).HttpJSON(w, nil)
+				return
+			}
+
+			resp.NewResponse(http.StatusOK, "", nil).HttpJSON(w, resp.NewHttpBody(LogoutRes{Revoked: n}))
+			return
+		}
+
+		id := q.Get("id")
+		if id == "" {
+			http.NotFound(w, r)
+			return
+		}
+
+		n, err := sa.RevokeById(r.Context(), id)
+		if errors.Is(err, session.ErrSessionNotFound) {
+			resp.NewResponse(http.StatusNotFound, "", err).HttpJSON(w, nil)
+			return
+		}
+		if errors.Is(err, session.ErrStatelessNotSupported) {
+			resp.NewResponse(http.StatusNotImplemented, "", err).HttpJSON(w, nil)
+			return
+		}
+		if err != nil {
+			resp.NewResponse(http.StatusInternalServerError, "", err).HttpJSON(w, nil)
+			return
+		}
+
+		resp.NewResponse(http.StatusOK, "", nil).HttpJSON(w, resp.NewHttpBody(LogoutRes{Revoked: n}))
+	}
+}
+
+func (a *AuthApp) InvitationPost(w http.ResponseWriter, r *http.Request) {
+	var in CreateInvitationIn
+	err := json.NewDecoder(r.Body).Decode(&in)
+	if err != nil {
+		resp.NewResponse(http.StatusInternalServerError, "", err).HttpJSON(w, nil)
+		return
+	}
+
+	out := a.CreateInvitation(r.Context(), session.UserId(r.Context()), in)
+	out.HttpJSON(w, resp.NewHttpBody(out.Res))
+}
+
+func (a *AuthApp) AcceptInvitationPost(w http.ResponseWriter, r *http.Request) {
+	var in AcceptInvitationIn
+	err := json.NewDecoder(r.Body).Decode(&in)
+	if err != nil {
+		resp.NewResponse(http.StatusInternalServerError, "", err).HttpJSON(w, nil)
+		return
+	}
+
+	out := a.AcceptInvitation(r.Context(), in)
+	out.HttpJSON(w, resp.NewHttpBody(out.Res))
+}
+
+// ChangePasswordPost end every session of the user and start a new one, the session that
+// live in the cookie get its new token into the cookie again like the login
+func (a *AuthApp) ChangePasswordPost(sa session.Authenticator, cc session.CookieConfig) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		var in ChangePasswordIn
+		err := json.NewDecoder(r.Body).Decode(&in)
+		if err != nil {
+			resp.NewResponse(http.StatusInternalServerError, "", err).HttpJSON(w, nil)
+			return
+		}
+
+		if !canRevoke(w, sa) {
+			return
+		}
+
+		out := a.ChangePassword(r.Context(), session.UserId(r.Context()), in)
+		if out.Error == nil {
+			// Every session made with the old password is ended, the client
+			// continue with the new token returned here
+			_, err := sa.RevokeByUserId(r.Context(), out.Res.Id)
+			if err != nil {
+				resp.NewResponse(http.StatusInternalServerError, "", err).HttpJSON(w, nil)
+				return
+			}
+
+			token, err := sa.Issue(r.Context(), out.Res.Id, out.Res.Role)
+			if err != nil {
+				resp.NewResponse(http.StatusInternalServerError, "", err).HttpJSON(w, nil)
+				return
+			}
+
+			out.Res.ExpiresIn = token.ExpiresIn
+			// The route accept the cookie only when there is no Authorization header
+			if r.Header.Get("Authorization") == "" {
+				out.Res.CsrfToken = session.SetCookie(w, cc, token)
+			} else {
+				out.Res.Token = token.AccessToken
+				out.Res.RefreshToken = token.RefreshToken
+			}
+		}
+
+		out.HttpJSON(w, resp.NewHttpBody(out.Res))
+	}
+}
+
+func (a *AuthApp) ChangeUsernamePost(w http.ResponseWriter, r *http.Request) {
+	var in ChangeUsernameIn
+	err := json.NewDecoder(r.Body).Decode(&in)
+	if err != nil {
+		resp.NewResponse(http.StatusInternalServerError, "", err).HttpJSON(w, nil)
+		return
+	}
+
+	out := a.ChangeUsername(r.Context(), session.UserId(r.Context()), in)
+	out.HttpJSON(w, resp.NewHttpBody(out.Res))
+}
+
+func (a *AuthApp) MeGet(w http.ResponseWriter, r *http.Request) {
+	out := a.GetMe(r.Context(), session.UserId(r.Context()))
+	out.HttpJSON(w, resp.NewHttpBody(out.Res))
+}
+
+func (a *AuthApp) MeUpdatePut(w http.ResponseWriter, r *http.Request) {
+	var in UpdateProfileIn
+	err := json.NewDecoder(r.Body).Decode(&in)
+	if err != nil {
+		resp.NewResponse(http.StatusInternalServerError, "", err).HttpJSON(w, nil)
+		return
+	}
+
+	out := a.UpdateProfile(r.Context(), session.UserId(r.Context()), in)
+	out.HttpJSON(w, resp.NewHttpBody(out.Res))
+}
+
+func (a *AuthApp) MeDeactivatePost(sa session.Authenticator) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		var in DeactivateAccountIn
+		err := json.NewDecoder(r.Body).Decode(&in)
+		if err != nil {
+			resp.NewResponse(http.StatusInternalServerError, "", err).HttpJSON(w, nil)
+			return
+		}
+
+		if !canRevoke(w, sa) {
+			return
+		}
+
+		out := a.DeactivateAccount(r.Context(), session.UserId(r.Context()), in)
+		if out.Error == nil {
+			_, err := sa.RevokeByUserId(r.Context(), out.Res.Id)
+			if err != nil {
+				resp.NewResponse(http.StatusInternalServerError, "", err).HttpJSON(w, nil)
+				return
+			}
+		}
+
+		out.HttpJSON(w, resp.NewHttpBody(out.Res))
+	}
+}
+
+func (a *AuthApp) UsersGet(w http.ResponseWriter, r *http.Request) {
+	q := r.URL.Query()
+	out := a.GetUsers(r.Context(), session.UserId(r.Context()), UsersQueryIn{
+		Query:  q.Get("q"),
+		Role:   q.Get("role"),
+		Status: q.Get("status"),
+		Limit:  q.Get("limit"),
+		Offset: q.Get("offset"),
+	})
+	out.HttpJSON(w, resp.NewHttpBody(out.Res))
+}
+
+func (a *AuthApp) UserDeactivatePost(sa session.Authenticator) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		var in DeactivateUserIn
+		err := json.NewDecoder(r.Body).Decode(&in)
+		if err != nil {
+			resp.NewResponse(http.StatusInternalServerError, "", err).HttpJSON(w, nil)
+			return
+		}
+
+		if !canRevoke(w, sa) {
+			return
+		}
+
+		out := a.DeactivateUser(r.Context(), session.UserId(r.Context()), in)
+		if out.Error == nil {
+			_, err := sa.RevokeByUserId(r.Context(), out.Res.Id)
+			if err != nil {
+				resp.NewResponse(http.StatusInternalServerError, "", err).HttpJSON(w, nil)
+				return
+			}
+		}
+
+		out.HttpJSON(w, resp.NewHttpBody(out.Res))
+	}
+}
+
+func (a *AuthApp) ForgotPasswordPost(w http.ResponseWriter, r *http.Request) {
+	var in ForgotPasswordIn
+	err := json.NewDecoder(r.Body).Decode(&in)
+	if err != nil {
+		resp.NewResponse(http.StatusInternalServerError, "", err).HttpJSON(w, nil)
+		return
+	}
+
+	in.Ip = clientIp(r)
+	out := a.ForgotPassword(r.Context(), in)
+	if out.StatusCode == http.StatusTooManyRequests {
+		w.Header().Set("Retry-After", strconv.FormatInt(out.RetryAfter, 10))
+	}
+	out.HttpJSON(w, out.Response)
+}
+
+func (a *AuthApp) ResetPasswordPost(sa session.Authenticator) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		var in ResetPasswordIn
+		err := json.NewDecoder(r.Body).Decode(&in)
+		if err != nil {
+			resp.NewResponse(http.StatusInternalServerError, "", err).HttpJSON(w, nil)
+			return
+		}
+
+		if !canRevoke(w, sa) {
+			return
+		}
+
+		out := a.ResetPassword(r.Context(), in)
+		if out.Error == nil {
+			_, err := sa.RevokeByUserId(r.Context(), out.Res.Id)
+			if err != nil {
+				resp.NewResponse(http.StatusInternalServerError, "", err).HttpJSON(w, nil)
+				return
+			}
+		}
+
+		out.HttpJSON(w, resp.NewHttpBody(out.Res))
+	}
+}
+
+func (a *AuthApp) UnlockUserPost(w http.ResponseWriter, r *http.Request) {
+	var in UnlockUserIn
+	err := json.NewDecoder(r.Body).Decode(&in)
+	if err != nil {
+		resp.NewResponse(http.StatusInternalServerError, "", err).HttpJSON(w, nil)
+		return
+	}
+
+	out := a.UnlockUser(r.Context(), session.UserId(r.Context()), in)
+	out.HttpJSON(w, resp.NewHttpBody(out.Res))
+}
+
+func (a *AuthApp) LoginTotpPost(sa session.Authenticator, cc session.CookieConfig) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		var in LoginTotpIn
+		err := json.NewDecoder(r.Body).Decode(&in)
+		if err != nil {
+			resp.NewResponse(http.StatusInternalServerError, "", err).HttpJSON(w, nil)
+			return
+		}
+
+		in.Ip = clientIp(r)
+		in.UserAgent = r.UserAgent()
+		out := a.LoginTotp(r.Context(), in)
+		if out.StatusCode == http.StatusTooManyRequests {
+			w.Header().Set("Retry-After", strconv.FormatInt(out.Res.RetryAfter, 10))
+		}
+		if out.Error == nil {
+			token, err := sa.Issue(r.Context(), out.Res.Id, out.Res.Role)
+			if err != nil {
+				resp.NewResponse(http.StatusInternalServerError, "", err).HttpJSON(w, nil)
+				return
+			}
+
+			setLoginToken(w, cc, &out.Res, token, in.Cookie)
+		}
+
+		out.HttpJSON(w, resp.NewHttpBody(out.Res))
+	}
+}
+
+func (a *AuthApp) RecoveryCodesPost(w http.ResponseWriter, r *http.Request) {
+	var in RecoveryCodesIn
+	err := json.NewDecoder(r.Body).Decode(&in)
+	if err != nil {
+		resp.NewResponse(http.StatusInternalServerError, "", err).HttpJSON(w, nil)
+		return
+	}
+
+	out := a.RegenerateRecoveryCodes(r.Context(), session.UserId(r.Context()), in)
+	out.HttpJSON(w, resp.NewHttpBody(out.Res))
+}
+
+func (a *AuthApp) ResetTotpPost(sa session.Authenticator) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		var in ResetTotpIn
+		err := json.NewDecoder(r.Body).Decode(&in)
+		if err != nil {
+			resp.NewResponse(http.StatusInternalServerError, "", err).HttpJSON(w, nil)
+			return
+		}
+
+		if !canRevoke(w, sa) {
+			return
+		}
+
+		out := a.ResetTotp(r.Context(), session.UserId(r.Context()), in)
+		if out.Error == nil {
+			// The lost authenticator app may be in the wrong hand,
+			// so every session of the user is ended too
+			_, err := sa.RevokeByUserId(r.Context(), out.Res.Id)
+			if err != nil {
+				resp.NewResponse(http.StatusInternalServerError, "", err).HttpJSON(w, nil)
+				return
+			}
+		}
+
+		out.HttpJSON(w, resp.NewHttpBody(out.Res))
+	}
+}
+
+func (a *AuthApp) ApiKeyPost(w http.ResponseWriter, r *http.Request) {
+	var in CreateApiKeyIn
+	err := json.NewDecoder(r.Body).Decode(&in)
+	if err != nil {
+		resp.NewResponse(http.StatusInternalServerError, "", err).HttpJSON(w, nil)
+		return
+	}
+
+	out := a.CreateApiKey(r.Context(), session.UserId(r.Context()), in)
+	out.HttpJSON(w, resp.NewHttpBody(out.Res))
+}
+
+func (a *AuthApp) ApiKeysGet(w http.ResponseWriter, r *http.Request) {
+	out := a.GetApiKeys(r.Context(), session.UserId(r.Context()))
+	out.HttpJSON(w, resp.NewHttpBody(out.Res))
+}
+
+func (a *AuthApp) ApiKeyRotatePost(w http.ResponseWriter, r *http.Request) {
+	out := a.RotateApiKey(r.Context(), session.UserId(r.Context()), r.URL.Query().Get("id"))
+	out.HttpJSON(w, resp.NewHttpBody(out.Res))
+}
+
+func (a *AuthApp) ApiKeyRevokeDelete(w http.ResponseWriter, r *http.Request) {
+	out := a.RevokeApiKey(r.Context(), session.UserId(r.Context()), r.URL.Query().Get("id"))
+	out.HttpJSON(w, resp.NewHttpBody(out.Res))
+}
+
+func activityQuery(r *http.Request) ActivityQueryIn {
+	q := r.URL.Query()
+	return ActivityQueryIn{
+		UserId:   q.Get("user_id"),
+		Username: q.Get("username"),
+		Status:   q.Get("status"),
+		From:     q.Get("from"),
+		To:       q.Get("to"),
+		Limit:    q.Get("limit"),
+	}
+}
+
+func (a *AuthApp) OwnActivityGet(w http.ResponseWriter, r *http.Request) {
+	out := a.GetOwnActivity(r.Context(), session.UserId(r.Context()), activityQuery(r))
+	out.HttpJSON(w, resp.NewHttpBody(out.Res))
+}
+
+func (a *AuthApp) ActivityGet(w http.ResponseWriter, r *http.Request) {
+	out := a.GetActivity(r.Context(), session.UserId(r.Context()), activityQuery(r))
+	out.HttpJSON(w, resp.NewHttpBody(out.Res))
+}
+
+// clientIp return the address of the connection, the forwarded header is not
+// trusted since it can be set by the client to escape the login throttle
+func clientIp(r *http.Request) string {
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		return r.RemoteAddr
+	}
+
+	return host
+}
+
+// canRevoke answer 501 when the sessions can not be revoked, the change that must end
+// every session of the user is refused instead of leaving the old token valid
+func canRevoke(w http.ResponseWriter, sa session.Authenticator) bool {
+	if sa.CanRevoke() {
+		return true
+	}
+
+	resp.NewResponse(http.StatusNotImplemented, "", session.ErrStatelessNotSupported).HttpJSON(w, nil)
+	return false
+}
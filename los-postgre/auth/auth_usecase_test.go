@@ -2,28 +2,54 @@ package auth_test
 
 import (
 	"context"
+	"encoding/hex"
 	"fmt"
 	"log"
 	"net/http"
+	"net/url"
 	"os"
+	"strings"
 	"testing"
 	"time"
 
 	"github.com/fikryfahrezy/adea/los-postgre/auth"
+	"github.com/fikryfahrezy/adea/los-postgre/id"
 	"github.com/fikryfahrezy/adea/los-postgre/model"
-	"github.com/jackc/pgx/v4"
+	"github.com/fikryfahrezy/adea/los-postgre/notify"
+	"github.com/fikryfahrezy/adea/los-postgre/oidc"
+	"github.com/fikryfahrezy/adea/los-postgre/oidc/oidctest"
+	"github.com/fikryfahrezy/adea/los-postgre/rbac"
+	"github.com/fikryfahrezy/adea/los-postgre/session"
+	"github.com/fikryfahrezy/adea/los-postgre/throttle"
+	"github.com/fikryfahrezy/adea/los-postgre/totp"
+	"github.com/jackc/pgx/v4/pgxpool"
 	_ "github.com/lib/pq"
 	"github.com/ory/dockertest"
 	"golang.org/x/crypto/bcrypt"
 )
 
+// recordNotifier keep the last message so the test can read the token sent to the user
+type recordNotifier struct {
+	last notify.Message
+}
+
+func (n *recordNotifier) Notify(ctx context.Context, msg notify.Message) error {
+	n.last = msg
+	return nil
+}
+
+func (n *recordNotifier) token() string {
+	return n.last.Body[strings.LastIndex(n.last.Body, " ")+1:]
+}
+
 var (
-	dbPg     *pgx.Conn
+	dbPg     *pgxpool.Pool
+	notifier = &recordNotifier{}
 	authRepo *auth.Repository
 	authApp  *auth.AuthApp
 )
 
-func loadTables(conn *pgx.Conn) error {
+func loadTables(conn *pgxpool.Pool) error {
 	tx, err := conn.Begin(context.Background())
 	if err != nil {
 		return err
@@ -61,9 +87,20 @@ func clearDb() error {
 
 	// This should be in order of which table truncate first before the other
 	queries := []string{
+		`TRUNCATE oidc_states CASCADE`,
+		`TRUNCATE user_identities CASCADE`,
+		`TRUNCATE api_keys CASCADE`,
+		`TRUNCATE login_challenges CASCADE`,
+		`TRUNCATE recovery_codes CASCADE`,
+		`TRUNCATE user_totps CASCADE`,
+		`TRUNCATE login_activities CASCADE`,
+		`TRUNCATE password_resets CASCADE`,
+		`TRUNCATE invitations CASCADE`,
 		`TRUNCATE users CASCADE`,
 	}
 
+	notifier.last = notify.Message{}
+
 	for _, v := range queries {
 		_, err = tx.Exec(context.Background(),
 			v,
@@ -98,12 +135,12 @@ func TestMain(m *testing.M) {
 	// exponential backoff-retry, because the application in the container might not be ready to accept connections yet
 	pool.MaxWait = 120 * time.Second
 	if err = pool.Retry(func() error {
-		dbConfig, err := pgx.ParseConfig(databaseUrl)
+		dbConfig, err := pgxpool.ParseConfig(databaseUrl)
 		if err != nil {
 			return err
 		}
 
-		dbPg, err = pgx.ConnectConfig(context.Background(), dbConfig)
+		dbPg, err = pgxpool.ConnectConfig(context.Background(), dbConfig)
 		if err != nil {
 			return err
 		}
@@ -113,8 +150,8 @@ func TestMain(m *testing.M) {
 		log.Fatalf("Could not connect to cockroach container: %s", err)
 	}
 
-	authRepo = auth.NewRepository(dbPg)
-	authApp = auth.NewApp(authRepo)
+	authRepo = auth.NewRepository(dbPg, id.NewUlid())
+	authApp = auth.NewApp(authRepo, auth.DefaultPasswordPolicy(), notifier, throttle.New(throttle.DefaultConfig()), nil)
 
 	loadTables(dbPg)
 
@@ -138,9 +175,9 @@ func TestLogin(t *testing.T) {
 	hashed, _ := bcrypt.GenerateFromPassword([]byte("password"), bcrypt.DefaultCost)
 
 	authRepo.InsertUser(ctx, model.User{
-		IsOfficer: true,
-		Username:  "existusername",
-		Password:  string(hashed),
+		Role:     rbac.Admin.String(),
+		Username: "existusername",
+		Password: string(hashed),
 	})
 
 	testCases := []struct {
@@ -157,7 +194,7 @@ func TestLogin(t *testing.T) {
 			},
 		},
 		{
-			expect: http.StatusBadRequest,
+			expect: http.StatusUnauthorized,
 			name:   "Login fail, password not match",
 			input: auth.LoginIn{
 				Username: "existusername",
@@ -165,7 +202,7 @@ func TestLogin(t *testing.T) {
 			},
 		},
 		{
-			expect: http.StatusNotFound,
+			expect: http.StatusUnauthorized,
 			name:   "Login fail, user not found",
 			input: auth.LoginIn{
 				Username: "nonexistusername",
@@ -215,9 +252,9 @@ func TestRegister(t *testing.T) {
 	hashed, _ := bcrypt.GenerateFromPassword([]byte("password"), bcrypt.DefaultCost)
 
 	authRepo.InsertUser(ctx, model.User{
-		IsOfficer: true,
-		Username:  "existusername",
-		Password:  string(hashed),
+		Role:     rbac.Admin.String(),
+		Username: "existusername",
+		Password: string(hashed),
 	})
 
 	testCases := []struct {
@@ -225,31 +262,20 @@ func TestRegister(t *testing.T) {
 		name   string
 		input  auth.RegisterIn
 	}{
-		{
-			expect: http.StatusCreated,
-			name:   "Register as officer successfully",
-			input: auth.RegisterIn{
-				IsOfficer: true,
-				Username:  "nonexsistofficerusername",
-				Password:  "password",
-			},
-		},
 		{
 			expect: http.StatusCreated,
 			name:   "Register as non officer successfully",
 			input: auth.RegisterIn{
-				IsOfficer: false,
-				Username:  "nonexsistnonofficerusername",
-				Password:  "password",
+				Username: "nonexsistnonofficerusername",
+				Password: "password",
 			},
 		},
 		{
 			expect: http.StatusBadRequest,
 			name:   "Register fail, username exist",
 			input: auth.RegisterIn{
-				IsOfficer: false,
-				Username:  "existusername",
-				Password:  "passwordxxxxx",
+				Username: "existusername",
+				Password: "passwordxxxxx",
 			},
 		},
 		{
@@ -283,3 +309,1871 @@ func TestRegister(t *testing.T) {
 		})
 	}
 }
+
+func TestRegisterAlwaysApplicant(t *testing.T) {
+	if err := clearDb(); err != nil {
+		t.Fatal(err)
+	}
+
+	ctx := context.Background()
+
+	out := authApp.Register(ctx, auth.RegisterIn{
+		Username: "username",
+		Password: "password",
+	})
+
+	if out.Res.Role != rbac.Applicant.String() {
+		t.Fatalf("resulting: %v, expect: %v | err: %v", out.Res.Role, rbac.Applicant.String(), out.Error)
+	}
+	// The applicant has no two-factor authentication to set up
+	if out.StatusCode != http.StatusCreated || out.Message != "" {
+		t.Fatalf("resulting: %d %q, expect: %d without message", out.StatusCode, out.Message, http.StatusCreated)
+	}
+}
+
+func TestCreateInvitation(t *testing.T) {
+	if err := clearDb(); err != nil {
+		t.Fatal(err)
+	}
+
+	ctx := context.Background()
+
+	admin, _ := authRepo.InsertUser(ctx, model.User{
+		Username: "admin",
+		Password: "password",
+		Role:     rbac.Admin.String(),
+	})
+	approver, _ := authRepo.InsertUser(ctx, model.User{
+		Username: "approver",
+		Password: "password",
+		Role:     rbac.Approver.String(),
+	})
+
+	testCases := []struct {
+		expect int
+		name   string
+		userId string
+		input  auth.CreateInvitationIn
+	}{
+		{
+			expect: http.StatusCreated,
+			name:   "Create invitation successfully",
+			userId: admin.Id,
+			input: auth.CreateInvitationIn{
+				Role: rbac.Approver.String(),
+			},
+		},
+		{
+			expect: http.StatusForbidden,
+			name:   "Create invitation fail, user is not admin",
+			userId: approver.Id,
+			input: auth.CreateInvitationIn{
+				Role: rbac.Approver.String(),
+			},
+		},
+		{
+			expect: http.StatusNotFound,
+			name:   "Create invitation fail, user not found",
+			userId: "random-id",
+			input: auth.CreateInvitationIn{
+				Role: rbac.Approver.String(),
+			},
+		},
+		{
+			expect: http.StatusUnprocessableEntity,
+			name:   "Create invitation fail, applicant role",
+			userId: admin.Id,
+			input: auth.CreateInvitationIn{
+				Role: rbac.Applicant.String(),
+			},
+		},
+		{
+			expect: http.StatusUnprocessableEntity,
+			name:   "Create invitation fail, negative expires in",
+			userId: admin.Id,
+			input: auth.CreateInvitationIn{
+				ExpiresIn: -1,
+				Role:      rbac.Approver.String(),
+			},
+		},
+	}
+
+	for _, c := range testCases {
+		t.Run(c.name, func(t *testing.T) {
+			out := authApp.CreateInvitation(ctx, c.userId, c.input)
+
+			if out.StatusCode != c.expect {
+				t.Fatalf("resulting: %d, expect: %d | err: %v", out.StatusCode, c.expect, out.Error)
+			}
+		})
+	}
+}
+
+func TestAcceptInvitation(t *testing.T) {
+	if err := clearDb(); err != nil {
+		t.Fatal(err)
+	}
+
+	ctx := context.Background()
+
+	admin, _ := authRepo.InsertUser(ctx, model.User{
+		Username: "admin",
+		Password: "password",
+		Role:     rbac.Admin.String(),
+	})
+
+	inv := authApp.CreateInvitation(ctx, admin.Id, auth.CreateInvitationIn{
+		Role: rbac.FieldOfficer.String(),
+	})
+	reused := authApp.CreateInvitation(ctx, admin.Id, auth.CreateInvitationIn{
+		Role: rbac.FieldOfficer.String(),
+	})
+
+	expired := "expired-token"
+	authRepo.InsertInvitation(ctx, model.Invitation{
+		Id:          "expired",
+		TokenHash:   session.KeyHash(expired),
+		Role:        rbac.Approver.String(),
+		InvitedBy:   admin.Id,
+		ExpiredDate: time.Now().Add(-time.Minute),
+	})
+
+	testCases := []struct {
+		expect int
+		name   string
+		input  auth.AcceptInvitationIn
+	}{
+		{
+			expect: http.StatusCreated,
+			name:   "Accept invitation successfully",
+			input: auth.AcceptInvitationIn{
+				Token:    inv.Res.Token,
+				Username: "officer",
+				Password: "password",
+			},
+		},
+		{
+			expect: http.StatusBadRequest,
+			name:   "Accept invitation fail, invitation already used",
+			input: auth.AcceptInvitationIn{
+				Token:    inv.Res.Token,
+				Username: "otherofficer",
+				Password: "password",
+			},
+		},
+		{
+			expect: http.StatusBadRequest,
+			name:   "Accept invitation fail, username exist",
+			input: auth.AcceptInvitationIn{
+				Token:    reused.Res.Token,
+				Username: "admin",
+				Password: "password",
+			},
+		},
+		{
+			expect: http.StatusBadRequest,
+			name:   "Accept invitation fail, invitation expired",
+			input: auth.AcceptInvitationIn{
+				Token:    expired,
+				Username: "approver",
+				Password: "password",
+			},
+		},
+		{
+			expect: http.StatusNotFound,
+			name:   "Accept invitation fail, invitation not found",
+			input: auth.AcceptInvitationIn{
+				Token:    "random-token",
+				Username: "approver",
+				Password: "password",
+			},
+		},
+		{
+			expect: http.StatusUnprocessableEntity,
+			name:   "Accept invitation fail, no token provided",
+			input: auth.AcceptInvitationIn{
+				Username: "approver",
+				Password: "password",
+			},
+		},
+	}
+
+	for _, c := range testCases {
+		t.Run(c.name, func(t *testing.T) {
+			out := authApp.AcceptInvitation(ctx, c.input)
+
+			if out.StatusCode != c.expect {
+				t.Fatalf("resulting: %d, expect: %d | err: %v", out.StatusCode, c.expect, out.Error)
+			}
+		})
+	}
+
+	user, _ := authRepo.GetUserByUsername(ctx, "officer")
+	if user.Role != rbac.FieldOfficer.String() {
+		t.Fatalf("resulting: %v, expect: %v", user.Role, rbac.FieldOfficer.String())
+	}
+}
+
+func TestRegisterPasswordPolicy(t *testing.T) {
+	if err := clearDb(); err != nil {
+		t.Fatal(err)
+	}
+
+	ctx := context.Background()
+
+	policy := auth.DefaultPasswordPolicy()
+	policy.LoadDenylist(strings.NewReader("# comment\nqwerty123\n"))
+	app := auth.NewApp(authRepo, policy, notifier, throttle.New(throttle.DefaultConfig()), nil)
+
+	testCases := []struct {
+		expect int
+		name   string
+		input  auth.RegisterIn
+	}{
+		{
+			expect: http.StatusUnprocessableEntity,
+			name:   "Register fail, password too short",
+			input: auth.RegisterIn{
+				Username: "username1",
+				Password: "short",
+			},
+		},
+		{
+			expect: http.StatusUnprocessableEntity,
+			name:   "Register fail, password too long",
+			input: auth.RegisterIn{
+				Username: "username2",
+				Password: strings.Repeat("x", 73),
+			},
+		},
+		{
+			expect: http.StatusUnprocessableEntity,
+			name:   "Register fail, password in denylist",
+			input: auth.RegisterIn{
+				Username: "username3",
+				Password: "QWERTY123",
+			},
+		},
+		{
+			expect: http.StatusCreated,
+			name:   "Register successfully",
+			input: auth.RegisterIn{
+				Username: "username4",
+				Password: "correct-horse-battery",
+			},
+		},
+	}
+
+	for _, c := range testCases {
+		t.Run(c.name, func(t *testing.T) {
+			out := app.Register(ctx, c.input)
+
+			if out.StatusCode != c.expect {
+				t.Fatalf("resulting: %d, expect: %d | err: %v", out.StatusCode, c.expect, out.Error)
+			}
+		})
+	}
+}
+
+func TestChangePassword(t *testing.T) {
+	if err := clearDb(); err != nil {
+		t.Fatal(err)
+	}
+
+	ctx := context.Background()
+
+	hashed, _ := bcrypt.GenerateFromPassword([]byte("password"), bcrypt.DefaultCost)
+	user, _ := authRepo.InsertUser(ctx, model.User{
+		Username: "username",
+		Password: string(hashed),
+		Role:     rbac.Applicant.String(),
+	})
+
+	testCases := []struct {
+		expect int
+		name   string
+		userId string
+		input  auth.ChangePasswordIn
+	}{
+		{
+			expect: http.StatusBadRequest,
+			name:   "Change password fail, old password not match",
+			userId: user.Id,
+			input: auth.ChangePasswordIn{
+				OldPassword: "passwordxxxxx",
+				NewPassword: "newpassword",
+			},
+		},
+		{
+			expect: http.StatusUnprocessableEntity,
+			name:   "Change password fail, same password",
+			userId: user.Id,
+			input: auth.ChangePasswordIn{
+				OldPassword: "password",
+				NewPassword: "password",
+			},
+		},
+		{
+			expect: http.StatusUnprocessableEntity,
+			name:   "Change password fail, new password too short",
+			userId: user.Id,
+			input: auth.ChangePasswordIn{
+				OldPassword: "password",
+				NewPassword: "short",
+			},
+		},
+		{
+			expect: http.StatusNotFound,
+			name:   "Change password fail, user not found",
+			userId: "random-id",
+			input: auth.ChangePasswordIn{
+				OldPassword: "password",
+				NewPassword: "newpassword",
+			},
+		},
+		{
+			expect: http.StatusOK,
+			name:   "Change password successfully",
+			userId: user.Id,
+			input: auth.ChangePasswordIn{
+				OldPassword: "password",
+				NewPassword: "newpassword",
+			},
+		},
+	}
+
+	for _, c := range testCases {
+		t.Run(c.name, func(t *testing.T) {
+			out := authApp.ChangePassword(ctx, c.userId, c.input)
+
+			if out.StatusCode != c.expect {
+				t.Fatalf("resulting: %d, expect: %d | err: %v", out.StatusCode, c.expect, out.Error)
+			}
+		})
+	}
+
+	if out := authApp.Login(ctx, auth.LoginIn{Username: "username", Password: "newpassword"}); out.StatusCode != http.StatusOK {
+		t.Fatalf("resulting: %d, expect: %d | err: %v", out.StatusCode, http.StatusOK, out.Error)
+	}
+}
+
+func TestForgotAndResetPassword(t *testing.T) {
+	if err := clearDb(); err != nil {
+		t.Fatal(err)
+	}
+
+	ctx := context.Background()
+
+	hashed, _ := bcrypt.GenerateFromPassword([]byte("password"), bcrypt.DefaultCost)
+	authRepo.InsertUser(ctx, model.User{
+		Username: "username",
+		Password: string(hashed),
+		Role:     rbac.Applicant.String(),
+	})
+
+	if out := authApp.ForgotPassword(ctx, auth.ForgotPasswordIn{Username: "nonexistusername"}); out.StatusCode != http.StatusOK {
+		t.Fatalf("resulting: %d, expect: %d | err: %v", out.StatusCode, http.StatusOK, out.Error)
+	}
+	if notifier.last.To != "" {
+		t.Fatalf("resulting: %v, expect no message sent", notifier.last)
+	}
+
+	authApp.ForgotPassword(ctx, auth.ForgotPasswordIn{Username: "username"})
+	oldToken := notifier.token()
+	authApp.ForgotPassword(ctx, auth.ForgotPasswordIn{Username: "username"})
+	token := notifier.token()
+
+	if notifier.last.To != "username" || token == oldToken {
+		t.Fatalf("resulting: %v, expect new token sent to username", notifier.last)
+	}
+
+	testCases := []struct {
+		expect int
+		name   string
+		input  auth.ResetPasswordIn
+	}{
+		{
+			expect: http.StatusUnprocessableEntity,
+			name:   "Reset password fail, password too short",
+			input: auth.ResetPasswordIn{
+				Token:    token,
+				Password: "short",
+			},
+		},
+		{
+			expect: http.StatusNotFound,
+			name:   "Reset password fail, token not found",
+			input: auth.ResetPasswordIn{
+				Token:    "random-token",
+				Password: "newpassword",
+			},
+		},
+		{
+			expect: http.StatusOK,
+			name:   "Reset password successfully",
+			input: auth.ResetPasswordIn{
+				Token:    token,
+				Password: "newpassword",
+			},
+		},
+		{
+			expect: http.StatusBadRequest,
+			name:   "Reset password fail, token already used",
+			input: auth.ResetPasswordIn{
+				Token:    token,
+				Password: "otherpassword",
+			},
+		},
+		{
+			expect: http.StatusBadRequest,
+			name:   "Reset password fail, older token is used by the reset",
+			input: auth.ResetPasswordIn{
+				Token:    oldToken,
+				Password: "otherpassword",
+			},
+		},
+	}
+
+	for _, c := range testCases {
+		t.Run(c.name, func(t *testing.T) {
+			out := authApp.ResetPassword(ctx, c.input)
+
+			if out.StatusCode != c.expect {
+				t.Fatalf("resulting: %d, expect: %d | err: %v", out.StatusCode, c.expect, out.Error)
+			}
+		})
+	}
+
+	if out := authApp.Login(ctx, auth.LoginIn{Username: "username", Password: "newpassword"}); out.StatusCode != http.StatusOK {
+		t.Fatalf("resulting: %d, expect: %d | err: %v", out.StatusCode, http.StatusOK, out.Error)
+	}
+}
+
+func TestLoginLockout(t *testing.T) {
+	if err := clearDb(); err != nil {
+		t.Fatal(err)
+	}
+
+	ctx := context.Background()
+
+	hashed, _ := bcrypt.GenerateFromPassword([]byte("password"), bcrypt.DefaultCost)
+	authRepo.InsertUser(ctx, model.User{
+		Username: "username",
+		Password: string(hashed),
+		Role:     rbac.Applicant.String(),
+	})
+
+	app := auth.NewApp(authRepo, auth.DefaultPasswordPolicy(), notifier, throttle.New(throttle.Config{
+		FreeAttempts: 2,
+		BaseDelay:    time.Minute,
+		MaxDelay:     time.Hour,
+		Window:       time.Hour,
+	}), nil)
+
+	testCases := []struct {
+		expect int
+		name   string
+		input  auth.LoginIn
+	}{
+		{
+			expect: http.StatusUnauthorized,
+			name:   "First failure",
+			input:  auth.LoginIn{Username: "username", Password: "wrongpassword", Ip: "10.0.0.1"},
+		},
+		{
+			expect: http.StatusUnauthorized,
+			name:   "Second failure",
+			input:  auth.LoginIn{Username: "username", Password: "wrongpassword", Ip: "10.0.0.1"},
+		},
+		{
+			expect: http.StatusUnauthorized,
+			name:   "Third failure start the backoff",
+			input:  auth.LoginIn{Username: "username", Password: "wrongpassword", Ip: "10.0.0.1"},
+		},
+		{
+			expect: http.StatusTooManyRequests,
+			name:   "Locked even with the right password",
+			input:  auth.LoginIn{Username: "username", Password: "password", Ip: "10.0.0.3"},
+		},
+		{
+			expect: http.StatusTooManyRequests,
+			name:   "Locked address for other username",
+			input:  auth.LoginIn{Username: "otherusername", Password: "password", Ip: "10.0.0.1"},
+		},
+	}
+
+	for _, c := range testCases {
+		t.Run(c.name, func(t *testing.T) {
+			out := app.Login(ctx, c.input)
+
+			if out.StatusCode != c.expect {
+				t.Fatalf("resulting: %d, expect: %d | err: %v", out.StatusCode, c.expect, out.Error)
+			}
+		})
+	}
+
+	out := app.Login(ctx, auth.LoginIn{Username: "username", Password: "password"})
+	if out.Res.RetryAfter <= 0 {
+		t.Fatalf("resulting: %d, expect greater than 0", out.Res.RetryAfter)
+	}
+}
+
+func TestUnlockUser(t *testing.T) {
+	if err := clearDb(); err != nil {
+		t.Fatal(err)
+	}
+
+	ctx := context.Background()
+
+	hashed, _ := bcrypt.GenerateFromPassword([]byte("password"), bcrypt.DefaultCost)
+	authRepo.InsertUser(ctx, model.User{
+		Username: "username",
+		Password: string(hashed),
+		Role:     rbac.Applicant.String(),
+	})
+	officer, _ := authRepo.InsertUser(ctx, model.User{
+		Username: "officer",
+		Password: string(hashed),
+		Role:     rbac.FieldOfficer.String(),
+	})
+	auditor, _ := authRepo.InsertUser(ctx, model.User{
+		Username: "auditor",
+		Password: string(hashed),
+		Role:     rbac.Auditor.String(),
+	})
+
+	app := auth.NewApp(authRepo, auth.DefaultPasswordPolicy(), notifier, throttle.New(throttle.Config{
+		FreeAttempts: 0,
+		BaseDelay:    time.Hour,
+		MaxDelay:     time.Hour,
+		Window:       time.Hour,
+	}), nil)
+
+	app.Login(ctx, auth.LoginIn{Username: "username", Password: "wrongpassword"})
+	if out := app.Login(ctx, auth.LoginIn{Username: "username", Password: "password"}); out.StatusCode != http.StatusTooManyRequests {
+		t.Fatalf("resulting: %d, expect: %d | err: %v", out.StatusCode, http.StatusTooManyRequests, out.Error)
+	}
+
+	testCases := []struct {
+		expect int
+		name   string
+		userId string
+		input  auth.UnlockUserIn
+	}{
+		{
+			expect: http.StatusForbidden,
+			name:   "Unlock fail, auditor can not unlock",
+			userId: auditor.Id,
+			input:  auth.UnlockUserIn{Username: "username"},
+		},
+		{
+			expect: http.StatusNotFound,
+			name:   "Unlock fail, username not found",
+			userId: officer.Id,
+			input:  auth.UnlockUserIn{Username: "nonexistusername"},
+		},
+		{
+			expect: http.StatusUnprocessableEntity,
+			name:   "Unlock fail, no username provided",
+			userId: officer.Id,
+			input:  auth.UnlockUserIn{},
+		},
+		{
+			expect: http.StatusOK,
+			name:   "Unlock successfully",
+			userId: officer.Id,
+			input:  auth.UnlockUserIn{Username: "username"},
+		},
+	}
+
+	for _, c := range testCases {
+		t.Run(c.name, func(t *testing.T) {
+			out := app.UnlockUser(ctx, c.userId, c.input)
+
+			if out.StatusCode != c.expect {
+				t.Fatalf("resulting: %d, expect: %d | err: %v", out.StatusCode, c.expect, out.Error)
+			}
+		})
+	}
+
+	if out := app.Login(ctx, auth.LoginIn{Username: "username", Password: "password"}); out.StatusCode != http.StatusOK {
+		t.Fatalf("resulting: %d, expect: %d | err: %v", out.StatusCode, http.StatusOK, out.Error)
+	}
+}
+
+func TestLoginActivity(t *testing.T) {
+	if err := clearDb(); err != nil {
+		t.Fatal(err)
+	}
+
+	ctx := context.Background()
+
+	hashed, _ := bcrypt.GenerateFromPassword([]byte("password"), bcrypt.DefaultCost)
+	user, _ := authRepo.InsertUser(ctx, model.User{
+		Username: "username",
+		Password: string(hashed),
+		Role:     rbac.Applicant.String(),
+	})
+
+	in := auth.LoginIn{Username: "username", Password: "password", Ip: "10.0.0.1", UserAgent: "test-agent"}
+	out := authApp.Login(ctx, in)
+	if out.StatusCode != http.StatusOK {
+		t.Fatalf("resulting: %d, expect: %d | err: %v", out.StatusCode, http.StatusOK, out.Error)
+	}
+	if out.Res.LastLoginAt != "" {
+		t.Fatalf("resulting: %s, expect: empty last login on the first login", out.Res.LastLoginAt)
+	}
+
+	authApp.Login(ctx, auth.LoginIn{Username: "username", Password: "wrongpassword", Ip: "10.0.0.2", UserAgent: "test-agent"})
+
+	if out = authApp.Login(ctx, in); out.Res.LastLoginAt == "" {
+		t.Fatal("resulting: empty, expect: the previous login")
+	}
+
+	testCases := []struct {
+		expect    int
+		expectLen int
+		name      string
+		input     auth.ActivityQueryIn
+	}{
+		{
+			expect:    http.StatusOK,
+			expectLen: 3,
+			name:      "Get own activity successfully",
+			input:     auth.ActivityQueryIn{},
+		},
+		{
+			expect:    http.StatusOK,
+			expectLen: 1,
+			name:      "Get own activity successfully, with limit",
+			input:     auth.ActivityQueryIn{Limit: "1"},
+		},
+		{
+			expect:    http.StatusUnprocessableEntity,
+			expectLen: 0,
+			name:      "Get own activity fail, limit not valid",
+			input:     auth.ActivityQueryIn{Limit: "0"},
+		},
+	}
+
+	for _, c := range testCases {
+		t.Run(c.name, func(t *testing.T) {
+			out := authApp.GetOwnActivity(ctx, user.Id, c.input)
+
+			if out.StatusCode != c.expect {
+				t.Fatalf("resulting: %d, expect: %d | err: %v", out.StatusCode, c.expect, out.Error)
+			}
+			if len(out.Res) != c.expectLen {
+				t.Fatalf("resulting: %d, expect: %d", len(out.Res), c.expectLen)
+			}
+		})
+	}
+
+	acts := authApp.GetOwnActivity(ctx, user.Id, auth.ActivityQueryIn{}).Res
+	if !acts[0].IsSuccess || acts[1].IsSuccess || acts[1].Ip != "10.0.0.2" || acts[1].UserAgent != "test-agent" {
+		t.Fatalf("resulting: %+v, expect: the newest attempt first", acts)
+	}
+}
+
+func TestGetActivity(t *testing.T) {
+	if err := clearDb(); err != nil {
+		t.Fatal(err)
+	}
+
+	ctx := context.Background()
+
+	hashed, _ := bcrypt.GenerateFromPassword([]byte("password"), bcrypt.DefaultCost)
+	applicant, _ := authRepo.InsertUser(ctx, model.User{
+		Username: "username",
+		Password: string(hashed),
+		Role:     rbac.Applicant.String(),
+	})
+	auditor, _ := authRepo.InsertUser(ctx, model.User{
+		Username: "auditor",
+		Password: string(hashed),
+		Role:     rbac.Auditor.String(),
+	})
+
+	authApp.Login(ctx, auth.LoginIn{Username: "username", Password: "password"})
+	authApp.Login(ctx, auth.LoginIn{Username: "username", Password: "wrongpassword"})
+	authApp.Login(ctx, auth.LoginIn{Username: "nonexistusername", Password: "password"})
+
+	testCases := []struct {
+		expect    int
+		expectLen int
+		name      string
+		userId    string
+		input     auth.ActivityQueryIn
+	}{
+		{
+			expect:    http.StatusForbidden,
+			expectLen: 0,
+			name:      "Get activity fail, applicant can not read activity",
+			userId:    applicant.Id,
+			input:     auth.ActivityQueryIn{},
+		},
+		{
+			expect:    http.StatusOK,
+			expectLen: 3,
+			name:      "Get activity successfully, every user",
+			userId:    auditor.Id,
+			input:     auth.ActivityQueryIn{},
+		},
+		{
+			expect:    http.StatusOK,
+			expectLen: 2,
+			name:      "Get activity successfully, by user id",
+			userId:    auditor.Id,
+			input:     auth.ActivityQueryIn{UserId: applicant.Id},
+		},
+		{
+			expect:    http.StatusOK,
+			expectLen: 1,
+			name:      "Get activity successfully, failure of unknown username",
+			userId:    auditor.Id,
+			input:     auth.ActivityQueryIn{Username: "nonexistusername", Status: "failure"},
+		},
+		{
+			expect:    http.StatusOK,
+			expectLen: 0,
+			name:      "Get activity successfully, nothing in the future",
+			userId:    auditor.Id,
+			input:     auth.ActivityQueryIn{From: time.Now().Add(time.Hour).Format(time.RFC3339)},
+		},
+		{
+			expect:    http.StatusUnprocessableEntity,
+			expectLen: 0,
+			name:      "Get activity fail, status not valid",
+			userId:    auditor.Id,
+			input:     auth.ActivityQueryIn{Status: "unknown"},
+		},
+		{
+			expect:    http.StatusUnprocessableEntity,
+			expectLen: 0,
+			name:      "Get activity fail, date not valid",
+			userId:    auditor.Id,
+			input:     auth.ActivityQueryIn{To: "yesterday"},
+		},
+	}
+
+	for _, c := range testCases {
+		t.Run(c.name, func(t *testing.T) {
+			out := authApp.GetActivity(ctx, c.userId, c.input)
+
+			if out.StatusCode != c.expect {
+				t.Fatalf("resulting: %d, expect: %d | err: %v", out.StatusCode, c.expect, out.Error)
+			}
+			if len(out.Res) != c.expectLen {
+				t.Fatalf("resulting: %d, expect: %d", len(out.Res), c.expectLen)
+			}
+		})
+	}
+}
+
+// enrollTotp log the officer in for the first time and verify the first code,
+// it return the secret and the recovery codes of the officer
+func enrollTotp(t *testing.T, app *auth.AuthApp, username string) (string, []string) {
+	ctx := context.Background()
+
+	out := app.Login(ctx, auth.LoginIn{Username: username, Password: "password"})
+	if out.StatusCode != http.StatusOK || !out.Res.TotpRequired || out.Res.TotpSecret == "" {
+		t.Fatalf("resulting: %d %+v, expect: %d with totp secret | err: %v", out.StatusCode, out.Res, http.StatusOK, out.Error)
+	}
+
+	secret := out.Res.TotpSecret
+	code, _ := totp.Code(secret, time.Now())
+	out = app.LoginTotp(ctx, auth.LoginTotpIn{ChallengeToken: out.Res.ChallengeToken, Code: code})
+	if out.StatusCode != http.StatusOK {
+		t.Fatalf("resulting: %d, expect: %d | err: %v", out.StatusCode, http.StatusOK, out.Error)
+	}
+
+	return secret, out.Res.RecoveryCodes
+}
+
+func TestLoginTotp(t *testing.T) {
+	if err := clearDb(); err != nil {
+		t.Fatal(err)
+	}
+
+	ctx := context.Background()
+
+	hashed, _ := bcrypt.GenerateFromPassword([]byte("password"), bcrypt.DefaultCost)
+	authRepo.InsertUser(ctx, model.User{
+		Username: "username",
+		Password: string(hashed),
+		Role:     rbac.Applicant.String(),
+	})
+	authRepo.InsertUser(ctx, model.User{
+		Username: "officer",
+		Password: string(hashed),
+		Role:     rbac.Approver.String(),
+	})
+
+	if out := authApp.Login(ctx, auth.LoginIn{Username: "username", Password: "password"}); out.Res.TotpRequired {
+		t.Fatal("resulting: totp required, expect: applicant log in with password only")
+	}
+
+	out := authApp.Login(ctx, auth.LoginIn{Username: "officer", Password: "password"})
+	if out.StatusCode != http.StatusOK || !out.Res.TotpRequired || out.Res.TotpUri == "" {
+		t.Fatalf("resulting: %d %+v, expect: %d with totp uri | err: %v", out.StatusCode, out.Res, http.StatusOK, out.Error)
+	}
+
+	secret := out.Res.TotpSecret
+	challenge := out.Res.ChallengeToken
+	code, _ := totp.Code(secret, time.Now())
+
+	if out := authApp.LoginTotp(ctx, auth.LoginTotpIn{ChallengeToken: challenge, RecoveryCode: "aaaaa-aaaaa"}); out.StatusCode != http.StatusUnauthorized {
+		t.Fatalf("resulting: %d, expect: %d | err: %v", out.StatusCode, http.StatusUnauthorized, out.Error)
+	}
+
+	out = authApp.LoginTotp(ctx, auth.LoginTotpIn{ChallengeToken: challenge, Code: code})
+	if out.StatusCode != http.StatusOK || len(out.Res.RecoveryCodes) != 10 {
+		t.Fatalf("resulting: %d %d, expect: %d with 10 recovery codes | err: %v", out.StatusCode, len(out.Res.RecoveryCodes), http.StatusOK, out.Error)
+	}
+	recoveryCodes := out.Res.RecoveryCodes
+
+	out = authApp.Login(ctx, auth.LoginIn{Username: "officer", Password: "password"})
+	if !out.Res.TotpRequired || out.Res.TotpSecret != "" {
+		t.Fatalf("resulting: %+v, expect: challenge without new secret", out.Res)
+	}
+	challenge = out.Res.ChallengeToken
+
+	testCases := []struct {
+		expect int
+		name   string
+		input  auth.LoginTotpIn
+	}{
+		{
+			expect: http.StatusUnprocessableEntity,
+			name:   "Login totp fail, no code provided",
+			input:  auth.LoginTotpIn{ChallengeToken: challenge},
+		},
+		{
+			expect: http.StatusUnauthorized,
+			name:   "Login totp fail, challenge not found",
+			input:  auth.LoginTotpIn{ChallengeToken: "nonexistchallenge", Code: code},
+		},
+		{
+			expect: http.StatusUnauthorized,
+			name:   "Login totp fail, code already used",
+			input:  auth.LoginTotpIn{ChallengeToken: challenge, Code: code},
+		},
+		{
+			expect: http.StatusOK,
+			name:   "Login totp successfully, with recovery code",
+			input:  auth.LoginTotpIn{ChallengeToken: challenge, RecoveryCode: strings.ToUpper(recoveryCodes[0])},
+		},
+		{
+			expect: http.StatusUnauthorized,
+			name:   "Login totp fail, challenge already used",
+			input:  auth.LoginTotpIn{ChallengeToken: challenge, RecoveryCode: recoveryCodes[1]},
+		},
+	}
+
+	for _, c := range testCases {
+		t.Run(c.name, func(t *testing.T) {
+			out := authApp.LoginTotp(ctx, c.input)
+
+			if out.StatusCode != c.expect {
+				t.Fatalf("resulting: %d, expect: %d | err: %v", out.StatusCode, c.expect, out.Error)
+			}
+		})
+	}
+
+	out = authApp.Login(ctx, auth.LoginIn{Username: "officer", Password: "password"})
+	if out := authApp.LoginTotp(ctx, auth.LoginTotpIn{ChallengeToken: out.Res.ChallengeToken, RecoveryCode: recoveryCodes[0]}); out.StatusCode != http.StatusUnauthorized {
+		t.Fatalf("resulting: %d, expect: %d | err: %v", out.StatusCode, http.StatusUnauthorized, out.Error)
+	}
+}
+
+func TestRecoveryCodesAndResetTotp(t *testing.T) {
+	if err := clearDb(); err != nil {
+		t.Fatal(err)
+	}
+
+	ctx := context.Background()
+
+	hashed, _ := bcrypt.GenerateFromPassword([]byte("password"), bcrypt.DefaultCost)
+	applicant, _ := authRepo.InsertUser(ctx, model.User{
+		Username: "username",
+		Password: string(hashed),
+		Role:     rbac.Applicant.String(),
+	})
+	officer, _ := authRepo.InsertUser(ctx, model.User{
+		Username: "officer",
+		Password: string(hashed),
+		Role:     rbac.FieldOfficer.String(),
+	})
+	admin, _ := authRepo.InsertUser(ctx, model.User{
+		Username: "admin",
+		Password: string(hashed),
+		Role:     rbac.Admin.String(),
+	})
+
+	secret, _ := enrollTotp(t, authApp, "officer")
+	// The code of the current step is used up by the enrollment
+	nextCode, _ := totp.Code(secret, time.Now().Add(totp.Period))
+
+	recoveryCases := []struct {
+		expect int
+		name   string
+		userId string
+		input  auth.RecoveryCodesIn
+	}{
+		{
+			expect: http.StatusUnprocessableEntity,
+			name:   "Regenerate recovery codes fail, no code provided",
+			userId: officer.Id,
+			input:  auth.RecoveryCodesIn{},
+		},
+		{
+			expect: http.StatusBadRequest,
+			name:   "Regenerate recovery codes fail, totp not enabled",
+			userId: applicant.Id,
+			input:  auth.RecoveryCodesIn{Code: nextCode},
+		},
+		{
+			expect: http.StatusBadRequest,
+			name:   "Regenerate recovery codes fail, wrong code",
+			userId: officer.Id,
+			input:  auth.RecoveryCodesIn{Code: "000000"},
+		},
+		{
+			expect: http.StatusOK,
+			name:   "Regenerate recovery codes successfully",
+			userId: officer.Id,
+			input:  auth.RecoveryCodesIn{Code: nextCode},
+		},
+	}
+
+	for _, c := range recoveryCases {
+		t.Run(c.name, func(t *testing.T) {
+			out := authApp.RegenerateRecoveryCodes(ctx, c.userId, c.input)
+
+			if out.StatusCode != c.expect {
+				t.Fatalf("resulting: %d, expect: %d | err: %v", out.StatusCode, c.expect, out.Error)
+			}
+		})
+	}
+
+	resetCases := []struct {
+		expect int
+		name   string
+		userId string
+		input  auth.ResetTotpIn
+	}{
+		{
+			expect: http.StatusForbidden,
+			name:   "Reset totp fail, officer can not reset",
+			userId: officer.Id,
+			input:  auth.ResetTotpIn{Username: "officer"},
+		},
+		{
+			expect: http.StatusNotFound,
+			name:   "Reset totp fail, username not found",
+			userId: admin.Id,
+			input:  auth.ResetTotpIn{Username: "nonexistusername"},
+		},
+		{
+			expect: http.StatusOK,
+			name:   "Reset totp successfully",
+			userId: admin.Id,
+			input:  auth.ResetTotpIn{Username: "officer"},
+		},
+		{
+			expect: http.StatusNotFound,
+			name:   "Reset totp fail, totp already reset",
+			userId: admin.Id,
+			input:  auth.ResetTotpIn{Username: "officer"},
+		},
+	}
+
+	for _, c := range resetCases {
+		t.Run(c.name, func(t *testing.T) {
+			out := authApp.ResetTotp(ctx, c.userId, c.input)
+
+			if out.StatusCode != c.expect {
+				t.Fatalf("resulting: %d, expect: %d | err: %v", out.StatusCode, c.expect, out.Error)
+			}
+		})
+	}
+
+	if out := authApp.Login(ctx, auth.LoginIn{Username: "officer", Password: "password"}); out.Res.TotpSecret == "" {
+		t.Fatal("resulting: no secret, expect: officer enroll again after reset")
+	}
+}
+
+func TestCreateApiKey(t *testing.T) {
+	if err := clearDb(); err != nil {
+		t.Fatal(err)
+	}
+
+	ctx := context.Background()
+
+	applicant, _ := authRepo.InsertUser(ctx, model.User{
+		Username: "username",
+		Password: "password",
+		Role:     rbac.Applicant.String(),
+	})
+	admin, _ := authRepo.InsertUser(ctx, model.User{
+		Username: "admin",
+		Password: "password",
+		Role:     rbac.Admin.String(),
+	})
+
+	testCases := []struct {
+		expect int
+		name   string
+		userId string
+		input  auth.CreateApiKeyIn
+	}{
+		{
+			expect: http.StatusForbidden,
+			name:   "Create api key fail, applicant can not create",
+			userId: applicant.Id,
+			input:  auth.CreateApiKeyIn{Name: "bot", Scopes: []string{rbac.LoanReadAll.String()}},
+		},
+		{
+			expect: http.StatusUnprocessableEntity,
+			name:   "Create api key fail, no name provided",
+			userId: admin.Id,
+			input:  auth.CreateApiKeyIn{Scopes: []string{rbac.LoanReadAll.String()}},
+		},
+		{
+			expect: http.StatusUnprocessableEntity,
+			name:   "Create api key fail, no scope provided",
+			userId: admin.Id,
+			input:  auth.CreateApiKeyIn{Name: "bot"},
+		},
+		{
+			expect: http.StatusUnprocessableEntity,
+			name:   "Create api key fail, unknown scope",
+			userId: admin.Id,
+			input:  auth.CreateApiKeyIn{Name: "bot", Scopes: []string{"loan:everything"}},
+		},
+		{
+			expect: http.StatusUnprocessableEntity,
+			name:   "Create api key fail, key can not manage key",
+			userId: admin.Id,
+			input:  auth.CreateApiKeyIn{Name: "bot", Scopes: []string{rbac.ApiKeyManage.String()}},
+		},
+		{
+			expect: http.StatusCreated,
+			name:   "Create api key successfully",
+			userId: admin.Id,
+			input:  auth.CreateApiKeyIn{Name: "bot", Scopes: []string{rbac.LoanReadAll.String(), rbac.LoanProceed.String()}},
+		},
+	}
+
+	for _, c := range testCases {
+		t.Run(c.name, func(t *testing.T) {
+			out := authApp.CreateApiKey(ctx, c.userId, c.input)
+
+			if out.StatusCode != c.expect {
+				t.Fatalf("resulting: %d, expect: %d | err: %v", out.StatusCode, c.expect, out.Error)
+			}
+			if out.Error == nil && !strings.HasPrefix(out.Res.Key, auth.ApiKeyPrefix) {
+				t.Fatalf("resulting: %s, expect: key with prefix %s", out.Res.Key, auth.ApiKeyPrefix)
+			}
+		})
+	}
+}
+
+func TestApiKeyLifecycle(t *testing.T) {
+	if err := clearDb(); err != nil {
+		t.Fatal(err)
+	}
+
+	ctx := context.Background()
+
+	admin, _ := authRepo.InsertUser(ctx, model.User{
+		Username: "admin",
+		Password: "password",
+		Role:     rbac.Admin.String(),
+	})
+
+	created := authApp.CreateApiKey(ctx, admin.Id, auth.CreateApiKeyIn{
+		Name:   "bot",
+		Scopes: []string{rbac.LoanReadAll.String()},
+	}).Res
+
+	sess, err := authApp.AuthenticateApiKey(ctx, created.Key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if sess.UserId != admin.Id || sess.Role != rbac.Admin.String() || sess.ApiKeyId != created.Id || len(sess.Scopes) != 1 {
+		t.Fatalf("resulting: %+v, expect: session of the admin limited to the key scopes", sess)
+	}
+
+	keys := authApp.GetApiKeys(ctx, admin.Id).Res
+	if len(keys) != 1 || keys[0].LastUsedDate == "" || keys[0].Key != "" {
+		t.Fatalf("resulting: %+v, expect: one used key without the key itself", keys)
+	}
+
+	rotated := authApp.RotateApiKey(ctx, admin.Id, created.Id)
+	if rotated.StatusCode != http.StatusOK || rotated.Res.Id != created.Id {
+		t.Fatalf("resulting: %d, expect: %d | err: %v", rotated.StatusCode, http.StatusOK, rotated.Error)
+	}
+	if _, err := authApp.AuthenticateApiKey(ctx, created.Key); err != auth.ErrApiKeyNotValid {
+		t.Fatalf("resulting: %v, expect: %v", err, auth.ErrApiKeyNotValid)
+	}
+	if _, err := authApp.AuthenticateApiKey(ctx, rotated.Res.Key); err != nil {
+		t.Fatal(err)
+	}
+
+	if out := authApp.RevokeApiKey(ctx, admin.Id, created.Id); out.StatusCode != http.StatusOK {
+		t.Fatalf("resulting: %d, expect: %d | err: %v", out.StatusCode, http.StatusOK, out.Error)
+	}
+	if _, err := authApp.AuthenticateApiKey(ctx, rotated.Res.Key); err != auth.ErrApiKeyNotValid {
+		t.Fatalf("resulting: %v, expect: %v", err, auth.ErrApiKeyNotValid)
+	}
+
+	testCases := []struct {
+		expect int
+		name   string
+		id     string
+	}{
+		{
+			expect: http.StatusNotFound,
+			name:   "Rotate api key fail, key revoked",
+			id:     created.Id,
+		},
+		{
+			expect: http.StatusNotFound,
+			name:   "Rotate api key fail, key not found",
+			id:     "nonexistid",
+		},
+	}
+
+	for _, c := range testCases {
+		t.Run(c.name, func(t *testing.T) {
+			out := authApp.RotateApiKey(ctx, admin.Id, c.id)
+
+			if out.StatusCode != c.expect {
+				t.Fatalf("resulting: %d, expect: %d | err: %v", out.StatusCode, c.expect, out.Error)
+			}
+		})
+	}
+
+	expiredKey := auth.ApiKeyPrefix + "expired"
+	authRepo.InsertApiKey(ctx, model.ApiKey{
+		Id:          "expired",
+		Name:        "expired bot",
+		KeyHash:     session.KeyHash(expiredKey),
+		UserId:      admin.Id,
+		Scopes:      []string{rbac.LoanReadAll.String()},
+		ExpiredDate: time.Now().Add(-time.Hour),
+	})
+	if _, err := authApp.AuthenticateApiKey(ctx, expiredKey); err != auth.ErrApiKeyNotValid {
+		t.Fatalf("resulting: %v, expect: %v", err, auth.ErrApiKeyNotValid)
+	}
+}
+
+func TestChangeUsername(t *testing.T) {
+	if err := clearDb(); err != nil {
+		t.Fatal(err)
+	}
+
+	ctx := context.Background()
+
+	hashed, _ := bcrypt.GenerateFromPassword([]byte("password"), bcrypt.DefaultCost)
+	user, _ := authRepo.InsertUser(ctx, model.User{
+		Username: "username",
+		Password: string(hashed),
+		Role:     rbac.Applicant.String(),
+	})
+	authRepo.InsertUser(ctx, model.User{
+		Username: "existusername",
+		Password: string(hashed),
+		Role:     rbac.Applicant.String(),
+	})
+
+	if strings.Contains(user.Id, hex.EncodeToString([]byte("username"))) {
+		t.Fatalf("resulting: %s, expect: id that does not carry the username", user.Id)
+	}
+
+	testCases := []struct {
+		expect int
+		name   string
+		input  auth.ChangeUsernameIn
+	}{
+		{
+			expect: http.StatusUnprocessableEntity,
+			name:   "Change username fail, no username provided",
+			input:  auth.ChangeUsernameIn{Password: "password"},
+		},
+		{
+			expect: http.StatusBadRequest,
+			name:   "Change username fail, password not match",
+			input:  auth.ChangeUsernameIn{Username: "newusername", Password: "wrongpassword"},
+		},
+		{
+			expect: http.StatusBadRequest,
+			name:   "Change username fail, same username",
+			input:  auth.ChangeUsernameIn{Username: "username", Password: "password"},
+		},
+		{
+			expect: http.StatusBadRequest,
+			name:   "Change username fail, username exist",
+			input:  auth.ChangeUsernameIn{Username: "existusername", Password: "password"},
+		},
+		{
+			expect: http.StatusOK,
+			name:   "Change username successfully",
+			input:  auth.ChangeUsernameIn{Username: "newusername", Password: "password"},
+		},
+	}
+
+	for _, c := range testCases {
+		t.Run(c.name, func(t *testing.T) {
+			out := authApp.ChangeUsername(ctx, user.Id, c.input)
+
+			if out.StatusCode != c.expect {
+				t.Fatalf("resulting: %d, expect: %d | err: %v", out.StatusCode, c.expect, out.Error)
+			}
+		})
+	}
+
+	if out := authApp.Login(ctx, auth.LoginIn{Username: "username", Password: "password"}); out.StatusCode != http.StatusUnauthorized {
+		t.Fatalf("resulting: %d, expect: %d | err: %v", out.StatusCode, http.StatusUnauthorized, out.Error)
+	}
+
+	out := authApp.Login(ctx, auth.LoginIn{Username: "newusername", Password: "password"})
+	if out.StatusCode != http.StatusOK || out.Res.Id != user.Id {
+		t.Fatalf("resulting: %d %s, expect: %d %s | err: %v", out.StatusCode, out.Res.Id, http.StatusOK, user.Id, out.Error)
+	}
+
+	if out := authApp.Register(ctx, auth.RegisterIn{Username: "username", Password: "password"}); out.StatusCode != http.StatusCreated {
+		t.Fatalf("resulting: %d, expect: %d | err: %v", out.StatusCode, http.StatusCreated, out.Error)
+	}
+}
+
+func TestChangeUsernameThrottle(t *testing.T) {
+	clearDb()
+	ctx := context.Background()
+
+	hashed, _ := bcrypt.GenerateFromPassword([]byte("password"), bcrypt.DefaultCost)
+	user, _ := authRepo.InsertUser(ctx, model.User{
+		Username: "username",
+		Password: string(hashed),
+		Role:     rbac.Applicant.String(),
+	})
+
+	app := auth.NewApp(authRepo, auth.DefaultPasswordPolicy(), notifier, throttle.New(throttle.Config{
+		FreeAttempts: 0,
+		BaseDelay:    time.Hour,
+		MaxDelay:     time.Hour,
+		Window:       time.Hour,
+	}), nil)
+
+	app.Login(ctx, auth.LoginIn{Username: "username", Password: "wrongpassword"})
+	if out := app.ChangeUsername(ctx, user.Id, auth.ChangeUsernameIn{Username: "NewUsername", Password: "password"}); out.StatusCode != http.StatusOK {
+		t.Fatalf("resulting: %d, expect: %d | err: %v", out.StatusCode, http.StatusOK, out.Error)
+	}
+
+	if out := app.Login(ctx, auth.LoginIn{Username: "newusername", Password: "password"}); out.StatusCode != http.StatusTooManyRequests {
+		t.Fatalf("resulting: %d, expect: %d | err: %v", out.StatusCode, http.StatusTooManyRequests, out.Error)
+	}
+
+	if out := app.Register(ctx, auth.RegisterIn{Username: "username", Password: "password"}); out.StatusCode != http.StatusCreated {
+		t.Fatalf("resulting: %d, expect: %d | err: %v", out.StatusCode, http.StatusCreated, out.Error)
+	}
+	if out := app.Login(ctx, auth.LoginIn{Username: "username", Password: "password"}); out.StatusCode != http.StatusOK {
+		t.Fatalf("resulting: %d, expect: %d | err: %v", out.StatusCode, http.StatusOK, out.Error)
+	}
+}
+
+func TestUpdateProfile(t *testing.T) {
+	if err := clearDb(); err != nil {
+		t.Fatal(err)
+	}
+	ctx := context.Background()
+
+	hashed, _ := bcrypt.GenerateFromPassword([]byte("password"), bcrypt.DefaultCost)
+	user, _ := authRepo.InsertUser(ctx, model.User{
+		Username: "username",
+		Password: string(hashed),
+		Role:     rbac.Applicant.String(),
+	})
+
+	testCases := []struct {
+		expect int
+		name   string
+		input  auth.UpdateProfileIn
+	}{
+		{
+			expect: http.StatusUnprocessableEntity,
+			name:   "Update profile fail, display name too long",
+			input:  auth.UpdateProfileIn{DisplayName: strings.Repeat("a", 101)},
+		},
+		{
+			expect: http.StatusUnprocessableEntity,
+			name:   "Update profile fail, email not valid",
+			input:  auth.UpdateProfileIn{Email: "John <john@example.com>"},
+		},
+		{
+			expect: http.StatusUnprocessableEntity,
+			name:   "Update profile fail, phone not valid",
+			input:  auth.UpdateProfileIn{Phone: "+62 812 abc"},
+		},
+		{
+			expect: http.StatusOK,
+			name:   "Update profile successfully",
+			input: auth.UpdateProfileIn{
+				DisplayName: " John Doe ",
+				Email:       "john@example.com",
+				Phone:       "+62 812-3456-7890",
+			},
+		},
+	}
+
+	for _, c := range testCases {
+		t.Run(c.name, func(t *testing.T) {
+			out := authApp.UpdateProfile(ctx, user.Id, c.input)
+
+			if out.StatusCode != c.expect {
+				t.Fatalf("resulting: %d, expect: %d | err: %v", out.StatusCode, c.expect, out.Error)
+			}
+		})
+	}
+
+	out := authApp.GetMe(ctx, user.Id)
+	if out.StatusCode != http.StatusOK {
+		t.Fatalf("resulting: %d, expect: %d | err: %v", out.StatusCode, http.StatusOK, out.Error)
+	}
+	if out.Res.DisplayName != "John Doe" || out.Res.Email != "john@example.com" || out.Res.Phone != "+6281234567890" {
+		t.Fatalf("resulting: %+v, expect: the updated profile", out.Res)
+	}
+	if !out.Res.IsActive || out.Res.Role != rbac.Applicant.String() || out.Res.CreatedDate == "" {
+		t.Fatalf("resulting: %+v, expect: an active applicant with the created date", out.Res)
+	}
+
+	if out := authApp.GetMe(ctx, "notexist"); out.StatusCode != http.StatusNotFound {
+		t.Fatalf("resulting: %d, expect: %d | err: %v", out.StatusCode, http.StatusNotFound, out.Error)
+	}
+}
+
+func TestDeactivateAccount(t *testing.T) {
+	if err := clearDb(); err != nil {
+		t.Fatal(err)
+	}
+	ctx := context.Background()
+
+	hashed, _ := bcrypt.GenerateFromPassword([]byte("password"), bcrypt.DefaultCost)
+	user, _ := authRepo.InsertUser(ctx, model.User{
+		Username: "username",
+		Password: string(hashed),
+		Role:     rbac.Applicant.String(),
+	})
+
+	testCases := []struct {
+		expect int
+		name   string
+		input  auth.DeactivateAccountIn
+	}{
+		{
+			expect: http.StatusUnprocessableEntity,
+			name:   "Deactivate account fail, no password provided",
+			input:  auth.DeactivateAccountIn{},
+		},
+		{
+			expect: http.StatusBadRequest,
+			name:   "Deactivate account fail, password not match",
+			input:  auth.DeactivateAccountIn{Password: "wrongpassword"},
+		},
+		{
+			expect: http.StatusOK,
+			name:   "Deactivate account successfully",
+			input:  auth.DeactivateAccountIn{Password: "password"},
+		},
+		{
+			expect: http.StatusBadRequest,
+			name:   "Deactivate account fail, already deactivated",
+			input:  auth.DeactivateAccountIn{Password: "password"},
+		},
+	}
+
+	for _, c := range testCases {
+		t.Run(c.name, func(t *testing.T) {
+			out := authApp.DeactivateAccount(ctx, user.Id, c.input)
+
+			if out.StatusCode != c.expect {
+				t.Fatalf("resulting: %d, expect: %d | err: %v", out.StatusCode, c.expect, out.Error)
+			}
+		})
+	}
+
+	if out := authApp.Login(ctx, auth.LoginIn{Username: "username", Password: "wrongpassword"}); out.StatusCode != http.StatusUnauthorized {
+		t.Fatalf("resulting: %d, expect: %d | err: %v", out.StatusCode, http.StatusUnauthorized, out.Error)
+	}
+	if out := authApp.Login(ctx, auth.LoginIn{Username: "username", Password: "password"}); out.StatusCode != http.StatusForbidden {
+		t.Fatalf("resulting: %d, expect: %d | err: %v", out.StatusCode, http.StatusForbidden, out.Error)
+	}
+
+	notifier.last = notify.Message{}
+	if out := authApp.ForgotPassword(ctx, auth.ForgotPasswordIn{Username: "username"}); out.StatusCode != http.StatusOK || notifier.last.To != "" {
+		t.Fatalf("resulting: %d %s, expect: %d and no message sent | err: %v", out.StatusCode, notifier.last.To, http.StatusOK, out.Error)
+	}
+
+	if out := authApp.Register(ctx, auth.RegisterIn{Username: "username", Password: "password"}); out.StatusCode != http.StatusBadRequest {
+		t.Fatalf("resulting: %d, expect: %d | err: %v", out.StatusCode, http.StatusBadRequest, out.Error)
+	}
+}
+
+func TestGetUsersAndDeactivateUser(t *testing.T) {
+	if err := clearDb(); err != nil {
+		t.Fatal(err)
+	}
+	ctx := context.Background()
+
+	hashed, _ := bcrypt.GenerateFromPassword([]byte("password"), bcrypt.DefaultCost)
+	admin, _ := authRepo.InsertUser(ctx, model.User{
+		Username: "admin",
+		Password: string(hashed),
+		Role:     rbac.Admin.String(),
+	})
+	officer, _ := authRepo.InsertUser(ctx, model.User{
+		Username: "officer",
+		Password: string(hashed),
+		Role:     rbac.FieldOfficer.String(),
+	})
+	approver, _ := authRepo.InsertUser(ctx, model.User{
+		Username: "approver",
+		Password: string(hashed),
+		Role:     rbac.Approver.String(),
+	})
+	applicant, _ := authRepo.InsertUser(ctx, model.User{
+		Username: "applicant",
+		Password: string(hashed),
+		Role:     rbac.Applicant.String(),
+	})
+	authRepo.UpdateProfile(ctx, applicant.Id, auth.UserProfile{DisplayName: "Jane Roe", Email: "jane@example.com"})
+
+	deactivateCases := []struct {
+		expect int
+		name   string
+		userId string
+		input  auth.DeactivateUserIn
+	}{
+		{
+			expect: http.StatusUnprocessableEntity,
+			name:   "Deactivate user fail, no username provided",
+			userId: officer.Id,
+			input:  auth.DeactivateUserIn{},
+		},
+		{
+			expect: http.StatusForbidden,
+			name:   "Deactivate user fail, approver not allowed",
+			userId: approver.Id,
+			input:  auth.DeactivateUserIn{Username: "applicant"},
+		},
+		{
+			expect: http.StatusNotFound,
+			name:   "Deactivate user fail, user not exist",
+			userId: officer.Id,
+			input:  auth.DeactivateUserIn{Username: "notexist"},
+		},
+		{
+			expect: http.StatusBadRequest,
+			name:   "Deactivate user fail, deactivate itself",
+			userId: officer.Id,
+			input:  auth.DeactivateUserIn{Username: "officer"},
+		},
+		{
+			expect: http.StatusForbidden,
+			name:   "Deactivate user fail, field officer deactivate another officer",
+			userId: officer.Id,
+			input:  auth.DeactivateUserIn{Username: "approver"},
+		},
+		{
+			expect: http.StatusOK,
+			name:   "Deactivate user successfully, field officer deactivate applicant",
+			userId: officer.Id,
+			input:  auth.DeactivateUserIn{Username: "applicant"},
+		},
+		{
+			expect: http.StatusOK,
+			name:   "Deactivate user successfully, admin deactivate officer",
+			userId: admin.Id,
+			input:  auth.DeactivateUserIn{Username: "approver"},
+		},
+	}
+
+	for _, c := range deactivateCases {
+		t.Run(c.name, func(t *testing.T) {
+			out := authApp.DeactivateUser(ctx, c.userId, c.input)
+
+			if out.StatusCode != c.expect {
+				t.Fatalf("resulting: %d, expect: %d | err: %v", out.StatusCode, c.expect, out.Error)
+			}
+		})
+	}
+
+	listCases := []struct {
+		expect    int
+		expectLen int
+		name      string
+		userId    string
+		input     auth.UsersQueryIn
+	}{
+		{
+			expect: http.StatusForbidden,
+			name:   "Get users fail, approver not allowed",
+			userId: approver.Id,
+		},
+		{
+			expect: http.StatusUnprocessableEntity,
+			name:   "Get users fail, status not valid",
+			userId: officer.Id,
+			input:  auth.UsersQueryIn{Status: "deleted"},
+		},
+		{
+			expect: http.StatusUnprocessableEntity,
+			name:   "Get users fail, role not valid",
+			userId: officer.Id,
+			input:  auth.UsersQueryIn{Role: "superuser"},
+		},
+		{
+			expect: http.StatusUnprocessableEntity,
+			name:   "Get users fail, limit not valid",
+			userId: officer.Id,
+			input:  auth.UsersQueryIn{Limit: "101"},
+		},
+		{
+			expect:    http.StatusOK,
+			expectLen: 4,
+			name:      "Get users successfully, every user",
+			userId:    officer.Id,
+		},
+		{
+			expect:    http.StatusOK,
+			expectLen: 2,
+			name:      "Get users successfully, inactive user",
+			userId:    officer.Id,
+			input:     auth.UsersQueryIn{Status: "inactive"},
+		},
+		{
+			expect:    http.StatusOK,
+			expectLen: 1,
+			name:      "Get users successfully, search by email",
+			userId:    admin.Id,
+			input:     auth.UsersQueryIn{Query: "JANE@"},
+		},
+		{
+			expect:    http.StatusOK,
+			expectLen: 1,
+			name:      "Get users successfully, filter by role",
+			userId:    admin.Id,
+			input:     auth.UsersQueryIn{Role: rbac.FieldOfficer.String()},
+		},
+		{
+			expect:    http.StatusOK,
+			expectLen: 1,
+			name:      "Get users successfully, paginated",
+			userId:    admin.Id,
+			input:     auth.UsersQueryIn{Limit: "2", Offset: "3"},
+		},
+	}
+
+	for _, c := range listCases {
+		t.Run(c.name, func(t *testing.T) {
+			out := authApp.GetUsers(ctx, c.userId, c.input)
+
+			if out.StatusCode != c.expect {
+				t.Fatalf("resulting: %d, expect: %d | err: %v", out.StatusCode, c.expect, out.Error)
+			}
+			if len(out.Res) != c.expectLen {
+				t.Fatalf("resulting: %d, expect: %d", len(out.Res), c.expectLen)
+			}
+		})
+	}
+
+	if out := authApp.Login(ctx, auth.LoginIn{Username: "applicant", Password: "password"}); out.StatusCode != http.StatusForbidden {
+		t.Fatalf("resulting: %d, expect: %d | err: %v", out.StatusCode, http.StatusForbidden, out.Error)
+	}
+}
+
+// oidcAuthorize start the OIDC login and follow the URL to the provider,
+// returning the code and state the provider redirect back with
+func oidcAuthorize(t *testing.T, idp *oidctest.Server, app *auth.AuthApp) (string, string) {
+	out := app.StartOidcLogin(context.Background())
+	if out.StatusCode != http.StatusOK {
+		t.Fatalf("resulting: %d, expect: %d | err: %v", out.StatusCode, http.StatusOK, out.Error)
+	}
+
+	client := idp.Client()
+	client.CheckRedirect = func(req *http.Request, via []*http.Request) error {
+		return http.ErrUseLastResponse
+	}
+
+	res, err := client.Get(out.Res.AuthUrl)
+	if err != nil {
+		t.Fatal(err)
+	}
+	res.Body.Close()
+
+	loc, err := url.Parse(res.Header.Get("Location"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return loc.Query().Get("code"), loc.Query().Get("state")
+}
+
+func TestOidcLogin(t *testing.T) {
+	if err := clearDb(); err != nil {
+		t.Fatal(err)
+	}
+	ctx := context.Background()
+
+	idp := oidctest.NewServer("los", "secret")
+	defer idp.Close()
+
+	provider, err := oidc.NewProvider(ctx, oidc.Config{
+		Issuer:       idp.Issuer(),
+		ClientId:     "los",
+		ClientSecret: "secret",
+		RedirectUrl:  "http://localhost:4000/auth/oidc/callback",
+		Scopes:       []string{"openid", "profile", "email"},
+		RoleClaim:    "roles",
+		AllowedRoles: []string{"field_officer", "credit_analyst", "approver"},
+	}, idp.Client())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	app := auth.NewApp(authRepo, auth.DefaultPasswordPolicy(), notifier, throttle.New(throttle.DefaultConfig()), provider)
+
+	hashed, _ := bcrypt.GenerateFromPassword([]byte("password"), bcrypt.DefaultCost)
+	authRepo.InsertUser(ctx, model.User{
+		Username: "username",
+		Password: string(hashed),
+		Role:     rbac.Applicant.String(),
+	})
+
+	if out := authApp.StartOidcLogin(ctx); out.StatusCode != http.StatusNotImplemented {
+		t.Fatalf("resulting: %d, expect: %d | err: %v", out.StatusCode, http.StatusNotImplemented, out.Error)
+	}
+
+	testCases := []struct {
+		expect      int
+		expectRole  string
+		roleChanged bool
+		name        string
+		subject     string
+		claims      map[string]interface{}
+	}{
+		{
+			expect:     http.StatusOK,
+			expectRole: rbac.CreditAnalyst.String(),
+			name:       "OIDC login successfully, first login create the user",
+			subject:    "subject-1",
+			claims: map[string]interface{}{
+				"preferred_username": "jdoe",
+				"name":               "John Doe",
+				"email":              "jdoe@example.com",
+				"roles":              []string{"offline_access", "credit_analyst"},
+			},
+		},
+		{
+			expect:      http.StatusOK,
+			expectRole:  rbac.Approver.String(),
+			roleChanged: true,
+			name:        "OIDC login successfully, role follow the claim",
+			subject:     "subject-1",
+			claims: map[string]interface{}{
+				"preferred_username": "jdoe",
+				"roles":              "approver",
+			},
+		},
+		{
+			expect:      http.StatusOK,
+			expectRole:  rbac.FieldOfficer.String(),
+			roleChanged: true,
+			name:        "OIDC login successfully, role not allowed is ignored",
+			subject:     "subject-1",
+			claims: map[string]interface{}{
+				"preferred_username": "jdoe",
+				"roles":              []string{"admin", "field_officer"},
+			},
+		},
+		{
+			expect:  http.StatusForbidden,
+			name:    "OIDC login fail, only role not allowed",
+			subject: "subject-4",
+			claims: map[string]interface{}{
+				"preferred_username": "root",
+				"roles":              []string{"admin", "senior_approver"},
+			},
+		},
+		{
+			expect:  http.StatusForbidden,
+			name:    "OIDC login fail, no officer role",
+			subject: "subject-2",
+			claims: map[string]interface{}{
+				"preferred_username": "applicant",
+				"roles":              []string{"applicant"},
+			},
+		},
+		{
+			expect:  http.StatusBadRequest,
+			name:    "OIDC login fail, username taken by a local user",
+			subject: "subject-3",
+			claims: map[string]interface{}{
+				"preferred_username": "username",
+				"roles":              []string{"field_officer"},
+			},
+		},
+	}
+
+	var userId string
+	for _, c := range testCases {
+		t.Run(c.name, func(t *testing.T) {
+			idp.SetUser(c.subject, c.claims)
+			code, state := oidcAuthorize(t, idp, app)
+
+			out := app.OidcCallback(ctx, auth.OidcCallbackIn{Code: code, State: state})
+			if out.StatusCode != c.expect {
+				t.Fatalf("resulting: %d, expect: %d | err: %v", out.StatusCode, c.expect, out.Error)
+			}
+			if out.Res.Role != c.expectRole || out.Res.TotpRequired {
+				t.Fatalf("resulting: %s %t, expect: %s false", out.Res.Role, out.Res.TotpRequired, c.expectRole)
+			}
+			if out.Res.RoleChanged != c.roleChanged {
+				t.Fatalf("resulting: %t, expect: %t", out.Res.RoleChanged, c.roleChanged)
+			}
+			if c.subject == "subject-1" {
+				if userId != "" && out.Res.Id != userId {
+					t.Fatalf("resulting: %s, expect: %s", out.Res.Id, userId)
+				}
+				userId = out.Res.Id
+			}
+		})
+	}
+
+	me := authApp.GetMe(ctx, userId)
+	if me.Res.Username != "jdoe" || me.Res.DisplayName != "John Doe" || me.Res.Email != "jdoe@example.com" {
+		t.Fatalf("resulting: %+v, expect: the profile from the claims", me.Res)
+	}
+
+	idp.SetUser("subject-1", map[string]interface{}{"roles": "approver"})
+	code, state := oidcAuthorize(t, idp, app)
+
+	callbackCases := []struct {
+		expect int
+		name   string
+		input  auth.OidcCallbackIn
+	}{
+		{
+			expect: http.StatusUnauthorized,
+			name:   "OIDC callback fail, provider return error",
+			input:  auth.OidcCallbackIn{State: state, Error: "access_denied"},
+		},
+		{
+			expect: http.StatusUnprocessableEntity,
+			name:   "OIDC callback fail, no code provided",
+			input:  auth.OidcCallbackIn{State: state},
+		},
+		{
+			expect: http.StatusUnauthorized,
+			name:   "OIDC callback fail, unknown state",
+			input:  auth.OidcCallbackIn{Code: code, State: "unknown"},
+		},
+		{
+			expect: http.StatusUnauthorized,
+			name:   "OIDC callback fail, code not valid",
+			input:  auth.OidcCallbackIn{Code: "notvalid", State: state},
+		},
+		{
+			expect: http.StatusUnauthorized,
+			name:   "OIDC callback fail, state already used",
+			input:  auth.OidcCallbackIn{Code: code, State: state},
+		},
+	}
+
+	for _, c := range callbackCases {
+		t.Run(c.name, func(t *testing.T) {
+			out := app.OidcCallback(ctx, c.input)
+
+			if out.StatusCode != c.expect {
+				t.Fatalf("resulting: %d, expect: %d | err: %v", out.StatusCode, c.expect, out.Error)
+			}
+		})
+	}
+
+	if out := app.Login(ctx, auth.LoginIn{Username: "username", Password: "password"}); out.StatusCode != http.StatusOK {
+		t.Fatalf("resulting: %d, expect: %d | err: %v", out.StatusCode, http.StatusOK, out.Error)
+	}
+
+	authRepo.DeactivateUser(ctx, userId)
+	code, state = oidcAuthorize(t, idp, app)
+	if out := app.OidcCallback(ctx, auth.OidcCallbackIn{Code: code, State: state}); out.StatusCode != http.StatusForbidden {
+		t.Fatalf("resulting: %d, expect: %d | err: %v", out.StatusCode, http.StatusForbidden, out.Error)
+	}
+}
+
+func TestForgotPasswordThrottle(t *testing.T) {
+	clearDb()
+	ctx := context.Background()
+
+	hashed, _ := bcrypt.GenerateFromPassword([]byte("password"), bcrypt.DefaultCost)
+	authRepo.InsertUser(ctx, model.User{
+		Username: "username",
+		Password: string(hashed),
+		Role:     rbac.Applicant.String(),
+	})
+
+	app := auth.NewApp(authRepo, auth.DefaultPasswordPolicy(), notifier, throttle.New(throttle.Config{
+		FreeAttempts: 1,
+		BaseDelay:    time.Minute,
+		MaxDelay:     time.Hour,
+		Window:       time.Hour,
+	}), nil)
+
+	testCases := []struct {
+		expect int
+		name   string
+		input  auth.ForgotPasswordIn
+	}{
+		{
+			expect: http.StatusOK,
+			name:   "First request is free",
+			input:  auth.ForgotPasswordIn{Username: "username", Ip: "10.0.0.1"},
+		},
+		{
+			expect: http.StatusOK,
+			name:   "Second request start the backoff",
+			input:  auth.ForgotPasswordIn{Username: "username", Ip: "10.0.0.1"},
+		},
+		{
+			expect: http.StatusTooManyRequests,
+			name:   "Username is throttled from any address",
+			input:  auth.ForgotPasswordIn{Username: "username", Ip: "10.0.0.3"},
+		},
+		{
+			expect: http.StatusTooManyRequests,
+			name:   "Address is throttled for any username",
+			input:  auth.ForgotPasswordIn{Username: "nonexistusername", Ip: "10.0.0.1"},
+		},
+	}
+
+	for _, c := range testCases {
+		t.Run(c.name, func(t *testing.T) {
+			out := app.ForgotPassword(ctx, c.input)
+
+			if out.StatusCode != c.expect {
+				t.Fatalf("resulting: %d, expect: %d | err: %v", out.StatusCode, c.expect, out.Error)
+			}
+		})
+	}
+
+	// The reset request does not lock the user out of the login
+	if out := app.Login(ctx, auth.LoginIn{Username: "username", Password: "password", Ip: "10.0.0.1"}); out.StatusCode != http.StatusOK {
+		t.Fatalf("resulting: %d, expect: %d | err: %v", out.StatusCode, http.StatusOK, out.Error)
+	}
+
+	// And the login does not clear the reset request count
+	if out := app.ForgotPassword(ctx, auth.ForgotPasswordIn{Username: "username", Ip: "10.0.0.3"}); out.StatusCode != http.StatusTooManyRequests {
+		t.Fatalf("resulting: %d, expect: %d", out.StatusCode, http.StatusTooManyRequests)
+	}
+}
@@ -0,0 +1,94 @@
+package committee_test
+
+import (
+	"testing"
+
+	"github.com/fikryfahrezy/adea/los-postgre/committee"
+)
+
+func TestOutcome(t *testing.T) {
+	testCases := []struct {
+		expect   committee.Status
+		name     string
+		tally    committee.Tally
+		quorum   int
+		majority int
+	}{
+		{
+			expect:   committee.Approved,
+			name:     "Simple majority approve",
+			tally:    committee.Tally{Invited: 5, Approve: 2, Reject: 1},
+			quorum:   50,
+			majority: 50,
+		},
+		{
+			expect:   committee.Rejected,
+			name:     "Tie is rejected",
+			tally:    committee.Tally{Invited: 4, Approve: 2, Reject: 2},
+			quorum:   50,
+			majority: 50,
+		},
+		{
+			expect:   committee.Rejected,
+			name:     "Two third majority not reached",
+			tally:    committee.Tally{Invited: 3, Approve: 2, Reject: 1},
+			quorum:   50,
+			majority: 67,
+		},
+		{
+			expect:   committee.Approved,
+			name:     "Abstain count for the quorum only",
+			tally:    committee.Tally{Invited: 4, Approve: 1, Abstain: 2},
+			quorum:   75,
+			majority: 50,
+		},
+		{
+			expect:   committee.NoQuorum,
+			name:     "Too few member voted",
+			tally:    committee.Tally{Invited: 5, Approve: 2},
+			quorum:   50,
+			majority: 50,
+		},
+		{
+			expect:   committee.NoQuorum,
+			name:     "Every voter abstained",
+			tally:    committee.Tally{Invited: 2, Abstain: 2},
+			quorum:   50,
+			majority: 50,
+		},
+	}
+
+	for _, c := range testCases {
+		t.Run(c.name, func(t *testing.T) {
+			if res := c.tally.Outcome(c.quorum, c.majority); res != c.expect {
+				t.Fatalf("resulting: %v, expect: %v", res, c.expect)
+			}
+		})
+	}
+}
+
+func TestCount(t *testing.T) {
+	tally := committee.Count(4, []string{"approve", "", "reject", "abstain"})
+	expect := committee.Tally{Invited: 4, Approve: 1, Reject: 1, Abstain: 1}
+	if tally != expect {
+		t.Fatalf("resulting: %+v, expect: %+v", tally, expect)
+	}
+}
+
+func TestConfigFromEnv(t *testing.T) {
+	t.Setenv("COMMITTEE_QUORUM", "60")
+	t.Setenv("COMMITTEE_THRESHOLD", "100")
+
+	cfg, err := committee.ConfigFromEnv()
+	if err != nil {
+		t.Fatalf("resulting: %v, expect: %v", err, nil)
+	}
+	if cfg.Quorum != 60 || cfg.Majority != committee.DefaultConfig().Majority || !cfg.IsRequired(101) || cfg.IsRequired(100) {
+		t.Fatalf("resulting: %+v, expect: quorum 60 and threshold 100", cfg)
+	}
+
+	t.Setenv("COMMITTEE_MAJORITY", "100")
+	if _, err := committee.ConfigFromEnv(); err == nil {
+		t.Fatal("resulting: nil, expect: error")
+	}
+}
@@ -2,10 +2,112 @@ CREATE TABLE users (
 	id VARCHAR(200) PRIMARY KEY,
 	username VARCHAR(200) NOT NULL UNIQUE,
 	password VARCHAR(200) NOT NULL,
-	is_officer BOOLEAN DEFAULT false,
+	role VARCHAR(50) NOT NULL DEFAULT 'applicant',
+	display_name VARCHAR(200) NOT NULL DEFAULT '',
+	email VARCHAR(320) NOT NULL DEFAULT '',
+	phone VARCHAR(20) NOT NULL DEFAULT '',
+	created_date TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+	last_login_at TIMESTAMP,
+	deactivated_date TIMESTAMP,
+	INDEX users_created_date_idx (created_date DESC)
+);
+
+CREATE TABLE invitations (
+	id VARCHAR(200) PRIMARY KEY,
+	token_hash VARCHAR(200) NOT NULL UNIQUE,
+	role VARCHAR(50) NOT NULL,
+	invited_by VARCHAR(200) NOT NULL REFERENCES users(id),
+	user_id VARCHAR(200) REFERENCES users(id),
+	is_used BOOLEAN DEFAULT false,
+	created_date TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+	expired_date TIMESTAMP NOT NULL
+);
+
+CREATE TABLE password_resets (
+	id VARCHAR(200) PRIMARY KEY,
+	token_hash VARCHAR(200) NOT NULL UNIQUE,
+	user_id VARCHAR(200) NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+	is_used BOOLEAN DEFAULT false,
+	created_date TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+	expired_date TIMESTAMP NOT NULL,
+	INDEX password_resets_user_id_idx (user_id)
+);
+
+CREATE TABLE user_totps (
+	user_id VARCHAR(200) PRIMARY KEY REFERENCES users(id) ON DELETE CASCADE,
+	secret VARCHAR(200) NOT NULL,
+	is_enabled BOOLEAN DEFAULT false,
+	last_counter BIGINT DEFAULT 0,
 	created_date TIMESTAMP DEFAULT CURRENT_TIMESTAMP
 );
 
+CREATE TABLE recovery_codes (
+	id VARCHAR(200) PRIMARY KEY,
+	user_id VARCHAR(200) NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+	code_hash VARCHAR(200) NOT NULL,
+	is_used BOOLEAN DEFAULT false,
+	created_date TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+	INDEX recovery_codes_user_id_idx (user_id, code_hash)
+);
+
+CREATE TABLE login_challenges (
+	id VARCHAR(200) PRIMARY KEY,
+	token_hash VARCHAR(200) NOT NULL UNIQUE,
+	user_id VARCHAR(200) NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+	attempts SMALLINT DEFAULT 0,
+	is_used BOOLEAN DEFAULT false,
+	created_date TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+	expired_date TIMESTAMP NOT NULL,
+	INDEX login_challenges_user_id_idx (user_id)
+);
+
+CREATE TABLE login_activities (
+	id VARCHAR(200) PRIMARY KEY,
+	user_id VARCHAR(200) REFERENCES users(id) ON DELETE CASCADE,
+	username VARCHAR(200) NOT NULL,
+	is_success BOOLEAN DEFAULT false,
+	reason VARCHAR(50) DEFAULT '',
+	ip VARCHAR(100) DEFAULT '',
+	user_agent VARCHAR(500) DEFAULT '',
+	created_date TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+	INDEX login_activities_user_id_idx (user_id, created_date DESC),
+	INDEX login_activities_username_idx (username, created_date DESC),
+	INDEX login_activities_created_date_idx (created_date DESC)
+);
+
+CREATE TABLE api_keys (
+	id VARCHAR(200) PRIMARY KEY,
+	name VARCHAR(200) NOT NULL,
+	prefix VARCHAR(50) NOT NULL,
+	key_hash VARCHAR(200) NOT NULL UNIQUE,
+	user_id VARCHAR(200) NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+	scopes STRING[] NOT NULL,
+	is_revoked BOOLEAN DEFAULT false,
+	created_date TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+	expired_date TIMESTAMP,
+	last_used_date TIMESTAMP
+);
+
+CREATE TABLE user_identities (
+	id VARCHAR(200) PRIMARY KEY,
+	issuer VARCHAR(500) NOT NULL,
+	subject VARCHAR(255) NOT NULL,
+	user_id VARCHAR(200) NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+	created_date TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+	UNIQUE (issuer, subject),
+	INDEX user_identities_user_id_idx (user_id)
+);
+
+CREATE TABLE oidc_states (
+	id VARCHAR(200) PRIMARY KEY,
+	state_hash VARCHAR(200) NOT NULL UNIQUE,
+	nonce VARCHAR(200) NOT NULL,
+	code_verifier VARCHAR(200) NOT NULL,
+	is_used BOOLEAN DEFAULT false,
+	created_date TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+	expired_date TIMESTAMP NOT NULL
+);
+
 CREATE TABLE loan_applications (
 	id VARCHAR(200) PRIMARY KEY,
 	user_id VARCHAR(200) NOT NULL REFERENCES users(id),
@@ -17,6 +119,7 @@ CREATE TABLE loan_applications (
 	id_card_url VARCHAR(200) DEFAULT '',
 	other_business VARCHAR(200) DEFAULT '',
 	status VARCHAR(25) DEFAULT '',
+	region VARCHAR(100) DEFAULT '',
 	is_private_field BOOLEAN DEFAULT false,
 	exp_in_year SMALLINT DEFAULT 0,
 	active_field_number SMALLINT DEFAULT 0,
@@ -28,6 +131,98 @@ CREATE TABLE loan_applications (
 	loan_application_in_idr BIGINT DEFAULT 0,
 	business_income_per_month_in_idr BIGINT DEFAULT 0,
 	business_outcome_per_month_in_idr BIGINT DEFAULT 0,
+	decision_reasons STRING[] NOT NULL DEFAULT '{}',
+	decision_note VARCHAR(1000) DEFAULT '',
+	decision_internal_note VARCHAR(2000) DEFAULT '',
+	unlocked_fields STRING[] NOT NULL DEFAULT '{}',
+	info_request_note VARCHAR(500) DEFAULT '',
+	withdraw_reason VARCHAR(500) DEFAULT '',
+	credit_score JSONB NOT NULL DEFAULT '{}',
+	claimed_date TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
 	created_date TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+	updated_date TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+	deleted_date TIMESTAMP
+);
+
+CREATE TABLE officer_regions (
+	user_id VARCHAR(200) PRIMARY KEY REFERENCES users(id) ON DELETE CASCADE,
+	region VARCHAR(100) NOT NULL DEFAULT '',
 	updated_date TIMESTAMP DEFAULT CURRENT_TIMESTAMP
-);
\ No newline at end of file
+);
+
+CREATE TABLE loan_status_history (
+	id VARCHAR(200) PRIMARY KEY,
+	loan_id VARCHAR(200) NOT NULL REFERENCES loan_applications(id) ON DELETE CASCADE,
+	from_status VARCHAR(25) DEFAULT '',
+	to_status VARCHAR(25) NOT NULL,
+	actor_id VARCHAR(200) NOT NULL REFERENCES users(id),
+	actor_role VARCHAR(50) DEFAULT '',
+	comment VARCHAR(500) DEFAULT '',
+	created_date TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+	INDEX loan_status_history_loan_id_idx (loan_id, id)
+);
+
+CREATE TABLE loan_approval_signatures (
+	id VARCHAR(200) PRIMARY KEY,
+	loan_id VARCHAR(200) NOT NULL REFERENCES loan_applications(id) ON DELETE CASCADE,
+	approver_id VARCHAR(200) NOT NULL REFERENCES users(id),
+	approver_role VARCHAR(50) DEFAULT '',
+	note VARCHAR(1000) DEFAULT '',
+	review_id VARCHAR(200) NOT NULL DEFAULT '',
+	created_date TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+	INDEX loan_approval_signatures_loan_id_idx (loan_id, id),
+	UNIQUE INDEX loan_approval_signatures_approver_idx (loan_id, approver_id, review_id)
+);
+
+CREATE TABLE committee_votes (
+	id VARCHAR(200) PRIMARY KEY,
+	loan_id VARCHAR(200) NOT NULL REFERENCES loan_applications(id) ON DELETE CASCADE,
+	opened_by VARCHAR(200) NOT NULL REFERENCES users(id),
+	status VARCHAR(25) NOT NULL DEFAULT 'open',
+	note VARCHAR(1000) DEFAULT '',
+	quorum SMALLINT NOT NULL,
+	majority SMALLINT NOT NULL,
+	deadline_date TIMESTAMP NOT NULL,
+	created_date TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+	closed_date TIMESTAMP,
+	INDEX committee_votes_loan_id_idx (loan_id, id),
+	INDEX committee_votes_status_idx (status, deadline_date)
+);
+
+CREATE TABLE committee_ballots (
+	id VARCHAR(200) PRIMARY KEY,
+	vote_id VARCHAR(200) NOT NULL REFERENCES committee_votes(id) ON DELETE CASCADE,
+	officer_id VARCHAR(200) NOT NULL REFERENCES users(id),
+	choice VARCHAR(25) DEFAULT '',
+	comment VARCHAR(500) DEFAULT '',
+	created_date TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+	voted_date TIMESTAMP,
+	UNIQUE INDEX committee_ballots_vote_id_officer_id_idx (vote_id, officer_id)
+);
+
+CREATE TABLE sessions (
+	id VARCHAR(200) PRIMARY KEY,
+	key_hash VARCHAR(200) NOT NULL UNIQUE,
+	family_id VARCHAR(200) DEFAULT '',
+	user_id VARCHAR(200) NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+	role VARCHAR(50) DEFAULT '',
+	created_date TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+	expired_date TIMESTAMP NOT NULL,
+	INDEX sessions_user_id_idx (user_id),
+	INDEX sessions_family_id_idx (family_id),
+	INDEX sessions_expired_date_idx (expired_date)
+);
+
+CREATE TABLE refresh_tokens (
+	id VARCHAR(200) PRIMARY KEY,
+	key_hash VARCHAR(200) NOT NULL UNIQUE,
+	family_id VARCHAR(200) NOT NULL,
+	user_id VARCHAR(200) NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+	role VARCHAR(50) DEFAULT '',
+	is_used BOOLEAN DEFAULT false,
+	created_date TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+	expired_date TIMESTAMP NOT NULL,
+	INDEX refresh_tokens_user_id_idx (user_id),
+	INDEX refresh_tokens_family_id_idx (family_id),
+	INDEX refresh_tokens_expired_date_idx (expired_date)
+);
@@ -0,0 +1,16 @@
+-- Run once on the database created before the role based access control,
+-- the officer flag of the user become its role and the old session is ended
+ALTER TABLE users ADD COLUMN IF NOT EXISTS role VARCHAR(50) NOT NULL DEFAULT 'applicant';
+
+UPDATE users SET role = 'field_officer' WHERE is_officer;
+
+ALTER TABLE users DROP COLUMN is_officer;
+
+DELETE FROM refresh_tokens WHERE true;
+DELETE FROM sessions WHERE true;
+
+ALTER TABLE sessions ADD COLUMN IF NOT EXISTS role VARCHAR(50) DEFAULT '';
+ALTER TABLE sessions DROP COLUMN IF EXISTS is_private;
+
+ALTER TABLE refresh_tokens ADD COLUMN IF NOT EXISTS role VARCHAR(50) DEFAULT '';
+ALTER TABLE refresh_tokens DROP COLUMN IF EXISTS is_private;
@@ -0,0 +1,91 @@
+package id_test
+
+import (
+	"regexp"
+	"sort"
+	"testing"
+	"time"
+
+	"github.com/fikryfahrezy/adea/los-postgre/id"
+)
+
+func TestNewGenerator(t *testing.T) {
+	testCases := []struct {
+		expect  *regexp.Regexp
+		name    string
+		kind    string
+		wantErr bool
+	}{
+		{
+			expect: regexp.MustCompile(`^[0-9A-HJKMNP-TV-Z]{26}$`),
+			name:   "Default to ulid",
+			kind:   "",
+		},
+		{
+			expect: regexp.MustCompile(`^[0-9A-HJKMNP-TV-Z]{26}$`),
+			name:   "Ulid",
+			kind:   "ulid",
+		},
+		{
+			expect: regexp.MustCompile(`^[0-9a-f]{8}-[0-9a-f]{4}-7[0-9a-f]{3}-[89ab][0-9a-f]{3}-[0-9a-f]{12}$`),
+			name:   "Uuid version 7",
+			kind:   "uuidv7",
+		},
+		{
+			name:    "Unknown generator",
+			kind:    "snowflake",
+			wantErr: true,
+		},
+	}
+
+	for _, c := range testCases {
+		t.Run(c.name, func(t *testing.T) {
+			g, err := id.NewGenerator(c.kind)
+			if (err != nil) != c.wantErr {
+				t.Fatalf("resulting: %v, expect error: %t", err, c.wantErr)
+			}
+			if c.wantErr {
+				return
+			}
+
+			v, err := g.New()
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !c.expect.MatchString(v) {
+				t.Fatalf("resulting: %s, expect to match: %s", v, c.expect)
+			}
+		})
+	}
+}
+
+func TestGeneratorSorted(t *testing.T) {
+	for _, kind := range []string{"ulid", "uuidv7"} {
+		t.Run(kind, func(t *testing.T) {
+			g, _ := id.NewGenerator(kind)
+
+			ids := make([]string, 0, 100)
+			seen := make(map[string]bool)
+			for i := 0; i < 100; i++ {
+				v, err := g.New()
+				if err != nil {
+					t.Fatal(err)
+				}
+				if seen[v] {
+					t.Fatalf("resulting: %s twice, expect: unique id", v)
+				}
+				seen[v] = true
+				ids = append(ids, v)
+
+				// UUIDv7 is only sorted across millisecond
+				if kind == "uuidv7" {
+					time.Sleep(time.Millisecond)
+				}
+			}
+
+			if !sort.StringsAreSorted(ids) {
+				t.Fatalf("resulting: %v, expect: sorted by creation", ids)
+			}
+		})
+	}
+}
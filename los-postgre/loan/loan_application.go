@@ -1,17 +1,28 @@
 package loan
 
-import "io"
+import (
+	"io"
+
+	"github.com/fikryfahrezy/adea/los-postgre/committee"
+	"github.com/fikryfahrezy/adea/los-postgre/queue"
+)
 
 type FileSaveFunc func(filename string, r io.Reader) (string, error)
 
 type LoanApp struct {
 	saveFile   FileSaveFunc
 	repository *Repository
+	queue      *queue.Queue
+	approval   ApprovalPolicy
+	committee  committee.Config
 }
 
-func NewApp(fileSaveFunc FileSaveFunc, repository *Repository) *LoanApp {
+func NewApp(fileSaveFunc FileSaveFunc, repository *Repository, loanQueue *queue.Queue, approval ApprovalPolicy, committeeCfg committee.Config) *LoanApp {
 	return &LoanApp{
 		saveFile:   fileSaveFunc,
 		repository: repository,
+		queue:      loanQueue,
+		approval:   approval,
+		committee:  committeeCfg,
 	}
 }
@@ -0,0 +1,172 @@
+package loan
+
+import (
+	"errors"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/fikryfahrezy/adea/los-postgre/model"
+	"github.com/fikryfahrezy/adea/los-postgre/rbac"
+)
+
+var ErrApprovalTierNotValid = errors.New("invalid APPROVAL_TIERS, expect comma separated above_in_idr:approvals")
+
+// ApprovalTier ask for Approvals signatures on the loan above AboveInIdr
+type ApprovalTier struct {
+	AboveInIdr int64
+	Approvals  int
+}
+
+// ApprovalPolicy decide how many approvers sign the loan before it is approved,
+// the loan below every tier only need one
+type ApprovalPolicy struct {
+	Tiers []ApprovalTier
+}
+
+func DefaultApprovalPolicy() ApprovalPolicy {
+	return ApprovalPolicy{
+		Tiers: []ApprovalTier{
+			{AboveInIdr: 50_000_000, Approvals: 2},
+		},
+	}
+}
+
+// ApprovalPolicyFromEnv read APPROVAL_TIERS like `50000000:2,200000000:3`,
+// the default policy is used when the env is empty and `none` ask one approver for every loan
+func ApprovalPolicyFromEnv() (ApprovalPolicy, error) {
+	s := strings.TrimSpace(os.Getenv("APPROVAL_TIERS"))
+	if s == "" {
+		return DefaultApprovalPolicy(), nil
+	}
+	if s == "none" {
+		return ApprovalPolicy{}, nil
+	}
+
+	policy := ApprovalPolicy{}
+	for _, v := range strings.Split(s, ",") {
+		above, approvals, ok := strings.Cut(strings.TrimSpace(v), ":")
+		if !ok {
+			return ApprovalPolicy{}, ErrApprovalTierNotValid
+		}
+
+		tier := ApprovalTier{}
+		var err error
+		if tier.AboveInIdr, err = strconv.ParseInt(above, 10, 64); err != nil || tier.AboveInIdr < 0 {
+			return ApprovalPolicy{}, ErrApprovalTierNotValid
+		}
+		if tier.Approvals, err = strconv.Atoi(approvals); err != nil || tier.Approvals < 1 {
+			return ApprovalPolicy{}, ErrApprovalTierNotValid
+		}
+
+		policy.Tiers = append(policy.Tiers, tier)
+	}
+
+	return policy, nil
+}
+
+// Required return how many signatures the loan of the amount need, the highest tier it is above win
+func (p ApprovalPolicy) Required(amountInIdr int64) int {
+	required := 1
+	for _, t := range p.Tiers {
+		if amountInIdr > t.AboveInIdr && t.Approvals > required {
+			required = t.Approvals
+		}
+	}
+
+	return required
+}
+
+// isApproved tell whether the signatures are enough for the loan, a single signature
+// of the role that approve any amount is always enough
+func (p ApprovalPolicy) isApproved(userLoan model.LoanApplication, signatures []model.ApprovalSignature) bool {
+	for _, s := range signatures {
+		if rbac.Can(s.ApproverRole, rbac.LoanApproveAll) {
+			return true
+		}
+	}
+
+	approvers := make(map[string]bool, len(signatures))
+	for _, s := range signatures {
+		approvers[s.ApproverId] = true
+	}
+
+	return len(approvers) >= p.Required(userLoan.LoanApplicationInIdr)
+}
+
+// reviewersOf list every officer that took the loan in review, they can not decide on it
+func reviewersOf(histories []model.LoanStatusHistory) map[string]bool {
+	reviewers := make(map[string]bool)
+	for _, h := range histories {
+		if h.FromStatus == Submitted.String() && h.ToStatus == InReview.String() {
+			reviewers[h.ActorId] = true
+		}
+	}
+
+	return reviewers
+}
+
+// currentSignatures keep the signatures given since the loan last went in review,
+// the one given before the applicant changed the loan does not count anymore
+func currentSignatures(signatures []model.ApprovalSignature, histories []model.LoanStatusHistory) []model.ApprovalSignature {
+	var since time.Time
+	for _, h := range histories {
+		if h.ToStatus == InReview.String() {
+			since = h.CreatedDate
+		}
+	}
+
+	res := make([]model.ApprovalSignature, 0, len(signatures))
+	for _, s := range signatures {
+		if !s.CreatedDate.Before(since) {
+			res = append(res, s)
+		}
+	}
+
+	return res
+}
+
+// lastReviewId return the id of the history that last put the loan in review,
+// an approver sign the loan once in every review
+func lastReviewId(histories []model.LoanStatusHistory) string {
+	var id string
+	for _, h := range histories {
+		if h.ToStatus == InReview.String() {
+			id = h.Id
+		}
+	}
+
+	return id
+}
+
+func hasSigned(signatures []model.ApprovalSignature, userId string) bool {
+	for _, s := range signatures {
+		if s.ApproverId == userId {
+			return true
+		}
+	}
+
+	return false
+}
+
+type ApprovalRes struct {
+	ApproverId   string `json:"approver_id"`
+	ApproverRole string `json:"approver_role"`
+	Note         string `json:"note"`
+	CreatedDate  string `json:"created_date"`
+}
+
+func approvalsRes(signatures []model.ApprovalSignature) []ApprovalRes {
+	res := make([]ApprovalRes, 0, len(signatures))
+	for _, s := range signatures {
+		res = append(res, ApprovalRes{
+			ApproverId:   s.ApproverId,
+			ApproverRole: s.ApproverRole,
+			Note:         s.Note,
+			CreatedDate:  s.CreatedDate.Format(time.RFC3339),
+		})
+	}
+
+	return res
+}
@@ -0,0 +1,99 @@
+package loan
+
+import (
+	"errors"
+	"strings"
+
+	"github.com/fikryfahrezy/adea/los-postgre/model"
+)
+
+// Reason is the structured reason of the approval or rejection, its description
+// is written for the applicant so it can be shown as is
+type Reason struct {
+	slug        string
+	description string
+	forApprove  bool
+	forReject   bool
+}
+
+func (r Reason) String() string {
+	return r.slug
+}
+
+func (r Reason) Description() string {
+	return r.description
+}
+
+var (
+	ReasonCriteriaMet            = Reason{"criteria_met", "The application meets the lending criteria", true, false}
+	ReasonRepaymentCapacity      = Reason{"repayment_capacity", "The business income is enough to repay the loan", true, false}
+	ReasonIncomeInsufficient     = Reason{"income_insufficient", "The business income is not enough to repay the loan", false, true}
+	ReasonAmountTooHigh          = Reason{"amount_too_high", "The requested amount is too high for the size of the business", false, true}
+	ReasonDocumentIncomplete     = Reason{"document_incomplete", "A required document is missing or can not be read", false, true}
+	ReasonIdentityNotVerified    = Reason{"identity_not_verified", "The identity of the applicant can not be verified", false, true}
+	ReasonExperienceInsufficient = Reason{"experience_insufficient", "The farming experience is below the requirement", false, true}
+	ReasonOutsidePolicy          = Reason{"outside_policy", "The application is outside of the lending policy", false, true}
+	// ReasonOther must come with the note that explain it
+	ReasonOther = Reason{"other", "See the note of the decision", true, true}
+)
+
+var reasons = []Reason{
+	ReasonCriteriaMet,
+	ReasonRepaymentCapacity,
+	ReasonIncomeInsufficient,
+	ReasonAmountTooHigh,
+	ReasonDocumentIncomplete,
+	ReasonIdentityNotVerified,
+	ReasonExperienceInsufficient,
+	ReasonOutsidePolicy,
+	ReasonOther,
+}
+
+func ReasonFromString(s string) (Reason, error) {
+	for _, r := range reasons {
+		if r.slug == s {
+			return r, nil
+		}
+	}
+
+	return Reason{}, errors.New("unknown reason: " + s)
+}
+
+// DecisionIn is the reason of the approve and reject action, the ReasonCodes and the Note
+// are shown to the applicant while the InternalNote is only shown to the officers
+type DecisionIn struct {
+	ReasonCodes  []string `json:"reason_codes"`
+	Note         string   `json:"note"`
+	InternalNote string   `json:"internal_note"`
+}
+
+type DecisionReasonRes struct {
+	Code        string `json:"code"`
+	Description string `json:"description"`
+}
+
+func decisionReasonsRes(codes []string) []DecisionReasonRes {
+	res := make([]DecisionReasonRes, 0, len(codes))
+	for _, v := range codes {
+		r, err := ReasonFromString(v)
+		if err != nil {
+			continue
+		}
+
+		res = append(res, DecisionReasonRes{
+			Code:        r.slug,
+			Description: r.description,
+		})
+	}
+
+	return res
+}
+
+// applyDecision keep the decision on the loan, the reason given twice is only kept once
+func applyDecision(userLoan model.LoanApplication, in DecisionIn) model.LoanApplication {
+	userLoan.DecisionReasons = uniqueStrings(in.ReasonCodes)
+	userLoan.DecisionNote = strings.TrimSpace(in.Note)
+	userLoan.DecisionInternalNote = strings.TrimSpace(in.InternalNote)
+
+	return userLoan
+}
@@ -2,71 +2,51 @@ package loan
 
 import (
 	"context"
-	"encoding/hex"
+	"database/sql"
 	"errors"
-	"fmt"
-	"math/rand"
 	"time"
 
 	"github.com/cockroachdb/cockroach-go/v2/crdb/crdbpgx"
+	"github.com/fikryfahrezy/adea/los-postgre/committee"
+	"github.com/fikryfahrezy/adea/los-postgre/id"
 	"github.com/fikryfahrezy/adea/los-postgre/model"
+	"github.com/fikryfahrezy/adea/los-postgre/queue"
 	"github.com/jackc/pgx/v4"
+	"github.com/jackc/pgx/v4/pgxpool"
 )
 
-type Status struct {
-	slug string
-}
-
-func (r Status) String() string {
-	return r.slug
-}
-
-var (
-	Unknown = Status{""}
-	Wait    = Status{"wait"}
-	Process = Status{"process"}
-	Reject  = Status{"reject"}
-	Approve = Status{"approve"}
-)
-
-func FromString(s string) (Status, error) {
-	switch s {
-	case Wait.slug:
-		return Wait, nil
-	case Process.slug:
-		return Process, nil
-	case Reject.slug:
-		return Reject, nil
-	case Approve.slug:
-		return Approve, nil
-	}
-
-	return Unknown, errors.New("unknown status: " + s)
-}
-
 var (
-	ErrUserNotFound     = errors.New("user not found")
-	ErrUserLoanNotFound = errors.New("user loan not found")
+	ErrUserNotFound      = errors.New("user not found")
+	ErrUserLoanNotFound  = errors.New("user loan not found")
+	ErrLoanStatusChanged = errors.New("loan status changed by someone else, reload the loan")
+	ErrVoteNotFound      = errors.New("committee vote not found")
+	ErrVoteOpen          = errors.New("a committee vote is still open on the loan")
+	ErrVoteClosed        = errors.New("committee vote already closed")
+	ErrNotVoteMember     = errors.New("user not invited to the committee vote")
+	ErrAlreadyVoted      = errors.New("user already voted")
 )
 
 type Repository struct {
-	db *pgx.Conn
+	db  *pgxpool.Pool
+	ids id.Generator
 }
 
-func NewRepository(db *pgx.Conn) *Repository {
+func NewRepository(db *pgxpool.Pool, ids id.Generator) *Repository {
 	return &Repository{
-		db: db,
+		db:  db,
+		ids: ids,
 	}
 }
 
 func (r *Repository) GetUser(ctx context.Context, userId string) (model.User, error) {
 	var user model.User
+	var deactivatedDate sql.NullTime
 	err := crdbpgx.ExecuteTx(context.Background(), r.db, pgx.TxOptions{}, func(tx pgx.Tx) error {
 		return tx.QueryRow(ctx,
-			`SELECT id, username, password, is_officer, created_date
+			`SELECT id, username, password, role, created_date, deactivated_date
 		FROM users WHERE id = $1`,
 			userId,
-		).Scan(&user.Id, &user.Username, &user.Password, &user.IsOfficer, &user.CreatedDate)
+		).Scan(&user.Id, &user.Username, &user.Password, &user.Role, &user.CreatedDate, &deactivatedDate)
 	})
 	if errors.Is(err, pgx.ErrNoRows) {
 		return model.User{}, ErrUserNotFound
@@ -75,143 +55,128 @@ func (r *Repository) GetUser(ctx context.Context, userId string) (model.User, er
 		return model.User{}, err
 	}
 
+	user.DeactivatedDate = deactivatedDate.Time
+
 	return user, nil
 }
 
-func (r *Repository) GetUserLoans(ctx context.Context, userId string) ([]model.LoanApplication, error) {
-	var userLoans []model.LoanApplication
+const loanColumns = `id,
+	user_id,
+	officer_id,
+	full_name,
+	birth_date,
+	full_address,
+	phone,
+	id_card_url,
+	other_business,
+	status,
+	region,
+	is_private_field,
+	exp_in_year,
+	active_field_number,
+	sow_seeds_per_cycle,
+	needed_fertilizier_per_cycle_in_kg,
+	estimated_yield_in_kg,
+	estimated_price_of_harvest_per_kg,
+	harvest_cycle_in_months,
+	loan_application_in_idr,
+	business_income_per_month_in_idr,
+	business_outcome_per_month_in_idr,
+	decision_reasons,
+	decision_note,
+	decision_internal_note,
+	unlocked_fields,
+	info_request_note,
+	withdraw_reason,
+	credit_score,
+	claimed_date,
+	created_date,
+	updated_date,
+	deleted_date`
+
+func scanLoan(row pgx.Row) (model.LoanApplication, error) {
+	var loan model.LoanApplication
+	if err := row.Scan(
+		&loan.Id,
+		&loan.UserId,
+		&loan.OfficerId,
+		&loan.FullName,
+		&loan.BirthDate,
+		&loan.FullAddress,
+		&loan.Phone,
+		&loan.IdCardUrl,
+		&loan.OtherBusiness,
+		&loan.Status,
+		&loan.Region,
+		&loan.IsPrivateField,
+		&loan.ExpInYear,
+		&loan.ActiveFieldNumber,
+		&loan.SowSeedsPerCycle,
+		&loan.NeededFertilizerPerCycleInKg,
+		&loan.EstimatedYieldInKg,
+		&loan.EstimatedPriceOfHarvestPerKg,
+		&loan.HarvestCycleInMonths,
+		&loan.LoanApplicationInIdr,
+		&loan.BusinessIncomePerMonthInIdr,
+		&loan.BusinessOutcomePerMonthInIdr,
+		&loan.DecisionReasons,
+		&loan.DecisionNote,
+		&loan.DecisionInternalNote,
+		&loan.UnlockedFields,
+		&loan.InfoRequestNote,
+		&loan.WithdrawReason,
+		&loan.CreditScore,
+		&loan.ClaimedDate,
+		&loan.CreatedDate,
+		&loan.UpdatedDate,
+		&loan.DeletedDate,
+	); err != nil {
+		return model.LoanApplication{}, err
+	}
+
+	return loan, nil
+}
+
+func (r *Repository) getLoans(ctx context.Context, where string, args ...interface{}) ([]model.LoanApplication, error) {
+	var loans []model.LoanApplication
 	err := crdbpgx.ExecuteTx(context.Background(), r.db, pgx.TxOptions{}, func(tx pgx.Tx) error {
+		loans = loans[:0]
+
 		rows, err := tx.Query(ctx,
-			`SELECT 
-				id,
-				user_id,
-				officer_id,
-				full_name,
-				birth_date,
-				full_address,
-				phone,
-				id_card_url,
-				other_business,
-				status,
-				is_private_field,
-				exp_in_year,
-				active_field_number,
-				sow_seeds_per_cycle,
-				needed_fertilizier_per_cycle_in_kg,
-				estimated_yield_in_kg,
-				estimated_price_of_harvest_per_kg,
-				harvest_cycle_in_months,
-				loan_application_in_idr,
-				business_income_per_month_in_idr,
-				business_outcome_per_month_in_idr,
-				created_date,
-				updated_date
-			FROM loan_applications
-			WHERE user_id = $1`,
-			userId,
+			`SELECT `+loanColumns+` FROM loan_applications `+where,
+			args...,
 		)
 		if err != nil {
 			return err
 		}
+		defer rows.Close()
 
 		for rows.Next() {
-			var userLoan model.LoanApplication
-			if err := rows.Scan(
-				&userLoan.Id,
-				&userLoan.UserId,
-				&userLoan.OfficerId,
-				&userLoan.FullName,
-				&userLoan.BirthDate,
-				&userLoan.FullAddress,
-				&userLoan.Phone,
-				&userLoan.IdCardUrl,
-				&userLoan.OtherBusiness,
-				&userLoan.Status,
-				&userLoan.IsPrivateField,
-				&userLoan.ExpInYear,
-				&userLoan.ActiveFieldNumber,
-				&userLoan.SowSeedsPerCycle,
-				&userLoan.NeededFertilizerPerCycleInKg,
-				&userLoan.EstimatedYieldInKg,
-				&userLoan.EstimatedPriceOfHarvestPerKg,
-				&userLoan.HarvestCycleInMonths,
-				&userLoan.LoanApplicationInIdr,
-				&userLoan.BusinessIncomePerMonthInIdr,
-				&userLoan.BusinessOutcomePerMonthInIdr,
-				&userLoan.CreatedDate,
-				&userLoan.UpdatedDate,
-			); err != nil {
+			loan, err := scanLoan(rows)
+			if err != nil {
 				return err
 			}
-			userLoans = append(userLoans, userLoan)
+			loans = append(loans, loan)
 		}
 
-		return nil
+		return rows.Err()
 	})
 	if err != nil {
 		return []model.LoanApplication{}, err
 	}
 
-	return userLoans, nil
+	return loans, nil
 }
 
-func (r *Repository) GetUserLoan(ctx context.Context, loanId, userId string) (model.LoanApplication, error) {
-	var userLoan model.LoanApplication
+func (r *Repository) getLoan(ctx context.Context, where string, args ...interface{}) (model.LoanApplication, error) {
+	var loan model.LoanApplication
 	err := crdbpgx.ExecuteTx(context.Background(), r.db, pgx.TxOptions{}, func(tx pgx.Tx) error {
-		return tx.QueryRow(ctx,
-			`SELECT 
-				id,
-				user_id,
-				officer_id,
-				full_name,
-				birth_date,
-				full_address,
-				phone,
-				id_card_url,
-				other_business,
-				status,
-				is_private_field,
-				exp_in_year,
-				active_field_number,
-				sow_seeds_per_cycle,
-				needed_fertilizier_per_cycle_in_kg,
-				estimated_yield_in_kg,
-				estimated_price_of_harvest_per_kg,
-				harvest_cycle_in_months,
-				loan_application_in_idr,
-				business_income_per_month_in_idr,
-				business_outcome_per_month_in_idr,
-				created_date,
-				updated_date
-			FROM loan_applications
-			WHERE id = $1 AND user_id = $2`,
-			loanId,
-			userId,
-		).Scan(
-			&userLoan.Id,
-			&userLoan.UserId,
-			&userLoan.OfficerId,
-			&userLoan.FullName,
-			&userLoan.BirthDate,
-			&userLoan.FullAddress,
-			&userLoan.Phone,
-			&userLoan.IdCardUrl,
-			&userLoan.OtherBusiness,
-			&userLoan.Status,
-			&userLoan.IsPrivateField,
-			&userLoan.ExpInYear,
-			&userLoan.ActiveFieldNumber,
-			&userLoan.SowSeedsPerCycle,
-			&userLoan.NeededFertilizerPerCycleInKg,
-			&userLoan.EstimatedYieldInKg,
-			&userLoan.EstimatedPriceOfHarvestPerKg,
-			&userLoan.HarvestCycleInMonths,
-			&userLoan.LoanApplicationInIdr,
-			&userLoan.BusinessIncomePerMonthInIdr,
-			&userLoan.BusinessOutcomePerMonthInIdr,
-			&userLoan.CreatedDate,
-			&userLoan.UpdatedDate,
-		)
+		var err error
+		loan, err = scanLoan(tx.QueryRow(ctx,
+			`SELECT `+loanColumns+` FROM loan_applications `+where,
+			args...,
+		))
+		return err
 	})
 	if errors.Is(err, pgx.ErrNoRows) {
 		return model.LoanApplication{}, ErrUserLoanNotFound
@@ -220,167 +185,50 @@ func (r *Repository) GetUserLoan(ctx context.Context, loanId, userId string) (mo
 		return model.LoanApplication{}, err
 	}
 
-	return userLoan, nil
+	return loan, nil
 }
 
-func (r *Repository) GetLoans(ctx context.Context) ([]model.LoanApplication, error) {
-	var loans []model.LoanApplication
-	err := crdbpgx.ExecuteTx(context.Background(), r.db, pgx.TxOptions{}, func(tx pgx.Tx) error {
-		rows, err := tx.Query(ctx,
-			`SELECT 
-				id,
-				user_id,
-				officer_id,
-				full_name,
-				birth_date,
-				full_address,
-				phone,
-				id_card_url,
-				other_business,
-				status,
-				is_private_field,
-				exp_in_year,
-				active_field_number,
-				sow_seeds_per_cycle,
-				needed_fertilizier_per_cycle_in_kg,
-				estimated_yield_in_kg,
-				estimated_price_of_harvest_per_kg,
-				harvest_cycle_in_months,
-				loan_application_in_idr,
-				business_income_per_month_in_idr,
-				business_outcome_per_month_in_idr,
-				created_date,
-				updated_date
-			FROM loan_applications`,
-		)
-		if err != nil {
-			return err
-		}
+func (r *Repository) GetUserLoans(ctx context.Context, userId string) ([]model.LoanApplication, error) {
+	return r.getLoans(ctx, `WHERE user_id = $1 AND deleted_date IS NULL`, userId)
+}
 
-		for rows.Next() {
-			var userLoan model.LoanApplication
-			if err := rows.Scan(
-				&userLoan.Id,
-				&userLoan.UserId,
-				&userLoan.OfficerId,
-				&userLoan.FullName,
-				&userLoan.BirthDate,
-				&userLoan.FullAddress,
-				&userLoan.Phone,
-				&userLoan.IdCardUrl,
-				&userLoan.OtherBusiness,
-				&userLoan.Status,
-				&userLoan.IsPrivateField,
-				&userLoan.ExpInYear,
-				&userLoan.ActiveFieldNumber,
-				&userLoan.SowSeedsPerCycle,
-				&userLoan.NeededFertilizerPerCycleInKg,
-				&userLoan.EstimatedYieldInKg,
-				&userLoan.EstimatedPriceOfHarvestPerKg,
-				&userLoan.HarvestCycleInMonths,
-				&userLoan.LoanApplicationInIdr,
-				&userLoan.BusinessIncomePerMonthInIdr,
-				&userLoan.BusinessOutcomePerMonthInIdr,
-				&userLoan.CreatedDate,
-				&userLoan.UpdatedDate,
-			); err != nil {
-				return err
-			}
-			loans = append(loans, userLoan)
-		}
+func (r *Repository) GetUserLoan(ctx context.Context, loanId, userId string) (model.LoanApplication, error) {
+	return r.getLoan(ctx, `WHERE id = $1 AND user_id = $2 AND deleted_date IS NULL`, loanId, userId)
+}
 
-		return nil
-	})
-	if err != nil {
-		return []model.LoanApplication{}, err
-	}
+func (r *Repository) GetLoans(ctx context.Context) ([]model.LoanApplication, error) {
+	return r.getLoans(ctx, `WHERE deleted_date IS NULL`)
+}
 
-	return loans, nil
+// GetDeletedLoans return the loan deleted by the applicant or archived by the officer
+func (r *Repository) GetDeletedLoans(ctx context.Context) ([]model.LoanApplication, error) {
+	return r.getLoans(ctx, `WHERE deleted_date IS NOT NULL`)
 }
 
 func (r *Repository) GetLoan(ctx context.Context, loanId string) (model.LoanApplication, error) {
-	var userLoan model.LoanApplication
-	err := crdbpgx.ExecuteTx(context.Background(), r.db, pgx.TxOptions{}, func(tx pgx.Tx) error {
-		return tx.QueryRow(ctx,
-			`SELECT 
-				id,
-				user_id,
-				officer_id,
-				full_name,
-				birth_date,
-				full_address,
-				phone,
-				id_card_url,
-				other_business,
-				status,
-				is_private_field,
-				exp_in_year,
-				active_field_number,
-				sow_seeds_per_cycle,
-				needed_fertilizier_per_cycle_in_kg,
-				estimated_yield_in_kg,
-				estimated_price_of_harvest_per_kg,
-				harvest_cycle_in_months,
-				loan_application_in_idr,
-				business_income_per_month_in_idr,
-				business_outcome_per_month_in_idr,
-				created_date,
-				updated_date
-			FROM loan_applications
-			WHERE id = $1`,
-			loanId,
-		).Scan(
-			&userLoan.Id,
-			&userLoan.UserId,
-			&userLoan.OfficerId,
-			&userLoan.FullName,
-			&userLoan.BirthDate,
-			&userLoan.FullAddress,
-			&userLoan.Phone,
-			&userLoan.IdCardUrl,
-			&userLoan.OtherBusiness,
-			&userLoan.Status,
-			&userLoan.IsPrivateField,
-			&userLoan.ExpInYear,
-			&userLoan.ActiveFieldNumber,
-			&userLoan.SowSeedsPerCycle,
-			&userLoan.NeededFertilizerPerCycleInKg,
-			&userLoan.EstimatedYieldInKg,
-			&userLoan.EstimatedPriceOfHarvestPerKg,
-			&userLoan.HarvestCycleInMonths,
-			&userLoan.LoanApplicationInIdr,
-			&userLoan.BusinessIncomePerMonthInIdr,
-			&userLoan.BusinessOutcomePerMonthInIdr,
-			&userLoan.CreatedDate,
-			&userLoan.UpdatedDate,
-		)
-	})
-	if errors.Is(err, pgx.ErrNoRows) {
-		return model.LoanApplication{}, ErrUserLoanNotFound
-	}
+	return r.getLoan(ctx, `WHERE id = $1 AND deleted_date IS NULL`, loanId)
+}
+
+func (r *Repository) InsertLoan(ctx context.Context, loan model.LoanApplication) (model.LoanApplication, error) {
+	loanId, err := r.ids.New()
 	if err != nil {
 		return model.LoanApplication{}, err
 	}
 
-	return userLoan, nil
-}
-
-func (r *Repository) InsertLoan(ctx context.Context, loan model.LoanApplication) (model.LoanApplication, error) {
 	t := time.Now()
-	tn := t.UnixNano()
-	ra := rand.New(rand.NewSource(tn))
-	id := hex.EncodeToString([]byte(fmt.Sprintf("%d-%d", tn, ra)))
-
-	loan.Id = id
+	loan.Id = loanId
 	loan.CreatedDate = t
 	loan.UpdatedDate = t
-	loan.Status = Wait.String()
+	if loan.Status == "" {
+		loan.Status = Submitted.String()
+	}
 
-	err := crdbpgx.ExecuteTx(context.Background(), r.db, pgx.TxOptions{}, func(tx pgx.Tx) error {
+	err = crdbpgx.ExecuteTx(context.Background(), r.db, pgx.TxOptions{}, func(tx pgx.Tx) error {
 		if _, err := tx.Exec(ctx,
 			`INSERT INTO loan_applications (
 				id,
 				user_id,
+				officer_id,
 				full_name,
 				birth_date,
 				full_address,
@@ -388,6 +236,7 @@ func (r *Repository) InsertLoan(ctx context.Context, loan model.LoanApplication)
 				id_card_url,
 				other_business,
 				status,
+				region,
 				is_private_field,
 				exp_in_year,
 				active_field_number,
@@ -399,12 +248,15 @@ func (r *Repository) InsertLoan(ctx context.Context, loan model.LoanApplication)
 				loan_application_in_idr,
 				business_income_per_month_in_idr,
 				business_outcome_per_month_in_idr,
+				credit_score,
+				claimed_date,
 				created_date,
 				updated_date
 			)
-			VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12, $13, $14, $15, $16, $17, $18, $19, $20, $21, $22)`,
+			VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12, $13, $14, $15, $16, $17, $18, $19, $20, $21, $22, $23, $24, $25, $26)`,
 			loan.Id,
 			loan.UserId,
+			loan.OfficerId,
 			loan.FullName,
 			loan.BirthDate,
 			loan.FullAddress,
@@ -412,6 +264,7 @@ func (r *Repository) InsertLoan(ctx context.Context, loan model.LoanApplication)
 			loan.IdCardUrl,
 			loan.OtherBusiness,
 			loan.Status,
+			loan.Region,
 			loan.IsPrivateField,
 			loan.ExpInYear,
 			loan.ActiveFieldNumber,
@@ -423,6 +276,8 @@ func (r *Repository) InsertLoan(ctx context.Context, loan model.LoanApplication)
 			loan.LoanApplicationInIdr,
 			loan.BusinessIncomePerMonthInIdr,
 			loan.BusinessOutcomePerMonthInIdr,
+			loan.CreditScore,
+			loan.ClaimedDate,
 			loan.CreatedDate,
 			loan.UpdatedDate,
 		); err != nil {
@@ -437,14 +292,79 @@ func (r *Repository) InsertLoan(ctx context.Context, loan model.LoanApplication)
 	return loan, nil
 }
 
+// RemoveLoan only mark the loan as deleted, the loan and its history are kept for the record
 func (r *Repository) RemoveLoan(ctx context.Context, loanId string) error {
+	return r.execLoan(ctx,
+		`UPDATE loan_applications SET deleted_date = $2 WHERE id = $1 AND deleted_date IS NULL`,
+		loanId, time.Now(),
+	)
+}
+
+// RestoreLoan bring back the deleted loan to the listing, the open loan is not restored
+// when its applicant already has another open loan
+func (r *Repository) RestoreLoan(ctx context.Context, loanId string) error {
 	err := crdbpgx.ExecuteTx(context.Background(), r.db, pgx.TxOptions{}, func(tx pgx.Tx) error {
-		if _, err := tx.Exec(ctx,
-			`DELETE FROM loan_applications WHERE id = $1`,
+		var userId, s string
+		err := tx.QueryRow(ctx,
+			`SELECT user_id, status FROM loan_applications WHERE id = $1 AND deleted_date IS NOT NULL`,
 			loanId,
-		); err != nil {
+		).Scan(&userId, &s)
+		if errors.Is(err, pgx.ErrNoRows) {
+			return ErrUserLoanNotFound
+		}
+		if err != nil {
+			return err
+		}
+
+		// The legacy status is mapped by FromString, so the open loan is checked here instead of in the query
+		if status, _ := FromString(s); status.IsOpen() {
+			rows, err := tx.Query(ctx,
+				`SELECT status FROM loan_applications WHERE user_id = $1 AND deleted_date IS NULL`,
+				userId,
+			)
+			if err != nil {
+				return err
+			}
+			defer rows.Close()
+
+			for rows.Next() {
+				var s string
+				if err := rows.Scan(&s); err != nil {
+					return err
+				}
+				if status, _ := FromString(s); status.IsOpen() {
+					return ErrProcessLoanExist
+				}
+			}
+			if err := rows.Err(); err != nil {
+				return err
+			}
+			rows.Close()
+		}
+
+		_, err = tx.Exec(ctx,
+			`UPDATE loan_applications SET (deleted_date, updated_date) = (NULL, $2) WHERE id = $1`,
+			loanId, time.Now(),
+		)
+		return err
+	})
+	if err != nil {
+		return err
+	}
+
+	return nil
+}
+
+// execLoan run the update of a single loan, the loan is not found when nothing is updated
+func (r *Repository) execLoan(ctx context.Context, query string, args ...interface{}) error {
+	err := crdbpgx.ExecuteTx(context.Background(), r.db, pgx.TxOptions{}, func(tx pgx.Tx) error {
+		tag, err := tx.Exec(ctx, query, args...)
+		if err != nil {
 			return err
 		}
+		if tag.RowsAffected() == 0 {
+			return ErrUserLoanNotFound
+		}
 		return nil
 	})
 	if err != nil {
@@ -453,19 +373,20 @@ func (r *Repository) RemoveLoan(ctx context.Context, loanId string) error {
 	return nil
 }
 
-func (r *Repository) UpdateLoan(ctx context.Context, loanId string, loan model.LoanApplication) error {
+// UpdateLoan save the fields edited by the applicant, the status, the officer and the claim are kept,
+// the loan is only saved when its status is still the prevStatus it was read with
+func (r *Repository) UpdateLoan(ctx context.Context, prevStatus string, loan model.LoanApplication) error {
 	t := time.Now()
 	err := crdbpgx.ExecuteTx(context.Background(), r.db, pgx.TxOptions{}, func(tx pgx.Tx) error {
-		if _, err := tx.Exec(ctx,
+		tag, err := tx.Exec(ctx,
 			`UPDATE loan_applications SET (
-				officer_id,
 				full_name,
 				birth_date,
 				full_address,
 				phone,
 				id_card_url,
 				other_business,
-				status,
+				region,
 				is_private_field,
 				exp_in_year,
 				active_field_number,
@@ -477,16 +398,18 @@ func (r *Repository) UpdateLoan(ctx context.Context, loanId string, loan model.L
 				loan_application_in_idr,
 				business_income_per_month_in_idr,
 				business_outcome_per_month_in_idr,
+				credit_score,
 				updated_date
-			) = ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12, $13, $14, $15, $16, $17, $18, $19, $20)`,
-			loan.OfficerId,
+			) = ($2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12, $13, $14, $15, $16, $17, $18, $19, $20, $21)
+			WHERE id = $1 AND status = $22 AND deleted_date IS NULL`,
+			loan.Id,
 			loan.FullName,
 			loan.BirthDate,
 			loan.FullAddress,
 			loan.Phone,
 			loan.IdCardUrl,
 			loan.OtherBusiness,
-			loan.Status,
+			loan.Region,
 			loan.IsPrivateField,
 			loan.ExpInYear,
 			loan.ActiveFieldNumber,
@@ -498,10 +421,27 @@ func (r *Repository) UpdateLoan(ctx context.Context, loanId string, loan model.L
 			loan.LoanApplicationInIdr,
 			loan.BusinessIncomePerMonthInIdr,
 			loan.BusinessOutcomePerMonthInIdr,
+			loan.CreditScore,
 			t,
-		); err != nil {
+			prevStatus,
+		)
+		if err != nil {
 			return err
 		}
+		if tag.RowsAffected() == 0 {
+			var exist bool
+			if err := tx.QueryRow(ctx,
+				`SELECT EXISTS (SELECT 1 FROM loan_applications WHERE id = $1 AND deleted_date IS NULL)`,
+				loan.Id,
+			).Scan(&exist); err != nil {
+				return err
+			}
+			if !exist {
+				return ErrUserLoanNotFound
+			}
+
+			return ErrLoanStatusChanged
+		}
 		return nil
 	})
 	if err != nil {
@@ -510,3 +450,691 @@ func (r *Repository) UpdateLoan(ctx context.Context, loanId string, loan model.L
 
 	return nil
 }
+
+// TransitionLoan save the new status of the loan and append the history of the change,
+// the loan is only saved when its status is still the prevStatus it was read with
+func (r *Repository) TransitionLoan(ctx context.Context, prevStatus string, loan model.LoanApplication, h model.LoanStatusHistory) (model.LoanStatusHistory, error) {
+	historyId, err := r.ids.New()
+	if err != nil {
+		return model.LoanStatusHistory{}, err
+	}
+
+	h.Id = historyId
+	h.LoanId = loan.Id
+	h.CreatedDate = time.Now()
+
+	err = crdbpgx.ExecuteTx(context.Background(), r.db, pgx.TxOptions{}, func(tx pgx.Tx) error {
+		return transitionLoan(ctx, tx, prevStatus, loan, h)
+	})
+	if err != nil {
+		return model.LoanStatusHistory{}, err
+	}
+
+	return h, nil
+}
+
+// transitionLoan is TransitionLoan within the transaction of the caller, the history is already made
+func transitionLoan(ctx context.Context, tx pgx.Tx, prevStatus string, loan model.LoanApplication, h model.LoanStatusHistory) error {
+	tag, err := tx.Exec(ctx,
+		`UPDATE loan_applications SET (
+			status,
+			officer_id,
+			decision_reasons,
+			decision_note,
+			decision_internal_note,
+			unlocked_fields,
+			info_request_note,
+			withdraw_reason,
+			claimed_date,
+			updated_date
+		) = ($2, $3, $4, $5, $6, $7, $8, $9, $10, $11)
+		WHERE id = $1 AND status = $12 AND deleted_date IS NULL`,
+		loan.Id,
+		loan.Status,
+		loan.OfficerId,
+		nonNilStrings(loan.DecisionReasons),
+		loan.DecisionNote,
+		loan.DecisionInternalNote,
+		nonNilStrings(loan.UnlockedFields),
+		loan.InfoRequestNote,
+		loan.WithdrawReason,
+		loan.ClaimedDate,
+		h.CreatedDate,
+		prevStatus,
+	)
+	if err != nil {
+		return err
+	}
+	if tag.RowsAffected() == 0 {
+		var exist bool
+		if err := tx.QueryRow(ctx,
+			`SELECT EXISTS (SELECT 1 FROM loan_applications WHERE id = $1 AND deleted_date IS NULL)`,
+			loan.Id,
+		).Scan(&exist); err != nil {
+			return err
+		}
+		if !exist {
+			return ErrUserLoanNotFound
+		}
+
+		return ErrLoanStatusChanged
+	}
+
+	_, err = tx.Exec(ctx,
+		`INSERT INTO loan_status_history (id, loan_id, from_status, to_status, actor_id, actor_role, comment, created_date)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8)`,
+		h.Id, h.LoanId, h.FromStatus, h.ToStatus, h.ActorId, h.ActorRole, h.Comment, h.CreatedDate,
+	)
+	return err
+}
+
+// WithdrawLoan cancel the open loan deleted by the applicant and mark it as deleted at once,
+// with the history of the cancel, the loan is only saved when its status is still prevStatus
+func (r *Repository) WithdrawLoan(ctx context.Context, prevStatus string, loan model.LoanApplication, h model.LoanStatusHistory) (model.LoanStatusHistory, error) {
+	historyId, err := r.ids.New()
+	if err != nil {
+		return model.LoanStatusHistory{}, err
+	}
+
+	t := time.Now()
+	h.Id = historyId
+	h.LoanId = loan.Id
+	h.CreatedDate = t
+
+	err = crdbpgx.ExecuteTx(context.Background(), r.db, pgx.TxOptions{}, func(tx pgx.Tx) error {
+		tag, err := tx.Exec(ctx,
+			`UPDATE loan_applications SET (
+				status,
+				withdraw_reason,
+				updated_date,
+				deleted_date
+			) = ($2, $3, $4, $4)
+			WHERE id = $1 AND status = $5 AND deleted_date IS NULL`,
+			loan.Id,
+			loan.Status,
+			loan.WithdrawReason,
+			t,
+			prevStatus,
+		)
+		if err != nil {
+			return err
+		}
+		if tag.RowsAffected() == 0 {
+			var exist bool
+			if err := tx.QueryRow(ctx,
+				`SELECT EXISTS (SELECT 1 FROM loan_applications WHERE id = $1 AND deleted_date IS NULL)`,
+				loan.Id,
+			).Scan(&exist); err != nil {
+				return err
+			}
+			if !exist {
+				return ErrUserLoanNotFound
+			}
+
+			return ErrLoanStatusChanged
+		}
+
+		_, err = tx.Exec(ctx,
+			`INSERT INTO loan_status_history (id, loan_id, from_status, to_status, actor_id, actor_role, comment, created_date)
+			VALUES ($1, $2, $3, $4, $5, $6, $7, $8)`,
+			h.Id, h.LoanId, h.FromStatus, h.ToStatus, h.ActorId, h.ActorRole, h.Comment, h.CreatedDate,
+		)
+		return err
+	})
+	if err != nil {
+		return model.LoanStatusHistory{}, err
+	}
+
+	return h, nil
+}
+
+// GetLoanHistories return every status change of the loan, the oldest first
+func (r *Repository) GetLoanHistories(ctx context.Context, loanId string) ([]model.LoanStatusHistory, error) {
+	var histories []model.LoanStatusHistory
+	err := crdbpgx.ExecuteTx(context.Background(), r.db, pgx.TxOptions{}, func(tx pgx.Tx) error {
+		var err error
+		histories, err = loanHistories(ctx, tx, loanId)
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return histories, nil
+}
+
+// loanHistories is GetLoanHistories within the transaction of the caller
+func loanHistories(ctx context.Context, tx pgx.Tx, loanId string) ([]model.LoanStatusHistory, error) {
+	// The id is time sortable, it keep the order of the change made in the same instant
+	rows, err := tx.Query(ctx,
+		`SELECT id, loan_id, from_status, to_status, actor_id, actor_role, comment, created_date
+		FROM loan_status_history WHERE loan_id = $1
+		ORDER BY id`,
+		loanId,
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	histories := make([]model.LoanStatusHistory, 0)
+	for rows.Next() {
+		var h model.LoanStatusHistory
+		if err := rows.Scan(&h.Id, &h.LoanId, &h.FromStatus, &h.ToStatus, &h.ActorId, &h.ActorRole, &h.Comment, &h.CreatedDate); err != nil {
+			return nil, err
+		}
+
+		histories = append(histories, h)
+	}
+
+	return histories, rows.Err()
+}
+
+// GetQueueOfficers return the active user of the roles with their region and how many open loan they have,
+// the loan is only counted while isClaimed tell the officer still hold it
+func (r *Repository) GetQueueOfficers(ctx context.Context, roles []string, isClaimed func(officerId string, claimedDate, now time.Time) bool) ([]queue.Officer, error) {
+	officers := make([]queue.Officer, 0)
+	err := crdbpgx.ExecuteTx(context.Background(), r.db, pgx.TxOptions{}, func(tx pgx.Tx) error {
+		officers = officers[:0]
+
+		// The legacy status is mapped by FromString, so the open loan is counted here instead of in the query
+		now := time.Now()
+		loads := make(map[string]int)
+		rows, err := tx.Query(ctx,
+			`SELECT officer_id, status, claimed_date FROM loan_applications
+			WHERE officer_id IS NOT NULL AND deleted_date IS NULL`,
+		)
+		if err != nil {
+			return err
+		}
+		for rows.Next() {
+			var officerId, s string
+			var claimedDate time.Time
+			if err := rows.Scan(&officerId, &s, &claimedDate); err != nil {
+				rows.Close()
+				return err
+			}
+			if status, _ := FromString(s); status.IsOpen() && isClaimed(officerId, claimedDate, now) {
+				loads[officerId]++
+			}
+		}
+		rows.Close()
+		if err := rows.Err(); err != nil {
+			return err
+		}
+
+		rows, err = tx.Query(ctx,
+			`SELECT u.id, COALESCE(o.region, '')
+			FROM users u LEFT JOIN officer_regions o ON o.user_id = u.id
+			WHERE u.role = ANY($1) AND u.deactivated_date IS NULL`,
+			roles,
+		)
+		if err != nil {
+			return err
+		}
+		defer rows.Close()
+
+		for rows.Next() {
+			var o queue.Officer
+			if err := rows.Scan(&o.Id, &o.Region); err != nil {
+				return err
+			}
+			o.Load = loads[o.Id]
+
+			officers = append(officers, o)
+		}
+
+		return rows.Err()
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return officers, nil
+}
+
+// AssignLoan give the loan to its OfficerId only when the stored loan still belong to the prevOfficerId,
+// so two officers claiming the same loan at once does not both get it
+func (r *Repository) AssignLoan(ctx context.Context, prevOfficerId string, loan model.LoanApplication) error {
+	prev := sql.NullString{String: prevOfficerId, Valid: prevOfficerId != ""}
+	err := crdbpgx.ExecuteTx(context.Background(), r.db, pgx.TxOptions{}, func(tx pgx.Tx) error {
+		tag, err := tx.Exec(ctx,
+			`UPDATE loan_applications SET (officer_id, claimed_date, updated_date) = ($2, $3, $4)
+			WHERE id = $1 AND deleted_date IS NULL AND officer_id IS NOT DISTINCT FROM $5`,
+			loan.Id,
+			loan.OfficerId,
+			loan.ClaimedDate,
+			time.Now(),
+			prev,
+		)
+		if err != nil {
+			return err
+		}
+		if tag.RowsAffected() == 0 {
+			var exist bool
+			if err := tx.QueryRow(ctx,
+				`SELECT EXISTS (SELECT 1 FROM loan_applications WHERE id = $1 AND deleted_date IS NULL)`,
+				loan.Id,
+			).Scan(&exist); err != nil {
+				return err
+			}
+			if !exist {
+				return ErrUserLoanNotFound
+			}
+
+			return ErrLoanClaimed
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+
+	return nil
+}
+
+func (r *Repository) SetOfficerRegion(ctx context.Context, region model.OfficerRegion) (model.OfficerRegion, error) {
+	region.UpdatedDate = time.Now()
+
+	err := crdbpgx.ExecuteTx(context.Background(), r.db, pgx.TxOptions{}, func(tx pgx.Tx) error {
+		_, err := tx.Exec(ctx,
+			`UPSERT INTO officer_regions (user_id, region, updated_date) VALUES ($1, $2, $3)`,
+			region.UserId, region.Region, region.UpdatedDate,
+		)
+		return err
+	})
+	if err != nil {
+		return model.OfficerRegion{}, err
+	}
+
+	return region, nil
+}
+
+// SignLoan keep the approval of the approver and return every signature given since the loan last went
+// in review, the new one included, the loan must still be in the prevStatus it was read with
+func (r *Repository) SignLoan(ctx context.Context, prevStatus string, s model.ApprovalSignature) ([]model.ApprovalSignature, error) {
+	signatureId, err := r.ids.New()
+	if err != nil {
+		return nil, err
+	}
+
+	t := time.Now()
+	s.Id = signatureId
+	s.CreatedDate = t
+
+	var signatures []model.ApprovalSignature
+	err = crdbpgx.ExecuteTx(context.Background(), r.db, pgx.TxOptions{}, func(tx pgx.Tx) error {
+		tag, err := tx.Exec(ctx,
+			`UPDATE loan_applications SET updated_date = $2 WHERE id = $1 AND status = $3 AND deleted_date IS NULL`,
+			s.LoanId, t, prevStatus,
+		)
+		if err != nil {
+			return err
+		}
+		if tag.RowsAffected() == 0 {
+			var exist bool
+			if err := tx.QueryRow(ctx,
+				`SELECT EXISTS (SELECT 1 FROM loan_applications WHERE id = $1 AND deleted_date IS NULL)`,
+				s.LoanId,
+			).Scan(&exist); err != nil {
+				return err
+			}
+			if !exist {
+				return ErrUserLoanNotFound
+			}
+
+			return ErrLoanStatusChanged
+		}
+
+		// The signatures are read in the same transaction as the new one is kept, so of the approvers
+		// signing at once the last one always see every signature and can approve the loan
+		histories, err := loanHistories(ctx, tx, s.LoanId)
+		if err != nil {
+			return err
+		}
+		all, err := approvalSignatures(ctx, tx, s.LoanId)
+		if err != nil {
+			return err
+		}
+		signatures = currentSignatures(all, histories)
+		if hasSigned(signatures, s.ApproverId) {
+			return ErrAlreadySigned
+		}
+		s.ReviewId = lastReviewId(histories)
+
+		tag, err = tx.Exec(ctx,
+			`INSERT INTO loan_approval_signatures (id, loan_id, approver_id, approver_role, note, review_id, created_date)
+			VALUES ($1, $2, $3, $4, $5, $6, $7)
+			ON CONFLICT (loan_id, approver_id, review_id) DO NOTHING`,
+			s.Id, s.LoanId, s.ApproverId, s.ApproverRole, s.Note, s.ReviewId, s.CreatedDate,
+		)
+		if err != nil {
+			return err
+		}
+		if tag.RowsAffected() == 0 {
+			return ErrAlreadySigned
+		}
+
+		signatures = append(signatures, s)
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return signatures, nil
+}
+
+// GetApprovalSignatures return every approval given to the loan, the oldest first
+func (r *Repository) GetApprovalSignatures(ctx context.Context, loanId string) ([]model.ApprovalSignature, error) {
+	var signatures []model.ApprovalSignature
+	err := crdbpgx.ExecuteTx(context.Background(), r.db, pgx.TxOptions{}, func(tx pgx.Tx) error {
+		var err error
+		signatures, err = approvalSignatures(ctx, tx, loanId)
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return signatures, nil
+}
+
+// approvalSignatures is GetApprovalSignatures within the transaction of the caller
+func approvalSignatures(ctx context.Context, tx pgx.Tx, loanId string) ([]model.ApprovalSignature, error) {
+	// The id is time sortable, it keep the order of the approval given in the same instant
+	rows, err := tx.Query(ctx,
+		`SELECT id, loan_id, approver_id, approver_role, note, review_id, created_date
+		FROM loan_approval_signatures WHERE loan_id = $1
+		ORDER BY id`,
+		loanId,
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	signatures := make([]model.ApprovalSignature, 0)
+	for rows.Next() {
+		var s model.ApprovalSignature
+		if err := rows.Scan(&s.Id, &s.LoanId, &s.ApproverId, &s.ApproverRole, &s.Note, &s.ReviewId, &s.CreatedDate); err != nil {
+			return nil, err
+		}
+
+		signatures = append(signatures, s)
+	}
+
+	return signatures, rows.Err()
+}
+
+// InsertCommitteeVote open the vote on the loan with a ballot for every invited officer,
+// there is only one open vote on a loan at a time
+func (r *Repository) InsertCommitteeVote(ctx context.Context, vote model.CommitteeVote, officerIds []string) (model.CommitteeVote, []model.CommitteeBallot, error) {
+	voteId, err := r.ids.New()
+	if err != nil {
+		return model.CommitteeVote{}, nil, err
+	}
+
+	t := time.Now()
+	vote.Id = voteId
+	vote.CreatedDate = t
+
+	ballots := make([]model.CommitteeBallot, 0, len(officerIds))
+	for _, v := range officerIds {
+		ballotId, err := r.ids.New()
+		if err != nil {
+			return model.CommitteeVote{}, nil, err
+		}
+
+		ballots = append(ballots, model.CommitteeBallot{
+			Id:          ballotId,
+			VoteId:      vote.Id,
+			OfficerId:   v,
+			CreatedDate: t,
+		})
+	}
+
+	err = crdbpgx.ExecuteTx(context.Background(), r.db, pgx.TxOptions{}, func(tx pgx.Tx) error {
+		var exist, isOpen bool
+		if err := tx.QueryRow(ctx,
+			`SELECT
+				EXISTS (SELECT 1 FROM loan_applications WHERE id = $1 AND deleted_date IS NULL),
+				EXISTS (SELECT 1 FROM committee_votes WHERE loan_id = $1 AND status = $2)`,
+			vote.LoanId, committee.Open.String(),
+		).Scan(&exist, &isOpen); err != nil {
+			return err
+		}
+		if !exist {
+			return ErrUserLoanNotFound
+		}
+		if isOpen {
+			return ErrVoteOpen
+		}
+
+		if _, err := tx.Exec(ctx,
+			`INSERT INTO committee_votes (id, loan_id, opened_by, status, note, quorum, majority, deadline_date, created_date, closed_date)
+			VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10)`,
+			vote.Id, vote.LoanId, vote.OpenedBy, vote.Status, vote.Note, vote.Quorum, vote.Majority, vote.DeadlineDate, vote.CreatedDate, vote.ClosedDate,
+		); err != nil {
+			return err
+		}
+
+		for _, b := range ballots {
+			if _, err := tx.Exec(ctx,
+				`INSERT INTO committee_ballots (id, vote_id, officer_id, choice, comment, created_date, voted_date)
+				VALUES ($1, $2, $3, $4, $5, $6, $7)`,
+				b.Id, b.VoteId, b.OfficerId, b.Choice, b.Comment, b.CreatedDate, b.VotedDate,
+			); err != nil {
+				return err
+			}
+		}
+
+		return nil
+	})
+	if err != nil {
+		return model.CommitteeVote{}, nil, err
+	}
+
+	return vote, ballots, nil
+}
+
+func (r *Repository) GetCommitteeVote(ctx context.Context, voteId string) (model.CommitteeVote, error) {
+	votes, err := r.findCommitteeVotes(ctx, `WHERE id = $1`, voteId)
+	if err != nil {
+		return model.CommitteeVote{}, err
+	}
+	if len(votes) == 0 {
+		return model.CommitteeVote{}, ErrVoteNotFound
+	}
+
+	return votes[0], nil
+}
+
+// GetCommitteeVotes return every vote of the loan, the oldest first
+func (r *Repository) GetCommitteeVotes(ctx context.Context, loanId string) ([]model.CommitteeVote, error) {
+	return r.findCommitteeVotes(ctx, `WHERE loan_id = $1`, loanId)
+}
+
+// GetOpenCommitteeVote return the vote still open on the loan, ErrVoteNotFound when there is none
+func (r *Repository) GetOpenCommitteeVote(ctx context.Context, loanId string) (model.CommitteeVote, error) {
+	votes, err := r.findCommitteeVotes(ctx, `WHERE loan_id = $1 AND status = $2`, loanId, committee.Open.String())
+	if err != nil {
+		return model.CommitteeVote{}, err
+	}
+	if len(votes) == 0 {
+		return model.CommitteeVote{}, ErrVoteNotFound
+	}
+
+	return votes[0], nil
+}
+
+// GetExpiredCommitteeVotes return the open vote past its deadline
+func (r *Repository) GetExpiredCommitteeVotes(ctx context.Context, now time.Time) ([]model.CommitteeVote, error) {
+	return r.findCommitteeVotes(ctx, `WHERE status = $1 AND deadline_date < $2`, committee.Open.String(), now)
+}
+
+func (r *Repository) findCommitteeVotes(ctx context.Context, where string, args ...interface{}) ([]model.CommitteeVote, error) {
+	votes := make([]model.CommitteeVote, 0)
+	err := crdbpgx.ExecuteTx(context.Background(), r.db, pgx.TxOptions{}, func(tx pgx.Tx) error {
+		votes = votes[:0]
+
+		// The id is time sortable
+		rows, err := tx.Query(ctx,
+			`SELECT id, loan_id, opened_by, status, note, quorum, majority, deadline_date, created_date, closed_date
+			FROM committee_votes `+where+` ORDER BY id`,
+			args...,
+		)
+		if err != nil {
+			return err
+		}
+		defer rows.Close()
+
+		for rows.Next() {
+			var v model.CommitteeVote
+			if err := rows.Scan(&v.Id, &v.LoanId, &v.OpenedBy, &v.Status, &v.Note, &v.Quorum, &v.Majority, &v.DeadlineDate, &v.CreatedDate, &v.ClosedDate); err != nil {
+				return err
+			}
+
+			votes = append(votes, v)
+		}
+
+		return rows.Err()
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return votes, nil
+}
+
+// GetCommitteeBallots return the ballot of every invited officer of the vote, in the order they were invited
+func (r *Repository) GetCommitteeBallots(ctx context.Context, voteId string) ([]model.CommitteeBallot, error) {
+	ballots := make([]model.CommitteeBallot, 0)
+	err := crdbpgx.ExecuteTx(context.Background(), r.db, pgx.TxOptions{}, func(tx pgx.Tx) error {
+		ballots = ballots[:0]
+
+		rows, err := tx.Query(ctx,
+			`SELECT id, vote_id, officer_id, choice, comment, created_date, voted_date
+			FROM committee_ballots WHERE vote_id = $1
+			ORDER BY id`,
+			voteId,
+		)
+		if err != nil {
+			return err
+		}
+		defer rows.Close()
+
+		for rows.Next() {
+			var b model.CommitteeBallot
+			if err := rows.Scan(&b.Id, &b.VoteId, &b.OfficerId, &b.Choice, &b.Comment, &b.CreatedDate, &b.VotedDate); err != nil {
+				return err
+			}
+
+			ballots = append(ballots, b)
+		}
+
+		return rows.Err()
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return ballots, nil
+}
+
+// CastBallot keep the choice of the officer, only once and only while the vote is open
+func (r *Repository) CastBallot(ctx context.Context, ballot model.CommitteeBallot) (model.CommitteeBallot, error) {
+	ballot.VotedDate = time.Now()
+
+	err := crdbpgx.ExecuteTx(context.Background(), r.db, pgx.TxOptions{}, func(tx pgx.Tx) error {
+		var status string
+		err := tx.QueryRow(ctx,
+			`SELECT status FROM committee_votes WHERE id = $1`,
+			ballot.VoteId,
+		).Scan(&status)
+		if errors.Is(err, pgx.ErrNoRows) {
+			return ErrVoteNotFound
+		}
+		if err != nil {
+			return err
+		}
+		if status != committee.Open.String() {
+			return ErrVoteClosed
+		}
+
+		var choice string
+		err = tx.QueryRow(ctx,
+			`SELECT id, choice, created_date FROM committee_ballots WHERE vote_id = $1 AND officer_id = $2`,
+			ballot.VoteId, ballot.OfficerId,
+		).Scan(&ballot.Id, &choice, &ballot.CreatedDate)
+		if errors.Is(err, pgx.ErrNoRows) {
+			return ErrNotVoteMember
+		}
+		if err != nil {
+			return err
+		}
+		if choice != "" {
+			return ErrAlreadyVoted
+		}
+
+		_, err = tx.Exec(ctx,
+			`UPDATE committee_ballots SET (choice, comment, voted_date) = ($2, $3, $4) WHERE id = $1`,
+			ballot.Id, ballot.Choice, ballot.Comment, ballot.VotedDate,
+		)
+		return err
+	})
+	if err != nil {
+		return model.CommitteeBallot{}, err
+	}
+
+	return ballot, nil
+}
+
+// CloseCommitteeVote save the outcome of the vote, only the open vote can be closed. The loan the vote decided,
+// when h has a status to move to, is saved with its new status and the history in the same transaction
+func (r *Repository) CloseCommitteeVote(ctx context.Context, vote model.CommitteeVote, prevStatus string, loan model.LoanApplication, h model.LoanStatusHistory) error {
+	if h.ToStatus != "" {
+		historyId, err := r.ids.New()
+		if err != nil {
+			return err
+		}
+
+		h.Id = historyId
+		h.LoanId = loan.Id
+		h.CreatedDate = vote.ClosedDate
+	}
+
+	err := crdbpgx.ExecuteTx(context.Background(), r.db, pgx.TxOptions{}, func(tx pgx.Tx) error {
+		tag, err := tx.Exec(ctx,
+			`UPDATE committee_votes SET (status, closed_date) = ($2, $3) WHERE id = $1 AND status = $4`,
+			vote.Id, vote.Status, vote.ClosedDate, committee.Open.String(),
+		)
+		if err != nil {
+			return err
+		}
+		if tag.RowsAffected() == 0 {
+			var exist bool
+			if err := tx.QueryRow(ctx,
+				`SELECT EXISTS (SELECT 1 FROM committee_votes WHERE id = $1)`,
+				vote.Id,
+			).Scan(&exist); err != nil {
+				return err
+			}
+			if !exist {
+				return ErrVoteNotFound
+			}
+
+			return ErrVoteClosed
+		}
+
+		if h.ToStatus == "" {
+			return nil
+		}
+		return transitionLoan(ctx, tx, prevStatus, loan, h)
+	})
+	if err != nil {
+		return err
+	}
+
+	return nil
+}
@@ -6,10 +6,11 @@ import (
 	"strconv"
 
 	"github.com/fikryfahrezy/adea/los-postgre/resp"
+	"github.com/fikryfahrezy/adea/los-postgre/session"
 )
 
 func (a *LoanApp) UserLoansGet(w http.ResponseWriter, r *http.Request) {
-	userId := r.Header.Get("authorization")
+	userId := session.UserId(r.Context())
 	out := a.GetUserLoans(r.Context(), userId)
 	out.HttpJSON(w, resp.NewHttpBody(out.Res))
 }
@@ -21,7 +22,7 @@ func (a *LoanApp) UserLoanDetailGet(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	userId := r.Header.Get("authorization")
+	userId := session.UserId(r.Context())
 	out := a.GetUserLoanDetail(r.Context(), loanId, userId)
 	out.HttpJSON(w, resp.NewHttpBody(out.Res))
 }
@@ -38,8 +39,10 @@ func (a *LoanApp) CreateLoanPost(w http.ResponseWriter, r *http.Request) {
 		FullAddress:   r.FormValue("full_address"),
 		Phone:         r.FormValue("phone"),
 		OtherBusiness: r.FormValue("other_business"),
+		Region:        r.FormValue("region"),
 	}
 
+	in.IsDraft, _ = strconv.ParseBool(r.FormValue("is_draft"))
 	in.IsPrivateField, _ = strconv.ParseBool(r.FormValue("is_private_field"))
 	in.ExpInYear, _ = strconv.ParseInt(r.FormValue("exp_in_year"), 10, 64)
 	in.ActiveFieldNumber, _ = strconv.ParseInt(r.FormValue("active_field_number"), 10, 64)
@@ -63,7 +66,7 @@ func (a *LoanApp) CreateLoanPost(w http.ResponseWriter, r *http.Request) {
 		File:     file,
 	}
 
-	userId := r.Header.Get("authorization")
+	userId := session.UserId(r.Context())
 	out := a.CreateLoan(r.Context(), userId, in)
 	out.HttpJSON(w, resp.NewHttpBody(out.Res))
 }
@@ -86,6 +89,7 @@ func (a *LoanApp) UpdateLoanPut(w http.ResponseWriter, r *http.Request) {
 		FullAddress:   r.FormValue("full_address"),
 		Phone:         r.FormValue("phone"),
 		OtherBusiness: r.FormValue("other_business"),
+		Region:        r.FormValue("region"),
 	}
 
 	in.IsPrivateField, _ = strconv.ParseBool(r.FormValue("is_private_field"))
@@ -111,7 +115,7 @@ func (a *LoanApp) UpdateLoanPut(w http.ResponseWriter, r *http.Request) {
 		File:     file,
 	}
 
-	userId := r.Header.Get("authorization")
+	userId := session.UserId(r.Context())
 	out := a.UpdateLoan(r.Context(), loanId, userId, in)
 	out.HttpJSON(w, resp.NewHttpBody(out.Res))
 }
@@ -123,7 +127,7 @@ func (a *LoanApp) UserLoanDelete(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	userId := r.Header.Get("authorization")
+	userId := session.UserId(r.Context())
 	out := a.DeleteLoan(r.Context(), loanId, userId)
 	out.HttpJSON(w, resp.NewHttpBody(out.Res))
 }
@@ -151,7 +155,7 @@ func (a *LoanApp) ProceedLoanPatch(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	userId := r.Header.Get("authorization")
+	userId := session.UserId(r.Context())
 	out := a.ProceedLoan(r.Context(), loanId, userId)
 	out.HttpJSON(w, resp.NewHttpBody(out.Res))
 }
@@ -170,7 +174,228 @@ func (a *LoanApp) ApproveLoanPatch(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	userId := r.Header.Get("authorization")
+	userId := session.UserId(r.Context())
 	out := a.ApproveLoan(r.Context(), loanId, userId, in)
 	out.HttpJSON(w, resp.NewHttpBody(out.Res))
 }
+
+func (a *LoanApp) LoanActionsGet(w http.ResponseWriter, r *http.Request) {
+	loanId := r.URL.Query().Get("id")
+	if loanId == "" {
+		http.NotFound(w, r)
+		return
+	}
+
+	userId := session.UserId(r.Context())
+	out := a.GetLoanActions(r.Context(), loanId, userId)
+	out.HttpJSON(w, resp.NewHttpBody(out.Res))
+}
+
+func (a *LoanApp) TransitionPatch(w http.ResponseWriter, r *http.Request) {
+	loanId := r.URL.Query().Get("id")
+	if loanId == "" {
+		http.NotFound(w, r)
+		return
+	}
+
+	var in TransitionIn
+	err := json.NewDecoder(r.Body).Decode(&in)
+	if err != nil {
+		resp.NewResponse(http.StatusInternalServerError, "", err).HttpJSON(w, nil)
+		return
+	}
+
+	userId := session.UserId(r.Context())
+	out := a.Transition(r.Context(), loanId, userId, in)
+	out.HttpJSON(w, resp.NewHttpBody(out.Res))
+}
+
+func (a *LoanApp) LoanHistoryGet(w http.ResponseWriter, r *http.Request) {
+	loanId := r.URL.Query().Get("id")
+	if loanId == "" {
+		http.NotFound(w, r)
+		return
+	}
+
+	userId := session.UserId(r.Context())
+	out := a.GetLoanHistory(r.Context(), loanId, userId)
+	out.HttpJSON(w, resp.NewHttpBody(out.Res))
+}
+
+func (a *LoanApp) WithdrawPatch(w http.ResponseWriter, r *http.Request) {
+	loanId := r.URL.Query().Get("id")
+	if loanId == "" {
+		http.NotFound(w, r)
+		return
+	}
+
+	var in WithdrawIn
+	err := json.NewDecoder(r.Body).Decode(&in)
+	if err != nil {
+		resp.NewResponse(http.StatusInternalServerError, "", err).HttpJSON(w, nil)
+		return
+	}
+
+	userId := session.UserId(r.Context())
+	out := a.Withdraw(r.Context(), loanId, userId, in)
+	out.HttpJSON(w, resp.NewHttpBody(out.Res))
+}
+
+func (a *LoanApp) DeletedLoansGet(w http.ResponseWriter, r *http.Request) {
+	out := a.GetDeletedLoans(r.Context())
+	out.HttpJSON(w, resp.NewHttpBody(out.Res))
+}
+
+func (a *LoanApp) ArchiveLoanPatch(w http.ResponseWriter, r *http.Request) {
+	loanId := r.URL.Query().Get("id")
+	if loanId == "" {
+		http.NotFound(w, r)
+		return
+	}
+
+	userId := session.UserId(r.Context())
+	out := a.ArchiveLoan(r.Context(), loanId, userId)
+	out.HttpJSON(w, resp.NewHttpBody(out.Res))
+}
+
+func (a *LoanApp) RestoreLoanPatch(w http.ResponseWriter, r *http.Request) {
+	loanId := r.URL.Query().Get("id")
+	if loanId == "" {
+		http.NotFound(w, r)
+		return
+	}
+
+	userId := session.UserId(r.Context())
+	out := a.RestoreLoan(r.Context(), loanId, userId)
+	out.HttpJSON(w, resp.NewHttpBody(out.Res))
+}
+
+func (a *LoanApp) MyQueueGet(w http.ResponseWriter, r *http.Request) {
+	userId := session.UserId(r.Context())
+	out := a.GetMyQueue(r.Context(), userId)
+	out.HttpJSON(w, resp.NewHttpBody(out.Res))
+}
+
+func (a *LoanApp) QueuePoolGet(w http.ResponseWriter, r *http.Request) {
+	userId := session.UserId(r.Context())
+	out := a.GetQueuePool(r.Context(), userId)
+	out.HttpJSON(w, resp.NewHttpBody(out.Res))
+}
+
+func (a *LoanApp) ClaimLoanPatch(w http.ResponseWriter, r *http.Request) {
+	loanId := r.URL.Query().Get("id")
+	if loanId == "" {
+		http.NotFound(w, r)
+		return
+	}
+
+	userId := session.UserId(r.Context())
+	out := a.ClaimLoan(r.Context(), loanId, userId)
+	out.HttpJSON(w, resp.NewHttpBody(out.Res))
+}
+
+func (a *LoanApp) ReleaseLoanPatch(w http.ResponseWriter, r *http.Request) {
+	loanId := r.URL.Query().Get("id")
+	if loanId == "" {
+		http.NotFound(w, r)
+		return
+	}
+
+	userId := session.UserId(r.Context())
+	out := a.ReleaseLoan(r.Context(), loanId, userId)
+	out.HttpJSON(w, resp.NewHttpBody(out.Res))
+}
+
+func (a *LoanApp) ReassignLoanPatch(w http.ResponseWriter, r *http.Request) {
+	loanId := r.URL.Query().Get("id")
+	if loanId == "" {
+		http.NotFound(w, r)
+		return
+	}
+
+	var in ReassignLoanIn
+	err := json.NewDecoder(r.Body).Decode(&in)
+	if err != nil {
+		resp.NewResponse(http.StatusInternalServerError, "", err).HttpJSON(w, nil)
+		return
+	}
+
+	userId := session.UserId(r.Context())
+	out := a.ReassignLoan(r.Context(), loanId, userId, in)
+	out.HttpJSON(w, resp.NewHttpBody(out.Res))
+}
+
+func (a *LoanApp) OfficerRegionPut(w http.ResponseWriter, r *http.Request) {
+	var in OfficerRegionIn
+	err := json.NewDecoder(r.Body).Decode(&in)
+	if err != nil {
+		resp.NewResponse(http.StatusInternalServerError, "", err).HttpJSON(w, nil)
+		return
+	}
+
+	userId := session.UserId(r.Context())
+	out := a.SetOfficerRegion(r.Context(), userId, in)
+	out.HttpJSON(w, resp.NewHttpBody(out.Res))
+}
+
+func (a *LoanApp) OpenVotePost(w http.ResponseWriter, r *http.Request) {
+	loanId := r.URL.Query().Get("id")
+	if loanId == "" {
+		http.NotFound(w, r)
+		return
+	}
+
+	var in OpenVoteIn
+	err := json.NewDecoder(r.Body).Decode(&in)
+	if err != nil {
+		resp.NewResponse(http.StatusInternalServerError, "", err).HttpJSON(w, nil)
+		return
+	}
+
+	userId := session.UserId(r.Context())
+	out := a.OpenVote(r.Context(), loanId, userId, in)
+	out.HttpJSON(w, resp.NewHttpBody(out.Res))
+}
+
+func (a *LoanApp) LoanVotesGet(w http.ResponseWriter, r *http.Request) {
+	loanId := r.URL.Query().Get("id")
+	if loanId == "" {
+		http.NotFound(w, r)
+		return
+	}
+
+	userId := session.UserId(r.Context())
+	out := a.GetLoanVotes(r.Context(), loanId, userId)
+	out.HttpJSON(w, resp.NewHttpBody(out.Res))
+}
+
+func (a *LoanApp) CastVotePatch(w http.ResponseWriter, r *http.Request) {
+	voteId := r.URL.Query().Get("id")
+	if voteId == "" {
+		http.NotFound(w, r)
+		return
+	}
+
+	var in CastVoteIn
+	err := json.NewDecoder(r.Body).Decode(&in)
+	if err != nil {
+		resp.NewResponse(http.StatusInternalServerError, "", err).HttpJSON(w, nil)
+		return
+	}
+
+	userId := session.UserId(r.Context())
+	out := a.CastVote(r.Context(), voteId, userId, in)
+	out.HttpJSON(w, resp.NewHttpBody(out.Res))
+}
+
+func (a *LoanApp) CloseVotePatch(w http.ResponseWriter, r *http.Request) {
+	voteId := r.URL.Query().Get("id")
+	if voteId == "" {
+		http.NotFound(w, r)
+		return
+	}
+
+	userId := session.UserId(r.Context())
+	out := a.CloseVote(r.Context(), voteId, userId)
+	out.HttpJSON(w, resp.NewHttpBody(out.Res))
+}
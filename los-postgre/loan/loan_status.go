@@ -0,0 +1,188 @@
+package loan
+
+import (
+	"errors"
+
+	"github.com/fikryfahrezy/adea/los-postgre/rbac"
+)
+
+type Status struct {
+	slug string
+}
+
+func (r Status) String() string {
+	return r.slug
+}
+
+var (
+	Unknown   = Status{""}
+	Draft     = Status{"draft"}
+	Submitted = Status{"submitted"}
+	InReview  = Status{"in_review"}
+	NeedsInfo = Status{"needs_info"}
+	Approved  = Status{"approved"}
+	Rejected  = Status{"rejected"}
+	Cancelled = Status{"cancelled"}
+	Disbursed = Status{"disbursed"}
+	Closed    = Status{"closed"}
+)
+
+// FromString also read the status stored before the transition table exist,
+// wait, process, reject and approve, as the status that replace them
+func FromString(s string) (Status, error) {
+	switch s {
+	case Draft.slug:
+		return Draft, nil
+	case Submitted.slug, "wait":
+		return Submitted, nil
+	case InReview.slug, "process":
+		return InReview, nil
+	case NeedsInfo.slug:
+		return NeedsInfo, nil
+	case Approved.slug, "approve":
+		return Approved, nil
+	case Rejected.slug, "reject":
+		return Rejected, nil
+	case Cancelled.slug:
+		return Cancelled, nil
+	case Disbursed.slug:
+		return Disbursed, nil
+	case Closed.slug:
+		return Closed, nil
+	}
+
+	return Unknown, errors.New("unknown status: " + s)
+}
+
+// IsOpen is the status of the loan that is not decided yet, the applicant can only have one open loan
+func (r Status) IsOpen() bool {
+	switch r {
+	case Draft, Submitted, InReview, NeedsInfo:
+		return true
+	}
+
+	return false
+}
+
+// IsFinal is the status the loan never leave, only the final loan can be archived
+func (r Status) IsFinal() bool {
+	switch r {
+	case Rejected, Cancelled, Closed:
+		return true
+	}
+
+	return false
+}
+
+// IsEditable is the status where the applicant can still change or delete the loan
+func (r Status) IsEditable() bool {
+	return r == Draft || r == Submitted
+}
+
+type Action struct {
+	slug string
+}
+
+func (a Action) String() string {
+	return a.slug
+}
+
+var (
+	ActionSubmit      = Action{"submit"}
+	ActionReview      = Action{"review"}
+	ActionRequestInfo = Action{"request_info"}
+	ActionResubmit    = Action{"resubmit"}
+	ActionApprove     = Action{"approve"}
+	ActionReject      = Action{"reject"}
+	ActionCancel      = Action{"cancel"}
+	ActionDisburse    = Action{"disburse"}
+	ActionClose       = Action{"close"}
+)
+
+func ActionFromString(s string) (Action, error) {
+	for _, t := range transitions {
+		if t.action.slug == s {
+			return t.action, nil
+		}
+	}
+
+	return Action{}, errors.New("unknown action: " + s)
+}
+
+// transition move the loan from one of the From status to the To status,
+// the actor must have the permission and, for the action of the applicant, own the loan
+type transition struct {
+	action     Action
+	from       []Status
+	to         Status
+	permission rbac.Permission
+	ownerOnly  bool
+}
+
+// transitions is the single place that decide how a loan move from one status to the other
+var transitions = []transition{
+	{action: ActionSubmit, from: []Status{Draft}, to: Submitted, permission: rbac.LoanUpdateOwn, ownerOnly: true},
+	{action: ActionReview, from: []Status{Submitted}, to: InReview, permission: rbac.LoanProceed},
+	{action: ActionRequestInfo, from: []Status{InReview}, to: NeedsInfo, permission: rbac.LoanProceed},
+	{action: ActionResubmit, from: []Status{NeedsInfo}, to: InReview, permission: rbac.LoanUpdateOwn, ownerOnly: true},
+	{action: ActionApprove, from: []Status{InReview}, to: Approved, permission: rbac.LoanApprove},
+	{action: ActionReject, from: []Status{InReview}, to: Rejected, permission: rbac.LoanApprove},
+	{action: ActionCancel, from: []Status{Draft, Submitted, NeedsInfo}, to: Cancelled, permission: rbac.LoanUpdateOwn, ownerOnly: true},
+	{action: ActionDisburse, from: []Status{Approved}, to: Disbursed, permission: rbac.LoanDisburse},
+	{action: ActionClose, from: []Status{Disbursed}, to: Closed, permission: rbac.LoanDisburse},
+}
+
+var (
+	ErrTransitionNotAllowed = errors.New("loan status does not allow the action")
+	ErrActionForbidden      = errors.New("user not allowed to do the action")
+)
+
+// Next return the status the action move the loan to, ErrTransitionNotAllowed when
+// the action can not be done from the status and ErrActionForbidden when the role can not do it
+func Next(from Status, action Action, role string, isOwner bool) (Status, error) {
+	for _, t := range transitions {
+		if t.action != action {
+			continue
+		}
+		if !t.allow(role, isOwner) {
+			return Unknown, ErrActionForbidden
+		}
+		if !t.isFrom(from) {
+			return Unknown, ErrTransitionNotAllowed
+		}
+
+		return t.to, nil
+	}
+
+	return Unknown, ErrTransitionNotAllowed
+}
+
+// Actions list what the role can do next on the loan in the status
+func Actions(from Status, role string, isOwner bool) []Action {
+	actions := make([]Action, 0)
+	for _, t := range transitions {
+		if t.isFrom(from) && t.allow(role, isOwner) {
+			actions = append(actions, t.action)
+		}
+	}
+
+	return actions
+}
+
+func (t transition) isFrom(s Status) bool {
+	for _, v := range t.from {
+		if v == s {
+			return true
+		}
+	}
+
+	return false
+}
+
+func (t transition) allow(role string, isOwner bool) bool {
+	if t.ownerOnly && !isOwner {
+		return false
+	}
+
+	return rbac.Can(role, t.permission)
+}
@@ -2,18 +2,31 @@ package loan
 
 import (
 	"context"
+	"database/sql"
 	"errors"
 	"io"
 	"net/http"
+	"sort"
+	"strings"
+	"time"
 
 	"github.com/fikryfahrezy/adea/los-postgre/model"
+	"github.com/fikryfahrezy/adea/los-postgre/rbac"
 	"github.com/fikryfahrezy/adea/los-postgre/resp"
 )
 
 var (
 	ErrProcessLoanExist  = errors.New("already have processed loan")
 	ErrModifyProcessLoan = errors.New("cannot modify processed loan")
-	ErrUserForbidden     = errors.New("officer only")
+	ErrUserForbidden     = errors.New("user role not allowed")
+	ErrArchiveOpenLoan   = errors.New("only rejected, cancelled or closed loan can be archived")
+	ErrLoanClaimed       = errors.New("loan claimed by another officer")
+	ErrLoanNotQueued     = errors.New("only submitted, in review or needs info loan is in the queue")
+	ErrLoanNotClaimed    = errors.New("loan not claimed by the user")
+	ErrOfficerNotValid   = errors.New("officer not found or not in the queue")
+	ErrSameReviewer      = errors.New("the approver must differ from the reviewer of the loan")
+	ErrAlreadySigned     = errors.New("loan already approved by the user, waiting for another approver")
+	ErrDecideOwnLoan     = errors.New("the approver can not decide on their own loan")
 )
 
 type File interface {
@@ -43,7 +56,7 @@ type (
 func (a *LoanApp) GetUserLoans(ctx context.Context, userId string) (out GetUserLoanOut) {
 	out.Response = resp.NewResponse(http.StatusOK, "", nil)
 
-	_, err := a.repository.GetUser(ctx, userId)
+	user, err := a.repository.GetUser(ctx, userId)
 	if errors.Is(err, ErrUserNotFound) {
 		out.Response = resp.NewResponse(http.StatusNotFound, "", err)
 		return
@@ -53,6 +66,11 @@ func (a *LoanApp) GetUserLoans(ctx context.Context, userId string) (out GetUserL
 		return
 	}
 
+	if !rbac.Can(user.Role, rbac.LoanReadOwn) {
+		out.Response = resp.NewResponse(http.StatusForbidden, "", ErrUserForbidden)
+		return
+	}
+
 	userLoans, err := a.repository.GetUserLoans(ctx, userId)
 	if err != nil {
 		out.Response = resp.NewResponse(http.StatusInternalServerError, "", err)
@@ -77,26 +95,32 @@ func (a *LoanApp) GetUserLoans(ctx context.Context, userId string) (out GetUserL
 
 type (
 	GetUserLoanDetailRes struct {
-		IsPrivateField               bool   `json:"is_private_field"`
-		ExpInYear                    int64  `json:"exp_in_year"`
-		ActiveFieldNumber            int64  `json:"active_field_number"`
-		SowSeedsPerCycle             int64  `json:"sow_seeds_per_cycle"`
-		NeededFertilizerPerCycleInKg int64  `json:"needed_fertilizer_per_cycle_in_kg"`
-		EstimatedYieldInKg           int64  `json:"estimated_yield_in_kg"`
-		EstimatedPriceOfHarvestPerKg int64  `json:"estimated_price_of_harvest_per_kg"`
-		HarvestCycleInMonths         int64  `json:"harvest_cycle_in_months"`
-		LoanApplicationInIdr         int64  `json:"loan_application_in_idr"`
-		BusinessIncomePerMonthInIdr  int64  `json:"business_income_per_month_in_idr"`
-		BusinessOutcomePerMonthInIdr int64  `json:"business_outcome_per_month_in_idr"`
-		LoanId                       string `json:"loan_id"`
-		UserId                       string `json:"user_id"`
-		FullName                     string `json:"full_name"`
-		BirthDate                    string `json:"birth_date"`
-		FullAddress                  string `json:"full_address"`
-		Phone                        string `json:"phone"`
-		OtherBusiness                string `json:"other_business"`
-		IdCardUrl                    string `json:"id_card_url"`
-		Status                       string `json:"status"`
+		IsPrivateField               bool                `json:"is_private_field"`
+		ExpInYear                    int64               `json:"exp_in_year"`
+		ActiveFieldNumber            int64               `json:"active_field_number"`
+		SowSeedsPerCycle             int64               `json:"sow_seeds_per_cycle"`
+		NeededFertilizerPerCycleInKg int64               `json:"needed_fertilizer_per_cycle_in_kg"`
+		EstimatedYieldInKg           int64               `json:"estimated_yield_in_kg"`
+		EstimatedPriceOfHarvestPerKg int64               `json:"estimated_price_of_harvest_per_kg"`
+		HarvestCycleInMonths         int64               `json:"harvest_cycle_in_months"`
+		LoanApplicationInIdr         int64               `json:"loan_application_in_idr"`
+		BusinessIncomePerMonthInIdr  int64               `json:"business_income_per_month_in_idr"`
+		BusinessOutcomePerMonthInIdr int64               `json:"business_outcome_per_month_in_idr"`
+		LoanId                       string              `json:"loan_id"`
+		UserId                       string              `json:"user_id"`
+		FullName                     string              `json:"full_name"`
+		BirthDate                    string              `json:"birth_date"`
+		FullAddress                  string              `json:"full_address"`
+		Phone                        string              `json:"phone"`
+		OtherBusiness                string              `json:"other_business"`
+		IdCardUrl                    string              `json:"id_card_url"`
+		Status                       string              `json:"status"`
+		DecisionReasons              []DecisionReasonRes `json:"decision_reasons"`
+		DecisionNote                 string              `json:"decision_note"`
+		UnlockedFields               []string            `json:"unlocked_fields"`
+		InfoRequestNote              string              `json:"info_request_note"`
+		WithdrawReason               string              `json:"withdraw_reason"`
+		Region                       string              `json:"region"`
 	}
 	GetUserLoanDetailOut struct {
 		resp.Response
@@ -107,7 +131,7 @@ type (
 func (a *LoanApp) GetUserLoanDetail(ctx context.Context, loanId, userId string) (out GetUserLoanDetailOut) {
 	out.Response = resp.NewResponse(http.StatusOK, "", nil)
 
-	_, err := a.repository.GetUser(ctx, userId)
+	user, err := a.repository.GetUser(ctx, userId)
 	if errors.Is(err, ErrUserNotFound) {
 		out.Response = resp.NewResponse(http.StatusNotFound, "", err)
 		return
@@ -117,6 +141,11 @@ func (a *LoanApp) GetUserLoanDetail(ctx context.Context, loanId, userId string)
 		return
 	}
 
+	if !rbac.Can(user.Role, rbac.LoanReadOwn) {
+		out.Response = resp.NewResponse(http.StatusForbidden, "", ErrUserForbidden)
+		return
+	}
+
 	userLoan, err := a.repository.GetUserLoan(ctx, loanId, userId)
 	if errors.Is(err, ErrUserLoanNotFound) {
 		out.Response = resp.NewResponse(http.StatusNotFound, "", err)
@@ -133,7 +162,7 @@ func (a *LoanApp) GetUserLoanDetail(ctx context.Context, loanId, userId string)
 		ActiveFieldNumber:            userLoan.ActiveFieldNumber,
 		SowSeedsPerCycle:             userLoan.SowSeedsPerCycle,
 		NeededFertilizerPerCycleInKg: userLoan.NeededFertilizerPerCycleInKg,
-		EstimatedYieldInKg:           userLoan.EstimatedPriceOfHarvestPerKg,
+		EstimatedYieldInKg:           userLoan.EstimatedYieldInKg,
 		EstimatedPriceOfHarvestPerKg: userLoan.EstimatedPriceOfHarvestPerKg,
 		HarvestCycleInMonths:         userLoan.HarvestCycleInMonths,
 		LoanApplicationInIdr:         userLoan.LoanApplicationInIdr,
@@ -148,6 +177,12 @@ func (a *LoanApp) GetUserLoanDetail(ctx context.Context, loanId, userId string)
 		OtherBusiness:                userLoan.OtherBusiness,
 		IdCardUrl:                    userLoan.IdCardUrl,
 		Status:                       userLoan.Status,
+		DecisionReasons:              decisionReasonsRes(userLoan.DecisionReasons),
+		DecisionNote:                 userLoan.DecisionNote,
+		UnlockedFields:               nonNilStrings(userLoan.UnlockedFields),
+		InfoRequestNote:              userLoan.InfoRequestNote,
+		WithdrawReason:               userLoan.WithdrawReason,
+		Region:                       userLoan.Region,
 	}
 
 	return
@@ -172,6 +207,10 @@ type (
 		Phone                        string
 		OtherBusiness                string
 		IdCard                       FileHeader
+		// Region is optional, it is used to assign the loan to the officer of the region
+		Region string
+		// IsDraft keep the loan as draft, it is only reviewed after the applicant submit it
+		IsDraft bool
 	}
 	CreateLoanRes struct {
 		Id string `json:"id"`
@@ -190,7 +229,7 @@ func (a *LoanApp) CreateLoan(ctx context.Context, userId string, in CreateLoanIn
 		return
 	}
 
-	_, err := a.repository.GetUser(ctx, userId)
+	user, err := a.repository.GetUser(ctx, userId)
 	if errors.Is(err, ErrUserNotFound) {
 		out.Response = resp.NewResponse(http.StatusNotFound, "", err)
 		return
@@ -200,6 +239,11 @@ func (a *LoanApp) CreateLoan(ctx context.Context, userId string, in CreateLoanIn
 		return
 	}
 
+	if !rbac.Can(user.Role, rbac.LoanCreate) {
+		out.Response = resp.NewResponse(http.StatusForbidden, "", ErrUserForbidden)
+		return
+	}
+
 	userLoans, err := a.repository.GetUserLoans(ctx, userId)
 	if err != nil {
 		out.Response = resp.NewResponse(http.StatusInternalServerError, "", err)
@@ -207,7 +251,7 @@ func (a *LoanApp) CreateLoan(ctx context.Context, userId string, in CreateLoanIn
 	}
 
 	for _, loan := range userLoans {
-		if loan.Status == Wait.String() || loan.Status == Process.String() {
+		if status, _ := FromString(loan.Status); status.IsOpen() {
 			out.Response = resp.NewResponse(http.StatusBadRequest, "", ErrProcessLoanExist)
 			return
 		}
@@ -229,7 +273,7 @@ func (a *LoanApp) CreateLoan(ctx context.Context, userId string, in CreateLoanIn
 		ActiveFieldNumber:            in.ActiveFieldNumber,
 		SowSeedsPerCycle:             in.SowSeedsPerCycle,
 		NeededFertilizerPerCycleInKg: in.NeededFertilizerPerCycleInKg,
-		EstimatedYieldInKg:           in.EstimatedPriceOfHarvestPerKg,
+		EstimatedYieldInKg:           in.EstimatedYieldInKg,
 		EstimatedPriceOfHarvestPerKg: in.EstimatedPriceOfHarvestPerKg,
 		HarvestCycleInMonths:         in.HarvestCycleInMonths,
 		LoanApplicationInIdr:         in.LoanApplicationInIdr,
@@ -242,6 +286,15 @@ func (a *LoanApp) CreateLoan(ctx context.Context, userId string, in CreateLoanIn
 		Phone:                        in.Phone,
 		IdCardUrl:                    fileUrl,
 		OtherBusiness:                in.OtherBusiness,
+		Region:                       strings.TrimSpace(in.Region),
+		Status:                       Submitted.String(),
+	}
+	newLoan = scoreLoan(newLoan)
+	if in.IsDraft {
+		newLoan.Status = Draft.String()
+	} else if newLoan, err = a.assignLoan(ctx, newLoan); err != nil {
+		out.Response = resp.NewResponse(http.StatusInternalServerError, "", err)
+		return
 	}
 
 	if newLoan, err = a.repository.InsertLoan(ctx, newLoan); err != nil {
@@ -275,6 +328,7 @@ type (
 		Phone                        string
 		OtherBusiness                string
 		IdCard                       FileHeader
+		Region                       string
 	}
 	UpdateLoanRes struct {
 		Id string `json:"id"`
@@ -293,7 +347,7 @@ func (a *LoanApp) UpdateLoan(ctx context.Context, loanId string, userId string,
 		return
 	}
 
-	_, err := a.repository.GetUser(ctx, userId)
+	user, err := a.repository.GetUser(ctx, userId)
 	if errors.Is(err, ErrUserNotFound) {
 		out.Response = resp.NewResponse(http.StatusNotFound, "", err)
 		return
@@ -303,6 +357,11 @@ func (a *LoanApp) UpdateLoan(ctx context.Context, loanId string, userId string,
 		return
 	}
 
+	if !rbac.Can(user.Role, rbac.LoanUpdateOwn) {
+		out.Response = resp.NewResponse(http.StatusForbidden, "", ErrUserForbidden)
+		return
+	}
+
 	userLoan, err := a.repository.GetUserLoan(ctx, loanId, userId)
 	if errors.Is(err, ErrUserLoanNotFound) {
 		out.Response = resp.NewResponse(http.StatusNotFound, "", err)
@@ -313,13 +372,17 @@ func (a *LoanApp) UpdateLoan(ctx context.Context, loanId string, userId string,
 		return
 	}
 
-	if userLoan.Status != Wait.String() {
+	// the loan that needs info is only editable on the fields the officer unlocked
+	status, _ := FromString(userLoan.Status)
+	needsInfo := status == NeedsInfo
+	if !status.IsEditable() && !needsInfo {
 		out.Response = resp.NewResponse(http.StatusBadRequest, "", ErrModifyProcessLoan)
 		return
 	}
+	currentLoan := userLoan
 
 	var fileUrl string
-	if in.IdCard.File != nil {
+	if in.IdCard.File != nil && (!needsInfo || isUnlocked(currentLoan, "id_card")) {
 		var err error
 		fileUrl, err = a.saveFile(in.IdCard.Filename, in.IdCard.File)
 		if err != nil {
@@ -333,7 +396,7 @@ func (a *LoanApp) UpdateLoan(ctx context.Context, loanId string, userId string,
 	userLoan.ActiveFieldNumber = in.ActiveFieldNumber
 	userLoan.SowSeedsPerCycle = in.SowSeedsPerCycle
 	userLoan.NeededFertilizerPerCycleInKg = in.NeededFertilizerPerCycleInKg
-	userLoan.EstimatedYieldInKg = in.EstimatedPriceOfHarvestPerKg
+	userLoan.EstimatedYieldInKg = in.EstimatedYieldInKg
 	userLoan.EstimatedPriceOfHarvestPerKg = in.EstimatedPriceOfHarvestPerKg
 	userLoan.HarvestCycleInMonths = in.HarvestCycleInMonths
 	userLoan.LoanApplicationInIdr = in.LoanApplicationInIdr
@@ -345,8 +408,22 @@ func (a *LoanApp) UpdateLoan(ctx context.Context, loanId string, userId string,
 	userLoan.Phone = in.Phone
 	userLoan.IdCardUrl = fileUrl
 	userLoan.OtherBusiness = in.OtherBusiness
+	userLoan.Region = strings.TrimSpace(in.Region)
+	if needsInfo {
+		userLoan = keepLockedFields(userLoan, currentLoan)
+	}
+	userLoan = scoreLoan(userLoan)
 
-	if err = a.repository.UpdateLoan(ctx, loanId, userLoan); err != nil {
+	err = a.repository.UpdateLoan(ctx, currentLoan.Status, userLoan)
+	if errors.Is(err, ErrLoanStatusChanged) {
+		out.Response = resp.NewResponse(http.StatusConflict, "", err)
+		return
+	}
+	if errors.Is(err, ErrUserLoanNotFound) {
+		out.Response = resp.NewResponse(http.StatusNotFound, "", err)
+		return
+	}
+	if err != nil {
 		out.Response = resp.NewResponse(http.StatusInternalServerError, "", err)
 		return
 	}
@@ -358,6 +435,9 @@ func (a *LoanApp) UpdateLoan(ctx context.Context, loanId string, userId string,
 	return
 }
 
+// deleteReason is the withdraw reason of the loan deleted by the applicant
+const deleteReason = "Deleted by the applicant"
+
 type (
 	DeleteLoanRes struct {
 		Id string `json:"id"`
@@ -370,7 +450,7 @@ type (
 
 func (a *LoanApp) DeleteLoan(ctx context.Context, loanId string, userId string) (out DeleteLoanOut) {
 	out.Response = resp.NewResponse(http.StatusOK, "", nil)
-	_, err := a.repository.GetUser(ctx, userId)
+	user, err := a.repository.GetUser(ctx, userId)
 	if errors.Is(err, ErrUserNotFound) {
 		out.Response = resp.NewResponse(http.StatusNotFound, "", err)
 		return
@@ -380,6 +460,11 @@ func (a *LoanApp) DeleteLoan(ctx context.Context, loanId string, userId string)
 		return
 	}
 
+	if !rbac.Can(user.Role, rbac.LoanDeleteOwn) {
+		out.Response = resp.NewResponse(http.StatusForbidden, "", ErrUserForbidden)
+		return
+	}
+
 	userLoan, err := a.repository.GetUserLoan(ctx, loanId, userId)
 	if errors.Is(err, ErrUserLoanNotFound) {
 		out.Response = resp.NewResponse(http.StatusNotFound, "", err)
@@ -390,12 +475,38 @@ func (a *LoanApp) DeleteLoan(ctx context.Context, loanId string, userId string)
 		return
 	}
 
-	if userLoan.Status != Wait.String() {
+	if status, _ := FromString(userLoan.Status); !status.IsEditable() {
 		out.Response = resp.NewResponse(http.StatusBadRequest, "", ErrModifyProcessLoan)
 		return
 	}
 
-	if err = a.repository.RemoveLoan(ctx, loanId); err != nil {
+	// The deleted loan is cancelled first, so it leave the queue and its history
+	// tell why it was closed, the same as when the applicant withdraw it
+	from, to, res := nextStatus(user, userLoan, ActionCancel)
+	if res.Error != nil {
+		out.Response = res
+		return
+	}
+
+	prevStatus := userLoan.Status
+	userLoan.Status = to.String()
+	userLoan.WithdrawReason = deleteReason
+	_, err = a.repository.WithdrawLoan(ctx, prevStatus, userLoan, model.LoanStatusHistory{
+		FromStatus: from.String(),
+		ToStatus:   to.String(),
+		ActorId:    user.Id,
+		ActorRole:  user.Role,
+		Comment:    deleteReason,
+	})
+	if errors.Is(err, ErrUserLoanNotFound) {
+		out.Response = resp.NewResponse(http.StatusNotFound, "", err)
+		return
+	}
+	if errors.Is(err, ErrLoanStatusChanged) {
+		out.Response = resp.NewResponse(http.StatusConflict, "", err)
+		return
+	}
+	if err != nil {
 		out.Response = resp.NewResponse(http.StatusInternalServerError, "", err)
 		return
 	}
@@ -430,7 +541,42 @@ func (a *LoanApp) GetLoans(ctx context.Context) (out GetUserLoanOut) {
 		return
 	}
 
-	res := make([]GetUserLoanRes, 0, 0)
+	loans := make([]model.LoanApplication, 0, len(userLoans))
+	for _, loan := range userLoans {
+		loans = append(loans, loan)
+	}
+	sort.Slice(loans, func(i, j int) bool {
+		return loans[i].CreatedDate.Before(loans[j].CreatedDate)
+	})
+
+	res := make([]GetUserLoanRes, 0, len(loans))
+	for _, loan := range loans {
+		res = append(res, GetUserLoanRes{
+			LoanId:          loan.Id,
+			UserId:          loan.UserId,
+			FullName:        loan.FullName,
+			LoanStatus:      loan.Status,
+			LoanCreatedDate: loan.CreatedDate.Format("2006-01-02"),
+		})
+	}
+
+	out.Res = res
+
+	return
+}
+
+// GetDeletedLoans list the loan deleted by the applicant or archived by the officer,
+// they are hidden from every other listing until restored
+func (a *LoanApp) GetDeletedLoans(ctx context.Context) (out GetUserLoanOut) {
+	out.Response = resp.NewResponse(http.StatusOK, "", nil)
+
+	userLoans, err := a.repository.GetDeletedLoans(ctx)
+	if err != nil {
+		out.Response = resp.NewResponse(http.StatusInternalServerError, "", err)
+		return
+	}
+
+	res := make([]GetUserLoanRes, 0, len(userLoans))
 	for _, loan := range userLoans {
 		res = append(res, GetUserLoanRes{
 			LoanId:          loan.Id,
@@ -448,26 +594,38 @@ func (a *LoanApp) GetLoans(ctx context.Context) (out GetUserLoanOut) {
 
 type (
 	GetLoanDetailRes struct {
-		IsPrivateField               bool   `json:"is_private_field"`
-		ExpInYear                    int64  `json:"exp_in_year"`
-		ActiveFieldNumber            int64  `json:"active_field_number"`
-		SowSeedsPerCycle             int64  `json:"sow_seeds_per_cycle"`
-		NeededFertilizerPerCycleInKg int64  `json:"needed_fertilizer_per_cycle_in_kg"`
-		EstimatedYieldInKg           int64  `json:"estimated_yield_in_kg"`
-		EstimatedPriceOfHarvestPerKg int64  `json:"estimated_price_of_harvest_per_kg"`
-		HarvestCycleInMonths         int64  `json:"harvest_cycle_in_months"`
-		LoanApplicationInIdr         int64  `json:"loan_application_in_idr"`
-		BusinessIncomePerMonthInIdr  int64  `json:"business_income_per_month_in_idr"`
-		BusinessOutcomePerMonthInIdr int64  `json:"business_outcome_per_month_in_idr"`
-		LoanId                       string `json:"loan_id"`
-		UserId                       string `json:"user_id"`
-		FullName                     string `json:"full_name"`
-		BirthDate                    string `json:"birth_date"`
-		FullAddress                  string `json:"full_address"`
-		Phone                        string `json:"phone"`
-		OtherBusiness                string `json:"other_business"`
-		IdCardUrl                    string `json:"id_card_url"`
-		Status                       string `json:"status"`
+		IsPrivateField               bool                `json:"is_private_field"`
+		ExpInYear                    int64               `json:"exp_in_year"`
+		ActiveFieldNumber            int64               `json:"active_field_number"`
+		SowSeedsPerCycle             int64               `json:"sow_seeds_per_cycle"`
+		NeededFertilizerPerCycleInKg int64               `json:"needed_fertilizer_per_cycle_in_kg"`
+		EstimatedYieldInKg           int64               `json:"estimated_yield_in_kg"`
+		EstimatedPriceOfHarvestPerKg int64               `json:"estimated_price_of_harvest_per_kg"`
+		HarvestCycleInMonths         int64               `json:"harvest_cycle_in_months"`
+		LoanApplicationInIdr         int64               `json:"loan_application_in_idr"`
+		BusinessIncomePerMonthInIdr  int64               `json:"business_income_per_month_in_idr"`
+		BusinessOutcomePerMonthInIdr int64               `json:"business_outcome_per_month_in_idr"`
+		LoanId                       string              `json:"loan_id"`
+		UserId                       string              `json:"user_id"`
+		FullName                     string              `json:"full_name"`
+		BirthDate                    string              `json:"birth_date"`
+		FullAddress                  string              `json:"full_address"`
+		Phone                        string              `json:"phone"`
+		OtherBusiness                string              `json:"other_business"`
+		IdCardUrl                    string              `json:"id_card_url"`
+		Status                       string              `json:"status"`
+		DecisionReasons              []DecisionReasonRes `json:"decision_reasons"`
+		DecisionNote                 string              `json:"decision_note"`
+		DecisionInternalNote         string              `json:"decision_internal_note"`
+		UnlockedFields               []string            `json:"unlocked_fields"`
+		InfoRequestNote              string              `json:"info_request_note"`
+		WithdrawReason               string              `json:"withdraw_reason"`
+		Region                       string              `json:"region"`
+		OfficerId                    string              `json:"officer_id"`
+		ClaimedDate                  string              `json:"claimed_date"`
+		RequiredApprovals            int                 `json:"required_approvals"`
+		ApprovalSignatures           []ApprovalRes       `json:"approval_signatures"`
+		CreditScore                  CreditScoreRes      `json:"credit_score"`
 	}
 	GetLoanDetailOut struct {
 		resp.Response
@@ -488,13 +646,19 @@ func (a *LoanApp) GetLoanDetail(ctx context.Context, loanId string) (out GetLoan
 		return
 	}
 
+	signatures, err := a.repository.GetApprovalSignatures(ctx, loanId)
+	if err != nil {
+		out.Response = resp.NewResponse(http.StatusInternalServerError, "", err)
+		return
+	}
+
 	out.Res = GetLoanDetailRes{
 		IsPrivateField:               userLoan.IsPrivateField,
 		ExpInYear:                    userLoan.ExpInYear,
 		ActiveFieldNumber:            userLoan.ActiveFieldNumber,
 		SowSeedsPerCycle:             userLoan.SowSeedsPerCycle,
 		NeededFertilizerPerCycleInKg: userLoan.NeededFertilizerPerCycleInKg,
-		EstimatedYieldInKg:           userLoan.EstimatedPriceOfHarvestPerKg,
+		EstimatedYieldInKg:           userLoan.EstimatedYieldInKg,
 		EstimatedPriceOfHarvestPerKg: userLoan.EstimatedPriceOfHarvestPerKg,
 		HarvestCycleInMonths:         userLoan.HarvestCycleInMonths,
 		LoanApplicationInIdr:         userLoan.LoanApplicationInIdr,
@@ -509,6 +673,18 @@ func (a *LoanApp) GetLoanDetail(ctx context.Context, loanId string) (out GetLoan
 		OtherBusiness:                userLoan.OtherBusiness,
 		IdCardUrl:                    userLoan.IdCardUrl,
 		Status:                       userLoan.Status,
+		DecisionReasons:              decisionReasonsRes(userLoan.DecisionReasons),
+		DecisionNote:                 userLoan.DecisionNote,
+		DecisionInternalNote:         userLoan.DecisionInternalNote,
+		UnlockedFields:               nonNilStrings(userLoan.UnlockedFields),
+		InfoRequestNote:              userLoan.InfoRequestNote,
+		WithdrawReason:               userLoan.WithdrawReason,
+		Region:                       userLoan.Region,
+		OfficerId:                    userLoan.OfficerId.String,
+		ClaimedDate:                  claimedDateRes(userLoan),
+		RequiredApprovals:            a.approval.Required(userLoan.LoanApplicationInIdr),
+		ApprovalSignatures:           approvalsRes(signatures),
+		CreditScore:                  creditScoreRes(userLoan),
 	}
 
 	return
@@ -537,7 +713,7 @@ func (a *LoanApp) ProceedLoan(ctx context.Context, loanId, userId string) (out P
 		return
 	}
 
-	if !user.IsOfficer {
+	if !rbac.Can(user.Role, rbac.LoanProceed) {
 		out.Response = resp.NewResponse(http.StatusForbidden, "", ErrUserForbidden)
 		return
 	}
@@ -552,15 +728,7 @@ func (a *LoanApp) ProceedLoan(ctx context.Context, loanId, userId string) (out P
 		return
 	}
 
-	if userLoan.Status != Wait.String() {
-		out.Response = resp.NewResponse(http.StatusBadRequest, "", ErrModifyProcessLoan)
-		return
-	}
-
-	userLoan.Status = Process.String()
-	userLoan.OfficerId.Scan(userId)
-	if err = a.repository.UpdateLoan(ctx, loanId, userLoan); err != nil {
-		out.Response = resp.NewResponse(http.StatusInternalServerError, "", err)
+	if _, out.Response = a.transition(ctx, user, userLoan, ActionReview, ""); out.Error != nil {
 		return
 	}
 
@@ -574,6 +742,7 @@ func (a *LoanApp) ProceedLoan(ctx context.Context, loanId, userId string) (out P
 type (
 	ApproveLoanIn struct {
 		IsApprove bool `json:"is_approve"`
+		DecisionIn
 	}
 	ApproveLoanRes struct {
 		Id string `json:"id"`
@@ -587,6 +756,11 @@ type (
 func (a *LoanApp) ApproveLoan(ctx context.Context, loanId, userId string, in ApproveLoanIn) (out ApproveLoanOut) {
 	out.Response = resp.NewResponse(http.StatusOK, "", nil)
 
+	if err := validateDecision(in.IsApprove, in.DecisionIn); err != nil {
+		out.Response = resp.NewResponse(http.StatusUnprocessableEntity, "", err)
+		return
+	}
+
 	user, err := a.repository.GetUser(ctx, userId)
 	if errors.Is(err, ErrUserNotFound) {
 		out.Response = resp.NewResponse(http.StatusNotFound, "", err)
@@ -597,7 +771,7 @@ func (a *LoanApp) ApproveLoan(ctx context.Context, loanId, userId string, in App
 		return
 	}
 
-	if !user.IsOfficer {
+	if !rbac.Can(user.Role, rbac.LoanApprove) {
 		out.Response = resp.NewResponse(http.StatusForbidden, "", ErrUserForbidden)
 		return
 	}
@@ -612,25 +786,863 @@ func (a *LoanApp) ApproveLoan(ctx context.Context, loanId, userId string, in App
 		return
 	}
 
-	if userLoan.Status != Process.String() {
-		out.Response = resp.NewResponse(http.StatusBadRequest, "", ErrModifyProcessLoan)
+	action := ActionReject
+	if in.IsApprove {
+		action = ActionApprove
+	}
+
+	userLoan = applyDecision(userLoan, in.DecisionIn)
+	if _, out.Response = a.decide(ctx, user, userLoan, action, userLoan.DecisionNote); out.Error != nil {
 		return
 	}
 
-	userLoan.OfficerId.Scan(userId)
+	out.Res = ApproveLoanRes{
+		Id: loanId,
+	}
 
-	userLoan.Status = Reject.String()
-	if in.IsApprove {
-		userLoan.Status = Approve.String()
+	return
+}
+
+// transition move the loan by the action of the user and save it with the history of the change,
+// the officer that move the loan become the officer of the loan
+func (a *LoanApp) transition(ctx context.Context, user model.User, userLoan model.LoanApplication, action Action, comment string) (model.LoanApplication, resp.Response) {
+	from, to, res := nextStatus(user, userLoan, action)
+	if res.Error != nil {
+		return model.LoanApplication{}, res
+	}
+
+	isOwner := userLoan.UserId == user.Id
+	if from == InReview {
+		if res := a.checkNoOpenVote(ctx, userLoan.Id); res.Error != nil {
+			return model.LoanApplication{}, res
+		}
+	}
+
+	// the officer in the queue can not work on the open loan claimed by the other officer
+	now := time.Now()
+	if !isOwner && from.IsOpen() && rbac.Can(user.Role, rbac.LoanQueue) &&
+		userLoan.OfficerId.String != user.Id && a.queue.IsClaimed(userLoan.OfficerId.String, userLoan.ClaimedDate, now) {
+		return model.LoanApplication{}, resp.NewResponse(http.StatusConflict, "", ErrLoanClaimed)
+	}
+
+	// the fields are locked again once the applicant resubmit or cancel the loan
+	if from == NeedsInfo {
+		userLoan.UnlockedFields = nil
+		userLoan.InfoRequestNote = ""
+	}
+
+	prevStatus := userLoan.Status
+	userLoan.Status = to.String()
+	switch {
+	case !isOwner:
+		userLoan.OfficerId = sql.NullString{String: user.Id, Valid: true}
+		userLoan.ClaimedDate = now
+	case to == Submitted:
+		assigned, err := a.assignLoan(ctx, userLoan)
+		if err != nil {
+			return model.LoanApplication{}, resp.NewResponse(http.StatusInternalServerError, "", err)
+		}
+		userLoan = assigned
+	case from == NeedsInfo && userLoan.OfficerId.String != "":
+		// the resubmitted loan is back in the queue of the officer that asked for the info
+		userLoan.ClaimedDate = now
+	}
+
+	_, err := a.repository.TransitionLoan(ctx, prevStatus, userLoan, model.LoanStatusHistory{
+		FromStatus: from.String(),
+		ToStatus:   to.String(),
+		ActorId:    user.Id,
+		ActorRole:  user.Role,
+		Comment:    comment,
+	})
+	if errors.Is(err, ErrUserLoanNotFound) {
+		return model.LoanApplication{}, resp.NewResponse(http.StatusNotFound, "", err)
+	}
+	if errors.Is(err, ErrLoanStatusChanged) {
+		return model.LoanApplication{}, resp.NewResponse(http.StatusConflict, "", err)
+	}
+	if err != nil {
+		return model.LoanApplication{}, resp.NewResponse(http.StatusInternalServerError, "", err)
+	}
+
+	return userLoan, resp.NewResponse(http.StatusOK, "", nil)
+}
+
+// nextStatus return the current status of the loan and the status the action of the user move it to
+func nextStatus(user model.User, userLoan model.LoanApplication, action Action) (Status, Status, resp.Response) {
+	from, err := FromString(userLoan.Status)
+	if err != nil {
+		return Unknown, Unknown, resp.NewResponse(http.StatusInternalServerError, "", err)
+	}
+
+	to, err := Next(from, action, user.Role, userLoan.UserId == user.Id)
+	if errors.Is(err, ErrActionForbidden) {
+		return Unknown, Unknown, resp.NewResponse(http.StatusForbidden, "", err)
+	}
+	if errors.Is(err, ErrTransitionNotAllowed) {
+		return Unknown, Unknown, resp.NewResponse(http.StatusBadRequest, "", ErrModifyProcessLoan)
+	}
+	if err != nil {
+		return Unknown, Unknown, resp.NewResponse(http.StatusInternalServerError, "", err)
+	}
+
+	return from, to, resp.NewResponse(http.StatusOK, "", nil)
+}
+
+// decide do the approve or reject action under the four-eyes principle, the officer that reviewed or own the loan
+// can not decide on it, and the approval only move the loan once it has the signatures its amount ask for
+func (a *LoanApp) decide(ctx context.Context, user model.User, userLoan model.LoanApplication, action Action, comment string) (model.LoanApplication, resp.Response) {
+	if _, _, res := nextStatus(user, userLoan, action); res.Error != nil {
+		return model.LoanApplication{}, res
+	}
+	if userLoan.UserId == user.Id {
+		return model.LoanApplication{}, resp.NewResponse(http.StatusForbidden, "", ErrDecideOwnLoan)
+	}
+	if a.committee.IsRequired(userLoan.LoanApplicationInIdr) {
+		return model.LoanApplication{}, resp.NewResponse(http.StatusForbidden, "", ErrCommitteeRequired)
+	}
+	if res := a.checkNoOpenVote(ctx, userLoan.Id); res.Error != nil {
+		return model.LoanApplication{}, res
+	}
+
+	reviewers, _, err := a.approvalState(ctx, userLoan.Id)
+	if err != nil {
+		return model.LoanApplication{}, resp.NewResponse(http.StatusInternalServerError, "", err)
+	}
+	if reviewers[user.Id] {
+		return model.LoanApplication{}, resp.NewResponse(http.StatusForbidden, "", ErrSameReviewer)
+	}
+	if action == ActionReject {
+		return a.transition(ctx, user, userLoan, action, comment)
+	}
+
+	signatures, err := a.repository.SignLoan(ctx, userLoan.Status, model.ApprovalSignature{
+		LoanId:       userLoan.Id,
+		ApproverId:   user.Id,
+		ApproverRole: user.Role,
+		Note:         comment,
+	})
+	if errors.Is(err, ErrUserLoanNotFound) {
+		return model.LoanApplication{}, resp.NewResponse(http.StatusNotFound, "", err)
+	}
+	if errors.Is(err, ErrLoanStatusChanged) || errors.Is(err, ErrAlreadySigned) {
+		return model.LoanApplication{}, resp.NewResponse(http.StatusConflict, "", err)
+	}
+	if err != nil {
+		return model.LoanApplication{}, resp.NewResponse(http.StatusInternalServerError, "", err)
+	}
+
+	// the loan stay in review until the next approver sign it
+	if !a.approval.isApproved(userLoan, signatures) {
+		return userLoan, resp.NewResponse(http.StatusOK, "", nil)
+	}
+
+	return a.transition(ctx, user, userLoan, action, comment)
+}
+
+// approvalState return the officers that reviewed the loan and the signatures given since its last review
+func (a *LoanApp) approvalState(ctx context.Context, loanId string) (map[string]bool, []model.ApprovalSignature, error) {
+	histories, err := a.repository.GetLoanHistories(ctx, loanId)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	signatures, err := a.repository.GetApprovalSignatures(ctx, loanId)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	return reviewersOf(histories), currentSignatures(signatures, histories), nil
+}
+
+// getActorLoan return the loan the user can see, the applicant only see their own loan
+// so the loan of the other applicant is not found the same as the one that does not exist
+func (a *LoanApp) getActorLoan(ctx context.Context, loanId, userId string) (model.User, model.LoanApplication, resp.Response) {
+	user, err := a.repository.GetUser(ctx, userId)
+	if errors.Is(err, ErrUserNotFound) {
+		return model.User{}, model.LoanApplication{}, resp.NewResponse(http.StatusNotFound, "", err)
+	}
+	if err != nil {
+		return model.User{}, model.LoanApplication{}, resp.NewResponse(http.StatusInternalServerError, "", err)
+	}
+
+	userLoan, err := a.repository.GetLoan(ctx, loanId)
+	if err == nil && userLoan.UserId != user.Id && !rbac.Can(user.Role, rbac.LoanReadAll) {
+		err = ErrUserLoanNotFound
+	}
+	if errors.Is(err, ErrUserLoanNotFound) {
+		return model.User{}, model.LoanApplication{}, resp.NewResponse(http.StatusNotFound, "", err)
+	}
+	if err != nil {
+		return model.User{}, model.LoanApplication{}, resp.NewResponse(http.StatusInternalServerError, "", err)
+	}
+
+	return user, userLoan, resp.NewResponse(http.StatusOK, "", nil)
+}
+
+type (
+	TransitionIn struct {
+		Action  string `json:"action"`
+		Comment string `json:"comment"`
+		// Fields is only read by the request_info action, they are the fields the applicant may correct
+		Fields []string `json:"fields"`
+		// DecisionIn is only read by the approve and reject action
+		DecisionIn
+	}
+	TransitionRes struct {
+		Id     string `json:"id"`
+		Status string `json:"status"`
+	}
+	TransitionOut struct {
+		resp.Response
+		Res TransitionRes
+	}
+)
+
+// Transition do any action of the transition table on the loan,
+// the role and the ownership of the user decide which action is allowed
+func (a *LoanApp) Transition(ctx context.Context, loanId, userId string, in TransitionIn) (out TransitionOut) {
+	out.Response = resp.NewResponse(http.StatusOK, "", nil)
+
+	if err := validateTransition(in); err != nil {
+		out.Response = resp.NewResponse(http.StatusUnprocessableEntity, "", err)
+		return
+	}
+
+	action, err := ActionFromString(in.Action)
+	if err != nil {
+		out.Response = resp.NewResponse(http.StatusUnprocessableEntity, "", ErrActionNotValid)
+		return
+	}
+
+	if action == ActionRequestInfo {
+		if err := validateRequestInfo(in.Fields); err != nil {
+			out.Response = resp.NewResponse(http.StatusUnprocessableEntity, "", err)
+			return
+		}
+	}
+	if action == ActionCancel {
+		if err := validateWithdraw(in.Comment); err != nil {
+			out.Response = resp.NewResponse(http.StatusUnprocessableEntity, "", err)
+			return
+		}
+	}
+
+	isDecision := action == ActionApprove || action == ActionReject
+	if isDecision {
+		if err := validateDecision(action == ActionApprove, in.DecisionIn); err != nil {
+			out.Response = resp.NewResponse(http.StatusUnprocessableEntity, "", err)
+			return
+		}
+	}
+
+	user, userLoan, res := a.getActorLoan(ctx, loanId, userId)
+	if res.Error != nil {
+		out.Response = res
+		return
+	}
+
+	comment := strings.TrimSpace(in.Comment)
+	if action == ActionRequestInfo {
+		userLoan.UnlockedFields = uniqueStrings(in.Fields)
+		userLoan.InfoRequestNote = comment
+	}
+	if action == ActionCancel {
+		userLoan.WithdrawReason = comment
+	}
+	if isDecision {
+		userLoan = applyDecision(userLoan, in.DecisionIn)
+		if comment == "" {
+			comment = userLoan.DecisionNote
+		}
+	}
+
+	move := a.transition
+	if isDecision {
+		move = a.decide
+	}
+	if userLoan, out.Response = move(ctx, user, userLoan, action, comment); out.Error != nil {
+		return
+	}
+
+	out.Res = TransitionRes{
+		Id:     userLoan.Id,
+		Status: userLoan.Status,
 	}
 
-	if err = a.repository.UpdateLoan(ctx, loanId, userLoan); err != nil {
+	return
+}
+
+type (
+	LoanActionsRes struct {
+		Id      string   `json:"id"`
+		Status  string   `json:"status"`
+		Actions []string `json:"actions"`
+	}
+	LoanActionsOut struct {
+		resp.Response
+		Res LoanActionsRes
+	}
+)
+
+// GetLoanActions list the action the user can do next on the loan
+func (a *LoanApp) GetLoanActions(ctx context.Context, loanId, userId string) (out LoanActionsOut) {
+	out.Response = resp.NewResponse(http.StatusOK, "", nil)
+
+	user, userLoan, res := a.getActorLoan(ctx, loanId, userId)
+	if res.Error != nil {
+		out.Response = res
+		return
+	}
+
+	status, err := FromString(userLoan.Status)
+	if err != nil {
 		out.Response = resp.NewResponse(http.StatusInternalServerError, "", err)
 		return
 	}
 
-	out.Res = ApproveLoanRes{
-		Id: loanId,
+	reviewers, signatures, err := a.approvalState(ctx, userLoan.Id)
+	if err != nil {
+		out.Response = resp.NewResponse(http.StatusInternalServerError, "", err)
+		return
+	}
+
+	// nobody move the loan while the committee vote on it
+	isVoting := false
+	if status == InReview {
+		res := a.checkNoOpenVote(ctx, userLoan.Id)
+		if res.StatusCode == http.StatusInternalServerError {
+			out.Response = res
+			return
+		}
+		isVoting = res.Error != nil
+	}
+
+	isOwner := userLoan.UserId == user.Id
+	actions := make([]string, 0)
+	for _, v := range Actions(status, user.Role, isOwner) {
+		isDecision := v == ActionApprove || v == ActionReject
+		if isVoting || (isDecision && (isOwner || reviewers[user.Id] || a.committee.IsRequired(userLoan.LoanApplicationInIdr))) ||
+			(v == ActionApprove && hasSigned(signatures, user.Id)) {
+			continue
+		}
+
+		actions = append(actions, v.String())
+	}
+
+	out.Res = LoanActionsRes{
+		Id:      userLoan.Id,
+		Status:  status.String(),
+		Actions: actions,
+	}
+
+	return
+}
+
+type (
+	LoanHistoryRes struct {
+		FromStatus  string `json:"from_status"`
+		ToStatus    string `json:"to_status"`
+		ActorId     string `json:"actor_id"`
+		ActorRole   string `json:"actor_role"`
+		Comment     string `json:"comment"`
+		CreatedDate string `json:"created_date"`
+	}
+	LoanHistoryOut struct {
+		resp.Response
+		Res []LoanHistoryRes
+	}
+)
+
+// GetLoanHistory list every status change of the loan, the oldest first, the applicant
+// see the role of the officer that changed it but not who the officer is
+func (a *LoanApp) GetLoanHistory(ctx context.Context, loanId, userId string) (out LoanHistoryOut) {
+	out.Response = resp.NewResponse(http.StatusOK, "", nil)
+
+	user, userLoan, res := a.getActorLoan(ctx, loanId, userId)
+	if res.Error != nil {
+		out.Response = res
+		return
+	}
+
+	histories, err := a.repository.GetLoanHistories(ctx, userLoan.Id)
+	if err != nil {
+		out.Response = resp.NewResponse(http.StatusInternalServerError, "", err)
+		return
+	}
+
+	isOfficer := rbac.Can(user.Role, rbac.LoanReadAll)
+	out.Res = make([]LoanHistoryRes, 0, len(histories))
+	for _, h := range histories {
+		actorId := h.ActorId
+		if !isOfficer && actorId != user.Id {
+			actorId = ""
+		}
+
+		out.Res = append(out.Res, LoanHistoryRes{
+			FromStatus:  h.FromStatus,
+			ToStatus:    h.ToStatus,
+			ActorId:     actorId,
+			ActorRole:   h.ActorRole,
+			Comment:     h.Comment,
+			CreatedDate: h.CreatedDate.Format(time.RFC3339),
+		})
+	}
+
+	return
+}
+
+type WithdrawIn struct {
+	Reason string `json:"reason"`
+}
+
+// Withdraw is the cancel action of the applicant, the reason is kept on the loan and in the history
+func (a *LoanApp) Withdraw(ctx context.Context, loanId, userId string, in WithdrawIn) (out TransitionOut) {
+	return a.Transition(ctx, loanId, userId, TransitionIn{
+		Action:  ActionCancel.String(),
+		Comment: in.Reason,
+	})
+}
+
+type (
+	ArchiveLoanRes struct {
+		Id string `json:"id"`
+	}
+	ArchiveLoanOut struct {
+		resp.Response
+		Res ArchiveLoanRes
+	}
+)
+
+// ArchiveLoan hide the final loan from the listing, the loan is kept and can be restored
+func (a *LoanApp) ArchiveLoan(ctx context.Context, loanId, userId string) (out ArchiveLoanOut) {
+	out.Response = resp.NewResponse(http.StatusOK, "", nil)
+
+	user, err := a.repository.GetUser(ctx, userId)
+	if errors.Is(err, ErrUserNotFound) {
+		out.Response = resp.NewResponse(http.StatusNotFound, "", err)
+		return
+	}
+	if err != nil {
+		out.Response = resp.NewResponse(http.StatusInternalServerError, "", err)
+		return
+	}
+
+	if !rbac.Can(user.Role, rbac.LoanArchive) {
+		out.Response = resp.NewResponse(http.StatusForbidden, "", ErrUserForbidden)
+		return
+	}
+
+	userLoan, err := a.repository.GetLoan(ctx, loanId)
+	if errors.Is(err, ErrUserLoanNotFound) {
+		out.Response = resp.NewResponse(http.StatusNotFound, "", err)
+		return
+	}
+	if err != nil {
+		out.Response = resp.NewResponse(http.StatusInternalServerError, "", err)
+		return
+	}
+
+	if status, _ := FromString(userLoan.Status); !status.IsFinal() {
+		out.Response = resp.NewResponse(http.StatusBadRequest, "", ErrArchiveOpenLoan)
+		return
+	}
+
+	err = a.repository.RemoveLoan(ctx, loanId)
+	if errors.Is(err, ErrUserLoanNotFound) {
+		out.Response = resp.NewResponse(http.StatusNotFound, "", err)
+		return
+	}
+	if err != nil {
+		out.Response = resp.NewResponse(http.StatusInternalServerError, "", err)
+		return
+	}
+
+	out.Res = ArchiveLoanRes{
+		Id: loanId,
+	}
+
+	return
+}
+
+type (
+	RestoreLoanRes struct {
+		Id string `json:"id"`
+	}
+	RestoreLoanOut struct {
+		resp.Response
+		Res RestoreLoanRes
+	}
+)
+
+// RestoreLoan bring back the loan deleted by the applicant or archived by the officer
+func (a *LoanApp) RestoreLoan(ctx context.Context, loanId, userId string) (out RestoreLoanOut) {
+	out.Response = resp.NewResponse(http.StatusOK, "", nil)
+
+	user, err := a.repository.GetUser(ctx, userId)
+	if errors.Is(err, ErrUserNotFound) {
+		out.Response = resp.NewResponse(http.StatusNotFound, "", err)
+		return
+	}
+	if err != nil {
+		out.Response = resp.NewResponse(http.StatusInternalServerError, "", err)
+		return
+	}
+
+	if !rbac.Can(user.Role, rbac.LoanArchive) {
+		out.Response = resp.NewResponse(http.StatusForbidden, "", ErrUserForbidden)
+		return
+	}
+
+	err = a.repository.RestoreLoan(ctx, loanId)
+	if errors.Is(err, ErrUserLoanNotFound) {
+		out.Response = resp.NewResponse(http.StatusNotFound, "", err)
+		return
+	}
+	if errors.Is(err, ErrProcessLoanExist) {
+		out.Response = resp.NewResponse(http.StatusConflict, "", err)
+		return
+	}
+	if err != nil {
+		out.Response = resp.NewResponse(http.StatusInternalServerError, "", err)
+		return
+	}
+
+	out.Res = RestoreLoanRes{
+		Id: loanId,
+	}
+
+	return
+}
+
+// authorize return the user that has the permission, the returned response
+// carry the error when the user is not found or not allowed
+func (a *LoanApp) authorize(ctx context.Context, userId string, p rbac.Permission) (model.User, resp.Response) {
+	user, err := a.repository.GetUser(ctx, userId)
+	if errors.Is(err, ErrUserNotFound) {
+		return model.User{}, resp.NewResponse(http.StatusNotFound, "", err)
+	}
+	if err != nil {
+		return model.User{}, resp.NewResponse(http.StatusInternalServerError, "", err)
+	}
+
+	if !rbac.Can(user.Role, p) {
+		return model.User{}, resp.NewResponse(http.StatusForbidden, "", ErrUserForbidden)
+	}
+
+	return user, resp.NewResponse(http.StatusOK, "", nil)
+}
+
+// assignLoan give the submitted loan to an officer by the strategy of the queue,
+// the loan stay in the pool when there is no officer
+func (a *LoanApp) assignLoan(ctx context.Context, userLoan model.LoanApplication) (model.LoanApplication, error) {
+	officers, err := a.repository.GetQueueOfficers(ctx, rbac.RolesWith(rbac.LoanQueue), a.queue.IsClaimed)
+	if err != nil {
+		return model.LoanApplication{}, err
+	}
+
+	if officer, ok := a.queue.Pick(officers, userLoan.Region); ok {
+		userLoan.OfficerId = sql.NullString{String: officer.Id, Valid: true}
+		userLoan.ClaimedDate = time.Now()
+	}
+
+	return userLoan, nil
+}
+
+// isQueued is the loan waiting for the officer, the draft is not submitted yet
+func isQueued(userLoan model.LoanApplication) bool {
+	status, _ := FromString(userLoan.Status)
+	return status.IsOpen() && status != Draft
+}
+
+func claimedDateRes(userLoan model.LoanApplication) string {
+	if userLoan.OfficerId.String == "" {
+		return ""
+	}
+
+	return userLoan.ClaimedDate.Format(time.RFC3339)
+}
+
+type (
+	QueueRes struct {
+		LoanId          string `json:"loan_id"`
+		UserId          string `json:"user_id"`
+		FullName        string `json:"full_name"`
+		LoanStatus      string `json:"loan_status"`
+		Region          string `json:"region"`
+		OfficerId       string `json:"officer_id"`
+		ClaimedDate     string `json:"claimed_date"`
+		LoanCreatedDate string `json:"loan_created_date"`
+	}
+	GetQueueOut struct {
+		resp.Response
+		Res []QueueRes
+	}
+)
+
+// getQueue list the queued loan that pass the filter, the oldest first
+func (a *LoanApp) getQueue(ctx context.Context, userId string, filter func(model.LoanApplication) bool) (out GetQueueOut) {
+	out.Response = resp.NewResponse(http.StatusOK, "", nil)
+
+	if _, out.Response = a.authorize(ctx, userId, rbac.LoanQueue); out.Error != nil {
+		return
+	}
+
+	userLoans, err := a.repository.GetLoans(ctx)
+	if err != nil {
+		out.Response = resp.NewResponse(http.StatusInternalServerError, "", err)
+		return
+	}
+
+	loans := make([]model.LoanApplication, 0, len(userLoans))
+	for _, loan := range userLoans {
+		if isQueued(loan) && filter(loan) {
+			loans = append(loans, loan)
+		}
+	}
+	sort.Slice(loans, func(i, j int) bool {
+		return loans[i].CreatedDate.Before(loans[j].CreatedDate)
+	})
+
+	res := make([]QueueRes, 0, len(loans))
+	for _, loan := range loans {
+		res = append(res, QueueRes{
+			LoanId:          loan.Id,
+			UserId:          loan.UserId,
+			FullName:        loan.FullName,
+			LoanStatus:      loan.Status,
+			Region:          loan.Region,
+			OfficerId:       loan.OfficerId.String,
+			ClaimedDate:     claimedDateRes(loan),
+			LoanCreatedDate: loan.CreatedDate.Format("2006-01-02"),
+		})
+	}
+
+	out.Res = res
+
+	return
+}
+
+// GetMyQueue list the loan claimed by or assigned to the officer, the oldest first
+func (a *LoanApp) GetMyQueue(ctx context.Context, userId string) (out GetQueueOut) {
+	now := time.Now()
+	return a.getQueue(ctx, userId, func(loan model.LoanApplication) bool {
+		return loan.OfficerId.String == userId && a.queue.IsClaimed(userId, loan.ClaimedDate, now)
+	})
+}
+
+// GetQueuePool list the loan nobody hold, the one never assigned and the one which claim expired
+func (a *LoanApp) GetQueuePool(ctx context.Context, userId string) (out GetQueueOut) {
+	now := time.Now()
+	return a.getQueue(ctx, userId, func(loan model.LoanApplication) bool {
+		return !a.queue.IsClaimed(loan.OfficerId.String, loan.ClaimedDate, now)
+	})
+}
+
+type (
+	QueueLoanRes struct {
+		Id          string `json:"id"`
+		OfficerId   string `json:"officer_id"`
+		ClaimedDate string `json:"claimed_date"`
+	}
+	QueueLoanOut struct {
+		resp.Response
+		Res QueueLoanRes
+	}
+)
+
+// saveClaim keep the officer of the loan, it fail when someone else changed the officer since prevOfficerId was read
+func (a *LoanApp) saveClaim(ctx context.Context, prevOfficerId string, userLoan model.LoanApplication) (out QueueLoanOut) {
+	out.Response = resp.NewResponse(http.StatusOK, "", nil)
+
+	err := a.repository.AssignLoan(ctx, prevOfficerId, userLoan)
+	if errors.Is(err, ErrUserLoanNotFound) {
+		out.Response = resp.NewResponse(http.StatusNotFound, "", err)
+		return
+	}
+	if errors.Is(err, ErrLoanClaimed) {
+		out.Response = resp.NewResponse(http.StatusConflict, "", err)
+		return
+	}
+	if err != nil {
+		out.Response = resp.NewResponse(http.StatusInternalServerError, "", err)
+		return
+	}
+
+	out.Res = QueueLoanRes{
+		Id:          userLoan.Id,
+		OfficerId:   userLoan.OfficerId.String,
+		ClaimedDate: claimedDateRes(userLoan),
+	}
+
+	return
+}
+
+// getQueuedLoan return the loan that is waiting for the officer
+func (a *LoanApp) getQueuedLoan(ctx context.Context, loanId string) (model.LoanApplication, resp.Response) {
+	userLoan, err := a.repository.GetLoan(ctx, loanId)
+	if errors.Is(err, ErrUserLoanNotFound) {
+		return model.LoanApplication{}, resp.NewResponse(http.StatusNotFound, "", err)
+	}
+	if err != nil {
+		return model.LoanApplication{}, resp.NewResponse(http.StatusInternalServerError, "", err)
+	}
+
+	if !isQueued(userLoan) {
+		return model.LoanApplication{}, resp.NewResponse(http.StatusBadRequest, "", ErrLoanNotQueued)
+	}
+
+	return userLoan, resp.NewResponse(http.StatusOK, "", nil)
+}
+
+// ClaimLoan take the loan from the pool, or keep the loan the officer already hold for another ClaimTTL
+func (a *LoanApp) ClaimLoan(ctx context.Context, loanId, userId string) (out QueueLoanOut) {
+	user, res := a.authorize(ctx, userId, rbac.LoanQueue)
+	if res.Error != nil {
+		out.Response = res
+		return
+	}
+
+	userLoan, res := a.getQueuedLoan(ctx, loanId)
+	if res.Error != nil {
+		out.Response = res
+		return
+	}
+
+	now := time.Now()
+	prevOfficerId := userLoan.OfficerId.String
+	if prevOfficerId != user.Id && a.queue.IsClaimed(prevOfficerId, userLoan.ClaimedDate, now) {
+		out.Response = resp.NewResponse(http.StatusConflict, "", ErrLoanClaimed)
+		return
+	}
+
+	userLoan.OfficerId = sql.NullString{String: user.Id, Valid: true}
+	userLoan.ClaimedDate = now
+
+	return a.saveClaim(ctx, prevOfficerId, userLoan)
+}
+
+// ReleaseLoan put the loan the officer hold back to the pool
+func (a *LoanApp) ReleaseLoan(ctx context.Context, loanId, userId string) (out QueueLoanOut) {
+	user, res := a.authorize(ctx, userId, rbac.LoanQueue)
+	if res.Error != nil {
+		out.Response = res
+		return
+	}
+
+	userLoan, res := a.getQueuedLoan(ctx, loanId)
+	if res.Error != nil {
+		out.Response = res
+		return
+	}
+
+	if userLoan.OfficerId.String != user.Id || !a.queue.IsClaimed(user.Id, userLoan.ClaimedDate, time.Now()) {
+		out.Response = resp.NewResponse(http.StatusBadRequest, "", ErrLoanNotClaimed)
+		return
+	}
+
+	userLoan.OfficerId = sql.NullString{}
+	userLoan.ClaimedDate = time.Time{}
+
+	return a.saveClaim(ctx, user.Id, userLoan)
+}
+
+// queueOfficer return the active user that can be given a loan
+func (a *LoanApp) queueOfficer(ctx context.Context, officerId string) (model.User, resp.Response) {
+	officer, err := a.repository.GetUser(ctx, officerId)
+	if err == nil && (!officer.IsActive() || !rbac.Can(officer.Role, rbac.LoanQueue)) {
+		err = ErrOfficerNotValid
+	}
+	if errors.Is(err, ErrUserNotFound) || errors.Is(err, ErrOfficerNotValid) {
+		return model.User{}, resp.NewResponse(http.StatusUnprocessableEntity, "", ErrOfficerNotValid)
+	}
+	if err != nil {
+		return model.User{}, resp.NewResponse(http.StatusInternalServerError, "", err)
+	}
+
+	return officer, resp.NewResponse(http.StatusOK, "", nil)
+}
+
+type ReassignLoanIn struct {
+	OfficerId string `json:"officer_id"`
+}
+
+// ReassignLoan give the loan to another officer whoever hold it now
+func (a *LoanApp) ReassignLoan(ctx context.Context, loanId, userId string, in ReassignLoanIn) (out QueueLoanOut) {
+	if in.OfficerId == "" {
+		out.Response = resp.NewResponse(http.StatusUnprocessableEntity, "", ErrOfficerRequired)
+		return
+	}
+
+	if _, out.Response = a.authorize(ctx, userId, rbac.QueueManage); out.Error != nil {
+		return
+	}
+
+	officer, res := a.queueOfficer(ctx, in.OfficerId)
+	if res.Error != nil {
+		out.Response = res
+		return
+	}
+
+	userLoan, res := a.getQueuedLoan(ctx, loanId)
+	if res.Error != nil {
+		out.Response = res
+		return
+	}
+
+	prevOfficerId := userLoan.OfficerId.String
+	userLoan.OfficerId = sql.NullString{String: officer.Id, Valid: true}
+	userLoan.ClaimedDate = time.Now()
+
+	return a.saveClaim(ctx, prevOfficerId, userLoan)
+}
+
+type (
+	OfficerRegionIn struct {
+		OfficerId string `json:"officer_id"`
+		Region    string `json:"region"`
+	}
+	OfficerRegionRes struct {
+		OfficerId string `json:"officer_id"`
+		Region    string `json:"region"`
+	}
+	OfficerRegionOut struct {
+		resp.Response
+		Res OfficerRegionRes
+	}
+)
+
+// SetOfficerRegion set the region the officer work in, the empty region remove it
+func (a *LoanApp) SetOfficerRegion(ctx context.Context, userId string, in OfficerRegionIn) (out OfficerRegionOut) {
+	out.Response = resp.NewResponse(http.StatusOK, "", nil)
+
+	if err := validateOfficerRegion(in); err != nil {
+		out.Response = resp.NewResponse(http.StatusUnprocessableEntity, "", err)
+		return
+	}
+
+	if _, out.Response = a.authorize(ctx, userId, rbac.QueueManage); out.Error != nil {
+		return
+	}
+
+	officer, res := a.queueOfficer(ctx, in.OfficerId)
+	if res.Error != nil {
+		out.Response = res
+		return
+	}
+
+	region, err := a.repository.SetOfficerRegion(ctx, model.OfficerRegion{
+		UserId: officer.Id,
+		Region: strings.TrimSpace(in.Region),
+	})
+	if err != nil {
+		out.Response = resp.NewResponse(http.StatusInternalServerError, "", err)
+		return
+	}
+
+	out.Res = OfficerRegionRes{
+		OfficerId: region.UserId,
+		Region:    region.Region,
 	}
 
 	return
@@ -3,18 +3,24 @@ package loan_test
 import (
 	"context"
 	"database/sql"
+	"errors"
 	"fmt"
 	"io"
 	"log"
 	"net/http"
 	"os"
+	"sync"
 	"testing"
 	"time"
 
 	"github.com/fikryfahrezy/adea/los-postgre/auth"
+	"github.com/fikryfahrezy/adea/los-postgre/committee"
+	"github.com/fikryfahrezy/adea/los-postgre/id"
 	"github.com/fikryfahrezy/adea/los-postgre/loan"
 	"github.com/fikryfahrezy/adea/los-postgre/model"
-	"github.com/jackc/pgx/v4"
+	"github.com/fikryfahrezy/adea/los-postgre/queue"
+	"github.com/fikryfahrezy/adea/los-postgre/rbac"
+	"github.com/jackc/pgx/v4/pgxpool"
 	"github.com/ory/dockertest"
 )
 
@@ -23,13 +29,13 @@ var (
 		return "", nil
 	}
 	db       *sql.DB
-	dbPg     *pgx.Conn
+	dbPg     *pgxpool.Pool
 	authRepo *auth.Repository
 	loanRepo *loan.Repository
 	loanApp  *loan.LoanApp
 )
 
-func loadTables(conn *pgx.Conn) error {
+func loadTables(conn *pgxpool.Pool) error {
 	tx, err := conn.Begin(context.Background())
 	if err != nil {
 		return err
@@ -105,12 +111,12 @@ func TestMain(m *testing.M) {
 	// exponential backoff-retry, because the application in the container might not be ready to accept connections yet
 	pool.MaxWait = 120 * time.Second
 	if err = pool.Retry(func() error {
-		dbConfig, err := pgx.ParseConfig(databaseUrl)
+		dbConfig, err := pgxpool.ParseConfig(databaseUrl)
 		if err != nil {
 			return err
 		}
 
-		dbPg, err = pgx.ConnectConfig(context.Background(), dbConfig)
+		dbPg, err = pgxpool.ConnectConfig(context.Background(), dbConfig)
 		if err != nil {
 			return err
 		}
@@ -120,9 +126,9 @@ func TestMain(m *testing.M) {
 		log.Fatalf("Could not connect to cockroach container: %s", err)
 	}
 
-	authRepo = auth.NewRepository(dbPg)
-	loanRepo = loan.NewRepository(dbPg)
-	loanApp = loan.NewApp(uploadFunc, loanRepo)
+	authRepo = auth.NewRepository(dbPg, id.NewUlid())
+	loanRepo = loan.NewRepository(dbPg, id.NewUlid())
+	loanApp = loan.NewApp(uploadFunc, loanRepo, queue.New(queue.DefaultConfig()), loan.DefaultApprovalPolicy(), committee.DefaultConfig())
 
 	loadTables(dbPg)
 
@@ -142,9 +148,9 @@ func TestGetUserLoans(t *testing.T) {
 	ctx := context.Background()
 
 	user := model.User{
-		Username:  "username",
-		Password:  "password",
-		IsOfficer: false,
+		Username: "username",
+		Password: "password",
+		Role:     rbac.Applicant.String(),
 	}
 	user, _ = authRepo.InsertUser(ctx, user)
 
@@ -183,9 +189,9 @@ func TestGetUserLoansButUserNotFound(t *testing.T) {
 	ctx := context.Background()
 
 	user := model.User{
-		Username:  "username",
-		Password:  "password",
-		IsOfficer: false,
+		Username: "username",
+		Password: "password",
+		Role:     rbac.Applicant.String(),
 	}
 	user, _ = authRepo.InsertUser(ctx, user)
 
@@ -224,9 +230,9 @@ func TestGetUserLoanDetail(t *testing.T) {
 	ctx := context.Background()
 
 	user := model.User{
-		Username:  "username",
-		Password:  "password",
-		IsOfficer: false,
+		Username: "username",
+		Password: "password",
+		Role:     rbac.Applicant.String(),
 	}
 	user, _ = authRepo.InsertUser(ctx, user)
 
@@ -265,16 +271,16 @@ func TestGetUserLoanDetailButLoanNotBelongToUser(t *testing.T) {
 	ctx := context.Background()
 
 	user := model.User{
-		Username:  "username",
-		Password:  "password",
-		IsOfficer: false,
+		Username: "username",
+		Password: "password",
+		Role:     rbac.Applicant.String(),
 	}
 	user, _ = authRepo.InsertUser(ctx, user)
 
 	user2 := model.User{
-		Username:  "username2",
-		Password:  "password",
-		IsOfficer: false,
+		Username: "username2",
+		Password: "password",
+		Role:     rbac.Applicant.String(),
 	}
 	user2, _ = authRepo.InsertUser(ctx, user2)
 
@@ -313,9 +319,9 @@ func TestGetUserLoanDetailButUserNotFound(t *testing.T) {
 	ctx := context.Background()
 
 	user := model.User{
-		Username:  "username",
-		Password:  "password",
-		IsOfficer: false,
+		Username: "username",
+		Password: "password",
+		Role:     rbac.Applicant.String(),
 	}
 	user, _ = authRepo.InsertUser(ctx, user)
 
@@ -354,9 +360,9 @@ func TestGetUserLoanDetailButLoanNotFound(t *testing.T) {
 	ctx := context.Background()
 
 	user := model.User{
-		Username:  "username",
-		Password:  "password",
-		IsOfficer: false,
+		Username: "username",
+		Password: "password",
+		Role:     rbac.Applicant.String(),
 	}
 	user, _ = authRepo.InsertUser(ctx, user)
 
@@ -377,9 +383,9 @@ func TestCreateNewLoan(t *testing.T) {
 	}
 
 	user := model.User{
-		Username:  "username",
-		Password:  "password",
-		IsOfficer: false,
+		Username: "username",
+		Password: "password",
+		Role:     rbac.Applicant.String(),
 	}
 	user, _ = authRepo.InsertUser(ctx, user)
 
@@ -1165,9 +1171,9 @@ func TestCreateNewLoanWithExist(t *testing.T) {
 	ctx := context.Background()
 
 	user := model.User{
-		Username:  "username",
-		Password:  "password",
-		IsOfficer: false,
+		Username: "username",
+		Password: "password",
+		Role:     rbac.Applicant.String(),
 	}
 	user, _ = authRepo.InsertUser(ctx, user)
 
@@ -1190,12 +1196,10 @@ func TestCreateNewLoanWithExist(t *testing.T) {
 		OtherBusiness:                "-",
 		UserId:                       user.Id,
 		IdCardUrl:                    "http://random",
+		Status:                       loan.InReview.String(),
 	}
 	newLoan, _ = loanRepo.InsertLoan(ctx, newLoan)
 
-	newLoan.Status = loan.Process.String()
-	loanRepo.UpdateLoan(ctx, newLoan.Id, newLoan)
-
 	otherNewLoan := loan.CreateLoanIn{
 		IsPrivateField:               true,
 		ExpInYear:                    1,
@@ -1236,9 +1240,9 @@ func TestCreateNewLoanWithExistProcess(t *testing.T) {
 	ctx := context.Background()
 
 	user := model.User{
-		Username:  "username",
-		Password:  "password",
-		IsOfficer: false,
+		Username: "username",
+		Password: "password",
+		Role:     rbac.Applicant.String(),
 	}
 	user, _ = authRepo.InsertUser(ctx, user)
 
@@ -1261,12 +1265,10 @@ func TestCreateNewLoanWithExistProcess(t *testing.T) {
 		OtherBusiness:                "-",
 		UserId:                       user.Id,
 		IdCardUrl:                    "http://random",
+		Status:                       loan.InReview.String(),
 	}
 	newLoan, _ = loanRepo.InsertLoan(ctx, newLoan)
 
-	newLoan.Status = loan.Process.String()
-	loanRepo.UpdateLoan(ctx, newLoan.Id, newLoan)
-
 	otherNewLoan := loan.CreateLoanIn{
 		IsPrivateField:               true,
 		ExpInYear:                    1,
@@ -1307,9 +1309,9 @@ func TestCreateNewLoanWithExistReject(t *testing.T) {
 	ctx := context.Background()
 
 	user := model.User{
-		Username:  "username",
-		Password:  "password",
-		IsOfficer: false,
+		Username: "username",
+		Password: "password",
+		Role:     rbac.Applicant.String(),
 	}
 	user, _ = authRepo.InsertUser(ctx, user)
 
@@ -1332,12 +1334,10 @@ func TestCreateNewLoanWithExistReject(t *testing.T) {
 		OtherBusiness:                "-",
 		UserId:                       user.Id,
 		IdCardUrl:                    "http://random",
+		Status:                       loan.Rejected.String(),
 	}
 	newLoan, _ = loanRepo.InsertLoan(ctx, newLoan)
 
-	newLoan.Status = loan.Reject.String()
-	loanRepo.UpdateLoan(ctx, newLoan.Id, newLoan)
-
 	otherNewLoan := loan.CreateLoanIn{
 		IsPrivateField:               true,
 		ExpInYear:                    1,
@@ -1378,9 +1378,9 @@ func TestCreateNewLoanWithExistApprove(t *testing.T) {
 	ctx := context.Background()
 
 	user := model.User{
-		Username:  "username",
-		Password:  "password",
-		IsOfficer: false,
+		Username: "username",
+		Password: "password",
+		Role:     rbac.Applicant.String(),
 	}
 	user, _ = authRepo.InsertUser(ctx, user)
 
@@ -1403,12 +1403,10 @@ func TestCreateNewLoanWithExistApprove(t *testing.T) {
 		OtherBusiness:                "-",
 		UserId:                       user.Id,
 		IdCardUrl:                    "http://random",
+		Status:                       loan.Approved.String(),
 	}
 	newLoan, _ = loanRepo.InsertLoan(ctx, newLoan)
 
-	newLoan.Status = loan.Approve.String()
-	loanRepo.UpdateLoan(ctx, newLoan.Id, newLoan)
-
 	otherNewLoan := loan.CreateLoanIn{
 		IsPrivateField:               true,
 		ExpInYear:                    1,
@@ -1487,9 +1485,9 @@ func TestUpdateLoan(t *testing.T) {
 	}
 
 	user := model.User{
-		Username:  "username",
-		Password:  "password",
-		IsOfficer: false,
+		Username: "username",
+		Password: "password",
+		Role:     rbac.Applicant.String(),
 	}
 	user, _ = authRepo.InsertUser(ctx, user)
 
@@ -2357,9 +2355,9 @@ func TestUpdateLoanButLoanNotExist(t *testing.T) {
 	ctx := context.Background()
 
 	user := model.User{
-		Username:  "username",
-		Password:  "password",
-		IsOfficer: false,
+		Username: "username",
+		Password: "password",
+		Role:     rbac.Applicant.String(),
 	}
 	user, _ = authRepo.InsertUser(ctx, user)
 
@@ -2403,16 +2401,16 @@ func TestUpdateLoanButLoanNotBelongToUser(t *testing.T) {
 	ctx := context.Background()
 
 	user := model.User{
-		Username:  "username",
-		Password:  "password",
-		IsOfficer: false,
+		Username: "username",
+		Password: "password",
+		Role:     rbac.Applicant.String(),
 	}
 	user, _ = authRepo.InsertUser(ctx, user)
 
 	user2 := model.User{
-		Username:  "username2",
-		Password:  "password2",
-		IsOfficer: false,
+		Username: "username2",
+		Password: "password2",
+		Role:     rbac.Applicant.String(),
 	}
 	user2, _ = authRepo.InsertUser(ctx, user2)
 
@@ -2478,9 +2476,9 @@ func TestUpdateLoanWithStatusProcess(t *testing.T) {
 	ctx := context.Background()
 
 	user := model.User{
-		Username:  "username",
-		Password:  "password",
-		IsOfficer: false,
+		Username: "username",
+		Password: "password",
+		Role:     rbac.Applicant.String(),
 	}
 	user, _ = authRepo.InsertUser(ctx, user)
 
@@ -2505,11 +2503,9 @@ func TestUpdateLoanWithStatusProcess(t *testing.T) {
 		IdCardUrl:                    "http://random",
 	}
 
+	newLoan.Status = loan.InReview.String()
 	newLoan, err = loanRepo.InsertLoan(ctx, newLoan)
 
-	newLoan.Status = loan.Process.String()
-	loanRepo.UpdateLoan(ctx, newLoan.Id, newLoan)
-
 	otherNewLoan := loan.UpdateLoanIn{
 		IsPrivateField:               true,
 		ExpInYear:                    1,
@@ -2550,9 +2546,9 @@ func TestUpdateLoanWithStatusReject(t *testing.T) {
 	ctx := context.Background()
 
 	user := model.User{
-		Username:  "username",
-		Password:  "password",
-		IsOfficer: false,
+		Username: "username",
+		Password: "password",
+		Role:     rbac.Applicant.String(),
 	}
 	user, _ = authRepo.InsertUser(ctx, user)
 
@@ -2575,12 +2571,10 @@ func TestUpdateLoanWithStatusReject(t *testing.T) {
 		OtherBusiness:                "-",
 		UserId:                       user.Id,
 		IdCardUrl:                    "http://random",
+		Status:                       loan.Rejected.String(),
 	}
 	newLoan, _ = loanRepo.InsertLoan(ctx, newLoan)
 
-	newLoan.Status = loan.Reject.String()
-	loanRepo.UpdateLoan(ctx, newLoan.Id, newLoan)
-
 	otherNewLoan := loan.UpdateLoanIn{
 		IsPrivateField:               true,
 		ExpInYear:                    1,
@@ -2621,9 +2615,9 @@ func TestUpdateLoanWithStatusApprove(t *testing.T) {
 	ctx := context.Background()
 
 	user := model.User{
-		Username:  "username",
-		Password:  "password",
-		IsOfficer: false,
+		Username: "username",
+		Password: "password",
+		Role:     rbac.Applicant.String(),
 	}
 	user, _ = authRepo.InsertUser(ctx, user)
 
@@ -2646,12 +2640,10 @@ func TestUpdateLoanWithStatusApprove(t *testing.T) {
 		OtherBusiness:                "-",
 		UserId:                       user.Id,
 		IdCardUrl:                    "http://random",
+		Status:                       loan.Approved.String(),
 	}
 	newLoan, _ = loanRepo.InsertLoan(ctx, newLoan)
 
-	newLoan.Status = loan.Approve.String()
-	loanRepo.UpdateLoan(ctx, newLoan.Id, newLoan)
-
 	otherNewLoan := loan.UpdateLoanIn{
 		IsPrivateField:               true,
 		ExpInYear:                    1,
@@ -2681,15 +2673,96 @@ func TestUpdateLoanWithStatusApprove(t *testing.T) {
 	}
 }
 
+func TestUpdateLoanButStatusChanged(t *testing.T) {
+	clearDb()
+
+	f, err := os.OpenFile("./loan_application.go", os.O_RDONLY, 0o444)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	ctx := context.Background()
+
+	user := model.User{
+		Username: "username",
+		Password: "password",
+		Role:     rbac.Applicant.String(),
+	}
+	user, _ = authRepo.InsertUser(ctx, user)
+
+	officer := model.User{
+		Username: "officer",
+		Password: "password",
+		Role:     rbac.FieldOfficer.String(),
+	}
+	officer, _ = authRepo.InsertUser(ctx, officer)
+
+	newLoan := model.LoanApplication{
+		FullName: "Full Name",
+		UserId:   user.Id,
+		Status:   loan.Submitted.String(),
+	}
+	newLoan, _ = loanRepo.InsertLoan(ctx, newLoan)
+
+	// The applicant read the loan before the officer work on it
+	staleLoan, _ := loanRepo.GetUserLoan(ctx, newLoan.Id, user.Id)
+
+	if out := loanApp.ClaimLoan(ctx, newLoan.Id, officer.Id); out.Error != nil {
+		t.Fatalf("resulting: %v, expect: %v", out.Error, nil)
+	}
+
+	// The save of the applicant keep the claim of the officer
+	out := loanApp.UpdateLoan(ctx, newLoan.Id, user.Id, loan.UpdateLoanIn{
+		IsPrivateField:               true,
+		ExpInYear:                    1,
+		ActiveFieldNumber:            1,
+		SowSeedsPerCycle:             1,
+		NeededFertilizerPerCycleInKg: 1,
+		EstimatedYieldInKg:           1,
+		EstimatedPriceOfHarvestPerKg: 1,
+		HarvestCycleInMonths:         1,
+		LoanApplicationInIdr:         1,
+		BusinessIncomePerMonthInIdr:  1,
+		BusinessOutcomePerMonthInIdr: 1,
+		FullName:                     "Full Name",
+		BirthDate:                    "2006-01-02",
+		FullAddress:                  "Full Address",
+		Phone:                        "0000000000",
+		OtherBusiness:                "-",
+		IdCard: loan.FileHeader{
+			Filename: "test.img",
+			File:     f,
+		},
+	})
+	if out.StatusCode != http.StatusOK {
+		t.Fatalf("resulting: %d, expect: %d | err: %v", out.StatusCode, http.StatusOK, out.Error)
+	}
+	if out := loanApp.GetMyQueue(ctx, officer.Id); len(out.Res) != 1 || out.Res[0].LoanId != newLoan.Id {
+		t.Fatalf("resulting: %+v, expect: the claimed loan", out.Res)
+	}
+
+	if out := loanApp.ProceedLoan(ctx, newLoan.Id, officer.Id); out.Error != nil {
+		t.Fatalf("resulting: %v, expect: %v", out.Error, nil)
+	}
+
+	// The stale save can not put the loan back to submitted
+	if err := loanRepo.UpdateLoan(ctx, staleLoan.Status, staleLoan); !errors.Is(err, loan.ErrLoanStatusChanged) {
+		t.Fatalf("resulting: %v, expect: %v", err, loan.ErrLoanStatusChanged)
+	}
+	if l, _ := loanRepo.GetUserLoan(ctx, newLoan.Id, user.Id); l.Status != loan.InReview.String() {
+		t.Fatalf("resulting: %s, expect: %s", l.Status, loan.InReview.String())
+	}
+}
+
 func TestDeleteUserLoan(t *testing.T) {
 	clearDb()
 
 	ctx := context.Background()
 
 	user := model.User{
-		Username:  "username",
-		Password:  "password",
-		IsOfficer: false,
+		Username: "username",
+		Password: "password",
+		Role:     rbac.Applicant.String(),
 	}
 	user, _ = authRepo.InsertUser(ctx, user)
 
@@ -2728,16 +2801,16 @@ func TestDeleteUserLoanButLoanNotBelongToUser(t *testing.T) {
 	ctx := context.Background()
 
 	user := model.User{
-		Username:  "username",
-		Password:  "password",
-		IsOfficer: false,
+		Username: "username",
+		Password: "password",
+		Role:     rbac.Applicant.String(),
 	}
 	user, _ = authRepo.InsertUser(ctx, user)
 
 	user2 := model.User{
-		Username:  "username2",
-		Password:  "password",
-		IsOfficer: false,
+		Username: "username2",
+		Password: "password",
+		Role:     rbac.Applicant.String(),
 	}
 	user2, _ = authRepo.InsertUser(ctx, user2)
 
@@ -2776,9 +2849,9 @@ func TestDeleteUserLoanButUserNotFound(t *testing.T) {
 	ctx := context.Background()
 
 	user := model.User{
-		Username:  "username",
-		Password:  "password",
-		IsOfficer: false,
+		Username: "username",
+		Password: "password",
+		Role:     rbac.Applicant.String(),
 	}
 	user, _ = authRepo.InsertUser(ctx, user)
 
@@ -2817,9 +2890,9 @@ func TestDeleteUserLoanButLoanNotFound(t *testing.T) {
 	ctx := context.Background()
 
 	user := model.User{
-		Username:  "username",
-		Password:  "password",
-		IsOfficer: false,
+		Username: "username",
+		Password: "password",
+		Role:     rbac.Applicant.String(),
 	}
 	user, _ = authRepo.InsertUser(ctx, user)
 
@@ -2835,9 +2908,9 @@ func TestDeleteLoanWithStatusProcess(t *testing.T) {
 	ctx := context.Background()
 
 	user := model.User{
-		Username:  "username",
-		Password:  "password",
-		IsOfficer: false,
+		Username: "username",
+		Password: "password",
+		Role:     rbac.Applicant.String(),
 	}
 	user, _ = authRepo.InsertUser(ctx, user)
 
@@ -2860,12 +2933,10 @@ func TestDeleteLoanWithStatusProcess(t *testing.T) {
 		OtherBusiness:                "-",
 		UserId:                       user.Id,
 		IdCardUrl:                    "http://random",
+		Status:                       loan.InReview.String(),
 	}
 	newLoan, _ = loanRepo.InsertLoan(ctx, newLoan)
 
-	newLoan.Status = loan.Process.String()
-	loanRepo.UpdateLoan(ctx, newLoan.Id, newLoan)
-
 	out := loanApp.DeleteLoan(ctx, newLoan.Id, user.Id)
 	if out.StatusCode != http.StatusBadRequest {
 		t.Fatalf("resulting: %d, expect: %d | err: %v", out.StatusCode, http.StatusBadRequest, out.Error)
@@ -2878,9 +2949,9 @@ func TestDeleteLoanWithStatusReject(t *testing.T) {
 	ctx := context.Background()
 
 	user := model.User{
-		Username:  "username",
-		Password:  "password",
-		IsOfficer: false,
+		Username: "username",
+		Password: "password",
+		Role:     rbac.Applicant.String(),
 	}
 	user, _ = authRepo.InsertUser(ctx, user)
 
@@ -2903,12 +2974,10 @@ func TestDeleteLoanWithStatusReject(t *testing.T) {
 		OtherBusiness:                "-",
 		UserId:                       user.Id,
 		IdCardUrl:                    "http://random",
+		Status:                       loan.Rejected.String(),
 	}
 	newLoan, _ = loanRepo.InsertLoan(ctx, newLoan)
 
-	newLoan.Status = loan.Reject.String()
-	loanRepo.UpdateLoan(ctx, newLoan.Id, newLoan)
-
 	out := loanApp.DeleteLoan(ctx, newLoan.Id, user.Id)
 	if out.StatusCode != http.StatusBadRequest {
 		t.Fatalf("resulting: %d, expect: %d | err: %v", out.StatusCode, http.StatusBadRequest, out.Error)
@@ -2921,9 +2990,9 @@ func TestDeleteLoanWithStatusApprove(t *testing.T) {
 	ctx := context.Background()
 
 	user := model.User{
-		Username:  "username",
-		Password:  "password",
-		IsOfficer: false,
+		Username: "username",
+		Password: "password",
+		Role:     rbac.Applicant.String(),
 	}
 	user, _ = authRepo.InsertUser(ctx, user)
 
@@ -2946,12 +3015,10 @@ func TestDeleteLoanWithStatusApprove(t *testing.T) {
 		OtherBusiness:                "-",
 		UserId:                       user.Id,
 		IdCardUrl:                    "http://random",
+		Status:                       loan.Approved.String(),
 	}
 	newLoan, _ = loanRepo.InsertLoan(ctx, newLoan)
 
-	newLoan.Status = loan.Approve.String()
-	loanRepo.UpdateLoan(ctx, newLoan.Id, newLoan)
-
 	out := loanApp.DeleteLoan(ctx, newLoan.Id, user.Id)
 	if out.StatusCode != http.StatusBadRequest {
 		t.Fatalf("resulting: %d, expect: %d | err: %v", out.StatusCode, http.StatusBadRequest, out.Error)
@@ -2964,9 +3031,9 @@ func TestGetLoans(t *testing.T) {
 	ctx := context.Background()
 
 	user := model.User{
-		Username:  "username",
-		Password:  "password",
-		IsOfficer: false,
+		Username: "username",
+		Password: "password",
+		Role:     rbac.Applicant.String(),
 	}
 	user, _ = authRepo.InsertUser(ctx, user)
 
@@ -3005,9 +3072,9 @@ func TestGetLoanDetail(t *testing.T) {
 	ctx := context.Background()
 
 	user := model.User{
-		Username:  "username",
-		Password:  "password",
-		IsOfficer: false,
+		Username: "username",
+		Password: "password",
+		Role:     rbac.Applicant.String(),
 	}
 	user, _ = authRepo.InsertUser(ctx, user)
 
@@ -3057,16 +3124,16 @@ func TestProceedLoan(t *testing.T) {
 	ctx := context.Background()
 
 	admin := model.User{
-		Username:  "admin",
-		Password:  "password",
-		IsOfficer: true,
+		Username: "admin",
+		Password: "password",
+		Role:     rbac.Admin.String(),
 	}
 	admin, _ = authRepo.InsertUser(ctx, admin)
 
 	user := model.User{
-		Username:  "username",
-		Password:  "password",
-		IsOfficer: false,
+		Username: "username",
+		Password: "password",
+		Role:     rbac.Applicant.String(),
 	}
 	user, _ = authRepo.InsertUser(ctx, user)
 
@@ -3105,9 +3172,9 @@ func TestProceedUserLoanButLoanNotFound(t *testing.T) {
 	ctx := context.Background()
 
 	admin := model.User{
-		Username:  "admin",
-		Password:  "password",
-		IsOfficer: true,
+		Username: "admin",
+		Password: "password",
+		Role:     rbac.Admin.String(),
 	}
 	admin, _ = authRepo.InsertUser(ctx, admin)
 
@@ -3123,16 +3190,16 @@ func TestProceedLoanWithStatusProcess(t *testing.T) {
 	ctx := context.Background()
 
 	admin := model.User{
-		Username:  "admin",
-		Password:  "password",
-		IsOfficer: true,
+		Username: "admin",
+		Password: "password",
+		Role:     rbac.Admin.String(),
 	}
 	admin, _ = authRepo.InsertUser(ctx, admin)
 
 	user := model.User{
-		Username:  "username",
-		Password:  "password",
-		IsOfficer: false,
+		Username: "username",
+		Password: "password",
+		Role:     rbac.Applicant.String(),
 	}
 	user, _ = authRepo.InsertUser(ctx, user)
 
@@ -3155,12 +3222,10 @@ func TestProceedLoanWithStatusProcess(t *testing.T) {
 		OtherBusiness:                "-",
 		UserId:                       user.Id,
 		IdCardUrl:                    "http://random",
+		Status:                       loan.InReview.String(),
 	}
 	newLoan, _ = loanRepo.InsertLoan(ctx, newLoan)
 
-	newLoan.Status = loan.Process.String()
-	loanRepo.UpdateLoan(ctx, newLoan.Id, newLoan)
-
 	out := loanApp.ProceedLoan(ctx, newLoan.Id, admin.Id)
 	if out.StatusCode != http.StatusBadRequest {
 		t.Fatalf("resulting: %d, expect: %d | err: %v", out.StatusCode, http.StatusBadRequest, out.Error)
@@ -3173,16 +3238,16 @@ func TestProceedLoanWithStatusReject(t *testing.T) {
 	ctx := context.Background()
 
 	admin := model.User{
-		Username:  "admin",
-		Password:  "password",
-		IsOfficer: true,
+		Username: "admin",
+		Password: "password",
+		Role:     rbac.Admin.String(),
 	}
 	admin, _ = authRepo.InsertUser(ctx, admin)
 
 	user := model.User{
-		Username:  "username",
-		Password:  "password",
-		IsOfficer: false,
+		Username: "username",
+		Password: "password",
+		Role:     rbac.Applicant.String(),
 	}
 	user, _ = authRepo.InsertUser(ctx, user)
 
@@ -3205,12 +3270,10 @@ func TestProceedLoanWithStatusReject(t *testing.T) {
 		OtherBusiness:                "-",
 		UserId:                       user.Id,
 		IdCardUrl:                    "http://random",
+		Status:                       loan.Rejected.String(),
 	}
 	newLoan, _ = loanRepo.InsertLoan(ctx, newLoan)
 
-	newLoan.Status = loan.Reject.String()
-	loanRepo.UpdateLoan(ctx, newLoan.Id, newLoan)
-
 	out := loanApp.ProceedLoan(ctx, newLoan.Id, admin.Id)
 	if out.StatusCode != http.StatusBadRequest {
 		t.Fatalf("resulting: %d, expect: %d | err: %v", out.StatusCode, http.StatusBadRequest, out.Error)
@@ -3223,16 +3286,16 @@ func TestProceedLoanWithStatusApprove(t *testing.T) {
 	ctx := context.Background()
 
 	admin := model.User{
-		Username:  "admin",
-		Password:  "password",
-		IsOfficer: true,
+		Username: "admin",
+		Password: "password",
+		Role:     rbac.Admin.String(),
 	}
 	admin, _ = authRepo.InsertUser(ctx, admin)
 
 	user := model.User{
-		Username:  "username",
-		Password:  "password",
-		IsOfficer: false,
+		Username: "username",
+		Password: "password",
+		Role:     rbac.Applicant.String(),
 	}
 	user, _ = authRepo.InsertUser(ctx, user)
 
@@ -3255,12 +3318,10 @@ func TestProceedLoanWithStatusApprove(t *testing.T) {
 		OtherBusiness:                "-",
 		UserId:                       user.Id,
 		IdCardUrl:                    "http://random",
+		Status:                       loan.Approved.String(),
 	}
 	newLoan, _ = loanRepo.InsertLoan(ctx, newLoan)
 
-	newLoan.Status = loan.Approve.String()
-	loanRepo.UpdateLoan(ctx, newLoan.Id, newLoan)
-
 	out := loanApp.ProceedLoan(ctx, newLoan.Id, admin.Id)
 	if out.StatusCode != http.StatusBadRequest {
 		t.Fatalf("resulting: %d, expect: %d | err: %v", out.StatusCode, http.StatusBadRequest, out.Error)
@@ -3273,16 +3334,16 @@ func TestApproveLoan(t *testing.T) {
 	ctx := context.Background()
 
 	admin := model.User{
-		Username:  "admin",
-		Password:  "password",
-		IsOfficer: true,
+		Username: "admin",
+		Password: "password",
+		Role:     rbac.Admin.String(),
 	}
 	admin, _ = authRepo.InsertUser(ctx, admin)
 
 	user := model.User{
-		Username:  "username",
-		Password:  "password",
-		IsOfficer: false,
+		Username: "username",
+		Password: "password",
+		Role:     rbac.Applicant.String(),
 	}
 	user, _ = authRepo.InsertUser(ctx, user)
 
@@ -3323,9 +3384,9 @@ func TestApproveLoanButLoanNotFound(t *testing.T) {
 	ctx := context.Background()
 
 	admin := model.User{
-		Username:  "admin",
-		Password:  "password",
-		IsOfficer: true,
+		Username: "admin",
+		Password: "password",
+		Role:     rbac.Admin.String(),
 	}
 	admin, _ = authRepo.InsertUser(ctx, admin)
 
@@ -3343,16 +3404,16 @@ func TestApproveLoanWithStatusWait(t *testing.T) {
 	ctx := context.Background()
 
 	admin := model.User{
-		Username:  "admin",
-		Password:  "password",
-		IsOfficer: true,
+		Username: "admin",
+		Password: "password",
+		Role:     rbac.Admin.String(),
 	}
 	admin, _ = authRepo.InsertUser(ctx, admin)
 
 	user := model.User{
-		Username:  "username",
-		Password:  "password",
-		IsOfficer: false,
+		Username: "username",
+		Password: "password",
+		Role:     rbac.Applicant.String(),
 	}
 	user, _ = authRepo.InsertUser(ctx, user)
 
@@ -3375,12 +3436,10 @@ func TestApproveLoanWithStatusWait(t *testing.T) {
 		OtherBusiness:                "-",
 		UserId:                       user.Id,
 		IdCardUrl:                    "http://random",
+		Status:                       loan.Submitted.String(),
 	}
 	newLoan, _ = loanRepo.InsertLoan(ctx, newLoan)
 
-	newLoan.Status = loan.Wait.String()
-	loanRepo.UpdateLoan(ctx, newLoan.Id, newLoan)
-
 	out := loanApp.ApproveLoan(ctx, newLoan.Id, admin.Id, loan.ApproveLoanIn{
 		IsApprove: true,
 	})
@@ -3395,16 +3454,16 @@ func TestApproveLoanWithStatusReject(t *testing.T) {
 	ctx := context.Background()
 
 	admin := model.User{
-		Username:  "admin",
-		Password:  "password",
-		IsOfficer: true,
+		Username: "admin",
+		Password: "password",
+		Role:     rbac.Admin.String(),
 	}
 	admin, _ = authRepo.InsertUser(ctx, admin)
 
 	user := model.User{
-		Username:  "username",
-		Password:  "password",
-		IsOfficer: false,
+		Username: "username",
+		Password: "password",
+		Role:     rbac.Applicant.String(),
 	}
 	user, _ = authRepo.InsertUser(ctx, user)
 
@@ -3427,12 +3486,10 @@ func TestApproveLoanWithStatusReject(t *testing.T) {
 		OtherBusiness:                "-",
 		UserId:                       user.Id,
 		IdCardUrl:                    "http://random",
+		Status:                       loan.Rejected.String(),
 	}
 	newLoan, _ = loanRepo.InsertLoan(ctx, newLoan)
 
-	newLoan.Status = loan.Reject.String()
-	loanRepo.UpdateLoan(ctx, newLoan.Id, newLoan)
-
 	out := loanApp.ApproveLoan(ctx, newLoan.Id, admin.Id, loan.ApproveLoanIn{
 		IsApprove: true,
 	})
@@ -3447,16 +3504,16 @@ func TestApproveLoanWithStatusApprove(t *testing.T) {
 	ctx := context.Background()
 
 	admin := model.User{
-		Username:  "admin",
-		Password:  "password",
-		IsOfficer: true,
+		Username: "admin",
+		Password: "password",
+		Role:     rbac.Admin.String(),
 	}
 	admin, _ = authRepo.InsertUser(ctx, admin)
 
 	user := model.User{
-		Username:  "username",
-		Password:  "password",
-		IsOfficer: false,
+		Username: "username",
+		Password: "password",
+		Role:     rbac.Applicant.String(),
 	}
 	user, _ = authRepo.InsertUser(ctx, user)
 
@@ -3479,12 +3536,10 @@ func TestApproveLoanWithStatusApprove(t *testing.T) {
 		OtherBusiness:                "-",
 		UserId:                       user.Id,
 		IdCardUrl:                    "http://random",
+		Status:                       loan.Approved.String(),
 	}
 	newLoan, _ = loanRepo.InsertLoan(ctx, newLoan)
 
-	newLoan.Status = loan.Approve.String()
-	loanRepo.UpdateLoan(ctx, newLoan.Id, newLoan)
-
 	out := loanApp.ApproveLoan(ctx, newLoan.Id, admin.Id, loan.ApproveLoanIn{
 		IsApprove: true,
 	})
@@ -3493,22 +3548,72 @@ func TestApproveLoanWithStatusApprove(t *testing.T) {
 	}
 }
 
+func TestApproveLoanByFieldOfficer(t *testing.T) {
+	clearDb()
+
+	ctx := context.Background()
+
+	officer := model.User{
+		Username: "officer",
+		Password: "password",
+		Role:     rbac.FieldOfficer.String(),
+	}
+	officer, _ = authRepo.InsertUser(ctx, officer)
+
+	user := model.User{
+		Username: "username",
+		Password: "password",
+		Role:     rbac.Applicant.String(),
+	}
+	user, _ = authRepo.InsertUser(ctx, user)
+
+	newLoan := model.LoanApplication{
+		IsPrivateField:               true,
+		ExpInYear:                    1,
+		ActiveFieldNumber:            1,
+		SowSeedsPerCycle:             1,
+		NeededFertilizerPerCycleInKg: 1,
+		EstimatedYieldInKg:           1,
+		EstimatedPriceOfHarvestPerKg: 1,
+		HarvestCycleInMonths:         1,
+		LoanApplicationInIdr:         1,
+		BusinessIncomePerMonthInIdr:  1,
+		BusinessOutcomePerMonthInIdr: 1,
+		FullName:                     "Full Name",
+		BirthDate:                    "2006-01-02",
+		FullAddress:                  "Full Address",
+		Phone:                        "0000000000",
+		OtherBusiness:                "-",
+		UserId:                       user.Id,
+		IdCardUrl:                    "http://random",
+		Status:                       loan.InReview.String(),
+	}
+	newLoan, _ = loanRepo.InsertLoan(ctx, newLoan)
+
+	out := loanApp.ApproveLoan(ctx, newLoan.Id, officer.Id, loan.ApproveLoanIn{
+		IsApprove: true,
+	})
+	if out.StatusCode != http.StatusForbidden {
+		t.Fatalf("resulting: %d, expect: %d | err: %v", out.StatusCode, http.StatusForbidden, out.Error)
+	}
+}
+
 func TestRejectLoan(t *testing.T) {
 	clearDb()
 
 	ctx := context.Background()
 
 	admin := model.User{
-		Username:  "admin",
-		Password:  "password",
-		IsOfficer: true,
+		Username: "admin",
+		Password: "password",
+		Role:     rbac.Admin.String(),
 	}
 	admin, _ = authRepo.InsertUser(ctx, admin)
 
 	user := model.User{
-		Username:  "username",
-		Password:  "password",
-		IsOfficer: false,
+		Username: "username",
+		Password: "password",
+		Role:     rbac.Applicant.String(),
 	}
 	user, _ = authRepo.InsertUser(ctx, user)
 
@@ -3535,7 +3640,8 @@ func TestRejectLoan(t *testing.T) {
 	loanRepo.InsertLoan(ctx, newLoan)
 
 	out := loanApp.ApproveLoan(ctx, newLoan.Id, admin.Id, loan.ApproveLoanIn{
-		IsApprove: false,
+		IsApprove:  false,
+		DecisionIn: loan.DecisionIn{ReasonCodes: []string{loan.ReasonIncomeInsufficient.String()}},
 	})
 
 	if out.Res.Id != newLoan.Id {
@@ -3549,14 +3655,15 @@ func TestRejectLoanButLoanNotFound(t *testing.T) {
 	ctx := context.Background()
 
 	admin := model.User{
-		Username:  "admin",
-		Password:  "password",
-		IsOfficer: true,
+		Username: "admin",
+		Password: "password",
+		Role:     rbac.Admin.String(),
 	}
 	admin, _ = authRepo.InsertUser(ctx, admin)
 
 	out := loanApp.ApproveLoan(ctx, "some-random-loan-id", admin.Id, loan.ApproveLoanIn{
-		IsApprove: false,
+		IsApprove:  false,
+		DecisionIn: loan.DecisionIn{ReasonCodes: []string{loan.ReasonIncomeInsufficient.String()}},
 	})
 
 	if out.StatusCode != http.StatusNotFound {
@@ -3569,16 +3676,16 @@ func TestRejectLoanWithStatusWait(t *testing.T) {
 	ctx := context.Background()
 
 	admin := model.User{
-		Username:  "admin",
-		Password:  "password",
-		IsOfficer: true,
+		Username: "admin",
+		Password: "password",
+		Role:     rbac.Admin.String(),
 	}
 	admin, _ = authRepo.InsertUser(ctx, admin)
 
 	user := model.User{
-		Username:  "username",
-		Password:  "password",
-		IsOfficer: false,
+		Username: "username",
+		Password: "password",
+		Role:     rbac.Applicant.String(),
 	}
 	user, _ = authRepo.InsertUser(ctx, user)
 
@@ -3601,14 +3708,13 @@ func TestRejectLoanWithStatusWait(t *testing.T) {
 		OtherBusiness:                "-",
 		UserId:                       user.Id,
 		IdCardUrl:                    "http://random",
+		Status:                       loan.Submitted.String(),
 	}
 	newLoan, _ = loanRepo.InsertLoan(ctx, newLoan)
 
-	newLoan.Status = loan.Wait.String()
-	loanRepo.UpdateLoan(ctx, newLoan.Id, newLoan)
-
 	out := loanApp.ApproveLoan(ctx, newLoan.Id, admin.Id, loan.ApproveLoanIn{
-		IsApprove: false,
+		IsApprove:  false,
+		DecisionIn: loan.DecisionIn{ReasonCodes: []string{loan.ReasonIncomeInsufficient.String()}},
 	})
 	if out.StatusCode != http.StatusBadRequest {
 		t.Fatalf("resulting: %d, expect: %d | err: %v", out.StatusCode, http.StatusBadRequest, out.Error)
@@ -3621,16 +3727,16 @@ func TestRejectLoanWithStatusReject(t *testing.T) {
 	ctx := context.Background()
 
 	admin := model.User{
-		Username:  "admin",
-		Password:  "password",
-		IsOfficer: true,
+		Username: "admin",
+		Password: "password",
+		Role:     rbac.Admin.String(),
 	}
 	admin, _ = authRepo.InsertUser(ctx, admin)
 
 	user := model.User{
-		Username:  "username",
-		Password:  "password",
-		IsOfficer: false,
+		Username: "username",
+		Password: "password",
+		Role:     rbac.Applicant.String(),
 	}
 	user, _ = authRepo.InsertUser(ctx, user)
 
@@ -3653,14 +3759,13 @@ func TestRejectLoanWithStatusReject(t *testing.T) {
 		OtherBusiness:                "-",
 		UserId:                       user.Id,
 		IdCardUrl:                    "http://random",
+		Status:                       loan.Rejected.String(),
 	}
 	newLoan, _ = loanRepo.InsertLoan(ctx, newLoan)
 
-	newLoan.Status = loan.Reject.String()
-	loanRepo.UpdateLoan(ctx, newLoan.Id, newLoan)
-
 	out := loanApp.ApproveLoan(ctx, newLoan.Id, admin.Id, loan.ApproveLoanIn{
-		IsApprove: false,
+		IsApprove:  false,
+		DecisionIn: loan.DecisionIn{ReasonCodes: []string{loan.ReasonIncomeInsufficient.String()}},
 	})
 	if out.StatusCode != http.StatusBadRequest {
 		t.Fatalf("resulting: %d, expect: %d | err: %v", out.StatusCode, http.StatusBadRequest, out.Error)
@@ -3673,16 +3778,16 @@ func TestRejectLoanWithStatusApprove(t *testing.T) {
 	ctx := context.Background()
 
 	admin := model.User{
-		Username:  "admin",
-		Password:  "password",
-		IsOfficer: true,
+		Username: "admin",
+		Password: "password",
+		Role:     rbac.Admin.String(),
 	}
 	admin, _ = authRepo.InsertUser(ctx, admin)
 
 	user := model.User{
-		Username:  "username",
-		Password:  "password",
-		IsOfficer: false,
+		Username: "username",
+		Password: "password",
+		Role:     rbac.Applicant.String(),
 	}
 	user, _ = authRepo.InsertUser(ctx, user)
 
@@ -3705,16 +3810,1656 @@ func TestRejectLoanWithStatusApprove(t *testing.T) {
 		OtherBusiness:                "-",
 		UserId:                       user.Id,
 		IdCardUrl:                    "http://random",
+		Status:                       loan.Approved.String(),
 	}
 	newLoan, _ = loanRepo.InsertLoan(ctx, newLoan)
 
-	newLoan.Status = loan.Approve.String()
-	loanRepo.UpdateLoan(ctx, newLoan.Id, newLoan)
-
 	out := loanApp.ApproveLoan(ctx, newLoan.Id, admin.Id, loan.ApproveLoanIn{
-		IsApprove: false,
+		IsApprove:  false,
+		DecisionIn: loan.DecisionIn{ReasonCodes: []string{loan.ReasonIncomeInsufficient.String()}},
 	})
 	if out.StatusCode != http.StatusBadRequest {
 		t.Fatalf("resulting: %d, expect: %d | err: %v", out.StatusCode, http.StatusBadRequest, out.Error)
 	}
 }
+
+func TestTransition(t *testing.T) {
+	clearDb()
+
+	ctx := context.Background()
+
+	officer := model.User{
+		Username: "officer",
+		Password: "password",
+		Role:     rbac.FieldOfficer.String(),
+	}
+	officer, _ = authRepo.InsertUser(ctx, officer)
+
+	approver := model.User{
+		Username: "approver",
+		Password: "password",
+		Role:     rbac.Approver.String(),
+	}
+	approver, _ = authRepo.InsertUser(ctx, approver)
+
+	user := model.User{
+		Username: "username",
+		Password: "password",
+		Role:     rbac.Applicant.String(),
+	}
+	user, _ = authRepo.InsertUser(ctx, user)
+
+	other := model.User{
+		Username: "other",
+		Password: "password",
+		Role:     rbac.Applicant.String(),
+	}
+	other, _ = authRepo.InsertUser(ctx, other)
+
+	newLoan := model.LoanApplication{
+		FullName: "Full Name",
+		UserId:   user.Id,
+		Status:   loan.Draft.String(),
+	}
+	newLoan, _ = loanRepo.InsertLoan(ctx, newLoan)
+
+	// Every step run on the same loan, in order
+	testCases := []struct {
+		expectStatus int
+		expectLoan   string
+		name         string
+		userId       string
+		action       string
+		comment      string
+	}{
+		{
+			expectStatus: http.StatusUnprocessableEntity,
+			expectLoan:   loan.Draft.String(),
+			name:         "Unknown action",
+			userId:       user.Id,
+			action:       "teleport",
+		},
+		{
+			expectStatus: http.StatusForbidden,
+			expectLoan:   loan.Draft.String(),
+			name:         "Officer can not submit the loan of the applicant",
+			userId:       officer.Id,
+			action:       loan.ActionSubmit.String(),
+		},
+		{
+			expectStatus: http.StatusNotFound,
+			expectLoan:   loan.Draft.String(),
+			name:         "Other applicant can not see the loan",
+			userId:       other.Id,
+			action:       loan.ActionSubmit.String(),
+		},
+		{
+			expectStatus: http.StatusOK,
+			expectLoan:   loan.Submitted.String(),
+			name:         "Applicant submit the draft",
+			userId:       user.Id,
+			action:       loan.ActionSubmit.String(),
+		},
+		{
+			expectStatus: http.StatusBadRequest,
+			expectLoan:   loan.Submitted.String(),
+			name:         "Submitted loan can not be approved",
+			userId:       approver.Id,
+			action:       loan.ActionApprove.String(),
+		},
+		{
+			expectStatus: http.StatusOK,
+			expectLoan:   loan.InReview.String(),
+			name:         "Officer review the loan",
+			userId:       officer.Id,
+			action:       loan.ActionReview.String(),
+		},
+		{
+			expectStatus: http.StatusBadRequest,
+			expectLoan:   loan.InReview.String(),
+			name:         "Applicant can not cancel the loan in review",
+			userId:       user.Id,
+			action:       loan.ActionCancel.String(),
+			comment:      "Found another lender",
+		},
+		{
+			expectStatus: http.StatusOK,
+			expectLoan:   loan.Approved.String(),
+			name:         "Approver approve the loan",
+			userId:       approver.Id,
+			action:       loan.ActionApprove.String(),
+		},
+		{
+			expectStatus: http.StatusForbidden,
+			expectLoan:   loan.Approved.String(),
+			name:         "Approver can not disburse the loan",
+			userId:       approver.Id,
+			action:       loan.ActionDisburse.String(),
+		},
+		{
+			expectStatus: http.StatusOK,
+			expectLoan:   loan.Disbursed.String(),
+			name:         "Officer disburse the loan",
+			userId:       officer.Id,
+			action:       loan.ActionDisburse.String(),
+		},
+		{
+			expectStatus: http.StatusOK,
+			expectLoan:   loan.Closed.String(),
+			name:         "Officer close the loan",
+			userId:       officer.Id,
+			action:       loan.ActionClose.String(),
+		},
+	}
+
+	for _, c := range testCases {
+		t.Run(c.name, func(t *testing.T) {
+			out := loanApp.Transition(ctx, newLoan.Id, c.userId, loan.TransitionIn{Action: c.action, Comment: c.comment})
+			if out.StatusCode != c.expectStatus {
+				t.Fatalf("resulting: %d, expect: %d | err: %v", out.StatusCode, c.expectStatus, out.Error)
+			}
+
+			userLoan, _ := loanRepo.GetLoan(ctx, newLoan.Id)
+			if userLoan.Status != c.expectLoan {
+				t.Fatalf("resulting: %s, expect: %s", userLoan.Status, c.expectLoan)
+			}
+		})
+	}
+}
+
+func TestGetLoanActions(t *testing.T) {
+	clearDb()
+
+	ctx := context.Background()
+
+	officer := model.User{
+		Username: "officer",
+		Password: "password",
+		Role:     rbac.FieldOfficer.String(),
+	}
+	officer, _ = authRepo.InsertUser(ctx, officer)
+
+	user := model.User{
+		Username: "username",
+		Password: "password",
+		Role:     rbac.Applicant.String(),
+	}
+	user, _ = authRepo.InsertUser(ctx, user)
+
+	// The loan stored before the transition table keep its old status
+	newLoan := model.LoanApplication{
+		FullName: "Full Name",
+		UserId:   user.Id,
+		Status:   "wait",
+	}
+	newLoan, _ = loanRepo.InsertLoan(ctx, newLoan)
+
+	testCases := []struct {
+		expect []string
+		name   string
+		userId string
+	}{
+		{
+			expect: []string{loan.ActionCancel.String()},
+			name:   "Applicant can cancel the submitted loan",
+			userId: user.Id,
+		},
+		{
+			expect: []string{loan.ActionReview.String()},
+			name:   "Officer can review the submitted loan",
+			userId: officer.Id,
+		},
+	}
+
+	for _, c := range testCases {
+		t.Run(c.name, func(t *testing.T) {
+			out := loanApp.GetLoanActions(ctx, newLoan.Id, c.userId)
+			if out.Error != nil {
+				t.Fatal(out.Error)
+			}
+			if out.Res.Status != loan.Submitted.String() {
+				t.Fatalf("resulting: %s, expect: %s", out.Res.Status, loan.Submitted.String())
+			}
+			if len(out.Res.Actions) != len(c.expect) || out.Res.Actions[0] != c.expect[0] {
+				t.Fatalf("resulting: %v, expect: %v", out.Res.Actions, c.expect)
+			}
+		})
+	}
+}
+
+func TestGetLoanHistory(t *testing.T) {
+	clearDb()
+
+	ctx := context.Background()
+
+	officer := model.User{
+		Username: "officer",
+		Password: "password",
+		Role:     rbac.FieldOfficer.String(),
+	}
+	officer, _ = authRepo.InsertUser(ctx, officer)
+
+	admin := model.User{
+		Username: "admin",
+		Password: "password",
+		Role:     rbac.Admin.String(),
+	}
+	admin, _ = authRepo.InsertUser(ctx, admin)
+
+	user := model.User{
+		Username: "username",
+		Password: "password",
+		Role:     rbac.Applicant.String(),
+	}
+	user, _ = authRepo.InsertUser(ctx, user)
+
+	newLoan := model.LoanApplication{
+		FullName: "Full Name",
+		UserId:   user.Id,
+	}
+	newLoan, _ = loanRepo.InsertLoan(ctx, newLoan)
+
+	if out := loanApp.ProceedLoan(ctx, newLoan.Id, officer.Id); out.Error != nil {
+		t.Fatal(out.Error)
+	}
+	if out := loanApp.Transition(ctx, newLoan.Id, admin.Id, loan.TransitionIn{
+		Action:     loan.ActionReject.String(),
+		Comment:    " No collateral ",
+		DecisionIn: loan.DecisionIn{ReasonCodes: []string{loan.ReasonOutsidePolicy.String()}},
+	}); out.Error != nil {
+		t.Fatal(out.Error)
+	}
+
+	// The loan read before the change can not be saved over it
+	if _, err := loanRepo.TransitionLoan(ctx, loan.InReview.String(), newLoan, model.LoanStatusHistory{}); !errors.Is(err, loan.ErrLoanStatusChanged) {
+		t.Fatalf("resulting: %v, expect: %v", err, loan.ErrLoanStatusChanged)
+	}
+
+	testCases := []struct {
+		expectActor string
+		name        string
+		userId      string
+	}{
+		{
+			expectActor: officer.Id,
+			name:        "Officer see who changed the loan",
+			userId:      officer.Id,
+		},
+		{
+			expectActor: "",
+			name:        "Applicant only see the role",
+			userId:      user.Id,
+		},
+	}
+
+	for _, c := range testCases {
+		t.Run(c.name, func(t *testing.T) {
+			out := loanApp.GetLoanHistory(ctx, newLoan.Id, c.userId)
+			if out.Error != nil {
+				t.Fatal(out.Error)
+			}
+			if len(out.Res) != 2 {
+				t.Fatalf("resulting: %d, expect: 2", len(out.Res))
+			}
+
+			review, reject := out.Res[0], out.Res[1]
+			if review.FromStatus != loan.Submitted.String() || review.ToStatus != loan.InReview.String() {
+				t.Fatalf("resulting: %+v, expect: submitted to in_review", review)
+			}
+			if review.ActorId != c.expectActor || review.ActorRole != rbac.FieldOfficer.String() {
+				t.Fatalf("resulting: %+v, expect: actor %q of field_officer", review, c.expectActor)
+			}
+			if reject.ToStatus != loan.Rejected.String() || reject.Comment != "No collateral" {
+				t.Fatalf("resulting: %+v, expect: rejected with the comment", reject)
+			}
+		})
+	}
+
+	other := model.User{
+		Username: "other",
+		Password: "password",
+		Role:     rbac.Applicant.String(),
+	}
+	other, _ = authRepo.InsertUser(ctx, other)
+
+	if out := loanApp.GetLoanHistory(ctx, newLoan.Id, other.Id); out.StatusCode != http.StatusNotFound {
+		t.Fatalf("resulting: %d, expect: %d | err: %v", out.StatusCode, http.StatusNotFound, out.Error)
+	}
+}
+
+func TestApproveLoanDecision(t *testing.T) {
+	clearDb()
+
+	ctx := context.Background()
+
+	admin := model.User{
+		Username: "admin",
+		Password: "password",
+		Role:     rbac.Admin.String(),
+	}
+	admin, _ = authRepo.InsertUser(ctx, admin)
+
+	user := model.User{
+		Username: "username",
+		Password: "password",
+		Role:     rbac.Applicant.String(),
+	}
+	user, _ = authRepo.InsertUser(ctx, user)
+
+	newLoan := model.LoanApplication{
+		FullName: "Full Name",
+		UserId:   user.Id,
+		Status:   loan.InReview.String(),
+	}
+	newLoan, _ = loanRepo.InsertLoan(ctx, newLoan)
+
+	testCases := []struct {
+		expect error
+		name   string
+		in     loan.ApproveLoanIn
+	}{
+		{
+			expect: loan.ErrReasonRequired,
+			name:   "Reject without reason",
+			in:     loan.ApproveLoanIn{IsApprove: false},
+		},
+		{
+			expect: loan.ErrReasonNotValid,
+			name:   "Reject with the reason of approval",
+			in: loan.ApproveLoanIn{
+				IsApprove:  false,
+				DecisionIn: loan.DecisionIn{ReasonCodes: []string{loan.ReasonCriteriaMet.String()}},
+			},
+		},
+		{
+			expect: loan.ErrReasonNotValid,
+			name:   "Reject with unknown reason",
+			in: loan.ApproveLoanIn{
+				IsApprove:  false,
+				DecisionIn: loan.DecisionIn{ReasonCodes: []string{"bad_luck"}},
+			},
+		},
+		{
+			expect: loan.ErrReasonOtherNote,
+			name:   "Reject with other reason without note",
+			in: loan.ApproveLoanIn{
+				IsApprove:  false,
+				DecisionIn: loan.DecisionIn{ReasonCodes: []string{loan.ReasonOther.String()}, Note: " "},
+			},
+		},
+		{
+			expect: nil,
+			name:   "Reject successfully",
+			in: loan.ApproveLoanIn{
+				IsApprove: false,
+				DecisionIn: loan.DecisionIn{
+					ReasonCodes:  []string{loan.ReasonIncomeInsufficient.String(), loan.ReasonIncomeInsufficient.String()},
+					Note:         "Apply again after the next harvest",
+					InternalNote: "Income statement look inflated",
+				},
+			},
+		},
+	}
+
+	for _, c := range testCases {
+		t.Run(c.name, func(t *testing.T) {
+			out := loanApp.ApproveLoan(ctx, newLoan.Id, admin.Id, c.in)
+			if !errors.Is(out.Error, c.expect) {
+				t.Fatalf("resulting: %v, expect: %v", out.Error, c.expect)
+			}
+		})
+	}
+
+	userOut := loanApp.GetUserLoanDetail(ctx, newLoan.Id, user.Id)
+	if len(userOut.Res.DecisionReasons) != 1 || userOut.Res.DecisionReasons[0].Code != loan.ReasonIncomeInsufficient.String() {
+		t.Fatalf("resulting: %+v, expect: income_insufficient only", userOut.Res.DecisionReasons)
+	}
+	if userOut.Res.DecisionReasons[0].Description == "" || userOut.Res.DecisionNote != "Apply again after the next harvest" {
+		t.Fatalf("resulting: %+v, expect: the description and the note", userOut.Res)
+	}
+
+	officerOut := loanApp.GetLoanDetail(ctx, newLoan.Id)
+	if officerOut.Res.DecisionInternalNote != "Income statement look inflated" {
+		t.Fatalf("resulting: %s, expect: the internal note", officerOut.Res.DecisionInternalNote)
+	}
+}
+
+func TestRequestInfo(t *testing.T) {
+	clearDb()
+
+	ctx := context.Background()
+	f, err := os.OpenFile("./loan_application.go", os.O_RDONLY, 0o444)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	officer := model.User{
+		Username: "officer",
+		Password: "password",
+		Role:     rbac.FieldOfficer.String(),
+	}
+	officer, _ = authRepo.InsertUser(ctx, officer)
+
+	user := model.User{
+		Username: "username",
+		Password: "password",
+		Role:     rbac.Applicant.String(),
+	}
+	user, _ = authRepo.InsertUser(ctx, user)
+
+	newLoan := model.LoanApplication{
+		IsPrivateField:               true,
+		ExpInYear:                    1,
+		ActiveFieldNumber:            1,
+		SowSeedsPerCycle:             1,
+		NeededFertilizerPerCycleInKg: 1,
+		EstimatedYieldInKg:           1,
+		EstimatedPriceOfHarvestPerKg: 1,
+		HarvestCycleInMonths:         1,
+		LoanApplicationInIdr:         1,
+		BusinessIncomePerMonthInIdr:  1,
+		BusinessOutcomePerMonthInIdr: 1,
+		FullName:                     "Full Name",
+		BirthDate:                    "2006-01-02",
+		FullAddress:                  "Full Address",
+		Phone:                        "0000000000",
+		OtherBusiness:                "-",
+		UserId:                       user.Id,
+		IdCardUrl:                    "http://random",
+		Status:                       loan.Submitted.String(),
+	}
+	newLoan, _ = loanRepo.InsertLoan(ctx, newLoan)
+
+	if out := loanApp.Transition(ctx, newLoan.Id, officer.Id, loan.TransitionIn{Action: loan.ActionReview.String()}); out.Error != nil {
+		t.Fatal(out.Error)
+	}
+
+	testCases := []struct {
+		expect error
+		name   string
+		in     loan.TransitionIn
+	}{
+		{
+			expect: loan.ErrFieldsRequired,
+			name:   "Request info without field",
+			in:     loan.TransitionIn{Action: loan.ActionRequestInfo.String()},
+		},
+		{
+			expect: loan.ErrFieldNotValid,
+			name:   "Request info with unknown field",
+			in: loan.TransitionIn{
+				Action: loan.ActionRequestInfo.String(),
+				Fields: []string{"status"},
+			},
+		},
+		{
+			expect: nil,
+			name:   "Request info successfully",
+			in: loan.TransitionIn{
+				Action:  loan.ActionRequestInfo.String(),
+				Comment: "The phone number can not be reached",
+				Fields:  []string{"phone", "loan_application_in_idr", "phone"},
+			},
+		},
+	}
+
+	for _, c := range testCases {
+		t.Run(c.name, func(t *testing.T) {
+			out := loanApp.Transition(ctx, newLoan.Id, officer.Id, c.in)
+			if !errors.Is(out.Error, c.expect) {
+				t.Fatalf("resulting: %v, expect: %v", out.Error, c.expect)
+			}
+		})
+	}
+
+	userOut := loanApp.GetUserLoanDetail(ctx, newLoan.Id, user.Id)
+	if len(userOut.Res.UnlockedFields) != 2 || userOut.Res.InfoRequestNote != "The phone number can not be reached" {
+		t.Fatalf("resulting: %+v, expect: phone and loan_application_in_idr unlocked", userOut.Res)
+	}
+
+	// Every field is sent but only the unlocked one is changed
+	updateIn := loan.UpdateLoanIn{
+		IsPrivateField:               true,
+		ExpInYear:                    2,
+		ActiveFieldNumber:            2,
+		SowSeedsPerCycle:             2,
+		NeededFertilizerPerCycleInKg: 2,
+		EstimatedYieldInKg:           2,
+		EstimatedPriceOfHarvestPerKg: 2,
+		HarvestCycleInMonths:         2,
+		LoanApplicationInIdr:         2,
+		BusinessIncomePerMonthInIdr:  2,
+		BusinessOutcomePerMonthInIdr: 2,
+		FullName:                     "Other Name",
+		BirthDate:                    "2006-01-02",
+		FullAddress:                  "Full Address",
+		Phone:                        "1111111111",
+		OtherBusiness:                "-",
+		IdCard: loan.FileHeader{
+			Filename: "test.img",
+			File:     f,
+		},
+	}
+	updateOut := loanApp.UpdateLoan(ctx, newLoan.Id, user.Id, updateIn)
+	if updateOut.Error != nil {
+		t.Fatal(updateOut.Error)
+	}
+
+	userLoan, _ := loanRepo.GetLoan(ctx, newLoan.Id)
+	if userLoan.Phone != "1111111111" || userLoan.LoanApplicationInIdr != 2 {
+		t.Fatalf("resulting: %+v, expect: the unlocked fields changed", userLoan)
+	}
+	if userLoan.FullName != "Full Name" || userLoan.ExpInYear != 1 || userLoan.IdCardUrl != "http://random" {
+		t.Fatalf("resulting: %+v, expect: the locked fields kept", userLoan)
+	}
+
+	resubmitOut := loanApp.Transition(ctx, newLoan.Id, user.Id, loan.TransitionIn{Action: loan.ActionResubmit.String()})
+	if resubmitOut.Error != nil {
+		t.Fatal(resubmitOut.Error)
+	}
+
+	userLoan, _ = loanRepo.GetLoan(ctx, newLoan.Id)
+	if userLoan.Status != loan.InReview.String() || userLoan.OfficerId.String != officer.Id {
+		t.Fatalf("resulting: %s %s, expect: %s %s", userLoan.Status, userLoan.OfficerId.String, loan.InReview.String(), officer.Id)
+	}
+	if len(userLoan.UnlockedFields) != 0 || userLoan.InfoRequestNote != "" {
+		t.Fatalf("resulting: %+v, expect: the fields locked again", userLoan)
+	}
+
+	if out := loanApp.UpdateLoan(ctx, newLoan.Id, user.Id, updateIn); !errors.Is(out.Error, loan.ErrModifyProcessLoan) {
+		t.Fatalf("resulting: %v, expect: %v", out.Error, loan.ErrModifyProcessLoan)
+	}
+}
+
+func TestWithdrawLoan(t *testing.T) {
+	clearDb()
+
+	ctx := context.Background()
+
+	user := model.User{
+		Username: "username",
+		Password: "password",
+		Role:     rbac.Applicant.String(),
+	}
+	user, _ = authRepo.InsertUser(ctx, user)
+
+	newLoan := model.LoanApplication{
+		FullName: "Full Name",
+		UserId:   user.Id,
+		Status:   loan.Submitted.String(),
+	}
+	newLoan, _ = loanRepo.InsertLoan(ctx, newLoan)
+
+	testCases := []struct {
+		expect error
+		name   string
+		in     loan.WithdrawIn
+	}{
+		{
+			expect: loan.ErrWithdrawReasonRequired,
+			name:   "Withdraw without reason",
+			in:     loan.WithdrawIn{Reason: " "},
+		},
+		{
+			expect: nil,
+			name:   "Withdraw successfully",
+			in:     loan.WithdrawIn{Reason: "Found another lender"},
+		},
+		{
+			expect: loan.ErrModifyProcessLoan,
+			name:   "Withdraw the cancelled loan",
+			in:     loan.WithdrawIn{Reason: "Found another lender"},
+		},
+	}
+
+	for _, c := range testCases {
+		t.Run(c.name, func(t *testing.T) {
+			out := loanApp.Withdraw(ctx, newLoan.Id, user.Id, c.in)
+			if !errors.Is(out.Error, c.expect) {
+				t.Fatalf("resulting: %v, expect: %v", out.Error, c.expect)
+			}
+		})
+	}
+
+	out := loanApp.GetUserLoanDetail(ctx, newLoan.Id, user.Id)
+	if out.Res.Status != loan.Cancelled.String() || out.Res.WithdrawReason != "Found another lender" {
+		t.Fatalf("resulting: %s %s, expect: the cancelled loan with the reason", out.Res.Status, out.Res.WithdrawReason)
+	}
+}
+
+func TestArchiveAndRestoreLoan(t *testing.T) {
+	clearDb()
+
+	ctx := context.Background()
+
+	officer := model.User{
+		Username: "officer",
+		Password: "password",
+		Role:     rbac.FieldOfficer.String(),
+	}
+	officer, _ = authRepo.InsertUser(ctx, officer)
+
+	user := model.User{
+		Username: "username",
+		Password: "password",
+		Role:     rbac.Applicant.String(),
+	}
+	user, _ = authRepo.InsertUser(ctx, user)
+
+	openLoan := model.LoanApplication{
+		FullName: "Full Name",
+		UserId:   user.Id,
+		Status:   loan.InReview.String(),
+	}
+	openLoan, _ = loanRepo.InsertLoan(ctx, openLoan)
+
+	finalLoan := model.LoanApplication{
+		FullName: "Full Name",
+		UserId:   user.Id,
+		Status:   loan.Rejected.String(),
+	}
+	finalLoan, _ = loanRepo.InsertLoan(ctx, finalLoan)
+
+	if out := loanApp.ArchiveLoan(ctx, finalLoan.Id, user.Id); !errors.Is(out.Error, loan.ErrUserForbidden) {
+		t.Fatalf("resulting: %v, expect: %v", out.Error, loan.ErrUserForbidden)
+	}
+	if out := loanApp.ArchiveLoan(ctx, openLoan.Id, officer.Id); !errors.Is(out.Error, loan.ErrArchiveOpenLoan) {
+		t.Fatalf("resulting: %v, expect: %v", out.Error, loan.ErrArchiveOpenLoan)
+	}
+	if out := loanApp.ArchiveLoan(ctx, finalLoan.Id, officer.Id); out.Error != nil {
+		t.Fatal(out.Error)
+	}
+
+	// The archived loan is kept but hidden from every listing
+	if out := loanApp.GetLoans(ctx); len(out.Res) != 1 {
+		t.Fatalf("resulting: %d, expect: %d", len(out.Res), 1)
+	}
+	if out := loanApp.GetUserLoans(ctx, user.Id); len(out.Res) != 1 {
+		t.Fatalf("resulting: %d, expect: %d", len(out.Res), 1)
+	}
+	if out := loanApp.GetLoanDetail(ctx, finalLoan.Id); out.StatusCode != http.StatusNotFound {
+		t.Fatalf("resulting: %d, expect: %d", out.StatusCode, http.StatusNotFound)
+	}
+	if out := loanApp.GetDeletedLoans(ctx); len(out.Res) != 1 || out.Res[0].LoanId != finalLoan.Id {
+		t.Fatalf("resulting: %+v, expect: the archived loan", out.Res)
+	}
+
+	if out := loanApp.RestoreLoan(ctx, finalLoan.Id, user.Id); !errors.Is(out.Error, loan.ErrUserForbidden) {
+		t.Fatalf("resulting: %v, expect: %v", out.Error, loan.ErrUserForbidden)
+	}
+	if out := loanApp.RestoreLoan(ctx, openLoan.Id, officer.Id); out.StatusCode != http.StatusNotFound {
+		t.Fatalf("resulting: %d, expect: %d", out.StatusCode, http.StatusNotFound)
+	}
+	if out := loanApp.RestoreLoan(ctx, finalLoan.Id, officer.Id); out.Error != nil {
+		t.Fatal(out.Error)
+	}
+	if out := loanApp.GetLoanDetail(ctx, finalLoan.Id); out.Res.Status != loan.Rejected.String() {
+		t.Fatalf("resulting: %s, expect: %s", out.Res.Status, loan.Rejected.String())
+	}
+}
+
+func TestDeleteAndRestoreOpenLoan(t *testing.T) {
+	clearDb()
+
+	ctx := context.Background()
+
+	officer := model.User{
+		Username: "officer",
+		Password: "password",
+		Role:     rbac.FieldOfficer.String(),
+	}
+	officer, _ = authRepo.InsertUser(ctx, officer)
+
+	user := model.User{
+		Username: "username",
+		Password: "password",
+		Role:     rbac.Applicant.String(),
+	}
+	user, _ = authRepo.InsertUser(ctx, user)
+
+	deletedLoan := model.LoanApplication{
+		FullName: "Full Name",
+		UserId:   user.Id,
+		Status:   loan.Submitted.String(),
+	}
+	deletedLoan, _ = loanRepo.InsertLoan(ctx, deletedLoan)
+
+	if out := loanApp.DeleteLoan(ctx, deletedLoan.Id, user.Id); out.Error != nil {
+		t.Fatal(out.Error)
+	}
+
+	// The deleted loan is cancelled with the history of it
+	histories, _ := loanRepo.GetLoanHistories(ctx, deletedLoan.Id)
+	if len(histories) != 1 || histories[0].ToStatus != loan.Cancelled.String() || histories[0].ActorId != user.Id {
+		t.Fatalf("resulting: %+v, expect: the cancel by the applicant", histories)
+	}
+
+	// The open loan deleted before it was cancelled on delete can not come back
+	// next to the loan the applicant created after it
+	legacyLoan := model.LoanApplication{
+		FullName: "Full Name",
+		UserId:   user.Id,
+		Status:   loan.Submitted.String(),
+	}
+	legacyLoan, _ = loanRepo.InsertLoan(ctx, legacyLoan)
+	loanRepo.RemoveLoan(ctx, legacyLoan.Id)
+
+	openLoan := model.LoanApplication{
+		FullName: "Full Name",
+		UserId:   user.Id,
+		Status:   loan.InReview.String(),
+	}
+	loanRepo.InsertLoan(ctx, openLoan)
+
+	if out := loanApp.RestoreLoan(ctx, legacyLoan.Id, officer.Id); !errors.Is(out.Error, loan.ErrProcessLoanExist) {
+		t.Fatalf("resulting: %v, expect: %v", out.Error, loan.ErrProcessLoanExist)
+	}
+
+	if out := loanApp.RestoreLoan(ctx, deletedLoan.Id, officer.Id); out.Error != nil {
+		t.Fatal(out.Error)
+	}
+	if out := loanApp.GetLoanDetail(ctx, deletedLoan.Id); out.Res.Status != loan.Cancelled.String() || out.Res.WithdrawReason == "" {
+		t.Fatalf("resulting: %s %q, expect: %s with the reason", out.Res.Status, out.Res.WithdrawReason, loan.Cancelled.String())
+	}
+}
+
+func TestAssignLoan(t *testing.T) {
+	clearDb()
+
+	ctx := context.Background()
+
+	busyOfficer := model.User{
+		Username: "busy",
+		Password: "password",
+		Role:     rbac.FieldOfficer.String(),
+	}
+	busyOfficer, _ = authRepo.InsertUser(ctx, busyOfficer)
+
+	freeOfficer := model.User{
+		Username: "free",
+		Password: "password",
+		Role:     rbac.CreditAnalyst.String(),
+	}
+	freeOfficer, _ = authRepo.InsertUser(ctx, freeOfficer)
+
+	admin := model.User{
+		Username: "admin",
+		Password: "password",
+		Role:     rbac.Admin.String(),
+	}
+	admin, _ = authRepo.InsertUser(ctx, admin)
+
+	user := model.User{
+		Username: "username",
+		Password: "password",
+		Role:     rbac.Applicant.String(),
+	}
+	user, _ = authRepo.InsertUser(ctx, user)
+
+	other := model.User{
+		Username: "other",
+		Password: "password",
+		Role:     rbac.Applicant.String(),
+	}
+	other, _ = authRepo.InsertUser(ctx, other)
+
+	busyLoan := model.LoanApplication{
+		FullName:    "Full Name",
+		UserId:      admin.Id,
+		OfficerId:   sql.NullString{String: busyOfficer.Id, Valid: true},
+		ClaimedDate: time.Now(),
+		Status:      loan.InReview.String(),
+	}
+	loanRepo.InsertLoan(ctx, busyLoan)
+
+	// The loan left untouched past the claim TTL is back in the pool, it is not counted in the load
+	for i := 0; i < 2; i++ {
+		loanRepo.InsertLoan(ctx, model.LoanApplication{
+			FullName:    "Full Name",
+			UserId:      admin.Id,
+			OfficerId:   sql.NullString{String: freeOfficer.Id, Valid: true},
+			ClaimedDate: time.Now().Add(-72 * time.Hour),
+			Status:      loan.InReview.String(),
+		})
+	}
+
+	draftLoan := model.LoanApplication{
+		FullName: "Full Name",
+		UserId:   user.Id,
+		Status:   loan.Draft.String(),
+		Region:   "Jakarta",
+	}
+	draftLoan, _ = loanRepo.InsertLoan(ctx, draftLoan)
+
+	// The least loaded officer get the submitted loan
+	if out := loanApp.Transition(ctx, draftLoan.Id, user.Id, loan.TransitionIn{Action: loan.ActionSubmit.String()}); out.Error != nil {
+		t.Fatal(out.Error)
+	}
+
+	userLoan, _ := loanRepo.GetLoan(ctx, draftLoan.Id)
+	if userLoan.OfficerId.String != freeOfficer.Id {
+		t.Fatalf("resulting: %s, expect: %s", userLoan.OfficerId.String, freeOfficer.Id)
+	}
+
+	if out := loanApp.SetOfficerRegion(ctx, busyOfficer.Id, loan.OfficerRegionIn{OfficerId: busyOfficer.Id, Region: "Jakarta"}); !errors.Is(out.Error, loan.ErrUserForbidden) {
+		t.Fatalf("resulting: %v, expect: %v", out.Error, loan.ErrUserForbidden)
+	}
+	if out := loanApp.SetOfficerRegion(ctx, admin.Id, loan.OfficerRegionIn{OfficerId: user.Id, Region: "Jakarta"}); !errors.Is(out.Error, loan.ErrOfficerNotValid) {
+		t.Fatalf("resulting: %v, expect: %v", out.Error, loan.ErrOfficerNotValid)
+	}
+	if out := loanApp.SetOfficerRegion(ctx, admin.Id, loan.OfficerRegionIn{OfficerId: busyOfficer.Id, Region: "Jakarta"}); out.Error != nil {
+		t.Fatal(out.Error)
+	}
+
+	// The officer of the region get the loan even when they are busier
+	loanRepo.InsertLoan(ctx, busyLoan)
+	regionApp := loan.NewApp(uploadFunc, loanRepo, queue.New(queue.Config{Strategy: queue.ByRegion, ClaimTTL: time.Hour}), loan.DefaultApprovalPolicy(), committee.DefaultConfig())
+	otherLoan := model.LoanApplication{
+		FullName: "Full Name",
+		UserId:   other.Id,
+		Status:   loan.Draft.String(),
+		Region:   "jakarta",
+	}
+	otherLoan, _ = loanRepo.InsertLoan(ctx, otherLoan)
+
+	if out := regionApp.Transition(ctx, otherLoan.Id, other.Id, loan.TransitionIn{Action: loan.ActionSubmit.String()}); out.Error != nil {
+		t.Fatal(out.Error)
+	}
+
+	userLoan, _ = loanRepo.GetLoan(ctx, otherLoan.Id)
+	if userLoan.OfficerId.String != busyOfficer.Id {
+		t.Fatalf("resulting: %s, expect: %s", userLoan.OfficerId.String, busyOfficer.Id)
+	}
+}
+
+func TestClaimLoan(t *testing.T) {
+	clearDb()
+
+	ctx := context.Background()
+
+	officer := model.User{
+		Username: "officer",
+		Password: "password",
+		Role:     rbac.FieldOfficer.String(),
+	}
+	officer, _ = authRepo.InsertUser(ctx, officer)
+
+	analyst := model.User{
+		Username: "analyst",
+		Password: "password",
+		Role:     rbac.CreditAnalyst.String(),
+	}
+	analyst, _ = authRepo.InsertUser(ctx, analyst)
+
+	admin := model.User{
+		Username: "admin",
+		Password: "password",
+		Role:     rbac.Admin.String(),
+	}
+	admin, _ = authRepo.InsertUser(ctx, admin)
+
+	retired := model.User{
+		Username: "retired",
+		Password: "password",
+		Role:     rbac.CreditAnalyst.String(),
+	}
+	retired, _ = authRepo.InsertUser(ctx, retired)
+	authRepo.DeactivateUser(ctx, retired.Id)
+
+	user := model.User{
+		Username: "username",
+		Password: "password",
+		Role:     rbac.Applicant.String(),
+	}
+	user, _ = authRepo.InsertUser(ctx, user)
+
+	newLoan := model.LoanApplication{
+		FullName: "Full Name",
+		UserId:   user.Id,
+		Status:   loan.Submitted.String(),
+	}
+	newLoan, _ = loanRepo.InsertLoan(ctx, newLoan)
+
+	// The claim of the analyst expired long ago
+	expiredLoan := model.LoanApplication{
+		FullName:    "Full Name",
+		UserId:      admin.Id,
+		OfficerId:   sql.NullString{String: analyst.Id, Valid: true},
+		ClaimedDate: time.Now().Add(-72 * time.Hour),
+		Status:      loan.InReview.String(),
+	}
+	expiredLoan, _ = loanRepo.InsertLoan(ctx, expiredLoan)
+
+	draftLoan := model.LoanApplication{
+		FullName: "Full Name",
+		UserId:   officer.Id,
+		Status:   loan.Draft.String(),
+	}
+	draftLoan, _ = loanRepo.InsertLoan(ctx, draftLoan)
+
+	// Every step run in order
+	testCases := []struct {
+		expect error
+		name   string
+		run    func() loan.QueueLoanOut
+	}{
+		{
+			expect: loan.ErrLoanNotQueued,
+			name:   "Claim the draft",
+			run:    func() loan.QueueLoanOut { return loanApp.ClaimLoan(ctx, draftLoan.Id, officer.Id) },
+		},
+		{
+			expect: loan.ErrUserForbidden,
+			name:   "Applicant can not claim",
+			run:    func() loan.QueueLoanOut { return loanApp.ClaimLoan(ctx, newLoan.Id, user.Id) },
+		},
+		{
+			expect: nil,
+			name:   "Officer claim the loan",
+			run:    func() loan.QueueLoanOut { return loanApp.ClaimLoan(ctx, newLoan.Id, officer.Id) },
+		},
+		{
+			expect: loan.ErrLoanClaimed,
+			name:   "Analyst can not claim the claimed loan",
+			run:    func() loan.QueueLoanOut { return loanApp.ClaimLoan(ctx, newLoan.Id, analyst.Id) },
+		},
+		{
+			expect: loan.ErrLoanNotClaimed,
+			name:   "Analyst can not release the loan of the officer",
+			run:    func() loan.QueueLoanOut { return loanApp.ReleaseLoan(ctx, newLoan.Id, analyst.Id) },
+		},
+		{
+			expect: nil,
+			name:   "Officer claim the expired loan",
+			run:    func() loan.QueueLoanOut { return loanApp.ClaimLoan(ctx, expiredLoan.Id, officer.Id) },
+		},
+		{
+			expect: nil,
+			name:   "Officer release the loan",
+			run:    func() loan.QueueLoanOut { return loanApp.ReleaseLoan(ctx, newLoan.Id, officer.Id) },
+		},
+		{
+			expect: loan.ErrUserForbidden,
+			name:   "Officer can not reassign",
+			run: func() loan.QueueLoanOut {
+				return loanApp.ReassignLoan(ctx, expiredLoan.Id, officer.Id, loan.ReassignLoanIn{OfficerId: analyst.Id})
+			},
+		},
+		{
+			expect: loan.ErrOfficerNotValid,
+			name:   "Admin can not reassign to the applicant",
+			run: func() loan.QueueLoanOut {
+				return loanApp.ReassignLoan(ctx, expiredLoan.Id, admin.Id, loan.ReassignLoanIn{OfficerId: user.Id})
+			},
+		},
+		{
+			expect: loan.ErrOfficerNotValid,
+			name:   "Admin can not reassign to the deactivated officer",
+			run: func() loan.QueueLoanOut {
+				return loanApp.ReassignLoan(ctx, expiredLoan.Id, admin.Id, loan.ReassignLoanIn{OfficerId: retired.Id})
+			},
+		},
+		{
+			expect: nil,
+			name:   "Admin reassign the loan to the analyst",
+			run: func() loan.QueueLoanOut {
+				return loanApp.ReassignLoan(ctx, expiredLoan.Id, admin.Id, loan.ReassignLoanIn{OfficerId: analyst.Id})
+			},
+		},
+	}
+
+	for _, c := range testCases {
+		t.Run(c.name, func(t *testing.T) {
+			out := c.run()
+			if !errors.Is(out.Error, c.expect) {
+				t.Fatalf("resulting: %v, expect: %v", out.Error, c.expect)
+			}
+		})
+	}
+
+	if out := loanApp.GetMyQueue(ctx, analyst.Id); len(out.Res) != 1 || out.Res[0].LoanId != expiredLoan.Id {
+		t.Fatalf("resulting: %+v, expect: the reassigned loan", out.Res)
+	}
+	if out := loanApp.GetMyQueue(ctx, officer.Id); len(out.Res) != 0 {
+		t.Fatalf("resulting: %+v, expect: empty queue", out.Res)
+	}
+	if out := loanApp.GetQueuePool(ctx, officer.Id); len(out.Res) != 1 || out.Res[0].LoanId != newLoan.Id {
+		t.Fatalf("resulting: %+v, expect: the released loan", out.Res)
+	}
+
+	// The officer can not work on the loan the analyst hold
+	if out := loanApp.Transition(ctx, expiredLoan.Id, officer.Id, loan.TransitionIn{
+		Action: loan.ActionRequestInfo.String(),
+		Fields: []string{"phone"},
+	}); !errors.Is(out.Error, loan.ErrLoanClaimed) {
+		t.Fatalf("resulting: %v, expect: %v", out.Error, loan.ErrLoanClaimed)
+	}
+}
+
+func TestApproveLoanTier(t *testing.T) {
+	clearDb()
+
+	ctx := context.Background()
+
+	users := make(map[string]model.User)
+	for _, v := range []struct {
+		name string
+		role rbac.Role
+	}{
+		{"user", rbac.Applicant},
+		{"officer", rbac.FieldOfficer},
+		{"admin", rbac.Admin},
+		{"approver", rbac.Approver},
+		{"approver2", rbac.Approver},
+		{"senior", rbac.SeniorApprover},
+	} {
+		users[v.name], _ = authRepo.InsertUser(ctx, model.User{
+			Username: v.name,
+			Password: "password",
+			Role:     v.role.String(),
+		})
+	}
+
+	insertLoan := func(amount int64) model.LoanApplication {
+		newLoan, _ := loanRepo.InsertLoan(ctx, model.LoanApplication{
+			FullName:             "Full Name",
+			UserId:               users["user"].Id,
+			LoanApplicationInIdr: amount,
+			Status:               loan.Submitted.String(),
+		})
+		return newLoan
+	}
+	smallLoan := insertLoan(50_000_000)
+	bigLoan := insertLoan(50_000_001)
+	seniorLoan := insertLoan(100_000_000)
+	infoLoan := insertLoan(100_000_000)
+
+	loanApp.ProceedLoan(ctx, smallLoan.Id, users["admin"].Id)
+	for _, v := range []model.LoanApplication{bigLoan, seniorLoan, infoLoan} {
+		loanApp.ProceedLoan(ctx, v.Id, users["officer"].Id)
+	}
+
+	approve := func(loanId, userName string) loan.ApproveLoanOut {
+		return loanApp.ApproveLoan(ctx, loanId, users[userName].Id, loan.ApproveLoanIn{
+			IsApprove:  true,
+			DecisionIn: loan.DecisionIn{ReasonCodes: []string{loan.ReasonCriteriaMet.String()}},
+		})
+	}
+
+	// Every step run in order
+	testCases := []struct {
+		expect       error
+		expectStatus string
+		name         string
+		loanId       string
+		run          func() loan.ApproveLoanOut
+	}{
+		{
+			expect:       loan.ErrSameReviewer,
+			expectStatus: loan.InReview.String(),
+			name:         "Reviewer can not approve",
+			loanId:       smallLoan.Id,
+			run:          func() loan.ApproveLoanOut { return approve(smallLoan.Id, "admin") },
+		},
+		{
+			expect:       loan.ErrSameReviewer,
+			expectStatus: loan.InReview.String(),
+			name:         "Reviewer can not reject",
+			loanId:       smallLoan.Id,
+			run: func() loan.ApproveLoanOut {
+				return loanApp.ApproveLoan(ctx, smallLoan.Id, users["admin"].Id, loan.ApproveLoanIn{
+					DecisionIn: loan.DecisionIn{ReasonCodes: []string{loan.ReasonOutsidePolicy.String()}},
+				})
+			},
+		},
+		{
+			expect:       nil,
+			expectStatus: loan.Approved.String(),
+			name:         "Loan at the tier need one approver",
+			loanId:       smallLoan.Id,
+			run:          func() loan.ApproveLoanOut { return approve(smallLoan.Id, "approver") },
+		},
+		{
+			expect:       nil,
+			expectStatus: loan.InReview.String(),
+			name:         "Loan above the tier wait for the second approver",
+			loanId:       bigLoan.Id,
+			run:          func() loan.ApproveLoanOut { return approve(bigLoan.Id, "approver") },
+		},
+		{
+			expect:       loan.ErrAlreadySigned,
+			expectStatus: loan.InReview.String(),
+			name:         "Approver can not sign twice",
+			loanId:       bigLoan.Id,
+			run:          func() loan.ApproveLoanOut { return approve(bigLoan.Id, "approver") },
+		},
+		{
+			expect:       nil,
+			expectStatus: loan.Approved.String(),
+			name:         "Second approver approve the loan",
+			loanId:       bigLoan.Id,
+			run:          func() loan.ApproveLoanOut { return approve(bigLoan.Id, "approver2") },
+		},
+		{
+			expect:       nil,
+			expectStatus: loan.Approved.String(),
+			name:         "Senior approver approve the loan alone",
+			loanId:       seniorLoan.Id,
+			run:          func() loan.ApproveLoanOut { return approve(seniorLoan.Id, "senior") },
+		},
+	}
+
+	for _, c := range testCases {
+		t.Run(c.name, func(t *testing.T) {
+			out := c.run()
+			if !errors.Is(out.Error, c.expect) {
+				t.Fatalf("resulting: %v, expect: %v", out.Error, c.expect)
+			}
+
+			detail := loanApp.GetLoanDetail(ctx, c.loanId)
+			if detail.Res.Status != c.expectStatus {
+				t.Fatalf("resulting: %s, expect: %s", detail.Res.Status, c.expectStatus)
+			}
+		})
+	}
+
+	detail := loanApp.GetLoanDetail(ctx, bigLoan.Id)
+	if detail.Res.RequiredApprovals != 2 || len(detail.Res.ApprovalSignatures) != 2 {
+		t.Fatalf("resulting: %d of %d, expect: 2 of 2", len(detail.Res.ApprovalSignatures), detail.Res.RequiredApprovals)
+	}
+	if detail.Res.ApprovalSignatures[0].ApproverId != users["approver"].Id {
+		t.Fatalf("resulting: %s, expect: %s", detail.Res.ApprovalSignatures[0].ApproverId, users["approver"].Id)
+	}
+
+	// The signature given before the applicant changed the loan does not count anymore
+	approve(infoLoan.Id, "approver")
+	loanApp.Transition(ctx, infoLoan.Id, users["officer"].Id, loan.TransitionIn{
+		Action:  loan.ActionRequestInfo.String(),
+		Comment: "Wrong phone",
+		Fields:  []string{"phone"},
+	})
+	loanApp.Transition(ctx, infoLoan.Id, users["user"].Id, loan.TransitionIn{Action: loan.ActionResubmit.String()})
+
+	if out := approve(infoLoan.Id, "approver"); out.Error != nil {
+		t.Fatalf("resulting: %v, expect: %v", out.Error, nil)
+	}
+	if out := loanApp.GetLoanDetail(ctx, infoLoan.Id); out.Res.Status != loan.InReview.String() {
+		t.Fatalf("resulting: %s, expect: %s", out.Res.Status, loan.InReview.String())
+	}
+
+	actions := loanApp.GetLoanActions(ctx, infoLoan.Id, users["officer"].Id).Res.Actions
+	if len(actions) != 1 || actions[0] != loan.ActionRequestInfo.String() {
+		t.Fatalf("resulting: %v, expect: [%s]", actions, loan.ActionRequestInfo)
+	}
+	actions = loanApp.GetLoanActions(ctx, infoLoan.Id, users["approver"].Id).Res.Actions
+	if len(actions) != 1 || actions[0] != loan.ActionReject.String() {
+		t.Fatalf("resulting: %v, expect: [%s]", actions, loan.ActionReject)
+	}
+}
+
+func TestApproveLoanOwnAndConcurrent(t *testing.T) {
+	clearDb()
+
+	ctx := context.Background()
+
+	users := make(map[string]model.User)
+	for _, v := range []struct {
+		name string
+		role rbac.Role
+	}{
+		{"user", rbac.Applicant},
+		{"officer", rbac.FieldOfficer},
+		{"approver", rbac.Approver},
+		{"approver2", rbac.Approver},
+		{"approver3", rbac.Approver},
+	} {
+		users[v.name], _ = authRepo.InsertUser(ctx, model.User{
+			Username: v.name,
+			Password: "password",
+			Role:     v.role.String(),
+		})
+	}
+
+	approveIn := loan.ApproveLoanIn{
+		IsApprove:  true,
+		DecisionIn: loan.DecisionIn{ReasonCodes: []string{loan.ReasonCriteriaMet.String()}},
+	}
+
+	ownLoan, _ := loanRepo.InsertLoan(ctx, model.LoanApplication{
+		FullName:             "Full Name",
+		UserId:               users["approver"].Id,
+		LoanApplicationInIdr: 1_000_000,
+		Status:               loan.Submitted.String(),
+	})
+	loanApp.ProceedLoan(ctx, ownLoan.Id, users["officer"].Id)
+
+	if out := loanApp.ApproveLoan(ctx, ownLoan.Id, users["approver"].Id, approveIn); !errors.Is(out.Error, loan.ErrDecideOwnLoan) {
+		t.Fatalf("resulting: %v, expect: %v", out.Error, loan.ErrDecideOwnLoan)
+	}
+	for _, v := range loanApp.GetLoanActions(ctx, ownLoan.Id, users["approver"].Id).Res.Actions {
+		if v == loan.ActionApprove.String() || v == loan.ActionReject.String() {
+			t.Fatalf("resulting: %s, expect: no decision on the own loan", v)
+		}
+	}
+
+	// Of the approvers signing at once one always see the signatures are enough,
+	// so the loan never stay in review with every signature it need
+	for i := 0; i < 10; i++ {
+		bigLoan, _ := loanRepo.InsertLoan(ctx, model.LoanApplication{
+			FullName:             "Full Name",
+			UserId:               users["user"].Id,
+			LoanApplicationInIdr: 100_000_000,
+			Status:               loan.Submitted.String(),
+		})
+		loanApp.ProceedLoan(ctx, bigLoan.Id, users["officer"].Id)
+
+		var wg sync.WaitGroup
+		for _, name := range []string{"approver", "approver2", "approver3"} {
+			wg.Add(1)
+			go func(name string) {
+				defer wg.Done()
+				out := loanApp.ApproveLoan(ctx, bigLoan.Id, users[name].Id, approveIn)
+				if out.Error != nil && !errors.Is(out.Error, loan.ErrLoanStatusChanged) && !errors.Is(out.Error, loan.ErrModifyProcessLoan) {
+					t.Errorf("resulting: %v, expect: %v", out.Error, nil)
+				}
+			}(name)
+		}
+		wg.Wait()
+
+		if out := loanApp.GetLoanDetail(ctx, bigLoan.Id); out.Res.Status != loan.Approved.String() {
+			t.Fatalf("resulting: %s, expect: %s", out.Res.Status, loan.Approved.String())
+		}
+	}
+}
+
+func TestApprovalPolicyFromEnv(t *testing.T) {
+	t.Setenv("APPROVAL_TIERS", "50000000:2, 200000000:3")
+
+	policy, err := loan.ApprovalPolicyFromEnv()
+	if err != nil {
+		t.Fatalf("resulting: %v, expect: %v", err, nil)
+	}
+
+	testCases := []struct {
+		expect int
+		amount int64
+	}{
+		{expect: 1, amount: 50_000_000},
+		{expect: 2, amount: 50_000_001},
+		{expect: 3, amount: 200_000_001},
+	}
+
+	for _, c := range testCases {
+		if res := policy.Required(c.amount); res != c.expect {
+			t.Fatalf("amount %d resulting: %d, expect: %d", c.amount, res, c.expect)
+		}
+	}
+
+	t.Setenv("APPROVAL_TIERS", "50000000")
+	if _, err := loan.ApprovalPolicyFromEnv(); !errors.Is(err, loan.ErrApprovalTierNotValid) {
+		t.Fatalf("resulting: %v, expect: %v", err, loan.ErrApprovalTierNotValid)
+	}
+}
+
+func TestCommitteeVote(t *testing.T) {
+	clearDb()
+
+	ctx := context.Background()
+
+	users := make(map[string]model.User)
+	for _, v := range []struct {
+		name string
+		role rbac.Role
+	}{
+		{"user", rbac.Applicant},
+		{"officer", rbac.FieldOfficer},
+		{"analyst", rbac.CreditAnalyst},
+		{"approver", rbac.Approver},
+		{"approver2", rbac.Approver},
+		{"senior", rbac.SeniorApprover},
+		{"retired", rbac.Approver},
+	} {
+		users[v.name], _ = authRepo.InsertUser(ctx, model.User{
+			Username: v.name,
+			Password: "password",
+			Role:     v.role.String(),
+		})
+	}
+	authRepo.DeactivateUser(ctx, users["retired"].Id)
+
+	committeeApp := loan.NewApp(uploadFunc, loanRepo, queue.New(queue.DefaultConfig()), loan.DefaultApprovalPolicy(), committee.Config{
+		ThresholdInIdr: 100_000_000,
+		Quorum:         50,
+		Majority:       50,
+		VoteTTL:        time.Hour,
+	})
+
+	insertLoan := func() model.LoanApplication {
+		newLoan, _ := loanRepo.InsertLoan(ctx, model.LoanApplication{
+			FullName:             "Full Name",
+			UserId:               users["user"].Id,
+			LoanApplicationInIdr: 200_000_000,
+			Status:               loan.Submitted.String(),
+		})
+		committeeApp.ProceedLoan(ctx, newLoan.Id, users["officer"].Id)
+		return newLoan
+	}
+	newLoan := insertLoan()
+
+	openVote := func(userName string, members ...string) loan.VoteOut {
+		officerIds := make([]string, 0, len(members))
+		for _, v := range members {
+			officerIds = append(officerIds, users[v].Id)
+		}
+		return committeeApp.OpenVote(ctx, newLoan.Id, users[userName].Id, loan.OpenVoteIn{
+			OfficerIds: officerIds,
+			Note:       "Loan above the threshold",
+		})
+	}
+
+	var voteId string
+	castVote := func(userName, choice string) error {
+		return committeeApp.CastVote(ctx, voteId, users[userName].Id, loan.CastVoteIn{
+			Choice:  choice,
+			Comment: "Checked the business income",
+		}).Error
+	}
+
+	// Every step run in order
+	testCases := []struct {
+		expect error
+		name   string
+		run    func() error
+	}{
+		{
+			expect: loan.ErrCommitteeRequired,
+			name:   "Approver can not decide alone above the threshold",
+			run: func() error {
+				return committeeApp.ApproveLoan(ctx, newLoan.Id, users["approver"].Id, loan.ApproveLoanIn{
+					IsApprove:  true,
+					DecisionIn: loan.DecisionIn{ReasonCodes: []string{loan.ReasonCriteriaMet.String()}},
+				}).Error
+			},
+		},
+		{
+			expect: loan.ErrUserForbidden,
+			name:   "Analyst can not open the vote",
+			run:    func() error { return openVote("analyst", "approver2").Error },
+		},
+		{
+			expect: loan.ErrMembersRequired,
+			name:   "Vote without member",
+			run:    func() error { return openVote("approver").Error },
+		},
+		{
+			expect: loan.ErrMemberNotValid,
+			name:   "Reviewer can not vote",
+			run:    func() error { return openVote("approver", "analyst", "officer").Error },
+		},
+		{
+			expect: loan.ErrMemberNotValid,
+			name:   "Applicant can not vote",
+			run:    func() error { return openVote("approver", "analyst", "user").Error },
+		},
+		{
+			expect: loan.ErrMemberNotValid,
+			name:   "Deactivated approver can not vote",
+			run:    func() error { return openVote("approver", "analyst", "retired").Error },
+		},
+		{
+			expect: nil,
+			name:   "Approver open the vote",
+			run: func() error {
+				out := openVote("approver", "analyst", "approver2", "senior", "analyst")
+				voteId = out.Res.Id
+				if out.Error == nil && (out.Res.Status != committee.Open.String() || out.Res.Invited != 3) {
+					return errors.New("expect the open vote with 3 invited")
+				}
+				return out.Error
+			},
+		},
+		{
+			expect: loan.ErrVoteOpen,
+			name:   "Only one vote open at a time",
+			run:    func() error { return openVote("senior", "analyst").Error },
+		},
+		{
+			expect: loan.ErrVoteOpen,
+			name:   "Loan can not be moved while the vote is open",
+			run: func() error {
+				return committeeApp.Transition(ctx, newLoan.Id, users["officer"].Id, loan.TransitionIn{
+					Action:  loan.ActionRequestInfo.String(),
+					Comment: "Wrong phone",
+					Fields:  []string{"phone"},
+				}).Error
+			},
+		},
+		{
+			expect: loan.ErrNotVoteMember,
+			name:   "Officer not invited can not vote",
+			run:    func() error { return castVote("officer", committee.Approve.String()) },
+		},
+		{
+			expect: loan.ErrChoiceNotValid,
+			name:   "Unknown choice",
+			run:    func() error { return castVote("analyst", "maybe") },
+		},
+		{
+			expect: nil,
+			name:   "Analyst approve",
+			run:    func() error { return castVote("analyst", committee.Approve.String()) },
+		},
+		{
+			expect: loan.ErrAlreadyVoted,
+			name:   "Analyst can not vote twice",
+			run:    func() error { return castVote("analyst", committee.Reject.String()) },
+		},
+		{
+			expect: nil,
+			name:   "Second approver reject",
+			run:    func() error { return castVote("approver2", committee.Reject.String()) },
+		},
+		{
+			expect: nil,
+			name:   "Last vote close the vote",
+			run:    func() error { return castVote("senior", committee.Approve.String()) },
+		},
+		{
+			expect: loan.ErrVoteClosed,
+			name:   "Closed vote can not be closed again",
+			run:    func() error { return committeeApp.CloseVote(ctx, voteId, users["approver"].Id).Error },
+		},
+	}
+
+	for _, c := range testCases {
+		t.Run(c.name, func(t *testing.T) {
+			if err := c.run(); !errors.Is(err, c.expect) {
+				t.Fatalf("resulting: %v, expect: %v", err, c.expect)
+			}
+		})
+	}
+
+	votes := committeeApp.GetLoanVotes(ctx, newLoan.Id, users["officer"].Id).Res
+	if len(votes) != 1 || votes[0].Status != committee.Approved.String() || votes[0].Approve != 2 || votes[0].Reject != 1 {
+		t.Fatalf("resulting: %+v, expect: approved 2 to 1", votes)
+	}
+	if out := committeeApp.GetLoanDetail(ctx, newLoan.Id); out.Res.Status != loan.Approved.String() {
+		t.Fatalf("resulting: %s, expect: %s", out.Res.Status, loan.Approved.String())
+	}
+
+	// Every voter abstained, the loan stay in review
+	newLoan = insertLoan()
+	voteId = openVote("approver", "analyst", "approver2").Res.Id
+	castVote("analyst", committee.Abstain.String())
+	if out := committeeApp.CloseVote(ctx, voteId, users["approver"].Id); out.Error != nil || out.Res.Status != committee.NoQuorum.String() {
+		t.Fatalf("resulting: %v %s, expect: %s", out.Error, out.Res.Status, committee.NoQuorum)
+	}
+	if out := committeeApp.GetLoanDetail(ctx, newLoan.Id); out.Res.Status != loan.InReview.String() {
+		t.Fatalf("resulting: %s, expect: %s", out.Res.Status, loan.InReview.String())
+	}
+
+	// The vote past its deadline is closed with the votes it has
+	newLoan = insertLoan()
+	vote, _, _ := loanRepo.InsertCommitteeVote(ctx, model.CommitteeVote{
+		LoanId:       newLoan.Id,
+		OpenedBy:     users["approver"].Id,
+		Status:       committee.Open.String(),
+		Quorum:       50,
+		Majority:     50,
+		DeadlineDate: time.Now().Add(-time.Minute),
+	}, []string{users["analyst"].Id, users["approver2"].Id})
+	loanRepo.CastBallot(ctx, model.CommitteeBallot{
+		VoteId:    vote.Id,
+		OfficerId: users["analyst"].Id,
+		Choice:    committee.Reject.String(),
+	})
+
+	voteId = vote.Id
+	if err := castVote("approver2", committee.Approve.String()); !errors.Is(err, loan.ErrVoteClosed) {
+		t.Fatalf("resulting: %v, expect: %v", err, loan.ErrVoteClosed)
+	}
+	if n, err := committeeApp.CloseExpiredVotes(ctx); err != nil || n != 0 {
+		t.Fatalf("resulting: %d %v, expect: 0 closed", n, err)
+	}
+	if out := committeeApp.GetLoanDetail(ctx, newLoan.Id); out.Res.Status != loan.Rejected.String() {
+		t.Fatalf("resulting: %s, expect: %s", out.Res.Status, loan.Rejected.String())
+	}
+
+	// The vote of the removed loan is closed as void so it is not tried again, and the committee
+	// decide the loan even when the officer that opened the vote can no longer decide
+	expiredVote := func(loanId string) model.CommitteeVote {
+		vote, _, _ := loanRepo.InsertCommitteeVote(ctx, model.CommitteeVote{
+			LoanId:       loanId,
+			OpenedBy:     users["approver"].Id,
+			Status:       committee.Open.String(),
+			Quorum:       50,
+			Majority:     50,
+			DeadlineDate: time.Now().Add(-time.Minute),
+		}, []string{users["analyst"].Id})
+		loanRepo.CastBallot(ctx, model.CommitteeBallot{
+			VoteId:    vote.Id,
+			OfficerId: users["analyst"].Id,
+			Choice:    committee.Approve.String(),
+		})
+		return vote
+	}
+
+	removedLoan := insertLoan()
+	removedVote := expiredVote(removedLoan.Id)
+	loanRepo.RemoveLoan(ctx, removedLoan.Id)
+	newLoan = insertLoan()
+	expiredVote(newLoan.Id)
+	authRepo.UpdateRole(ctx, users["approver"].Id, rbac.Applicant.String())
+
+	if n, err := committeeApp.CloseExpiredVotes(ctx); n != 2 || err != nil {
+		t.Fatalf("resulting: %d %v, expect: 2 closed", n, err)
+	}
+	if v, _ := loanRepo.GetCommitteeVote(ctx, removedVote.Id); v.Status != committee.Void.String() {
+		t.Fatalf("resulting: %s, expect: %s", v.Status, committee.Void.String())
+	}
+	if out := committeeApp.GetLoanDetail(ctx, newLoan.Id); out.Res.Status != loan.Approved.String() {
+		t.Fatalf("resulting: %s, expect: %s", out.Res.Status, loan.Approved.String())
+	}
+
+	histories, _ := loanRepo.GetLoanHistories(ctx, newLoan.Id)
+	if last := histories[len(histories)-1]; last.ActorRole != loan.CommitteeActorRole || last.ToStatus != loan.Approved.String() {
+		t.Fatalf("resulting: %+v, expect: approved by %s", last, loan.CommitteeActorRole)
+	}
+}
+
+func TestCreditScore(t *testing.T) {
+	clearDb()
+
+	ctx := context.Background()
+	f, err := os.OpenFile("./loan_application.go", os.O_RDONLY, 0o444)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	user, _ := authRepo.InsertUser(ctx, model.User{
+		Username: "username",
+		Password: "password",
+		Role:     rbac.Applicant.String(),
+	})
+
+	created := loanApp.CreateLoan(ctx, user.Id, loan.CreateLoanIn{
+		IsPrivateField:               true,
+		ExpInYear:                    6,
+		ActiveFieldNumber:            1,
+		SowSeedsPerCycle:             1,
+		NeededFertilizerPerCycleInKg: 1,
+		EstimatedYieldInKg:           10_000,
+		EstimatedPriceOfHarvestPerKg: 5_000,
+		HarvestCycleInMonths:         4,
+		LoanApplicationInIdr:         30_000_000,
+		BusinessIncomePerMonthInIdr:  10_000_000,
+		BusinessOutcomePerMonthInIdr: 5_000_000,
+		FullName:                     "Full Name",
+		BirthDate:                    "2006-01-02",
+		FullAddress:                  "Full Address",
+		Phone:                        "0000000000",
+		OtherBusiness:                "-",
+		IdCard: loan.FileHeader{
+			Filename: "test.img",
+			File:     f,
+		},
+		IsDraft: true,
+	})
+	if created.Error != nil {
+		t.Fatalf("resulting: %v, expect: %v", created.Error, nil)
+	}
+
+	out := loanApp.GetLoanDetail(ctx, created.Res.Id)
+	if out.Res.EstimatedYieldInKg != 10_000 {
+		t.Fatalf("resulting: %d, expect: %d", out.Res.EstimatedYieldInKg, 10_000)
+	}
+	score := out.Res.CreditScore
+	if score.Score != 91 || score.Grade != "A" || score.ProjectedRevenuePerYearInIdr != 150_000_000 || score.ScoredDate == "" {
+		t.Fatalf("resulting: %+v, expect: score 91 graded A", score)
+	}
+	if len(score.Factors) != 5 || score.Factors[0].Name != "debt_service" {
+		t.Fatalf("resulting: %+v, expect: 5 factors starting with debt_service", score.Factors)
+	}
+
+	updated := loanApp.UpdateLoan(ctx, created.Res.Id, user.Id, loan.UpdateLoanIn{
+		ExpInYear:                    1,
+		ActiveFieldNumber:            1,
+		SowSeedsPerCycle:             1,
+		NeededFertilizerPerCycleInKg: 1,
+		EstimatedYieldInKg:           1_000,
+		EstimatedPriceOfHarvestPerKg: 2_000,
+		HarvestCycleInMonths:         6,
+		LoanApplicationInIdr:         12_000_000,
+		BusinessIncomePerMonthInIdr:  3_000_000,
+		BusinessOutcomePerMonthInIdr: 3_500_000,
+		FullName:                     "Full Name",
+		BirthDate:                    "2006-01-02",
+		FullAddress:                  "Full Address",
+		Phone:                        "0000000000",
+		OtherBusiness:                "-",
+		IdCard: loan.FileHeader{
+			Filename: "test.img",
+			File:     f,
+		},
+	})
+	if updated.Error != nil {
+		t.Fatalf("resulting: %v, expect: %v", updated.Error, nil)
+	}
+
+	out = loanApp.GetLoanDetail(ctx, created.Res.Id)
+	if out.Res.CreditScore.Score != 3 || out.Res.CreditScore.Grade != "E" {
+		t.Fatalf("resulting: %+v, expect: score 3 graded E", out.Res.CreditScore)
+	}
+
+	// The loan stored before the scoring is scored when it is read
+	oldLoan, _ := loanRepo.InsertLoan(ctx, model.LoanApplication{
+		FullName:             "Full Name",
+		UserId:               user.Id,
+		ExpInYear:            10,
+		LoanApplicationInIdr: 1_000_000,
+	})
+	out = loanApp.GetLoanDetail(ctx, oldLoan.Id)
+	if out.Res.CreditScore.Score != 15 || out.Res.CreditScore.ScoredDate != "" {
+		t.Fatalf("resulting: %+v, expect: score 15 without scored date", out.Res.CreditScore)
+	}
+}
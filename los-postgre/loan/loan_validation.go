@@ -3,8 +3,11 @@ package loan
 import (
 	"errors"
 	"strconv"
+	"strings"
 	"time"
 	"unicode/utf8"
+
+	"github.com/fikryfahrezy/adea/los-postgre/committee"
 )
 
 var (
@@ -37,6 +40,20 @@ var (
 	ErrIncomePerMonthLtZero     = errors.New("business income per month should greater than zero")
 	ErrOutcomePerMonthRequired  = errors.New("business outcome per month required")
 	ErrOutcomePerMonthLtZero    = errors.New("business outcome per month should greater than zero")
+	ErrActionNotValid           = errors.New("loan action not valid")
+	ErrCommentMax500            = errors.New("comment max 500 characters")
+	ErrReasonRequired           = errors.New("at least one reason code required to reject")
+	ErrReasonNotValid           = errors.New("reason code not valid for the decision")
+	ErrReasonOtherNote          = errors.New("note required for the other reason")
+	ErrNoteMax1000              = errors.New("note max 1000 characters")
+	ErrInternalNoteMax2000      = errors.New("internal note max 2000 characters")
+	ErrFieldsRequired           = errors.New("at least one field required to request info")
+	ErrFieldNotValid            = errors.New("field not valid")
+	ErrWithdrawReasonRequired   = errors.New("reason required to withdraw")
+	ErrRegionMax100             = errors.New("region max 100 characters")
+	ErrOfficerRequired          = errors.New("officer required")
+	ErrMembersRequired          = errors.New("at least one officer required to vote")
+	ErrChoiceNotValid           = errors.New("vote choice not valid")
 )
 
 func validateCreateLoan(in CreateLoanIn) error {
@@ -67,6 +84,9 @@ func validateCreateLoan(in CreateLoanIn) error {
 	if _, err := strconv.Atoi(in.Phone); err != nil {
 		return ErrPhoneNotNumbers
 	}
+	if utf8.RuneCountInString(in.Region) > 100 {
+		return ErrRegionMax100
+	}
 	if in.ExpInYear == 0 {
 		return ErrExpInYearRequired
 	}
@@ -165,6 +185,9 @@ func validateUpdateLoan(in UpdateLoanIn) error {
 	if _, err := strconv.Atoi(in.Phone); err != nil {
 		return ErrPhoneNotNumbers
 	}
+	if utf8.RuneCountInString(in.Region) > 100 {
+		return ErrRegionMax100
+	}
 	if in.ExpInYear == 0 {
 		return ErrExpInYearRequired
 	}
@@ -234,3 +257,94 @@ func validateUpdateLoan(in UpdateLoanIn) error {
 
 	return nil
 }
+
+func validateTransition(in TransitionIn) error {
+	if utf8.RuneCountInString(in.Comment) > 500 {
+		return ErrCommentMax500
+	}
+
+	return nil
+}
+
+func validateWithdraw(reason string) error {
+	if strings.TrimSpace(reason) == "" {
+		return ErrWithdrawReasonRequired
+	}
+	if utf8.RuneCountInString(reason) > 500 {
+		return ErrCommentMax500
+	}
+
+	return nil
+}
+
+func validateOfficerRegion(in OfficerRegionIn) error {
+	if in.OfficerId == "" {
+		return ErrOfficerRequired
+	}
+	if utf8.RuneCountInString(in.Region) > 100 {
+		return ErrRegionMax100
+	}
+
+	return nil
+}
+
+func validateOpenVote(in OpenVoteIn) error {
+	if len(in.OfficerIds) == 0 {
+		return ErrMembersRequired
+	}
+	if utf8.RuneCountInString(in.Note) > 1000 {
+		return ErrNoteMax1000
+	}
+
+	return nil
+}
+
+func validateCastVote(in CastVoteIn) error {
+	if _, err := committee.ChoiceFromString(in.Choice); err != nil {
+		return ErrChoiceNotValid
+	}
+	if utf8.RuneCountInString(in.Comment) > 500 {
+		return ErrCommentMax500
+	}
+
+	return nil
+}
+
+func validateRequestInfo(fields []string) error {
+	if len(fields) == 0 {
+		return ErrFieldsRequired
+	}
+
+	for _, v := range fields {
+		if !isLoanField(v) {
+			return ErrFieldNotValid
+		}
+	}
+
+	return nil
+}
+
+func validateDecision(isApprove bool, in DecisionIn) error {
+	if !isApprove && len(in.ReasonCodes) == 0 {
+		return ErrReasonRequired
+	}
+
+	for _, v := range in.ReasonCodes {
+		r, err := ReasonFromString(v)
+		if err != nil || (isApprove && !r.forApprove) || (!isApprove && !r.forReject) {
+			return ErrReasonNotValid
+		}
+		if r == ReasonOther && strings.TrimSpace(in.Note) == "" {
+			return ErrReasonOtherNote
+		}
+	}
+
+	if utf8.RuneCountInString(in.Note) > 1000 {
+		return ErrNoteMax1000
+	}
+	if utf8.RuneCountInString(in.InternalNote) > 2000 {
+		return ErrInternalNoteMax2000
+	}
+
+	return nil
+}
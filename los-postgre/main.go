@@ -4,23 +4,32 @@ import (
 	"context"
 	"log"
 	"os"
+	"time"
 
 	"github.com/cockroachdb/cockroach-go/v2/crdb/crdbpgx"
 	"github.com/fikryfahrezy/adea/los-postgre/auth"
+	"github.com/fikryfahrezy/adea/los-postgre/committee"
 	"github.com/fikryfahrezy/adea/los-postgre/file"
 	"github.com/fikryfahrezy/adea/los-postgre/handler"
+	"github.com/fikryfahrezy/adea/los-postgre/id"
 	"github.com/fikryfahrezy/adea/los-postgre/loan"
+	"github.com/fikryfahrezy/adea/los-postgre/notify"
+	"github.com/fikryfahrezy/adea/los-postgre/oidc"
+	"github.com/fikryfahrezy/adea/los-postgre/queue"
 	"github.com/fikryfahrezy/adea/los-postgre/session"
 	"github.com/fikryfahrezy/adea/los-postgre/setting"
+	"github.com/fikryfahrezy/adea/los-postgre/throttle"
 	"github.com/jackc/pgx/v4"
+	"github.com/jackc/pgx/v4/pgxpool"
 )
 
 func main() {
-	conn, err := pgx.Connect(context.Background(), os.Getenv("DATABASE_URL"))
+	// The pool is shared by the request and the sweepers, a single connection can not be used at once
+	conn, err := pgxpool.Connect(context.Background(), os.Getenv("DATABASE_URL"))
 	if err != nil {
 		log.Fatal(err)
 	}
-	defer conn.Close(context.Background())
+	defer conn.Close()
 
 	err = crdbpgx.ExecuteTx(context.Background(), conn, pgx.TxOptions{}, func(tx pgx.Tx) error {
 		return conn.Ping(context.Background())
@@ -30,16 +39,73 @@ func main() {
 	}
 
 	file := file.New()
-	session := session.New()
+	sessionStore := session.NewPg(conn)
+	go session.RunSweeper(context.Background(), sessionStore, time.Minute)
 
-	authRepo := auth.NewRepository(conn)
-	loanRepo := loan.NewRepository(conn)
+	ids, err := id.FromEnv()
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	authRepo := auth.NewRepository(conn, ids)
+	loanRepo := loan.NewRepository(conn, ids)
 
 	setting := setting.NewSetting(file)
-	authApp := auth.NewApp(authRepo)
-	loanApp := loan.NewApp(file.Save, loanRepo)
+	passwordPolicy, err := auth.PasswordPolicyFromEnv()
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	loginThrottle := throttle.New(throttle.ConfigFromEnv())
+	go throttle.RunSweeper(context.Background(), loginThrottle, time.Minute)
+
+	// OIDC_ISSUER enable the login through the OpenID provider of the partner,
+	// the provider must be reachable at start to read its discovery document
+	var idp *oidc.Provider
+	if oidcCfg := oidc.ConfigFromEnv(); oidcCfg.Issuer != "" {
+		idp, err = oidc.NewProvider(context.Background(), oidcCfg, nil)
+		if err != nil {
+			log.Fatal(err)
+		}
+	}
+
+	queueCfg, err := queue.ConfigFromEnv()
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	approval, err := loan.ApprovalPolicyFromEnv()
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	committeeCfg, err := committee.ConfigFromEnv()
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	authApp := auth.NewApp(authRepo, passwordPolicy, notify.FromEnv(), loginThrottle, idp)
+	loanApp := loan.NewApp(file.Save, loanRepo, queue.New(queueCfg), approval, committeeCfg)
+	go loan.RunVoteSweeper(context.Background(), loanApp, time.Minute)
+
+	if err := authApp.EnsureAdmin(context.Background(), os.Getenv("ADMIN_USERNAME"), os.Getenv("ADMIN_PASSWORD")); err != nil {
+		log.Fatal(err)
+	}
+
+	// AUTH_MODE=token issue stateless signed token instead of keeping session,
+	// useful when the replicas can not share the session store
+	sessionCfg := session.ConfigFromEnv()
+	var authenticator session.Authenticator = session.NewManager(sessionStore, sessionCfg)
+	if os.Getenv("AUTH_MODE") == "token" {
+		signer, err := session.SignerFromEnv(sessionCfg)
+		if err != nil {
+			log.Fatal(err)
+		}
+		signer.SetUserLookup(authApp.SessionRole)
+		authenticator = signer
+	}
 
-	handler := handler.NewHandler(session, setting, authApp, loanApp)
+	handler := handler.NewHandler(authenticator, setting, authApp, loanApp, session.CookieConfigFromEnv(sessionCfg))
 
 	handler.ServeRestAPI()
 }
@@ -0,0 +1,16 @@
+package model
+
+import "time"
+
+// ApprovalSignature is the approval of a single approver on the loan, the loan above the
+// approval tier is only approved once it has enough of them
+type ApprovalSignature struct {
+	Id           string
+	LoanId       string
+	ApproverId   string
+	ApproverRole string
+	Note         string
+	// ReviewId is the history that put the loan in review when it was signed
+	ReviewId    string
+	CreatedDate time.Time
+}
@@ -0,0 +1,30 @@
+package model
+
+import "time"
+
+// CommitteeVote is the credit committee deciding on a loan, Quorum and Majority are kept
+// as they were when the vote opened so a change of the config does not change the running vote
+type CommitteeVote struct {
+	Id           string
+	LoanId       string
+	OpenedBy     string
+	Status       string
+	Note         string
+	Quorum       int
+	Majority     int
+	DeadlineDate time.Time
+	CreatedDate  time.Time
+	// ClosedDate is zero while the vote is open
+	ClosedDate time.Time
+}
+
+// CommitteeBallot is the invitation of a member to the vote, Choice is empty until the member vote
+type CommitteeBallot struct {
+	Id          string
+	VoteId      string
+	OfficerId   string
+	Choice      string
+	Comment     string
+	CreatedDate time.Time
+	VotedDate   time.Time
+}
@@ -0,0 +1,24 @@
+package model
+
+import "time"
+
+// CreditScore is the automated assessment of the farm business of the loan,
+// it is computed again every time the applicant change the loan
+type CreditScore struct {
+	ProjectedRevenuePerYearInIdr int64
+	NetMargin                    float64
+	LoanToRevenue                float64
+	DebtServiceRatio             float64
+	Score                        int64
+	Grade                        string
+	Factors                      []ScoreFactor
+	ScoredDate                   time.Time
+}
+
+// ScoreFactor is how much one factor add to the score, out of its Weight
+type ScoreFactor struct {
+	Name        string
+	Weight      int64
+	Points      int64
+	Explanation string
+}
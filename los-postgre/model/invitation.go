@@ -0,0 +1,14 @@
+package model
+
+import "time"
+
+type Invitation struct {
+	IsUsed      bool
+	Id          string
+	TokenHash   string
+	Role        string
+	InvitedBy   string
+	UserId      string
+	CreatedDate time.Time
+	ExpiredDate time.Time
+}
@@ -26,7 +26,26 @@ type LoanApplication struct {
 	IdCardUrl                    string
 	OtherBusiness                string
 	Status                       string
-	OfficerId                    sql.NullString
-	CreatedDate                  time.Time
-	UpdatedDate                  time.Time
+	// Region is where the farm is, the loan can be assigned to the officer of the region
+	Region string
+	// DecisionReasons and DecisionNote explain the approval or rejection to the applicant,
+	// DecisionInternalNote is only shown to the officers
+	DecisionReasons      []string
+	DecisionNote         string
+	DecisionInternalNote string
+	// UnlockedFields are the fields the applicant may correct while the loan needs info,
+	// InfoRequestNote tell the applicant what to correct
+	UnlockedFields  []string
+	InfoRequestNote string
+	// WithdrawReason is why the applicant cancelled the loan
+	WithdrawReason string
+	OfficerId      sql.NullString
+	// CreditScore is computed from the farm business fields when the loan is created or updated
+	CreditScore CreditScore
+	// ClaimedDate is when the officer of the loan last touched it, the claim expire after a while
+	ClaimedDate time.Time
+	CreatedDate time.Time
+	UpdatedDate time.Time
+	// DeletedDate is set once the loan is deleted or archived, the loan is kept but hidden
+	DeletedDate sql.NullTime
 }
@@ -0,0 +1,16 @@
+package model
+
+import "time"
+
+// LoanStatusHistory is a single transition of a loan, it is only ever appended
+// so the previous status and who changed it are never lost
+type LoanStatusHistory struct {
+	Id          string
+	LoanId      string
+	FromStatus  string
+	ToStatus    string
+	ActorId     string
+	ActorRole   string
+	Comment     string
+	CreatedDate time.Time
+}
@@ -3,9 +3,20 @@ package model
 import "time"
 
 type User struct {
-	IsOfficer   bool
 	Id          string
 	Username    string
 	Password    string
+	Role        string
+	DisplayName string
+	Email       string
+	Phone       string
 	CreatedDate time.Time
+	// LastLoginAt is zero when the user never logged in
+	LastLoginAt time.Time
+	// DeactivatedDate is zero while the user is active, a deactivated user can not log in
+	DeactivatedDate time.Time
+}
+
+func (u User) IsActive() bool {
+	return u.DeactivatedDate.IsZero()
 }
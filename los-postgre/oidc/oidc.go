@@ -0,0 +1,426 @@
+package oidc
+
+import (
+	"context"
+	"crypto"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math/big"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+	"sync"
+	"time"
+)
+
+var (
+	ErrDiscovery      = errors.New("oidc discovery failed")
+	ErrExchangeFailed = errors.New("oidc code exchange failed")
+	ErrTokenNotValid  = errors.New("oidc id token not valid")
+)
+
+// leeway is how much the clock of the provider may be ahead or behind
+const leeway = time.Minute
+
+type Config struct {
+	Issuer       string
+	ClientId     string
+	ClientSecret string
+	RedirectUrl  string
+	Scopes       []string
+	// RoleClaim is the claim of the ID token holding the role of the user,
+	// a dot separate the nested claim like realm_access.roles
+	RoleClaim string
+	// AllowedRoles are the roles the provider may grant, any other role in the claim is ignored
+	AllowedRoles []string
+}
+
+// ConfigFromEnv read the OIDC_* variable, the provider is not used when OIDC_ISSUER is empty
+func ConfigFromEnv() Config {
+	cfg := Config{
+		Issuer:       os.Getenv("OIDC_ISSUER"),
+		ClientId:     os.Getenv("OIDC_CLIENT_ID"),
+		ClientSecret: os.Getenv("OIDC_CLIENT_SECRET"),
+		RedirectUrl:  os.Getenv("OIDC_REDIRECT_URL"),
+		Scopes:       []string{"openid", "profile", "email"},
+		RoleClaim:    "roles",
+		// The admin and the senior approver can do too much to be granted by
+		// whoever edit the claim at the provider, they have to be allowed explicitly
+		AllowedRoles: []string{"field_officer", "credit_analyst", "approver"},
+	}
+	if v := os.Getenv("OIDC_SCOPES"); v != "" {
+		cfg.Scopes = strings.Fields(v)
+	}
+	if v := os.Getenv("OIDC_ROLE_CLAIM"); v != "" {
+		cfg.RoleClaim = v
+	}
+	if v := os.Getenv("OIDC_ALLOWED_ROLES"); v != "" {
+		cfg.AllowedRoles = strings.Fields(v)
+	}
+
+	return cfg
+}
+
+// Claims is the part of the ID token the application use
+type Claims struct {
+	Issuer            string
+	Subject           string
+	Nonce             string
+	Email             string
+	Name              string
+	PreferredUsername string
+	Roles             []string
+	Expiry            time.Time
+}
+
+// Provider run the authorization code flow with PKCE against an OpenID provider,
+// the endpoints are read from its discovery document and the signing keys from its JWKS
+type Provider struct {
+	cfg           Config
+	client        *http.Client
+	authEndpoint  string
+	tokenEndpoint string
+	jwksUri       string
+
+	sync.RWMutex
+	keys map[string]*rsa.PublicKey
+	now  func() time.Time
+}
+
+func NewProvider(ctx context.Context, cfg Config, client *http.Client) (*Provider, error) {
+	if client == nil {
+		client = &http.Client{Timeout: 10 * time.Second}
+	}
+
+	var doc struct {
+		Issuer                string `json:"issuer"`
+		AuthorizationEndpoint string `json:"authorization_endpoint"`
+		TokenEndpoint         string `json:"token_endpoint"`
+		JwksUri               string `json:"jwks_uri"`
+	}
+	if err := getJSON(ctx, client, strings.TrimSuffix(cfg.Issuer, "/")+"/.well-known/openid-configuration", &doc); err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrDiscovery, err)
+	}
+
+	// The issuer must match exactly, otherwise a token of another provider could be accepted
+	if doc.Issuer != cfg.Issuer {
+		return nil, fmt.Errorf("%w: issuer %q does not match %q", ErrDiscovery, doc.Issuer, cfg.Issuer)
+	}
+	if doc.AuthorizationEndpoint == "" || doc.TokenEndpoint == "" || doc.JwksUri == "" {
+		return nil, fmt.Errorf("%w: missing endpoint", ErrDiscovery)
+	}
+
+	return &Provider{
+		cfg:           cfg,
+		client:        client,
+		authEndpoint:  doc.AuthorizationEndpoint,
+		tokenEndpoint: doc.TokenEndpoint,
+		jwksUri:       doc.JwksUri,
+		keys:          make(map[string]*rsa.PublicKey),
+		now:           time.Now,
+	}, nil
+}
+
+func (p *Provider) Issuer() string {
+	return p.cfg.Issuer
+}
+
+func (p *Provider) AllowedRoles() []string {
+	return p.cfg.AllowedRoles
+}
+
+// AuthCodeURL return the URL the user is sent to, the verifier is kept by the caller
+// and only its S256 challenge leave the application
+func (p *Provider) AuthCodeURL(state, nonce, verifier string) string {
+	q := url.Values{}
+	q.Set("response_type", "code")
+	q.Set("client_id", p.cfg.ClientId)
+	q.Set("redirect_uri", p.cfg.RedirectUrl)
+	q.Set("scope", strings.Join(p.cfg.Scopes, " "))
+	q.Set("state", state)
+	q.Set("nonce", nonce)
+	q.Set("code_challenge", Challenge(verifier))
+	q.Set("code_challenge_method", "S256")
+
+	sep := "?"
+	if strings.Contains(p.authEndpoint, "?") {
+		sep = "&"
+	}
+
+	return p.authEndpoint + sep + q.Encode()
+}
+
+// Exchange trade the code for the ID token and return its verified claims,
+// the nonce must be the one sent with the authorization request
+func (p *Provider) Exchange(ctx context.Context, code, verifier, nonce string) (Claims, error) {
+	form := url.Values{}
+	form.Set("grant_type", "authorization_code")
+	form.Set("code", code)
+	form.Set("redirect_uri", p.cfg.RedirectUrl)
+	form.Set("code_verifier", verifier)
+	form.Set("client_id", p.cfg.ClientId)
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, p.tokenEndpoint, strings.NewReader(form.Encode()))
+	if err != nil {
+		return Claims{}, err
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	req.Header.Set("Accept", "application/json")
+	if p.cfg.ClientSecret != "" {
+		req.SetBasicAuth(url.QueryEscape(p.cfg.ClientId), url.QueryEscape(p.cfg.ClientSecret))
+	}
+
+	res, err := p.client.Do(req)
+	if err != nil {
+		return Claims{}, err
+	}
+	defer res.Body.Close()
+
+	var body struct {
+		IdToken          string `json:"id_token"`
+		Error            string `json:"error"`
+		ErrorDescription string `json:"error_description"`
+	}
+	if err := json.NewDecoder(res.Body).Decode(&body); err != nil {
+		return Claims{}, fmt.Errorf("%w: %v", ErrExchangeFailed, err)
+	}
+	if res.StatusCode != http.StatusOK || body.Error != "" {
+		return Claims{}, fmt.Errorf("%w: %s %s", ErrExchangeFailed, body.Error, body.ErrorDescription)
+	}
+	if body.IdToken == "" {
+		return Claims{}, fmt.Errorf("%w: no id token", ErrExchangeFailed)
+	}
+
+	claims, err := p.Verify(ctx, body.IdToken)
+	if err != nil {
+		return Claims{}, err
+	}
+	if claims.Nonce != nonce {
+		return Claims{}, fmt.Errorf("%w: nonce does not match", ErrTokenNotValid)
+	}
+
+	return claims, nil
+}
+
+// Verify check the signature, issuer, audience and expiry of the ID token,
+// only RS256 is accepted so the algorithm can not be downgraded by the token itself
+func (p *Provider) Verify(ctx context.Context, rawIdToken string) (Claims, error) {
+	parts := strings.Split(rawIdToken, ".")
+	if len(parts) != 3 {
+		return Claims{}, fmt.Errorf("%w: malformed", ErrTokenNotValid)
+	}
+
+	var header struct {
+		Alg string `json:"alg"`
+		Kid string `json:"kid"`
+	}
+	if err := decodeSegment(parts[0], &header); err != nil {
+		return Claims{}, fmt.Errorf("%w: %v", ErrTokenNotValid, err)
+	}
+	if header.Alg != "RS256" {
+		return Claims{}, fmt.Errorf("%w: algorithm %q not accepted", ErrTokenNotValid, header.Alg)
+	}
+
+	key, err := p.key(ctx, header.Kid)
+	if err != nil {
+		return Claims{}, err
+	}
+
+	sig, err := base64.RawURLEncoding.DecodeString(parts[2])
+	if err != nil {
+		return Claims{}, fmt.Errorf("%w: %v", ErrTokenNotValid, err)
+	}
+	digest := sha256.Sum256([]byte(parts[0] + "." + parts[1]))
+	if err := rsa.VerifyPKCS1v15(key, crypto.SHA256, digest[:], sig); err != nil {
+		return Claims{}, fmt.Errorf("%w: signature", ErrTokenNotValid)
+	}
+
+	var raw map[string]interface{}
+	if err := decodeSegment(parts[1], &raw); err != nil {
+		return Claims{}, fmt.Errorf("%w: %v", ErrTokenNotValid, err)
+	}
+
+	claims := Claims{
+		Issuer:            stringClaim(raw, "iss"),
+		Subject:           stringClaim(raw, "sub"),
+		Nonce:             stringClaim(raw, "nonce"),
+		Email:             stringClaim(raw, "email"),
+		Name:              stringClaim(raw, "name"),
+		PreferredUsername: stringClaim(raw, "preferred_username"),
+		Roles:             stringsClaim(raw, p.cfg.RoleClaim),
+	}
+	if exp, ok := raw["exp"].(float64); ok {
+		claims.Expiry = time.Unix(int64(exp), 0)
+	}
+
+	if claims.Issuer != p.cfg.Issuer {
+		return Claims{}, fmt.Errorf("%w: issuer", ErrTokenNotValid)
+	}
+	if claims.Subject == "" {
+		return Claims{}, fmt.Errorf("%w: no subject", ErrTokenNotValid)
+	}
+	if !hasAudience(raw["aud"], p.cfg.ClientId) {
+		return Claims{}, fmt.Errorf("%w: audience", ErrTokenNotValid)
+	}
+	if claims.Expiry.IsZero() || p.now().After(claims.Expiry.Add(leeway)) {
+		return Claims{}, fmt.Errorf("%w: expired", ErrTokenNotValid)
+	}
+
+	return claims, nil
+}
+
+// key return the signing key of the kid, the JWKS is fetched again once
+// when the kid is unknown since the provider may have rotated its key
+func (p *Provider) key(ctx context.Context, kid string) (*rsa.PublicKey, error) {
+	p.RLock()
+	key, ok := p.keys[kid]
+	p.RUnlock()
+	if ok {
+		return key, nil
+	}
+
+	var jwks struct {
+		Keys []struct {
+			Kty string `json:"kty"`
+			Kid string `json:"kid"`
+			Use string `json:"use"`
+			N   string `json:"n"`
+			E   string `json:"e"`
+		} `json:"keys"`
+	}
+	if err := getJSON(ctx, p.client, p.jwksUri, &jwks); err != nil {
+		return nil, err
+	}
+
+	keys := make(map[string]*rsa.PublicKey, len(jwks.Keys))
+	for _, v := range jwks.Keys {
+		if v.Kty != "RSA" || (v.Use != "" && v.Use != "sig") {
+			continue
+		}
+
+		n, err := base64.RawURLEncoding.DecodeString(v.N)
+		if err != nil {
+			continue
+		}
+		e, err := base64.RawURLEncoding.DecodeString(v.E)
+		if err != nil {
+			continue
+		}
+
+		keys[v.Kid] = &rsa.PublicKey{
+			N: new(big.Int).SetBytes(n),
+			E: int(new(big.Int).SetBytes(e).Int64()),
+		}
+	}
+
+	p.Lock()
+	p.keys = keys
+	p.Unlock()
+
+	key, ok = keys[kid]
+	if !ok {
+		return nil, fmt.Errorf("%w: unknown key %q", ErrTokenNotValid, kid)
+	}
+
+	return key, nil
+}
+
+// NewVerifier return a PKCE code verifier of 43 character, the minimum of RFC 7636
+// with 256 bit of randomness
+func NewVerifier() (string, error) {
+	b := make([]byte, 32)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+
+	return base64.RawURLEncoding.EncodeToString(b), nil
+}
+
+// Challenge return the S256 code challenge of the verifier
+func Challenge(verifier string) string {
+	sum := sha256.Sum256([]byte(verifier))
+	return base64.RawURLEncoding.EncodeToString(sum[:])
+}
+
+func getJSON(ctx context.Context, client *http.Client, url string, v interface{}) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Accept", "application/json")
+
+	res, err := client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer res.Body.Close()
+
+	if res.StatusCode != http.StatusOK {
+		return fmt.Errorf("get %s: %s", url, res.Status)
+	}
+
+	return json.NewDecoder(res.Body).Decode(v)
+}
+
+func decodeSegment(seg string, v interface{}) error {
+	b, err := base64.RawURLEncoding.DecodeString(seg)
+	if err != nil {
+		return err
+	}
+
+	return json.Unmarshal(b, v)
+}
+
+func stringClaim(raw map[string]interface{}, name string) string {
+	s, _ := raw[name].(string)
+	return s
+}
+
+// stringsClaim read a claim that is either a string or a list of string,
+// following the dot of the name into the nested object
+func stringsClaim(raw map[string]interface{}, name string) []string {
+	var v interface{} = raw
+	for _, k := range strings.Split(name, ".") {
+		m, ok := v.(map[string]interface{})
+		if !ok {
+			return nil
+		}
+		v = m[k]
+	}
+
+	switch v := v.(type) {
+	case string:
+		return []string{v}
+	case []interface{}:
+		res := make([]string, 0, len(v))
+		for _, s := range v {
+			if s, ok := s.(string); ok {
+				res = append(res, s)
+			}
+		}
+		return res
+	}
+
+	return nil
+}
+
+func hasAudience(aud interface{}, clientId string) bool {
+	switch aud := aud.(type) {
+	case string:
+		return aud == clientId
+	case []interface{}:
+		for _, v := range aud {
+			if v == clientId {
+				return true
+			}
+		}
+	}
+
+	return false
+}
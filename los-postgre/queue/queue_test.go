@@ -0,0 +1,109 @@
+package queue_test
+
+import (
+	"testing"
+	"time"
+
+	"github.com/fikryfahrezy/adea/los-postgre/queue"
+)
+
+func TestPick(t *testing.T) {
+	officers := []queue.Officer{
+		{Id: "c", Region: "Bandung", Load: 0},
+		{Id: "a", Region: "Jakarta", Load: 2},
+		{Id: "b", Region: "Jakarta", Load: 1},
+	}
+
+	testCases := []struct {
+		expect   []string
+		name     string
+		strategy queue.Strategy
+		region   string
+	}{
+		{
+			expect:   []string{"a", "b", "c", "a"},
+			name:     "Round robin give each officer in turn",
+			strategy: queue.RoundRobin,
+		},
+		{
+			expect:   []string{"c", "c"},
+			name:     "Least loaded give the officer with the fewest loan",
+			strategy: queue.LeastLoaded,
+		},
+		{
+			expect:   []string{"b"},
+			name:     "Region give the least loaded officer of the region",
+			strategy: queue.ByRegion,
+			region:   "jakarta",
+		},
+		{
+			expect:   []string{"c"},
+			name:     "Region without officer fall back to every officer",
+			strategy: queue.ByRegion,
+			region:   "Surabaya",
+		},
+	}
+
+	for _, c := range testCases {
+		t.Run(c.name, func(t *testing.T) {
+			q := queue.New(queue.Config{Strategy: c.strategy, ClaimTTL: time.Hour})
+			for i, expect := range c.expect {
+				o, ok := q.Pick(officers, c.region)
+				if !ok || o.Id != expect {
+					t.Fatalf("pick %d resulting: %s, expect: %s", i+1, o.Id, expect)
+				}
+			}
+		})
+	}
+
+	if _, ok := queue.New(queue.DefaultConfig()).Pick(nil, ""); ok {
+		t.Fatal("resulting: an officer, expect: none")
+	}
+}
+
+func TestIsClaimed(t *testing.T) {
+	q := queue.New(queue.Config{Strategy: queue.LeastLoaded, ClaimTTL: time.Hour})
+	now := time.Now()
+
+	testCases := []struct {
+		expect      bool
+		name        string
+		officerId   string
+		claimedDate time.Time
+	}{
+		{
+			expect:      true,
+			name:        "Recently touched",
+			officerId:   "a",
+			claimedDate: now.Add(-time.Minute),
+		},
+		{
+			expect:      false,
+			name:        "Untouched for too long",
+			officerId:   "a",
+			claimedDate: now.Add(-2 * time.Hour),
+		},
+		{
+			expect:      false,
+			name:        "Not assigned",
+			claimedDate: now,
+		},
+	}
+
+	for _, c := range testCases {
+		t.Run(c.name, func(t *testing.T) {
+			if res := q.IsClaimed(c.officerId, c.claimedDate, now); res != c.expect {
+				t.Fatalf("resulting: %v, expect: %v", res, c.expect)
+			}
+		})
+	}
+}
+
+func TestStrategyFromString(t *testing.T) {
+	if s, err := queue.StrategyFromString("region"); err != nil || s != queue.ByRegion {
+		t.Fatalf("resulting: %v %v, expect: %v", s, err, queue.ByRegion)
+	}
+	if _, err := queue.StrategyFromString("random"); err != queue.ErrUnknownStrategy {
+		t.Fatalf("resulting: %v, expect: %v", err, queue.ErrUnknownStrategy)
+	}
+}
@@ -0,0 +1,207 @@
+package rbac
+
+import (
+	"errors"
+	"sort"
+)
+
+type Role struct {
+	slug string
+}
+
+func (r Role) String() string {
+	return r.slug
+}
+
+var (
+	Unknown       = Role{""}
+	Applicant     = Role{"applicant"}
+	FieldOfficer  = Role{"field_officer"}
+	CreditAnalyst = Role{"credit_analyst"}
+	Approver      = Role{"approver"}
+	// SeniorApprover approve the loan of any amount alone, above the tier the other approver need a second signature
+	SeniorApprover = Role{"senior_approver"}
+	Admin          = Role{"admin"}
+	Auditor        = Role{"auditor"}
+)
+
+func FromString(s string) (Role, error) {
+	switch s {
+	case Applicant.slug:
+		return Applicant, nil
+	case FieldOfficer.slug:
+		return FieldOfficer, nil
+	case CreditAnalyst.slug:
+		return CreditAnalyst, nil
+	case Approver.slug:
+		return Approver, nil
+	case SeniorApprover.slug:
+		return SeniorApprover, nil
+	case Admin.slug:
+		return Admin, nil
+	case Auditor.slug:
+		return Auditor, nil
+	}
+
+	return Unknown, errors.New("unknown role: " + s)
+}
+
+type Permission struct {
+	slug string
+}
+
+func (p Permission) String() string {
+	return p.slug
+}
+
+var (
+	LoanCreate     = Permission{"loan:create"}
+	LoanReadOwn    = Permission{"loan:read_own"}
+	LoanUpdateOwn  = Permission{"loan:update_own"}
+	LoanDeleteOwn  = Permission{"loan:delete_own"}
+	LoanReadAll    = Permission{"loan:read_all"}
+	LoanProceed    = Permission{"loan:proceed"}
+	LoanApprove    = Permission{"loan:approve"}
+	LoanApproveAll = Permission{"loan:approve_all"}
+	LoanDisburse   = Permission{"loan:disburse"}
+	LoanArchive    = Permission{"loan:archive"}
+	LoanQueue      = Permission{"loan:queue"}
+	QueueManage    = Permission{"queue:manage"}
+	CommitteeVote  = Permission{"committee:vote"}
+	CommitteeOpen  = Permission{"committee:open"}
+	SessionRead    = Permission{"session:read"}
+	SessionRevoke  = Permission{"session:revoke"}
+	UserInvite     = Permission{"user:invite"}
+	UserUnlock     = Permission{"user:unlock"}
+	UserRead       = Permission{"user:read"}
+	UserDeactivate = Permission{"user:deactivate"}
+	UserTotpReset  = Permission{"user:totp_reset"}
+	ActivityRead   = Permission{"activity:read"}
+	ApiKeyManage   = Permission{"apikey:manage"}
+	SettingDb      = Permission{"setting:db"}
+	SettingTmp     = Permission{"setting:tmp"}
+)
+
+func PermissionFromString(s string) (Permission, error) {
+	for _, ps := range matrix {
+		for _, p := range ps {
+			if p.slug == s {
+				return p, nil
+			}
+		}
+	}
+
+	return Permission{}, errors.New("unknown permission: " + s)
+}
+
+// matrix is the single place that decide what each role can do,
+// both the route middleware and the usecase check against it
+var matrix = map[Role][]Permission{
+	Applicant: {
+		LoanCreate,
+		LoanReadOwn,
+		LoanUpdateOwn,
+		LoanDeleteOwn,
+	},
+	FieldOfficer: {
+		LoanReadAll,
+		LoanProceed,
+		LoanDisburse,
+		LoanArchive,
+		LoanQueue,
+		CommitteeVote,
+		UserUnlock,
+		UserRead,
+		UserDeactivate,
+	},
+	CreditAnalyst: {
+		LoanReadAll,
+		LoanProceed,
+		LoanQueue,
+		CommitteeVote,
+		UserRead,
+	},
+	Approver: {
+		LoanReadAll,
+		LoanApprove,
+		CommitteeVote,
+		CommitteeOpen,
+	},
+	SeniorApprover: {
+		LoanReadAll,
+		LoanApprove,
+		LoanApproveAll,
+		CommitteeVote,
+		CommitteeOpen,
+	},
+	Auditor: {
+		LoanReadAll,
+		SessionRead,
+		ActivityRead,
+		UserRead,
+	},
+	Admin: {
+		LoanCreate,
+		LoanReadOwn,
+		LoanUpdateOwn,
+		LoanDeleteOwn,
+		LoanReadAll,
+		LoanProceed,
+		LoanApprove,
+		LoanApproveAll,
+		LoanDisburse,
+		LoanArchive,
+		QueueManage,
+		CommitteeVote,
+		CommitteeOpen,
+		SessionRead,
+		SessionRevoke,
+		UserInvite,
+		UserUnlock,
+		UserRead,
+		UserDeactivate,
+		UserTotpReset,
+		ActivityRead,
+		ApiKeyManage,
+		SettingDb,
+		SettingTmp,
+	},
+}
+
+func (r Role) Can(p Permission) bool {
+	for _, v := range matrix[r] {
+		if v == p {
+			return true
+		}
+	}
+
+	return false
+}
+
+// Can check the permission of a role stored as string, unknown role has no permission
+// while the empty one, a user stored before the role exist, is treated as applicant
+func Can(role string, p Permission) bool {
+	if role == "" {
+		role = Applicant.slug
+	}
+
+	r, err := FromString(role)
+	if err != nil {
+		return false
+	}
+
+	return r.Can(p)
+}
+
+// RolesWith list the role that has the permission, sorted by name
+func RolesWith(p Permission) []string {
+	roles := make([]string, 0)
+	for r := range matrix {
+		if r.Can(p) {
+			roles = append(roles, r.slug)
+		}
+	}
+	sort.Strings(roles)
+
+	return roles
+}
@@ -0,0 +1,198 @@
+package rbac_test
+
+import (
+	"testing"
+
+	"github.com/fikryfahrezy/adea/los-postgre/rbac"
+)
+
+func TestCan(t *testing.T) {
+	testCases := []struct {
+		expect     bool
+		name       string
+		role       string
+		permission rbac.Permission
+	}{
+		{
+			expect:     true,
+			name:       "Applicant can create loan",
+			role:       rbac.Applicant.String(),
+			permission: rbac.LoanCreate,
+		},
+		{
+			expect:     false,
+			name:       "Applicant can not approve loan",
+			role:       rbac.Applicant.String(),
+			permission: rbac.LoanApprove,
+		},
+		{
+			expect:     true,
+			name:       "Field officer can proceed loan",
+			role:       rbac.FieldOfficer.String(),
+			permission: rbac.LoanProceed,
+		},
+		{
+			expect:     false,
+			name:       "Field officer can not approve loan",
+			role:       rbac.FieldOfficer.String(),
+			permission: rbac.LoanApprove,
+		},
+		{
+			expect:     true,
+			name:       "Approver can approve loan",
+			role:       rbac.Approver.String(),
+			permission: rbac.LoanApprove,
+		},
+		{
+			expect:     false,
+			name:       "Approver can not approve loan of any amount alone",
+			role:       rbac.Approver.String(),
+			permission: rbac.LoanApproveAll,
+		},
+		{
+			expect:     true,
+			name:       "Senior approver can approve loan of any amount alone",
+			role:       rbac.SeniorApprover.String(),
+			permission: rbac.LoanApproveAll,
+		},
+		{
+			expect:     true,
+			name:       "Credit analyst can vote in the committee",
+			role:       rbac.CreditAnalyst.String(),
+			permission: rbac.CommitteeVote,
+		},
+		{
+			expect:     false,
+			name:       "Credit analyst can not open a committee vote",
+			role:       rbac.CreditAnalyst.String(),
+			permission: rbac.CommitteeOpen,
+		},
+		{
+			expect:     false,
+			name:       "Auditor can not revoke session",
+			role:       rbac.Auditor.String(),
+			permission: rbac.SessionRevoke,
+		},
+		{
+			expect:     true,
+			name:       "Auditor can read login activity",
+			role:       rbac.Auditor.String(),
+			permission: rbac.ActivityRead,
+		},
+		{
+			expect:     true,
+			name:       "Field officer can deactivate user",
+			role:       rbac.FieldOfficer.String(),
+			permission: rbac.UserDeactivate,
+		},
+		{
+			expect:     true,
+			name:       "Field officer can disburse loan",
+			role:       rbac.FieldOfficer.String(),
+			permission: rbac.LoanDisburse,
+		},
+		{
+			expect:     false,
+			name:       "Approver can not disburse loan",
+			role:       rbac.Approver.String(),
+			permission: rbac.LoanDisburse,
+		},
+		{
+			expect:     true,
+			name:       "Field officer can archive loan",
+			role:       rbac.FieldOfficer.String(),
+			permission: rbac.LoanArchive,
+		},
+		{
+			expect:     false,
+			name:       "Applicant can not archive loan",
+			role:       rbac.Applicant.String(),
+			permission: rbac.LoanArchive,
+		},
+		{
+			expect:     true,
+			name:       "Credit analyst is in the loan queue",
+			role:       rbac.CreditAnalyst.String(),
+			permission: rbac.LoanQueue,
+		},
+		{
+			expect:     false,
+			name:       "Field officer can not manage the queue",
+			role:       rbac.FieldOfficer.String(),
+			permission: rbac.QueueManage,
+		},
+		{
+			expect:     false,
+			name:       "Approver can not read user",
+			role:       rbac.Approver.String(),
+			permission: rbac.UserRead,
+		},
+		{
+			expect:     false,
+			name:       "Field officer can not read login activity",
+			role:       rbac.FieldOfficer.String(),
+			permission: rbac.ActivityRead,
+		},
+		{
+			expect:     false,
+			name:       "Field officer can not reset totp",
+			role:       rbac.FieldOfficer.String(),
+			permission: rbac.UserTotpReset,
+		},
+		{
+			expect:     true,
+			name:       "Admin can load json db",
+			role:       rbac.Admin.String(),
+			permission: rbac.SettingDb,
+		},
+		{
+			expect:     true,
+			name:       "Empty role is treated as applicant",
+			role:       "",
+			permission: rbac.LoanReadOwn,
+		},
+		{
+			expect:     false,
+			name:       "Unknown role can not do anything",
+			role:       "superuser",
+			permission: rbac.LoanReadOwn,
+		},
+	}
+
+	for _, c := range testCases {
+		t.Run(c.name, func(t *testing.T) {
+			if res := rbac.Can(c.role, c.permission); res != c.expect {
+				t.Fatalf("resulting: %v, expect: %v", res, c.expect)
+			}
+		})
+	}
+}
+
+func TestPermissionFromString(t *testing.T) {
+	testCases := []struct {
+		expect bool
+		name   string
+		input  string
+	}{
+		{expect: true, name: "Known permission", input: rbac.LoanProceed.String()},
+		{expect: false, name: "Unknown permission", input: "loan:everything"},
+		{expect: false, name: "Empty permission", input: ""},
+	}
+
+	for _, c := range testCases {
+		t.Run(c.name, func(t *testing.T) {
+			_, err := rbac.PermissionFromString(c.input)
+			if (err == nil) != c.expect {
+				t.Fatalf("resulting: %v, expect: %t", err, c.expect)
+			}
+		})
+	}
+}
+
+func TestRolesWith(t *testing.T) {
+	expect := []string{rbac.CreditAnalyst.String(), rbac.FieldOfficer.String()}
+	res := rbac.RolesWith(rbac.LoanQueue)
+	if len(res) != len(expect) || res[0] != expect[0] || res[1] != expect[1] {
+		t.Fatalf("resulting: %v, expect: %v", res, expect)
+	}
+}
@@ -0,0 +1,158 @@
+package scoring_test
+
+import (
+	"math"
+	"testing"
+
+	"github.com/fikryfahrezy/adea/los-postgre/model"
+	"github.com/fikryfahrezy/adea/los-postgre/scoring"
+)
+
+func TestEvaluate(t *testing.T) {
+	testCases := []struct {
+		expect model.CreditScore
+		name   string
+		loan   model.LoanApplication
+	}{
+		{
+			expect: model.CreditScore{
+				ProjectedRevenuePerYearInIdr: 150_000_000,
+				NetMargin:                    0.5,
+				LoanToRevenue:                0.2,
+				DebtServiceRatio:             0.5,
+				Score:                        91,
+				Grade:                        scoring.A.String(),
+			},
+			name: "Healthy business",
+			loan: model.LoanApplication{
+				IsPrivateField:               true,
+				ExpInYear:                    6,
+				EstimatedYieldInKg:           10_000,
+				EstimatedPriceOfHarvestPerKg: 5_000,
+				HarvestCycleInMonths:         4,
+				LoanApplicationInIdr:         30_000_000,
+				BusinessIncomePerMonthInIdr:  10_000_000,
+				BusinessOutcomePerMonthInIdr: 5_000_000,
+			},
+		},
+		{
+			expect: model.CreditScore{
+				ProjectedRevenuePerYearInIdr: 4_000_000,
+				NetMargin:                    -0.1667,
+				LoanToRevenue:                3,
+				Score:                        3,
+				Grade:                        scoring.E.String(),
+			},
+			name: "Business losing money",
+			loan: model.LoanApplication{
+				ExpInYear:                    1,
+				EstimatedYieldInKg:           1_000,
+				EstimatedPriceOfHarvestPerKg: 2_000,
+				HarvestCycleInMonths:         6,
+				LoanApplicationInIdr:         12_000_000,
+				BusinessIncomePerMonthInIdr:  3_000_000,
+				BusinessOutcomePerMonthInIdr: 3_500_000,
+			},
+		},
+		{
+			expect: model.CreditScore{
+				NetMargin:        0.5,
+				DebtServiceRatio: 0.5,
+				Score:            66,
+				Grade:            scoring.B.String(),
+			},
+			name: "Harvest without a cycle has no projected revenue",
+			loan: model.LoanApplication{
+				IsPrivateField:               true,
+				ExpInYear:                    6,
+				EstimatedYieldInKg:           10_000,
+				EstimatedPriceOfHarvestPerKg: 5_000,
+				LoanApplicationInIdr:         30_000_000,
+				BusinessIncomePerMonthInIdr:  10_000_000,
+				BusinessOutcomePerMonthInIdr: 5_000_000,
+			},
+		},
+		{
+			expect: model.CreditScore{
+				ProjectedRevenuePerYearInIdr: math.MaxInt64,
+				NetMargin:                    0.5,
+				DebtServiceRatio:             0.5,
+				Score:                        91,
+				Grade:                        scoring.A.String(),
+			},
+			name: "Revenue too big for int64 does not overflow",
+			loan: model.LoanApplication{
+				IsPrivateField:               true,
+				ExpInYear:                    6,
+				EstimatedYieldInKg:           math.MaxInt64 / 2,
+				EstimatedPriceOfHarvestPerKg: 1_000_000,
+				HarvestCycleInMonths:         1,
+				LoanApplicationInIdr:         30_000_000,
+				BusinessIncomePerMonthInIdr:  10_000_000,
+				BusinessOutcomePerMonthInIdr: 5_000_000,
+			},
+		},
+		{
+			expect: model.CreditScore{
+				Score: 15,
+				Grade: scoring.E.String(),
+			},
+			name: "Nothing to compute the ratio with",
+			loan: model.LoanApplication{
+				ExpInYear:            10,
+				LoanApplicationInIdr: 1_000_000,
+			},
+		},
+	}
+
+	for _, c := range testCases {
+		t.Run(c.name, func(t *testing.T) {
+			res := scoring.Evaluate(c.loan)
+			if len(res.Factors) != 5 {
+				t.Fatalf("resulting: %d, expect: %d", len(res.Factors), 5)
+			}
+
+			var total int64
+			for _, f := range res.Factors {
+				if f.Points < 0 || f.Points > f.Weight || f.Explanation == "" {
+					t.Fatalf("resulting: %+v, expect: points within weight and an explanation", f)
+				}
+				total += f.Weight
+			}
+			if total != 100 {
+				t.Fatalf("resulting: %d, expect: %d", total, 100)
+			}
+
+			res.Factors = nil
+			if res.ProjectedRevenuePerYearInIdr != c.expect.ProjectedRevenuePerYearInIdr ||
+				res.NetMargin != c.expect.NetMargin ||
+				res.LoanToRevenue != c.expect.LoanToRevenue ||
+				res.DebtServiceRatio != c.expect.DebtServiceRatio ||
+				res.Score != c.expect.Score ||
+				res.Grade != c.expect.Grade {
+				t.Fatalf("resulting: %+v, expect: %+v", res, c.expect)
+			}
+		})
+	}
+}
+
+func TestGradeOf(t *testing.T) {
+	testCases := []struct {
+		expect scoring.Grade
+		score  int64
+	}{
+		{expect: scoring.A, score: 100},
+		{expect: scoring.A, score: 80},
+		{expect: scoring.B, score: 79},
+		{expect: scoring.C, score: 50},
+		{expect: scoring.D, score: 35},
+		{expect: scoring.E, score: 34},
+		{expect: scoring.E, score: 0},
+	}
+
+	for _, c := range testCases {
+		if res := scoring.GradeOf(c.score); res != c.expect {
+			t.Fatalf("resulting: %v, expect: %v | score: %d", res, c.expect, c.score)
+		}
+	}
+}
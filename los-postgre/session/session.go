@@ -1,58 +1,333 @@
 package session
 
 import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
 	"sync"
 	"time"
 )
 
+var (
+	ErrSessionNotFound = errors.New("session not found")
+	ErrSessionExpired  = errors.New("session expired")
+	ErrRefreshNotFound = errors.New("refresh token not found")
+	ErrRefreshReused   = errors.New("refresh token already used, every session of the login are revoked")
+)
+
 type SessionObj struct {
-	IsPrivate bool
-	Key       string
-	Value     string
-	Expired   int64
+	Id       string
+	Key      string
+	FamilyId string
+	UserId   string
+	Role     string
+	// ApiKeyId is only set when the request is authenticated by an API key,
+	// then the Scopes limit what the key can do on top of the Role of its owner
+	ApiKeyId string
+	Scopes   []string
+	Created  int64
+	Expired  int64
+}
+
+func (s SessionObj) IsExpired() bool {
+	return (s.Expired - time.Now().Unix()) <= 0
+}
+
+// RefreshObj is a long lived token that can be exchanged once for a new access session,
+// every refresh token that come from the same login share the same FamilyId
+type RefreshObj struct {
+	IsUsed   bool
+	Id       string
+	Key      string
+	FamilyId string
+	UserId   string
+	Role     string
+	Created  int64
+	Expired  int64
+}
+
+func (r RefreshObj) IsExpired() bool {
+	return (r.Expired - time.Now().Unix()) <= 0
+}
+
+// Store is where the sessions are kept, the implementation could be
+// a process local map or a shared database so the sessions survive restart
+// and can be used by multiple replicas
+type Store interface {
+	Get(ctx context.Context, key string) (SessionObj, error)
+	Set(ctx context.Context, sess SessionObj) error
+	Extend(ctx context.Context, key string, exp int64) error
+	Delete(ctx context.Context, key string) error
+	DeleteById(ctx context.Context, id string) (SessionObj, error)
+	DeleteByUserId(ctx context.Context, userId string) (int, error)
+	DeleteByFamilyId(ctx context.Context, familyId string) (int, error)
+	GetByUserId(ctx context.Context, userId string) ([]SessionObj, error)
+	SetRefresh(ctx context.Context, ref RefreshObj) error
+	// UseRefresh mark the refresh token as used and return it as it was before,
+	// so a true IsUsed mean the token has been presented before
+	UseRefresh(ctx context.Context, key string) (RefreshObj, error)
+	Sweep(ctx context.Context) (int, error)
 }
 
 type Session struct {
 	sync.RWMutex
-	sessions map[string]SessionObj
+	sessions  map[string]SessionObj
+	refreshes map[string]RefreshObj
 }
 
 func New() *Session {
 	return &Session{
-		sessions: make(map[string]SessionObj),
+		sessions:  make(map[string]SessionObj),
+		refreshes: make(map[string]RefreshObj),
 	}
 }
 
-func (s *Session) Get(key string) (SessionObj, bool) {
+func (s *Session) Get(ctx context.Context, key string) (SessionObj, error) {
 	s.Lock()
 	defer s.Unlock()
 	sess, ok := s.sessions[key]
-	return sess, ok
+	if !ok {
+		return SessionObj{}, ErrSessionNotFound
+	}
+
+	return sess, nil
 }
 
-func (s *Session) Set(key, value string, isPrivate bool, exp int64) {
+func (s *Session) Set(ctx context.Context, sess SessionObj) error {
 	s.Lock()
 	defer s.Unlock()
 
-	s.sessions[key] = SessionObj{
-		Key:       key,
-		Value:     value,
-		IsPrivate: isPrivate,
-		Expired:   exp,
+	if sess.Id == "" {
+		sess.Id = KeyId(sess.Key)
 	}
+	if sess.Created == 0 {
+		sess.Created = time.Now().Unix()
+	}
+
+	s.sessions[sess.Key] = sess
+
+	return nil
 }
 
-func (s *Session) IsKeyPrivate(key string) (SessionObj, bool) {
+func (s *Session) Extend(ctx context.Context, key string, exp int64) error {
 	s.Lock()
 	defer s.Unlock()
+
 	sess, ok := s.sessions[key]
 	if !ok {
-		return sess, false
+		return ErrSessionNotFound
+	}
+
+	sess.Expired = exp
+	s.sessions[key] = sess
+
+	return nil
+}
+
+func (s *Session) Delete(ctx context.Context, key string) error {
+	s.Lock()
+	defer s.Unlock()
+
+	delete(s.sessions, key)
+
+	return nil
+}
+
+func (s *Session) DeleteById(ctx context.Context, id string) (SessionObj, error) {
+	s.Lock()
+	defer s.Unlock()
+
+	for k, v := range s.sessions {
+		if v.Id == id {
+			delete(s.sessions, k)
+			return v, nil
+		}
+	}
+
+	return SessionObj{}, ErrSessionNotFound
+}
+
+// DeleteByUserId remove every session and refresh token owned by the user
+// and return how many sessions removed
+func (s *Session) DeleteByUserId(ctx context.Context, userId string) (int, error) {
+	s.Lock()
+	defer s.Unlock()
+
+	n := 0
+	for k, v := range s.sessions {
+		if v.UserId == userId {
+			delete(s.sessions, k)
+			n++
+		}
+	}
+
+	for k, v := range s.refreshes {
+		if v.UserId == userId {
+			delete(s.refreshes, k)
+		}
+	}
+
+	return n, nil
+}
+
+// DeleteByFamilyId remove every session and refresh token that come from the same login
+// and return how many sessions removed
+func (s *Session) DeleteByFamilyId(ctx context.Context, familyId string) (int, error) {
+	s.Lock()
+	defer s.Unlock()
+
+	n := 0
+	for k, v := range s.sessions {
+		if v.FamilyId == familyId {
+			delete(s.sessions, k)
+			n++
+		}
+	}
+
+	for k, v := range s.refreshes {
+		if v.FamilyId == familyId {
+			delete(s.refreshes, k)
+		}
+	}
+
+	return n, nil
+}
+
+func (s *Session) GetByUserId(ctx context.Context, userId string) ([]SessionObj, error) {
+	s.Lock()
+	defer s.Unlock()
+
+	sessions := make([]SessionObj, 0)
+	for _, v := range s.sessions {
+		if v.UserId == userId && !v.IsExpired() {
+			sessions = append(sessions, v)
+		}
+	}
+
+	return sessions, nil
+}
+
+func (s *Session) SetRefresh(ctx context.Context, ref RefreshObj) error {
+	s.Lock()
+	defer s.Unlock()
+
+	if ref.Id == "" {
+		ref.Id = KeyId(ref.Key)
+	}
+	if ref.Created == 0 {
+		ref.Created = time.Now().Unix()
+	}
+
+	s.refreshes[ref.Key] = ref
+
+	return nil
+}
+
+func (s *Session) UseRefresh(ctx context.Context, key string) (RefreshObj, error) {
+	s.Lock()
+	defer s.Unlock()
+
+	ref, ok := s.refreshes[key]
+	if !ok {
+		return RefreshObj{}, ErrRefreshNotFound
 	}
 
-	return sess, sess.IsPrivate
+	used := ref
+	used.IsUsed = true
+	s.refreshes[key] = used
+
+	return ref, nil
+}
+
+// Sweep remove every expired session and refresh token and return how many sessions removed
+func (s *Session) Sweep(ctx context.Context) (int, error) {
+	s.Lock()
+	defer s.Unlock()
+
+	n := 0
+	for k, v := range s.sessions {
+		if v.IsExpired() {
+			delete(s.sessions, k)
+			n++
+		}
+	}
+
+	for k, v := range s.refreshes {
+		if v.IsExpired() {
+			delete(s.refreshes, k)
+		}
+	}
+
+	return n, nil
+}
+
+// RunSweeper call Sweep every interval until the context is done,
+// it is blocking so it should be run in its own goroutine
+func RunSweeper(ctx context.Context, store Store, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			store.Sweep(ctx)
+		}
+	}
+}
+
+// NewToken return a random opaque token to be used as session key,
+// it carry no information about the user it belongs to
+func NewToken() (string, error) {
+	b, err := randomBytes(32)
+	if err != nil {
+		return "", err
+	}
+
+	return hex.EncodeToString(b), nil
+}
+
+func randomBytes(n int) ([]byte, error) {
+	b := make([]byte, n)
+	if _, err := rand.Read(b); err != nil {
+		return nil, err
+	}
+
+	return b, nil
+}
+
+// KeyId derive a short identifier from the session key, the id is used to refer
+// the session when listing or revoking it so the key itself is never shown
+// to anyone other than its owner
+func KeyId(key string) string {
+	sum := sha256.Sum256([]byte(key))
+	return hex.EncodeToString(sum[:8])
+}
+
+// KeyHash is what stored in place of the key by the store that persist sessions
+// outside the process, so a leaked table does not leak usable tokens
+func KeyHash(key string) string {
+	sum := sha256.Sum256([]byte(key))
+	return hex.EncodeToString(sum[:])
+}
+
+type ctxKey struct{}
+
+func NewContext(ctx context.Context, sess SessionObj) context.Context {
+	return context.WithValue(ctx, ctxKey{}, sess)
+}
+
+func FromContext(ctx context.Context) (SessionObj, bool) {
+	sess, ok := ctx.Value(ctxKey{}).(SessionObj)
+	return sess, ok
 }
 
-func (s *Session) IsExpired(sess SessionObj) bool {
-	return (sess.Expired - time.Now().Unix()) <= 0
+// UserId return the id of the user that own the session attached to the context
+// or empty string if there is no session in the context
+func UserId(ctx context.Context) string {
+	sess, _ := FromContext(ctx)
+	return sess.UserId
 }
@@ -0,0 +1,130 @@
+package session
+
+import (
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/hex"
+	"net/http"
+	"os"
+	"strings"
+	"time"
+)
+
+const (
+	// AccessCookie and RefreshCookie hold the token for the browser, they are HttpOnly
+	// so a script injected into the page can never read them
+	AccessCookie  = "los_session"
+	RefreshCookie = "los_refresh"
+	// CsrfCookie is readable by the script of the page, which must send its value back
+	// in the CsrfHeader on every request that change something
+	CsrfCookie = "los_csrf"
+	CsrfHeader = "X-CSRF-Token"
+	// refreshPath limit the refresh token to the only route that need it
+	refreshPath = "/auth/refresh"
+)
+
+type CookieConfig struct {
+	Secure   bool
+	SameSite http.SameSite
+	Domain   string
+	// MaxAge is how long the browser keep the cookies, it follow the refresh token
+	// so the expired access token can still be refreshed from the cookie
+	MaxAge time.Duration
+}
+
+// CookieConfigFromEnv read COOKIE_SECURE, COOKIE_SAMESITE and COOKIE_DOMAIN,
+// the cookie is only sent over HTTPS unless COOKIE_SECURE=false for local development
+func CookieConfigFromEnv(cfg Config) CookieConfig {
+	cc := CookieConfig{
+		Secure:   os.Getenv("COOKIE_SECURE") != "false",
+		SameSite: http.SameSiteLaxMode,
+		Domain:   os.Getenv("COOKIE_DOMAIN"),
+		MaxAge:   cfg.RefreshTTL,
+	}
+
+	switch strings.ToLower(os.Getenv("COOKIE_SAMESITE")) {
+	case "strict":
+		cc.SameSite = http.SameSiteStrictMode
+	case "none":
+		// The browser drop the SameSite=None cookie that is not Secure
+		cc.SameSite = http.SameSiteNoneMode
+		cc.Secure = true
+	}
+
+	return cc
+}
+
+// CsrfToken derive the CSRF token from the access token, so the token sent in the header
+// must belong to the session of the cookie and a cookie planted by another site is useless
+func CsrfToken(accessToken string) string {
+	sum := sha256.Sum256([]byte("csrf:" + accessToken))
+	return hex.EncodeToString(sum[:])
+}
+
+// SetCookie put the token into the cookies of the response and return the CSRF token
+// the client send back in the CsrfHeader
+func SetCookie(w http.ResponseWriter, cc CookieConfig, token Token) string {
+	csrf := CsrfToken(token.AccessToken)
+	maxAge := int(cc.MaxAge.Seconds())
+
+	http.SetCookie(w, cc.cookie(AccessCookie, token.AccessToken, "/", maxAge, true))
+	if token.RefreshToken != "" {
+		http.SetCookie(w, cc.cookie(RefreshCookie, token.RefreshToken, refreshPath, maxAge, true))
+	}
+	http.SetCookie(w, cc.cookie(CsrfCookie, csrf, "/", maxAge, false))
+
+	return csrf
+}
+
+// ClearCookie tell the browser to remove every cookie set by SetCookie
+func ClearCookie(w http.ResponseWriter, cc CookieConfig) {
+	http.SetCookie(w, cc.cookie(AccessCookie, "", "/", -1, true))
+	http.SetCookie(w, cc.cookie(RefreshCookie, "", refreshPath, -1, true))
+	http.SetCookie(w, cc.cookie(CsrfCookie, "", "/", -1, false))
+}
+
+func (cc CookieConfig) cookie(name, value, path string, maxAge int, httpOnly bool) *http.Cookie {
+	return &http.Cookie{
+		Name:     name,
+		Value:    value,
+		Path:     path,
+		Domain:   cc.Domain,
+		MaxAge:   maxAge,
+		Secure:   cc.Secure,
+		HttpOnly: httpOnly,
+		SameSite: cc.SameSite,
+	}
+}
+
+// CookieToken return the value of the cookie or empty string when the request does not have it
+func CookieToken(r *http.Request, name string) string {
+	c, err := r.Cookie(name)
+	if err != nil {
+		return ""
+	}
+
+	return c.Value
+}
+
+// ValidCsrf check the double submitted CSRF token, the header must equal the cookie
+// and both must be derived from the access token of the request
+func ValidCsrf(r *http.Request, accessToken string) bool {
+	header := r.Header.Get(CsrfHeader)
+	if header == "" || accessToken == "" {
+		return false
+	}
+
+	cookie := CookieToken(r, CsrfCookie)
+	return subtle.ConstantTimeCompare([]byte(header), []byte(cookie)) == 1 &&
+		subtle.ConstantTimeCompare([]byte(header), []byte(CsrfToken(accessToken))) == 1
+}
+
+// IsSafeMethod is the method that must not change anything, so it does not need the CSRF token
+func IsSafeMethod(method string) bool {
+	switch method {
+	case http.MethodGet, http.MethodHead, http.MethodOptions:
+		return true
+	}
+
+	return false
+}
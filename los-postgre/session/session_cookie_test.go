@@ -0,0 +1,132 @@
+package session_test
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/fikryfahrezy/adea/los-postgre/session"
+)
+
+func TestSetCookie(t *testing.T) {
+	cc := session.CookieConfig{Secure: true, SameSite: http.SameSiteStrictMode, MaxAge: time.Hour}
+	w := httptest.NewRecorder()
+
+	csrf := session.SetCookie(w, cc, session.Token{AccessToken: "access", RefreshToken: "refresh"})
+	if csrf != session.CsrfToken("access") {
+		t.Fatalf("resulting: %s, expect: %s", csrf, session.CsrfToken("access"))
+	}
+
+	cookies := make(map[string]*http.Cookie)
+	for _, c := range w.Result().Cookies() {
+		cookies[c.Name] = c
+	}
+
+	testCases := []struct {
+		httpOnly bool
+		name     string
+		value    string
+		path     string
+	}{
+		{
+			httpOnly: true,
+			name:     session.AccessCookie,
+			value:    "access",
+			path:     "/",
+		},
+		{
+			httpOnly: true,
+			name:     session.RefreshCookie,
+			value:    "refresh",
+			path:     "/auth/refresh",
+		},
+		{
+			httpOnly: false,
+			name:     session.CsrfCookie,
+			value:    csrf,
+			path:     "/",
+		},
+	}
+
+	for _, c := range testCases {
+		t.Run(c.name, func(t *testing.T) {
+			cookie, ok := cookies[c.name]
+			if !ok {
+				t.Fatalf("resulting: no cookie, expect: %s", c.name)
+			}
+			if cookie.Value != c.value || cookie.Path != c.path || cookie.HttpOnly != c.httpOnly {
+				t.Fatalf("resulting: %+v, expect: %s at %s, http only %t", cookie, c.value, c.path, c.httpOnly)
+			}
+			if !cookie.Secure || cookie.SameSite != http.SameSiteStrictMode || cookie.MaxAge != 3600 {
+				t.Fatalf("resulting: %+v, expect: secure strict cookie of an hour", cookie)
+			}
+		})
+	}
+
+	w = httptest.NewRecorder()
+	session.ClearCookie(w, cc)
+	for _, c := range w.Result().Cookies() {
+		if c.MaxAge >= 0 || c.Value != "" {
+			t.Fatalf("resulting: %+v, expect: removed cookie", c)
+		}
+	}
+}
+
+func TestValidCsrf(t *testing.T) {
+	csrf := session.CsrfToken("access")
+
+	testCases := []struct {
+		expect bool
+		name   string
+		cookie string
+		header string
+	}{
+		{
+			expect: true,
+			name:   "Header equal the cookie",
+			cookie: csrf,
+			header: csrf,
+		},
+		{
+			expect: false,
+			name:   "No header",
+			cookie: csrf,
+			header: "",
+		},
+		{
+			expect: false,
+			name:   "No cookie",
+			cookie: "",
+			header: csrf,
+		},
+		{
+			expect: false,
+			name:   "Header differ from the cookie",
+			cookie: csrf,
+			header: session.CsrfToken("other"),
+		},
+		{
+			expect: false,
+			name:   "Planted cookie of another session",
+			cookie: session.CsrfToken("other"),
+			header: session.CsrfToken("other"),
+		},
+	}
+
+	for _, c := range testCases {
+		t.Run(c.name, func(t *testing.T) {
+			r := httptest.NewRequest(http.MethodPost, "/loan/create", nil)
+			if c.cookie != "" {
+				r.AddCookie(&http.Cookie{Name: session.CsrfCookie, Value: c.cookie})
+			}
+			if c.header != "" {
+				r.Header.Set(session.CsrfHeader, c.header)
+			}
+
+			if res := session.ValidCsrf(r, "access"); res != c.expect {
+				t.Fatalf("resulting: %t, expect: %t", res, c.expect)
+			}
+		})
+	}
+}
@@ -0,0 +1,211 @@
+package session
+
+import (
+	"context"
+	"errors"
+	"os"
+	"time"
+)
+
+type Config struct {
+	// AccessTTL is how long an access session live since it was last used
+	AccessTTL time.Duration
+	// RefreshTTL is how long a refresh token can be exchanged for a new access session
+	RefreshTTL time.Duration
+	// LoginTTL is how long the signed token of a login keep being refreshed before
+	// the user has to log in again, the signed token can not be revoked so it has to end
+	LoginTTL time.Duration
+}
+
+func DefaultConfig() Config {
+	return Config{
+		AccessTTL:  30 * time.Minute,
+		RefreshTTL: 7 * 24 * time.Hour,
+		LoginTTL:   30 * 24 * time.Hour,
+	}
+}
+
+// ConfigFromEnv read ACCESS_TOKEN_TTL, REFRESH_TOKEN_TTL and LOGIN_TTL in time.ParseDuration format,
+// the default config value is used for the empty or invalid one
+func ConfigFromEnv() Config {
+	cfg := DefaultConfig()
+	if d, err := time.ParseDuration(os.Getenv("ACCESS_TOKEN_TTL")); err == nil && d > 0 {
+		cfg.AccessTTL = d
+	}
+	if d, err := time.ParseDuration(os.Getenv("REFRESH_TOKEN_TTL")); err == nil && d > 0 {
+		cfg.RefreshTTL = d
+	}
+	if d, err := time.ParseDuration(os.Getenv("LOGIN_TTL")); err == nil && d > 0 {
+		cfg.LoginTTL = d
+	}
+
+	return cfg
+}
+
+type Token struct {
+	AccessToken  string
+	RefreshToken string
+	ExpiresIn    int64
+}
+
+// Authenticator issue and verify the token used by the client, Manager keep
+// every session in a Store while Signer verify the signed token without state
+type Authenticator interface {
+	Issue(ctx context.Context, userId, role string) (Token, error)
+	Refresh(ctx context.Context, refreshToken string) (Token, error)
+	Authenticate(ctx context.Context, accessToken string) (SessionObj, error)
+	Revoke(ctx context.Context, sess SessionObj) (int, error)
+	RevokeById(ctx context.Context, id string) (int, error)
+	RevokeByUserId(ctx context.Context, userId string) (int, error)
+	GetByUserId(ctx context.Context, userId string) ([]SessionObj, error)
+	// CanRevoke tell whether the issued token can be ended before it expire
+	CanRevoke() bool
+}
+
+type Manager struct {
+	store Store
+	cfg   Config
+}
+
+func NewManager(store Store, cfg Config) *Manager {
+	return &Manager{
+		store: store,
+		cfg:   cfg,
+	}
+}
+
+// Issue start a new login for the user, the access and refresh token returned
+// are the first of a new family
+func (m *Manager) Issue(ctx context.Context, userId, role string) (Token, error) {
+	familyId, err := NewToken()
+	if err != nil {
+		return Token{}, err
+	}
+
+	return m.issue(ctx, familyId, userId, role)
+}
+
+// Refresh exchange the refresh token for a new pair of token, a refresh token
+// can only be used once, presenting it again revoke the whole family since
+// it mean the token has been stolen by someone
+func (m *Manager) Refresh(ctx context.Context, refreshToken string) (Token, error) {
+	ref, err := m.store.UseRefresh(ctx, refreshToken)
+	if err != nil {
+		return Token{}, err
+	}
+
+	if ref.IsUsed {
+		if _, err := m.store.DeleteByFamilyId(ctx, ref.FamilyId); err != nil {
+			return Token{}, err
+		}
+		return Token{}, ErrRefreshReused
+	}
+
+	if ref.IsExpired() {
+		return Token{}, ErrSessionExpired
+	}
+
+	return m.issue(ctx, ref.FamilyId, ref.UserId, ref.Role)
+}
+
+func (m *Manager) issue(ctx context.Context, familyId, userId, role string) (Token, error) {
+	accessToken, err := NewToken()
+	if err != nil {
+		return Token{}, err
+	}
+
+	refreshToken, err := NewToken()
+	if err != nil {
+		return Token{}, err
+	}
+
+	now := time.Now()
+	err = m.store.Set(ctx, SessionObj{
+		Key:      accessToken,
+		FamilyId: familyId,
+		UserId:   userId,
+		Role:     role,
+		Created:  now.Unix(),
+		Expired:  now.Add(m.cfg.AccessTTL).Unix(),
+	})
+	if err != nil {
+		return Token{}, err
+	}
+
+	err = m.store.SetRefresh(ctx, RefreshObj{
+		Key:      refreshToken,
+		FamilyId: familyId,
+		UserId:   userId,
+		Role:     role,
+		Created:  now.Unix(),
+		Expired:  now.Add(m.cfg.RefreshTTL).Unix(),
+	})
+	if err != nil {
+		return Token{}, err
+	}
+
+	return Token{
+		AccessToken:  accessToken,
+		RefreshToken: refreshToken,
+		ExpiresIn:    int64(m.cfg.AccessTTL.Seconds()),
+	}, nil
+}
+
+// Authenticate return the session of the access token, the session expiry is slid
+// forward when it is past half of its lifetime so an active user is not logged out
+func (m *Manager) Authenticate(ctx context.Context, accessToken string) (SessionObj, error) {
+	sess, err := m.store.Get(ctx, accessToken)
+	if err != nil {
+		return SessionObj{}, err
+	}
+
+	if sess.IsExpired() {
+		return SessionObj{}, ErrSessionExpired
+	}
+
+	now := time.Now()
+	if time.Unix(sess.Expired, 0).Sub(now) < m.cfg.AccessTTL/2 {
+		exp := now.Add(m.cfg.AccessTTL).Unix()
+		if err := m.store.Extend(ctx, accessToken, exp); err != nil && !errors.Is(err, ErrSessionNotFound) {
+			return SessionObj{}, err
+		}
+		sess.Expired = exp
+	}
+
+	return sess, nil
+}
+
+// Revoke end the login the session come from, including its refresh token
+func (m *Manager) Revoke(ctx context.Context, sess SessionObj) (int, error) {
+	if sess.FamilyId == "" {
+		return 1, m.store.Delete(ctx, sess.Key)
+	}
+
+	return m.store.DeleteByFamilyId(ctx, sess.FamilyId)
+}
+
+func (m *Manager) RevokeById(ctx context.Context, id string) (int, error) {
+	sess, err := m.store.DeleteById(ctx, id)
+	if err != nil {
+		return 0, err
+	}
+
+	if sess.FamilyId == "" {
+		return 1, nil
+	}
+
+	n, err := m.store.DeleteByFamilyId(ctx, sess.FamilyId)
+	return n + 1, err
+}
+
+func (m *Manager) RevokeByUserId(ctx context.Context, userId string) (int, error) {
+	return m.store.DeleteByUserId(ctx, userId)
+}
+
+func (m *Manager) CanRevoke() bool {
+	return true
+}
+
+func (m *Manager) GetByUserId(ctx context.Context, userId string) ([]SessionObj, error) {
+	return m.store.GetByUserId(ctx, userId)
+}
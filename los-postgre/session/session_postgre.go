@@ -0,0 +1,303 @@
+package session
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/cockroachdb/cockroach-go/v2/crdb/crdbpgx"
+	"github.com/jackc/pgx/v4"
+	"github.com/jackc/pgx/v4/pgxpool"
+)
+
+// PgSession keep the sessions in the sessions table, only the hash of the key is stored
+// and the expiry is checked by the database so every replica see the same sessions
+type PgSession struct {
+	db *pgxpool.Pool
+}
+
+func NewPg(db *pgxpool.Pool) *PgSession {
+	return &PgSession{
+		db: db,
+	}
+}
+
+func (s *PgSession) Get(ctx context.Context, key string) (SessionObj, error) {
+	var created, expired time.Time
+	sess := SessionObj{Key: key}
+	err := crdbpgx.ExecuteTx(context.Background(), s.db, pgx.TxOptions{}, func(tx pgx.Tx) error {
+		return tx.QueryRow(ctx,
+			`SELECT id, family_id, user_id, role, created_date, expired_date
+			FROM sessions WHERE key_hash = $1 AND expired_date > now()`,
+			KeyHash(key),
+		).Scan(&sess.Id, &sess.FamilyId, &sess.UserId, &sess.Role, &created, &expired)
+	})
+	if errors.Is(err, pgx.ErrNoRows) {
+		return SessionObj{}, ErrSessionNotFound
+	}
+	if err != nil {
+		return SessionObj{}, err
+	}
+
+	sess.Created = created.Unix()
+	sess.Expired = expired.Unix()
+
+	return sess, nil
+}
+
+func (s *PgSession) Set(ctx context.Context, sess SessionObj) error {
+	if sess.Id == "" {
+		sess.Id = KeyId(sess.Key)
+	}
+	if sess.Created == 0 {
+		sess.Created = time.Now().Unix()
+	}
+
+	return crdbpgx.ExecuteTx(context.Background(), s.db, pgx.TxOptions{}, func(tx pgx.Tx) error {
+		if _, err := tx.Exec(ctx,
+			`UPSERT INTO sessions (id, key_hash, family_id, user_id, role, created_date, expired_date)
+			VALUES ($1, $2, $3, $4, $5, $6, $7)`,
+			sess.Id,
+			KeyHash(sess.Key),
+			sess.FamilyId,
+			sess.UserId,
+			sess.Role,
+			time.Unix(sess.Created, 0).UTC(),
+			time.Unix(sess.Expired, 0).UTC(),
+		); err != nil {
+			return err
+		}
+		return nil
+	})
+}
+
+func (s *PgSession) Extend(ctx context.Context, key string, exp int64) error {
+	var n int64
+	err := crdbpgx.ExecuteTx(context.Background(), s.db, pgx.TxOptions{}, func(tx pgx.Tx) error {
+		tag, err := tx.Exec(ctx,
+			`UPDATE sessions SET expired_date = $2 WHERE key_hash = $1 AND expired_date > now()`,
+			KeyHash(key),
+			time.Unix(exp, 0).UTC(),
+		)
+		if err != nil {
+			return err
+		}
+
+		n = tag.RowsAffected()
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+
+	if n == 0 {
+		return ErrSessionNotFound
+	}
+
+	return nil
+}
+
+func (s *PgSession) Delete(ctx context.Context, key string) error {
+	return crdbpgx.ExecuteTx(context.Background(), s.db, pgx.TxOptions{}, func(tx pgx.Tx) error {
+		if _, err := tx.Exec(ctx,
+			`DELETE FROM sessions WHERE key_hash = $1`,
+			KeyHash(key),
+		); err != nil {
+			return err
+		}
+		return nil
+	})
+}
+
+func (s *PgSession) DeleteById(ctx context.Context, id string) (SessionObj, error) {
+	var created, expired time.Time
+	var sess SessionObj
+	err := crdbpgx.ExecuteTx(context.Background(), s.db, pgx.TxOptions{}, func(tx pgx.Tx) error {
+		return tx.QueryRow(ctx,
+			`DELETE FROM sessions WHERE id = $1
+			RETURNING id, family_id, user_id, role, created_date, expired_date`,
+			id,
+		).Scan(&sess.Id, &sess.FamilyId, &sess.UserId, &sess.Role, &created, &expired)
+	})
+	if errors.Is(err, pgx.ErrNoRows) {
+		return SessionObj{}, ErrSessionNotFound
+	}
+	if err != nil {
+		return SessionObj{}, err
+	}
+
+	sess.Created = created.Unix()
+	sess.Expired = expired.Unix()
+
+	return sess, nil
+}
+
+func (s *PgSession) DeleteByUserId(ctx context.Context, userId string) (int, error) {
+	var n int64
+	err := crdbpgx.ExecuteTx(context.Background(), s.db, pgx.TxOptions{}, func(tx pgx.Tx) error {
+		tag, err := tx.Exec(ctx,
+			`DELETE FROM sessions WHERE user_id = $1`,
+			userId,
+		)
+		if err != nil {
+			return err
+		}
+
+		n = tag.RowsAffected()
+
+		_, err = tx.Exec(ctx,
+			`DELETE FROM refresh_tokens WHERE user_id = $1`,
+			userId,
+		)
+		return err
+	})
+	if err != nil {
+		return 0, err
+	}
+
+	return int(n), nil
+}
+
+func (s *PgSession) DeleteByFamilyId(ctx context.Context, familyId string) (int, error) {
+	var n int64
+	err := crdbpgx.ExecuteTx(context.Background(), s.db, pgx.TxOptions{}, func(tx pgx.Tx) error {
+		tag, err := tx.Exec(ctx,
+			`DELETE FROM sessions WHERE family_id = $1`,
+			familyId,
+		)
+		if err != nil {
+			return err
+		}
+
+		n = tag.RowsAffected()
+
+		_, err = tx.Exec(ctx,
+			`DELETE FROM refresh_tokens WHERE family_id = $1`,
+			familyId,
+		)
+		return err
+	})
+	if err != nil {
+		return 0, err
+	}
+
+	return int(n), nil
+}
+
+func (s *PgSession) GetByUserId(ctx context.Context, userId string) ([]SessionObj, error) {
+	var sessions []SessionObj
+	err := crdbpgx.ExecuteTx(context.Background(), s.db, pgx.TxOptions{}, func(tx pgx.Tx) error {
+		sessions = make([]SessionObj, 0)
+		rows, err := tx.Query(ctx,
+			`SELECT id, family_id, user_id, role, created_date, expired_date
+			FROM sessions WHERE user_id = $1 AND expired_date > now()
+			ORDER BY created_date DESC`,
+			userId,
+		)
+		if err != nil {
+			return err
+		}
+
+		for rows.Next() {
+			var created, expired time.Time
+			var sess SessionObj
+			if err := rows.Scan(&sess.Id, &sess.FamilyId, &sess.UserId, &sess.Role, &created, &expired); err != nil {
+				return err
+			}
+
+			sess.Created = created.Unix()
+			sess.Expired = expired.Unix()
+			sessions = append(sessions, sess)
+		}
+
+		return rows.Err()
+	})
+	if err != nil {
+		return []SessionObj{}, err
+	}
+
+	return sessions, nil
+}
+
+func (s *PgSession) SetRefresh(ctx context.Context, ref RefreshObj) error {
+	if ref.Id == "" {
+		ref.Id = KeyId(ref.Key)
+	}
+	if ref.Created == 0 {
+		ref.Created = time.Now().Unix()
+	}
+
+	return crdbpgx.ExecuteTx(context.Background(), s.db, pgx.TxOptions{}, func(tx pgx.Tx) error {
+		if _, err := tx.Exec(ctx,
+			`UPSERT INTO refresh_tokens (id, key_hash, family_id, user_id, role, is_used, created_date, expired_date)
+			VALUES ($1, $2, $3, $4, $5, $6, $7, $8)`,
+			ref.Id,
+			KeyHash(ref.Key),
+			ref.FamilyId,
+			ref.UserId,
+			ref.Role,
+			ref.IsUsed,
+			time.Unix(ref.Created, 0).UTC(),
+			time.Unix(ref.Expired, 0).UTC(),
+		); err != nil {
+			return err
+		}
+		return nil
+	})
+}
+
+func (s *PgSession) UseRefresh(ctx context.Context, key string) (RefreshObj, error) {
+	var created, expired time.Time
+	ref := RefreshObj{Key: key}
+	err := crdbpgx.ExecuteTx(context.Background(), s.db, pgx.TxOptions{}, func(tx pgx.Tx) error {
+		err := tx.QueryRow(ctx,
+			`SELECT id, family_id, user_id, role, is_used, created_date, expired_date
+			FROM refresh_tokens WHERE key_hash = $1 FOR UPDATE`,
+			KeyHash(key),
+		).Scan(&ref.Id, &ref.FamilyId, &ref.UserId, &ref.Role, &ref.IsUsed, &created, &expired)
+		if err != nil {
+			return err
+		}
+
+		_, err = tx.Exec(ctx,
+			`UPDATE refresh_tokens SET is_used = true WHERE key_hash = $1`,
+			KeyHash(key),
+		)
+		return err
+	})
+	if errors.Is(err, pgx.ErrNoRows) {
+		return RefreshObj{}, ErrRefreshNotFound
+	}
+	if err != nil {
+		return RefreshObj{}, err
+	}
+
+	ref.Created = created.Unix()
+	ref.Expired = expired.Unix()
+
+	return ref, nil
+}
+
+func (s *PgSession) Sweep(ctx context.Context) (int, error) {
+	var n int64
+	err := crdbpgx.ExecuteTx(context.Background(), s.db, pgx.TxOptions{}, func(tx pgx.Tx) error {
+		tag, err := tx.Exec(ctx,
+			`DELETE FROM sessions WHERE expired_date <= now()`,
+		)
+		if err != nil {
+			return err
+		}
+
+		n = tag.RowsAffected()
+
+		_, err = tx.Exec(ctx,
+			`DELETE FROM refresh_tokens WHERE expired_date <= now()`,
+		)
+		return err
+	})
+	if err != nil {
+		return 0, err
+	}
+
+	return int(n), nil
+}
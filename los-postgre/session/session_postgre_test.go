@@ -0,0 +1,246 @@
+package session_test
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/fikryfahrezy/adea/los-postgre/session"
+	"github.com/jackc/pgx/v4/pgxpool"
+	"github.com/ory/dockertest"
+)
+
+var (
+	dbPg    *pgxpool.Pool
+	pgStore *session.PgSession
+)
+
+func loadTables(conn *pgxpool.Pool) error {
+	tx, err := conn.Begin(context.Background())
+	if err != nil {
+		return err
+	}
+
+	defer tx.Rollback(context.Background())
+
+	f, err := os.ReadFile("../docs/db.sql")
+	if err != nil {
+		return err
+	}
+
+	_, err = tx.Exec(context.Background(),
+		string(f),
+	)
+	if err != nil {
+		return err
+	}
+
+	err = tx.Commit(context.Background())
+	if err != nil {
+		return err
+	}
+
+	return nil
+}
+
+func clearDb() error {
+	tx, err := dbPg.Begin(context.Background())
+	if err != nil {
+		return err
+	}
+
+	defer tx.Rollback(context.Background())
+
+	// This should be in order of which table truncate first before the other
+	queries := []string{
+		`TRUNCATE sessions CASCADE`,
+		`TRUNCATE refresh_tokens CASCADE`,
+		`TRUNCATE users CASCADE`,
+	}
+
+	for _, v := range queries {
+		_, err = tx.Exec(context.Background(),
+			v,
+		)
+		if err != nil {
+			return err
+		}
+	}
+
+	err = tx.Commit(context.Background())
+	if err != nil {
+		return err
+	}
+
+	return nil
+}
+
+func insertUser(id string) error {
+	_, err := dbPg.Exec(context.Background(),
+		`INSERT INTO users (id, username, password) VALUES ($1, $1, '')`,
+		id,
+	)
+	return err
+}
+
+func TestMain(m *testing.M) {
+	var err error
+	pool, err := dockertest.NewPool("")
+	if err != nil {
+		log.Fatalf("Could not connect to docker: %s", err)
+	}
+
+	resource, err := pool.RunWithOptions(&dockertest.RunOptions{Repository: "cockroachdb/cockroach", Tag: "v21.2.13", Cmd: []string{"start-single-node", "--insecure"}})
+	if err != nil {
+		log.Fatalf("Could not start resource: %s", err)
+	}
+
+	databaseUrl := fmt.Sprintf("postgresql://root@localhost:%s/defaultdb?sslmode=disable", resource.GetPort("26257/tcp"))
+
+	// exponential backoff-retry, because the application in the container might not be ready to accept connections yet
+	pool.MaxWait = 120 * time.Second
+	if err = pool.Retry(func() error {
+		dbConfig, err := pgxpool.ParseConfig(databaseUrl)
+		if err != nil {
+			return err
+		}
+
+		dbPg, err = pgxpool.ConnectConfig(context.Background(), dbConfig)
+		if err != nil {
+			return err
+		}
+
+		return dbPg.Ping(context.Background())
+	}); err != nil {
+		log.Fatalf("Could not connect to cockroach container: %s", err)
+	}
+
+	pgStore = session.NewPg(dbPg)
+
+	loadTables(dbPg)
+
+	code := m.Run()
+
+	// When you're done, kill and remove the container
+	if err = pool.Purge(resource); err != nil {
+		log.Fatalf("Could not purge resource: %s", err)
+	}
+
+	os.Exit(code)
+}
+
+func TestPgGet(t *testing.T) {
+	if err := clearDb(); err != nil {
+		t.Fatal(err)
+	}
+
+	ctx := context.Background()
+	insertUser("user1")
+
+	pgStore.Set(ctx, session.SessionObj{Key: "token1", UserId: "user1", Role: "admin", Expired: time.Now().Add(time.Hour).Unix()})
+	pgStore.Set(ctx, session.SessionObj{Key: "expired", UserId: "user1", Role: "admin", Expired: time.Now().Add(-time.Minute).Unix()})
+
+	sess, err := pgStore.Get(ctx, "token1")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if sess.UserId != "user1" || sess.Role != "admin" || sess.Key != "token1" {
+		t.Fatalf("resulting: %+v, expect session of user1", sess)
+	}
+
+	if _, err := pgStore.Get(ctx, "expired"); !errors.Is(err, session.ErrSessionNotFound) {
+		t.Fatalf("resulting: %v, expect: %v", err, session.ErrSessionNotFound)
+	}
+}
+
+func TestPgDelete(t *testing.T) {
+	if err := clearDb(); err != nil {
+		t.Fatal(err)
+	}
+
+	ctx := context.Background()
+	insertUser("user1")
+	insertUser("user2")
+	exp := time.Now().Add(time.Hour).Unix()
+
+	pgStore.Set(ctx, session.SessionObj{Key: "token1", UserId: "user1", Expired: exp})
+	pgStore.Set(ctx, session.SessionObj{Key: "token2", UserId: "user1", Expired: exp})
+	pgStore.Set(ctx, session.SessionObj{Key: "token3", UserId: "user2", Expired: exp})
+
+	pgStore.Delete(ctx, "token1")
+	if _, err := pgStore.Get(ctx, "token1"); !errors.Is(err, session.ErrSessionNotFound) {
+		t.Fatalf("resulting: %v, expect: %v", err, session.ErrSessionNotFound)
+	}
+
+	if n, _ := pgStore.DeleteByUserId(ctx, "user1"); n != 1 {
+		t.Fatalf("resulting: %d, expect: %d", n, 1)
+	}
+
+	if _, err := pgStore.DeleteById(ctx, session.KeyId("token3")); err != nil {
+		t.Fatalf("resulting: %v, expect: %v", err, nil)
+	}
+
+	if _, err := pgStore.DeleteById(ctx, session.KeyId("token3")); !errors.Is(err, session.ErrSessionNotFound) {
+		t.Fatalf("resulting: %v, expect: %v", err, session.ErrSessionNotFound)
+	}
+}
+
+func TestPgSweep(t *testing.T) {
+	if err := clearDb(); err != nil {
+		t.Fatal(err)
+	}
+
+	ctx := context.Background()
+	insertUser("user1")
+
+	pgStore.Set(ctx, session.SessionObj{Key: "expired", UserId: "user1", Expired: time.Now().Add(-time.Minute).Unix()})
+	pgStore.Set(ctx, session.SessionObj{Key: "active", UserId: "user1", Expired: time.Now().Add(time.Hour).Unix()})
+
+	if n, _ := pgStore.Sweep(ctx); n != 1 {
+		t.Fatalf("resulting: %d, expect: %d", n, 1)
+	}
+
+	if res, _ := pgStore.GetByUserId(ctx, "user1"); len(res) != 1 {
+		t.Fatalf("resulting: %d, expect: %d", len(res), 1)
+	}
+}
+
+func TestPgUseRefresh(t *testing.T) {
+	if err := clearDb(); err != nil {
+		t.Fatal(err)
+	}
+
+	ctx := context.Background()
+	insertUser("user1")
+	exp := time.Now().Add(time.Hour).Unix()
+
+	pgStore.Set(ctx, session.SessionObj{Key: "token1", FamilyId: "family1", UserId: "user1", Expired: exp})
+	pgStore.SetRefresh(ctx, session.RefreshObj{Key: "refresh1", FamilyId: "family1", UserId: "user1", Expired: exp})
+
+	ref, err := pgStore.UseRefresh(ctx, "refresh1")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if ref.IsUsed {
+		t.Fatalf("resulting: %v, expect: %v", ref.IsUsed, false)
+	}
+
+	ref, _ = pgStore.UseRefresh(ctx, "refresh1")
+	if !ref.IsUsed {
+		t.Fatalf("resulting: %v, expect: %v", ref.IsUsed, true)
+	}
+
+	if n, _ := pgStore.DeleteByFamilyId(ctx, "family1"); n != 1 {
+		t.Fatalf("resulting: %d, expect: %d", n, 1)
+	}
+
+	if _, err := pgStore.UseRefresh(ctx, "refresh1"); !errors.Is(err, session.ErrRefreshNotFound) {
+		t.Fatalf("resulting: %v, expect: %v", err, session.ErrRefreshNotFound)
+	}
+}
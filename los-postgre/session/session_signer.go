@@ -0,0 +1,301 @@
+package session
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"os"
+	"strings"
+	"time"
+)
+
+var (
+	ErrTokenMalformed        = errors.New("token malformed")
+	ErrTokenSignature        = errors.New("token signature not valid")
+	ErrTokenUnknownKey       = errors.New("token signed with unknown key")
+	ErrSignerNoKey           = errors.New("signer require at least one key and the current key id")
+	ErrStatelessNotSupported = errors.New("not supported by stateless session")
+)
+
+const (
+	tokenTypeAccess  = "access"
+	tokenTypeRefresh = "refresh"
+)
+
+type (
+	signedHeader struct {
+		Alg string `json:"alg"`
+		Typ string `json:"typ"`
+		Kid string `json:"kid"`
+	}
+	signedClaims struct {
+		Sub  string `json:"sub"`
+		Role string `json:"role"`
+		Typ  string `json:"token_type"`
+		Jti  string `json:"jti"`
+		Fam  string `json:"fam"`
+		Iat  int64  `json:"iat"`
+		Exp  int64  `json:"exp"`
+		// Auth is when the user logged in, every token refreshed from the login keep it
+		Auth int64 `json:"auth_time"`
+	}
+)
+
+// UserLookup return the current role of the user, the error end the refresh,
+// ErrRefreshNotFound for the user that is gone or deactivated
+type UserLookup func(ctx context.Context, userId string) (string, error)
+
+// Signer is the stateless alternative of Manager, the token it issue is an HMAC-SHA256
+// signed JWT that carry the user id, role and expiry so it can be verified
+// without any lookup, which also mean an issued token can not be revoked before it expire.
+// Every key has an id written in the token header, so a new key can be added
+// to sign new token while the old one is kept to verify the token already issued
+type Signer struct {
+	cfg  Config
+	kid  string
+	keys map[string][]byte
+	// lookup is nil when the refresh trust the role of the token
+	lookup UserLookup
+}
+
+func NewSigner(cfg Config, kid string, keys map[string][]byte) (*Signer, error) {
+	if _, ok := keys[kid]; !ok || len(keys[kid]) == 0 {
+		return nil, ErrSignerNoKey
+	}
+
+	return &Signer{
+		cfg:  cfg,
+		kid:  kid,
+		keys: keys,
+	}, nil
+}
+
+// SignerFromEnv read the keys from TOKEN_SIGNING_KEYS in "kid:secret,kid:secret" format
+// and the key used to sign new token from TOKEN_SIGNING_KEY_ID
+func SignerFromEnv(cfg Config) (*Signer, error) {
+	keys := make(map[string][]byte)
+	for _, pair := range strings.Split(os.Getenv("TOKEN_SIGNING_KEYS"), ",") {
+		kid, secret, ok := strings.Cut(strings.TrimSpace(pair), ":")
+		if !ok || kid == "" || secret == "" {
+			continue
+		}
+		keys[kid] = []byte(secret)
+	}
+
+	return NewSigner(cfg, os.Getenv("TOKEN_SIGNING_KEY_ID"), keys)
+}
+
+// SetUserLookup make every refresh read the user again, so the deactivated user
+// is not refreshed and the changed role is carried by the new token
+func (s *Signer) SetUserLookup(lookup UserLookup) {
+	s.lookup = lookup
+}
+
+func (s *Signer) Issue(ctx context.Context, userId, role string) (Token, error) {
+	familyId, err := NewToken()
+	if err != nil {
+		return Token{}, err
+	}
+
+	return s.issue(userId, role, familyId, time.Now().Unix())
+}
+
+// Refresh exchange a signed refresh token for a new pair of token, since there is no state
+// the refresh token can not be detected when reused, it is only valid until it expire
+// and no token of the login outlive LoginTTL
+func (s *Signer) Refresh(ctx context.Context, refreshToken string) (Token, error) {
+	claims, err := s.verify(refreshToken)
+	if errors.Is(err, ErrSessionExpired) {
+		return Token{}, err
+	}
+	if err != nil || claims.Typ != tokenTypeRefresh {
+		return Token{}, ErrRefreshNotFound
+	}
+
+	if time.Now().After(time.Unix(claims.Auth, 0).Add(s.cfg.LoginTTL)) {
+		return Token{}, ErrSessionExpired
+	}
+
+	role := claims.Role
+	if s.lookup != nil {
+		if role, err = s.lookup(ctx, claims.Sub); err != nil {
+			return Token{}, err
+		}
+	}
+
+	return s.issue(claims.Sub, role, claims.Fam, claims.Auth)
+}
+
+func (s *Signer) Authenticate(ctx context.Context, accessToken string) (SessionObj, error) {
+	claims, err := s.verify(accessToken)
+	if errors.Is(err, ErrSessionExpired) {
+		return SessionObj{}, err
+	}
+	if err != nil || claims.Typ != tokenTypeAccess {
+		return SessionObj{}, ErrSessionNotFound
+	}
+
+	return SessionObj{
+		Id:       claims.Jti,
+		Key:      accessToken,
+		FamilyId: claims.Fam,
+		UserId:   claims.Sub,
+		Role:     claims.Role,
+		Created:  claims.Iat,
+		Expired:  claims.Exp,
+	}, nil
+}
+
+func (s *Signer) Revoke(ctx context.Context, sess SessionObj) (int, error) {
+	return 0, ErrStatelessNotSupported
+}
+
+func (s *Signer) RevokeById(ctx context.Context, id string) (int, error) {
+	return 0, ErrStatelessNotSupported
+}
+
+func (s *Signer) RevokeByUserId(ctx context.Context, userId string) (int, error) {
+	return 0, ErrStatelessNotSupported
+}
+
+func (s *Signer) GetByUserId(ctx context.Context, userId string) ([]SessionObj, error) {
+	return nil, ErrStatelessNotSupported
+}
+
+func (s *Signer) CanRevoke() bool {
+	return false
+}
+
+func (s *Signer) issue(userId, role, familyId string, authTime int64) (Token, error) {
+	now := time.Now()
+	end := time.Unix(authTime, 0).Add(s.cfg.LoginTTL)
+	accessExp := now.Add(s.cfg.AccessTTL)
+	if accessExp.After(end) {
+		accessExp = end
+	}
+	refreshExp := now.Add(s.cfg.RefreshTTL)
+	if refreshExp.After(end) {
+		refreshExp = end
+	}
+
+	accessToken, err := s.sign(signedClaims{
+		Sub:  userId,
+		Role: role,
+		Typ:  tokenTypeAccess,
+		Fam:  familyId,
+		Iat:  now.Unix(),
+		Exp:  accessExp.Unix(),
+		Auth: authTime,
+	})
+	if err != nil {
+		return Token{}, err
+	}
+
+	refreshToken, err := s.sign(signedClaims{
+		Sub:  userId,
+		Role: role,
+		Typ:  tokenTypeRefresh,
+		Fam:  familyId,
+		Iat:  now.Unix(),
+		Exp:  refreshExp.Unix(),
+		Auth: authTime,
+	})
+	if err != nil {
+		return Token{}, err
+	}
+
+	return Token{
+		AccessToken:  accessToken,
+		RefreshToken: refreshToken,
+		ExpiresIn:    int64(accessExp.Sub(now).Seconds()),
+	}, nil
+}
+
+func (s *Signer) sign(claims signedClaims) (string, error) {
+	jti, err := randomBytes(8)
+	if err != nil {
+		return "", err
+	}
+	claims.Jti = base64.RawURLEncoding.EncodeToString(jti)
+
+	header, err := json.Marshal(signedHeader{Alg: "HS256", Typ: "JWT", Kid: s.kid})
+	if err != nil {
+		return "", err
+	}
+
+	payload, err := json.Marshal(claims)
+	if err != nil {
+		return "", err
+	}
+
+	unsigned := base64.RawURLEncoding.EncodeToString(header) + "." + base64.RawURLEncoding.EncodeToString(payload)
+	signature := hmacSHA256(s.keys[s.kid], unsigned)
+
+	return unsigned + "." + base64.RawURLEncoding.EncodeToString(signature), nil
+}
+
+func (s *Signer) verify(token string) (signedClaims, error) {
+	parts := strings.Split(token, ".")
+	if len(parts) != 3 {
+		return signedClaims{}, ErrTokenMalformed
+	}
+
+	headerJson, err := base64.RawURLEncoding.DecodeString(parts[0])
+	if err != nil {
+		return signedClaims{}, ErrTokenMalformed
+	}
+
+	var header signedHeader
+	if err := json.Unmarshal(headerJson, &header); err != nil {
+		return signedClaims{}, ErrTokenMalformed
+	}
+
+	// Only accept the algorithm this signer produce, so a token can not pick
+	// a weaker one, "none" for example, through its own header
+	if header.Alg != "HS256" {
+		return signedClaims{}, ErrTokenSignature
+	}
+
+	key, ok := s.keys[header.Kid]
+	if !ok {
+		return signedClaims{}, ErrTokenUnknownKey
+	}
+
+	signature, err := base64.RawURLEncoding.DecodeString(parts[2])
+	if err != nil {
+		return signedClaims{}, ErrTokenMalformed
+	}
+
+	if !hmac.Equal(signature, hmacSHA256(key, parts[0]+"."+parts[1])) {
+		return signedClaims{}, ErrTokenSignature
+	}
+
+	payload, err := base64.RawURLEncoding.DecodeString(parts[1])
+	if err != nil {
+		return signedClaims{}, ErrTokenMalformed
+	}
+
+	var claims signedClaims
+	if err := json.Unmarshal(payload, &claims); err != nil {
+		return signedClaims{}, ErrTokenMalformed
+	}
+
+	if claims.Sub == "" {
+		return signedClaims{}, ErrTokenMalformed
+	}
+
+	if claims.Exp <= time.Now().Unix() {
+		return signedClaims{}, ErrSessionExpired
+	}
+
+	return claims, nil
+}
+
+func hmacSHA256(key []byte, data string) []byte {
+	mac := hmac.New(sha256.New, key)
+	mac.Write([]byte(data))
+	return mac.Sum(nil)
+}
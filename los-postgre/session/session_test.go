@@ -0,0 +1,88 @@
+package session_test
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/fikryfahrezy/adea/los-postgre/session"
+)
+
+func TestNewToken(t *testing.T) {
+	token1, err := session.NewToken()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	token2, err := session.NewToken()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if token1 == token2 {
+		t.Fatalf("resulting: %s, expect different token", token2)
+	}
+}
+
+func TestDelete(t *testing.T) {
+	ctx := context.Background()
+	sess := session.New()
+	exp := time.Now().Add(time.Hour).Unix()
+
+	sess.Set(ctx, session.SessionObj{Key: "token1", UserId: "user1", Expired: exp})
+	sess.Set(ctx, session.SessionObj{Key: "token2", UserId: "user1", Expired: exp})
+	sess.Set(ctx, session.SessionObj{Key: "token3", UserId: "user2", Expired: exp})
+
+	sess.Delete(ctx, "token1")
+	if _, err := sess.Get(ctx, "token1"); !errors.Is(err, session.ErrSessionNotFound) {
+		t.Fatalf("resulting: %v, expect: %v", err, session.ErrSessionNotFound)
+	}
+
+	if n, _ := sess.DeleteByUserId(ctx, "user1"); n != 1 {
+		t.Fatalf("resulting: %d, expect: %d", n, 1)
+	}
+
+	if _, err := sess.DeleteById(ctx, session.KeyId("token3")); err != nil {
+		t.Fatalf("resulting: %v, expect: %v", err, nil)
+	}
+
+	if _, err := sess.DeleteById(ctx, session.KeyId("token3")); !errors.Is(err, session.ErrSessionNotFound) {
+		t.Fatalf("resulting: %v, expect: %v", err, session.ErrSessionNotFound)
+	}
+}
+
+func TestGetByUserId(t *testing.T) {
+	ctx := context.Background()
+	sess := session.New()
+	exp := time.Now().Add(time.Hour).Unix()
+
+	sess.Set(ctx, session.SessionObj{Key: "token1", UserId: "user1", Expired: exp})
+	sess.Set(ctx, session.SessionObj{Key: "token2", UserId: "user1", Expired: exp})
+	sess.Set(ctx, session.SessionObj{Key: "token3", UserId: "user2", Expired: exp})
+	sess.Set(ctx, session.SessionObj{Key: "token4", UserId: "user1", Expired: time.Now().Add(-time.Minute).Unix()})
+
+	if res, _ := sess.GetByUserId(ctx, "user1"); len(res) != 2 {
+		t.Fatalf("resulting: %d, expect: %d", len(res), 2)
+	}
+}
+
+func TestSweep(t *testing.T) {
+	ctx := context.Background()
+	sess := session.New()
+
+	sess.Set(ctx, session.SessionObj{Key: "expired", UserId: "user1", Expired: time.Now().Add(-time.Minute).Unix()})
+	sess.Set(ctx, session.SessionObj{Key: "active", UserId: "user1", Expired: time.Now().Add(time.Hour).Unix()})
+
+	if n, _ := sess.Sweep(ctx); n != 1 {
+		t.Fatalf("resulting: %d, expect: %d", n, 1)
+	}
+
+	if _, err := sess.Get(ctx, "expired"); !errors.Is(err, session.ErrSessionNotFound) {
+		t.Fatalf("resulting: %v, expect: %v", err, session.ErrSessionNotFound)
+	}
+
+	if _, err := sess.Get(ctx, "active"); err != nil {
+		t.Fatalf("resulting: %v, expect: %v", err, nil)
+	}
+}
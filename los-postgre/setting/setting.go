@@ -1,12 +1,17 @@
 package setting
 
 import (
+	"errors"
 	"net/http"
 
 	"github.com/fikryfahrezy/adea/los-postgre/file"
+	"github.com/fikryfahrezy/adea/los-postgre/rbac"
 	"github.com/fikryfahrezy/adea/los-postgre/resp"
+	"github.com/fikryfahrezy/adea/los-postgre/session"
 )
 
+var ErrSettingForbidden = errors.New("user role not allowed")
+
 type SettingApp struct {
 	file file.File
 }
@@ -17,7 +22,24 @@ func NewSetting(file file.File) *SettingApp {
 	}
 }
 
+// allowed check the permission of the session in the request context,
+// the route middleware already did it but the setting replace the whole data
+// so it is checked once more here
+func allowed(w http.ResponseWriter, r *http.Request, p rbac.Permission) bool {
+	sess, _ := session.FromContext(r.Context())
+	if !rbac.Can(sess.Role, p) {
+		resp.NewResponse(http.StatusForbidden, "", ErrSettingForbidden).HttpJSON(w, nil)
+		return false
+	}
+
+	return true
+}
+
 func (a *SettingApp) ZipTmp(w http.ResponseWriter, r *http.Request) {
+	if !allowed(w, r, rbac.SettingTmp) {
+		return
+	}
+
 	contentDisposition := "attachment; filename=tmp.zip"
 	w.Header().Set("Content-Disposition", contentDisposition)
 	w.WriteHeader(http.StatusOK)
@@ -28,6 +50,10 @@ func (a *SettingApp) ZipTmp(w http.ResponseWriter, r *http.Request) {
 }
 
 func (a *SettingApp) LoadZipTmp(w http.ResponseWriter, r *http.Request) {
+	if !allowed(w, r, rbac.SettingTmp) {
+		return
+	}
+
 	if err := r.ParseMultipartForm(1024); err != nil {
 		resp.NewResponse(http.StatusInternalServerError, "", err).HttpJSON(w, nil)
 		return
@@ -0,0 +1,184 @@
+package throttle
+
+import (
+	"context"
+	"os"
+	"strconv"
+	"sync"
+	"time"
+)
+
+type Config struct {
+	// FreeAttempts is how many failure allowed before the key start to wait
+	FreeAttempts int
+	// BaseDelay is the first wait, it is doubled on every following failure
+	BaseDelay time.Duration
+	// MaxDelay cap the wait, reaching it mean the key is locked out for that long
+	MaxDelay time.Duration
+	// Window is how long a failure is remembered when there is no other failure
+	Window time.Duration
+}
+
+func DefaultConfig() Config {
+	return Config{
+		FreeAttempts: 3,
+		BaseDelay:    time.Second,
+		MaxDelay:     15 * time.Minute,
+		Window:       time.Hour,
+	}
+}
+
+// ConfigFromEnv read LOGIN_FREE_ATTEMPTS and LOGIN_MAX_LOCKOUT in time.ParseDuration format,
+// the default config value is used for the empty or invalid one
+func ConfigFromEnv() Config {
+	cfg := DefaultConfig()
+	if n, err := strconv.Atoi(os.Getenv("LOGIN_FREE_ATTEMPTS")); err == nil && n >= 0 {
+		cfg.FreeAttempts = n
+	}
+	if d, err := time.ParseDuration(os.Getenv("LOGIN_MAX_LOCKOUT")); err == nil && d > 0 {
+		cfg.MaxDelay = d
+	}
+
+	return cfg
+}
+
+type entry struct {
+	failures    int
+	lastFailure time.Time
+	blockUntil  time.Time
+}
+
+// Throttle count the failure of a key, like a username or an IP address, and make
+// the key wait exponentially longer after the free attempts are used up
+type Throttle struct {
+	sync.Mutex
+	cfg     Config
+	entries map[string]entry
+}
+
+func New(cfg Config) *Throttle {
+	return &Throttle{
+		cfg:     cfg,
+		entries: make(map[string]entry),
+	}
+}
+
+// Wait return how long the key must wait before it can try again, zero mean it can try now
+func (t *Throttle) Wait(key string) time.Duration {
+	t.Lock()
+	defer t.Unlock()
+
+	e, ok := t.entries[key]
+	if !ok {
+		return 0
+	}
+
+	now := time.Now()
+	if wait := e.blockUntil.Sub(now); wait > 0 {
+		return wait
+	}
+
+	if now.Sub(e.lastFailure) > t.cfg.Window {
+		delete(t.entries, key)
+	}
+
+	return 0
+}
+
+// Fail record a failure of the key and return how long it must wait now
+func (t *Throttle) Fail(key string) time.Duration {
+	t.Lock()
+	defer t.Unlock()
+
+	now := time.Now()
+	e := t.entries[key]
+	if now.Sub(e.lastFailure) > t.cfg.Window && !e.blockUntil.After(now) {
+		e = entry{}
+	}
+
+	e.failures++
+	e.lastFailure = now
+
+	var wait time.Duration
+	if over := e.failures - t.cfg.FreeAttempts; over > 0 {
+		wait = t.cfg.MaxDelay
+		// Stop doubling once it pass the max so the shift does not overflow
+		if over <= 32 {
+			if d := t.cfg.BaseDelay << (over - 1); d > 0 && d < t.cfg.MaxDelay {
+				wait = d
+			}
+		}
+		e.blockUntil = now.Add(wait)
+	}
+
+	t.entries[key] = e
+
+	return wait
+}
+
+func (t *Throttle) Reset(key string) {
+	t.Lock()
+	defer t.Unlock()
+
+	delete(t.entries, key)
+}
+
+// Move carry the failure of a key over to another key, like when the username is renamed,
+// so the rename does not clear the lockout. The stricter of the two entry is kept
+func (t *Throttle) Move(from, to string) {
+	t.Lock()
+	defer t.Unlock()
+
+	e, ok := t.entries[from]
+	if !ok {
+		return
+	}
+	delete(t.entries, from)
+
+	if cur, ok := t.entries[to]; ok {
+		if cur.failures > e.failures {
+			e.failures = cur.failures
+		}
+		if cur.lastFailure.After(e.lastFailure) {
+			e.lastFailure = cur.lastFailure
+		}
+		if cur.blockUntil.After(e.blockUntil) {
+			e.blockUntil = cur.blockUntil
+		}
+	}
+
+	t.entries[to] = e
+}
+
+// Sweep remove the key that is not waiting and has no failure within the window
+func (t *Throttle) Sweep() int {
+	t.Lock()
+	defer t.Unlock()
+
+	now := time.Now()
+	n := 0
+	for k, e := range t.entries {
+		if !e.blockUntil.After(now) && now.Sub(e.lastFailure) > t.cfg.Window {
+			delete(t.entries, k)
+			n++
+		}
+	}
+
+	return n
+}
+
+// RunSweeper call Sweep every interval until the context is done,
+// it is blocking so it should be run in its own goroutine
+func RunSweeper(ctx context.Context, t *Throttle, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			t.Sweep()
+		}
+	}
+}
@@ -0,0 +1,97 @@
+package throttle_test
+
+import (
+	"testing"
+	"time"
+
+	"github.com/fikryfahrezy/adea/los-postgre/throttle"
+)
+
+func TestFailBackoff(t *testing.T) {
+	th := throttle.New(throttle.Config{
+		FreeAttempts: 2,
+		BaseDelay:    time.Second,
+		MaxDelay:     5 * time.Second,
+		Window:       time.Hour,
+	})
+
+	expects := []time.Duration{0, 0, time.Second, 2 * time.Second, 4 * time.Second, 5 * time.Second, 5 * time.Second}
+	for i, expect := range expects {
+		if wait := th.Fail("user:username"); wait != expect {
+			t.Fatalf("failure %d resulting: %v, expect: %v", i+1, wait, expect)
+		}
+	}
+
+	if wait := th.Wait("user:username"); wait <= 0 {
+		t.Fatalf("resulting: %v, expect greater than 0", wait)
+	}
+
+	if wait := th.Wait("user:other"); wait != 0 {
+		t.Fatalf("resulting: %v, expect: %v", wait, 0)
+	}
+
+	th.Reset("user:username")
+	if wait := th.Wait("user:username"); wait != 0 {
+		t.Fatalf("resulting: %v, expect: %v", wait, 0)
+	}
+}
+
+func TestWaitExpire(t *testing.T) {
+	th := throttle.New(throttle.Config{
+		FreeAttempts: 0,
+		BaseDelay:    10 * time.Millisecond,
+		MaxDelay:     time.Second,
+		Window:       time.Millisecond,
+	})
+
+	th.Fail("ip:127.0.0.1")
+	if wait := th.Wait("ip:127.0.0.1"); wait <= 0 {
+		t.Fatalf("resulting: %v, expect greater than 0", wait)
+	}
+
+	time.Sleep(20 * time.Millisecond)
+
+	if wait := th.Wait("ip:127.0.0.1"); wait != 0 {
+		t.Fatalf("resulting: %v, expect: %v", wait, 0)
+	}
+
+	if n := th.Sweep(); n != 0 {
+		t.Fatalf("resulting: %d, expect: %d", n, 0)
+	}
+
+	th.Fail("ip:127.0.0.2")
+	time.Sleep(20 * time.Millisecond)
+	if n := th.Sweep(); n != 1 {
+		t.Fatalf("resulting: %d, expect: %d", n, 1)
+	}
+}
+
+func TestMove(t *testing.T) {
+	th := throttle.New(throttle.Config{
+		FreeAttempts: 1,
+		BaseDelay:    time.Minute,
+		MaxDelay:     time.Hour,
+		Window:       time.Hour,
+	})
+
+	th.Fail("user:old")
+	th.Fail("user:old")
+	th.Move("user:old", "user:new")
+
+	if wait := th.Wait("user:old"); wait != 0 {
+		t.Fatalf("resulting: %v, expect: %v", wait, 0)
+	}
+	if wait := th.Wait("user:new"); wait <= 0 {
+		t.Fatalf("resulting: %v, expect greater than 0", wait)
+	}
+
+	// The next failure continue the backoff instead of starting over
+	if wait := th.Fail("user:new"); wait != 2*time.Minute {
+		t.Fatalf("resulting: %v, expect: %v", wait, 2*time.Minute)
+	}
+
+	th.Move("user:none", "user:new")
+	if wait := th.Wait("user:new"); wait <= 0 {
+		t.Fatalf("resulting: %v, expect greater than 0", wait)
+	}
+}
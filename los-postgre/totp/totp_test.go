@@ -0,0 +1,90 @@
+package totp_test
+
+import (
+	"encoding/base32"
+	"net/url"
+	"testing"
+	"time"
+
+	"github.com/fikryfahrezy/adea/los-postgre/totp"
+)
+
+// rfcSecret is the SHA1 seed of the RFC 6238 test vector
+var rfcSecret = base32.StdEncoding.WithPadding(base32.NoPadding).EncodeToString([]byte("12345678901234567890"))
+
+func TestCode(t *testing.T) {
+	// The RFC 6238 test vectors use 8 digits, the last 6 of them are expected here
+	testCases := []struct {
+		expect string
+		name   string
+		unix   int64
+	}{
+		{expect: "287082", name: "Code at 59", unix: 59},
+		{expect: "081804", name: "Code at 1111111109", unix: 1111111109},
+		{expect: "050471", name: "Code at 1111111111", unix: 1111111111},
+		{expect: "005924", name: "Code at 1234567890", unix: 1234567890},
+		{expect: "279037", name: "Code at 2000000000", unix: 2000000000},
+		{expect: "353130", name: "Code at 20000000000", unix: 20000000000},
+	}
+
+	for _, c := range testCases {
+		t.Run(c.name, func(t *testing.T) {
+			code, err := totp.Code(rfcSecret, time.Unix(c.unix, 0))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if code != c.expect {
+				t.Fatalf("resulting: %s, expect: %s", code, c.expect)
+			}
+		})
+	}
+}
+
+func TestValidate(t *testing.T) {
+	now := time.Unix(1111111111, 0)
+	code, _ := totp.Code(rfcSecret, now)
+
+	testCases := []struct {
+		expect bool
+		name   string
+		code   string
+		at     time.Time
+	}{
+		{expect: true, name: "Validate current step", code: code, at: now},
+		{expect: true, name: "Validate previous step", code: code, at: now.Add(totp.Period)},
+		{expect: false, name: "Validate fail, outside skew", code: code, at: now.Add(2 * totp.Period)},
+		{expect: false, name: "Validate fail, wrong code", code: "000000", at: now},
+		{expect: false, name: "Validate fail, wrong length", code: "1234", at: now},
+	}
+
+	for _, c := range testCases {
+		t.Run(c.name, func(t *testing.T) {
+			counter, ok := totp.Validate(rfcSecret, c.code, c.at, 1)
+			if ok != c.expect {
+				t.Fatalf("resulting: %t, expect: %t", ok, c.expect)
+			}
+			if ok && counter != totp.Counter(now) {
+				t.Fatalf("resulting: %d, expect: %d", counter, totp.Counter(now))
+			}
+		})
+	}
+}
+
+func TestGenerateSecret(t *testing.T) {
+	secret, err := totp.GenerateSecret()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := totp.Code(secret, time.Now()); err != nil {
+		t.Fatal(err)
+	}
+
+	u, err := url.Parse(totp.URI("LOS", "officer", secret))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if u.Scheme != "otpauth" || u.Host != "totp" || u.Query().Get("secret") != secret {
+		t.Fatalf("resulting: %s, expect: otpauth totp uri with the secret", u)
+	}
+}